@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/agent"
+	"github.com/frostyard/intuneme/internal/broker"
+	"github.com/frostyard/intuneme/internal/locale"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/udev"
+	"github.com/spf13/cobra"
+)
+
+// resumeSettle is how long the agent waits after a resume before healing, so
+// USB devices and the display server have re-enumerated.
+const resumeSettle = 5 * time.Second
+
+// idleCheckInterval is how often the agent applies the [pause] idle policy.
+const idleCheckInterval = time.Minute
+
+// restartDeviceBroker is run as the container user, whose sudo inside the
+// container is passwordless.
+const restartDeviceBroker = "sudo systemctl restart microsoft-identity-device-broker.service"
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Heal the container after suspend/resume and network changes (foreground)",
+	Long: `Watch for the host resuming from sleep, for NetworkManager regaining
+connectivity and for timezone changes, and repair the running container
+without a restart.
+
+After a resume it re-forwards plugged-in YubiKeys and cameras, reconnects the
+container to the current display and audio (as 'intuneme session refresh'
+does) and restarts the device broker. After a network change it restarts the
+device broker. After a timezone change, e.g. while traveling, it copies the
+host's timezone and locale into the container.
+
+With idle_minutes set in the [pause] table of config.toml, the agent also
+pauses the container after that many minutes without broker calls and without
+an Edge or Company Portal window.
+
+The agent has no terminal, so sudo never prompts: steps that would need a
+password are skipped with a warning. Run it as a systemd user service with
+'intuneme agent install'; view its output with
+'journalctl --user -u intuneme-agent'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		if _, err := loadConfig(root); err != nil {
+			return err
+		}
+		return runAgent(cmd.Context(), runner.NonInteractive{Runner: newRunner()}, root)
+	},
+}
+
+var agentInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Run the agent as a systemd user service for this profile",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+		execPath, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("resolve executable path: %w", err)
+		}
+		if err := agent.Install(cmd.Context(), newRunner(), execPath, currentProfile(), cfg.MachineName); err != nil {
+			return err
+		}
+		rep.Message("Installed and started %s.", agent.UnitName(cfg.MachineName))
+		return nil
+	},
+}
+
+var agentRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Stop and remove the agent user service for this profile",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+		if !agent.Installed(cfg.MachineName) {
+			rep.Message("%s is not installed.", agent.UnitName(cfg.MachineName))
+			return nil
+		}
+		if err := agent.Remove(cmd.Context(), newRunner(), cfg.MachineName); err != nil {
+			return err
+		}
+		rep.Message("Removed %s.", agent.UnitName(cfg.MachineName))
+		return nil
+	},
+}
+
+// runAgent heals the container after each host event until ctx is done.
+func runAgent(ctx context.Context, r runner.Runner, root string) error {
+	events := make(chan agent.Event)
+	errc := make(chan error, 1)
+	go func() { errc <- agent.Watch(ctx, events) }()
+
+	idle := &idleTracker{lastActive: time.Now()}
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	rep.Message("Watching for resume, network and timezone changes...")
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case now := <-ticker.C:
+			if err := idle.check(ctx, r, root, now); err != nil {
+				rep.Warning("idle check: %v", err)
+			}
+		case ev := <-events:
+			rep.Message("Host %s.", ev)
+			if ev == agent.Resumed {
+				select {
+				case <-time.After(resumeSettle):
+				case <-ctx.Done():
+					return nil
+				}
+			}
+			if err := heal(ctx, r, root, ev); err != nil {
+				rep.Warning("heal after %s: %v", ev, err)
+			}
+		}
+	}
+}
+
+// heal re-runs the self-healing steps of start that ev may have undone. The
+// config is reloaded each time, since it may have changed since the agent
+// started.
+func heal(ctx context.Context, r runner.Runner, root string, ev agent.Event) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	// A paused container heals when it is resumed; reaching into it now
+	// would block on its frozen processes.
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) || nspawn.IsPaused(ctx, r, cfg.MachineName) {
+		return nil
+	}
+
+	if ev == agent.TimezoneChanged {
+		if err := locale.Sync(ctx, r, cfg.MachineName, cfg.HostUID, locale.Detect()); err != nil {
+			return err
+		}
+		rep.Message("Synced the container's timezone.")
+		return nil
+	}
+
+	if ev == agent.Resumed {
+		// Devices that do not re-enumerate on resume get no udev event, so
+		// they are forwarded again here, through the passwordless helper.
+		forwardDevices(ctx, r, cfg.MachineName, udev.ForwardDeviceHelper)
+		session, err := nspawn.RefreshSession(ctx, r, cfg.MachineName, cfg.HostUID)
+		if err != nil {
+			rep.Warning("refresh session: %v", err)
+		} else if err := nspawn.SaveSession(root, *session); err != nil {
+			rep.Warning("record session: %v", err)
+		}
+	}
+
+	if out, err := nspawn.ExecOutput(ctx, r, cfg.MachineName, cfg.HostUID, restartDeviceBroker); err != nil {
+		return fmt.Errorf("restart device broker: %w\n%s", err, out)
+	}
+	rep.Message("Restarted the device broker.")
+	return nil
+}
+
+// idleTracker applies the [pause] idle policy: it pauses the container once
+// it has gone idle_minutes without broker calls or app windows.
+type idleTracker struct {
+	lastActive time.Time
+}
+
+// check records any activity since the last check and pauses the container if
+// the idle period has passed. The config is reloaded so a changed policy
+// applies without restarting the agent.
+func (t *idleTracker) check(ctx context.Context, r runner.Runner, root string, now time.Time) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	if cfg.Pause.IdleMinutes <= 0 {
+		return nil
+	}
+	// A stopped or paused container restarts the idle period once it is
+	// running again.
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) || nspawn.IsPaused(ctx, r, cfg.MachineName) {
+		t.lastActive = now
+		return nil
+	}
+	if last, ok := broker.LastActivity(root); ok && last.After(t.lastActive) {
+		t.lastActive = last
+	}
+	open, err := nspawn.AppsOpen(ctx, r, cfg.MachineName, cfg.HostUID)
+	if err != nil {
+		return err
+	}
+	if open {
+		t.lastActive = now
+		return nil
+	}
+	idle := time.Duration(cfg.Pause.IdleMinutes) * time.Minute
+	if now.Sub(t.lastActive) < idle {
+		return nil
+	}
+	rep.Message("No broker calls or app windows for %s; pausing the container.", idle)
+	if err := nspawn.Pause(ctx, r, cfg.MachineName); err != nil {
+		return err
+	}
+	t.lastActive = now
+	return nil
+}
+
+func init() {
+	agentCmd.AddCommand(agentInstallCmd, agentRemoveCmd)
+	rootCmd.AddCommand(agentCmd)
+}
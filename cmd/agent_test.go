@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/agent"
+	"github.com/frostyard/intuneme/internal/broker"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestHeal_NotRunning(t *testing.T) {
+	root, _ := initializedRoot(t, true)
+	r := &stopMockRunner{showFailAfter: 0}
+	if err := heal(context.Background(), r, root, agent.Resumed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeal_NetworkUp(t *testing.T) {
+	root, _ := initializedRoot(t, true)
+	rec := &runner.Recorder{}
+	rec.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+	if err := heal(context.Background(), runner.NonInteractive{Runner: rec}, root, agent.NetworkUp); err != nil {
+		t.Fatal(err)
+	}
+	var plan []string
+	for _, s := range rec.Steps {
+		plan = append(plan, s.String())
+	}
+	joined := strings.Join(plan, "\n")
+	if strings.Contains(joined, "machinectl bind") {
+		t.Errorf("a network change should not refresh the session:\n%s", joined)
+	}
+	last := plan[len(plan)-1]
+	if !strings.HasPrefix(last, "sudo -n /usr/local/libexec/intuneme/nsenter-exec 4321") || !strings.Contains(last, "restart microsoft-identity-device-broker.service") {
+		t.Errorf("last command = %q, want a device broker restart through the helper", last)
+	}
+}
+
+func TestIdleTracker(t *testing.T) {
+	root, _ := initializedRoot(t, true)
+	f, err := os.OpenFile(filepath.Join(root, "config.toml"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("[pause]\nidle_minutes = 30\n")
+	_ = f.Close()
+
+	start := time.Now()
+	check := func(now time.Time, apps string) []string {
+		t.Helper()
+		rec := &runner.Recorder{}
+		rec.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+		rec.Answer("sudo /usr/local/libexec/intuneme/nsenter-exec", runner.Reply{Output: apps})
+		tracker := &idleTracker{lastActive: start}
+		if err := tracker.check(context.Background(), rec, root, now); err != nil {
+			t.Fatal(err)
+		}
+		var plan []string
+		for _, s := range rec.Steps {
+			plan = append(plan, s.String())
+		}
+		return plan
+	}
+	paused := func(plan []string) bool {
+		return slices.Contains(plan, "sudo /usr/local/libexec/intuneme/freezer freeze")
+	}
+
+	if plan := check(start.Add(10*time.Minute), "closed\n"); paused(plan) {
+		t.Errorf("paused before the idle period passed:\n%s", strings.Join(plan, "\n"))
+	}
+	if plan := check(start.Add(31*time.Minute), "open\n"); paused(plan) {
+		t.Errorf("paused with an app window open:\n%s", strings.Join(plan, "\n"))
+	}
+	if plan := check(start.Add(31*time.Minute), "closed\n"); !paused(plan) {
+		t.Errorf("did not pause after the idle period:\n%s", strings.Join(plan, "\n"))
+	}
+
+	// A broker call restarts the idle period.
+	recent := start.Add(20 * time.Minute)
+	if err := os.WriteFile(broker.ActivityPath(root), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(broker.ActivityPath(root), recent, recent); err != nil {
+		t.Fatal(err)
+	}
+	if plan := check(start.Add(31*time.Minute), "closed\n"); paused(plan) {
+		t.Errorf("paused despite a recent broker call:\n%s", strings.Join(plan, "\n"))
+	}
+}
+
+func TestHeal_TimezoneChanged(t *testing.T) {
+	root, _ := initializedRoot(t, true)
+	rec := &runner.Recorder{}
+	rec.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+	if err := heal(context.Background(), runner.NonInteractive{Runner: rec}, root, agent.TimezoneChanged); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range rec.Steps {
+		if strings.Contains(s.String(), "device-broker") || strings.Contains(s.String(), "machinectl bind") {
+			t.Errorf("a timezone change should only sync the timezone, got %s", s)
+		}
+	}
+}
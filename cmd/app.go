@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/apps"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "List container applications and export them to the host desktop",
+}
+
+var appListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the applications installed in the container",
+	Long: `List the applications the container provides desktop entries for: the ones
+from its packages and the ones its user installed, such as Edge web apps.
+Launch any of them with 'intuneme open <id>'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, home, err := loadAppContext()
+		if err != nil {
+			return err
+		}
+		list, err := apps.List(cfg.RootfsPath, home, currentProfile())
+		if err != nil {
+			return err
+		}
+		if clix.OutputJSON(list) {
+			return nil
+		}
+		if len(list) == 0 {
+			rep.Message("No applications found in the container.")
+			return nil
+		}
+		for _, a := range list {
+			mark := ""
+			if a.Exported {
+				mark = " (exported)"
+			}
+			rep.MessagePlain("%-40s %s%s", a.ID, a.Name, mark)
+		}
+		return nil
+	},
+}
+
+var appExportCmd = &cobra.Command{
+	Use:   "export <id>...",
+	Short: "Add container applications to the host's application grid",
+	Long: `Write a host desktop entry for each application, with its icon copied from
+the container, so it can be launched from the host desktop like a host app.
+The entry runs 'intuneme open <id>', so the container must be running.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, home, err := loadAppContext()
+		if err != nil {
+			return err
+		}
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		execPath, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("resolve executable path: %w", err)
+		}
+		r := newRunner()
+		for _, id := range args {
+			app, err := apps.Find(cfg.RootfsPath, home, currentProfile(), id)
+			if err != nil {
+				return err
+			}
+			if err := apps.Export(r, cfg.RootfsPath, home, root, execPath, currentProfile(), app); err != nil {
+				return err
+			}
+			rep.Message("Exported %s (%s).", app.ID, app.Name)
+		}
+		return nil
+	},
+}
+
+var appUnexportCmd = &cobra.Command{
+	Use:   "unexport <id>...",
+	Short: "Remove exported applications from the host's application grid",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		r := newRunner()
+		for _, id := range args {
+			if err := apps.ValidateID(id); err != nil {
+				return err
+			}
+			if err := apps.Unexport(r, root, currentProfile(), id); err != nil {
+				return err
+			}
+			rep.Message("Unexported %s.", id)
+		}
+		return nil
+	},
+}
+
+// loadAppContext loads the config of an initialized profile and the host
+// directory that is its container user's home.
+func loadAppContext() (*config.Config, string, error) {
+	root, err := resolveRoot()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := os.Stat(cfg.RootfsPath); err != nil {
+		return nil, "", fmt.Errorf("not initialized — run 'intuneme init' first")
+	}
+	home, err := config.IntuneHome(profileName)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, home, nil
+}
+
+func init() {
+	appCmd.AddCommand(appListCmd, appExportCmd, appUnexportCmd)
+	rootCmd.AddCommand(appCmd)
+}
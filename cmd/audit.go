@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/audit"
+	"github.com/frostyard/intuneme/internal/logs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditSince string
+	auditLines int
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the privileged commands intuneme has run",
+	Long: `Show the audit log of every command intuneme ran as root (through sudo),
+oldest first, with its exit status and duration. Credential-looking values such
+as PASSWORD=... or TOKEN=... are redacted before they are written.
+
+The log is append-only JSONL at audit.jsonl under the data root; use --json to
+print the raw entries.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+
+		since, err := logs.ParseSince(auditSince, time.Now())
+		if err != nil {
+			return err
+		}
+		entries, err := audit.Read(root)
+		if err != nil {
+			return err
+		}
+		entries = filterAudit(entries, since, auditLines)
+
+		if clix.OutputJSON(entries) {
+			return nil
+		}
+		if len(entries) == 0 {
+			rep.Message("No privileged commands recorded.")
+			return nil
+		}
+		for _, e := range entries {
+			rep.MessagePlain("%s", e.String())
+		}
+		return nil
+	},
+}
+
+// filterAudit keeps entries at or after since, then the last lines of those
+// (all when lines is 0).
+func filterAudit(entries []audit.Entry, since time.Time, lines int) []audit.Entry {
+	kept := entries[:0:0]
+	for _, e := range entries {
+		if !e.Time.Before(since) {
+			kept = append(kept, e)
+		}
+	}
+	if lines > 0 && len(kept) > lines {
+		kept = kept[len(kept)-lines:]
+	}
+	return kept
+}
+
+func init() {
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "only show entries newer than a duration (30m) or time (\"2006-01-02 15:04\")")
+	auditCmd.Flags().IntVarP(&auditLines, "lines", "n", 50, "number of most recent entries to show (0 for all)")
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/autostart"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/nvidia"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/sudoers"
+	"github.com/spf13/cobra"
+)
+
+// postBootTimeout bounds how long the post-boot hook waits for the container
+// to finish booting, matching start's default --timeout.
+const postBootTimeout = 60 * time.Second
+
+var (
+	postBootMachine string
+	postBootUser    string
+)
+
+var autostartCmd = &cobra.Command{
+	Use:   "autostart",
+	Short: "Start the container automatically at desktop login",
+}
+
+var autostartEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Boot the container at every desktop login without a password prompt",
+	Long: `Set up the container to boot when you log in to the desktop, without a
+terminal or password prompt. This installs, once, with sudo:
+
+  - the container's systemd service unit (as 'intuneme service install'), with
+    a post-boot hook that installs udev rules, reconciles user groups and
+    forwards plugged-in devices as root
+  - a root-owned copy of intuneme that runs that hook, under
+    /usr/local/libexec/<machine>
+  - a polkit rule that lets you start and stop that one unit without a password
+  - a systemd user unit that runs 'intuneme start' when the session starts
+
+At login, start boots the unit, reconnects the container to the session's
+display and audio, and starts the broker proxy if it is enabled.
+
+Run enable again after changing config.toml (network, resources, mounts) so the
+service unit picks up the change, and after upgrading intuneme so the hook runs
+the new version.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		return runAutostartEnable(cmd.Context(), newRunner(), root)
+	},
+}
+
+var autostartDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop booting the container at login",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+		r := newRunner()
+		ctx := cmd.Context()
+
+		if !autostart.Enabled(cfg.MachineName) {
+			rep.Message("Autostart is not enabled.")
+			return nil
+		}
+		if clix.DryRun {
+			rep.Message("[dry-run] Would remove %s, %s and %s", autostart.UnitName(cfg.MachineName), autostart.PolkitRulePath(cfg.MachineName), autostart.HelperPath(cfg.MachineName))
+			return nil
+		}
+
+		rep.Message("Checking sudo credentials...")
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
+			return fmt.Errorf("sudo authentication failed: %w", err)
+		}
+		if err := autostart.Remove(ctx, r, cfg.MachineName); err != nil {
+			return err
+		}
+		rep.Message("Autostart disabled. %s stays installed; remove it with 'intuneme service uninstall'.", nspawn.UnitName(cfg.MachineName))
+		return nil
+	},
+}
+
+var autostartPostBootCmd = &cobra.Command{
+	Use:    "post-boot",
+	Short:  "Run the privileged post-boot steps (called by the service unit)",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// This runs as root from the service unit, so it takes everything
+		// from its root-owned command line and reads nothing the user can
+		// write, config.toml included.
+		if err := config.ValidateMachineName(postBootMachine); err != nil {
+			return err
+		}
+		if _, err := user.Lookup(postBootUser); err != nil {
+			return fmt.Errorf("unknown user %q: %w", postBootUser, err)
+		}
+		cfg := &config.Config{MachineName: postBootMachine, HostUser: postBootUser}
+		// The plain runner keeps root from creating the user's audit log.
+		return runAutostartPostBoot(cmd.Context(), &runner.SystemRunner{}, cfg)
+	},
+}
+
+// runAutostartEnable installs the service unit, polkit rule and user unit that
+// boot the container at login.
+func runAutostartEnable(ctx context.Context, r runner.Runner, root string) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(cfg.RootfsPath); err != nil {
+		return fmt.Errorf("not initialized — run 'intuneme init' first")
+	}
+
+	boot, err := prepareBoot(r, root, cfg)
+	if err != nil {
+		return err
+	}
+	if err := boot.useAutostart(cfg.MachineName, cfg.HostUser); err != nil {
+		return err
+	}
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine executable path: %w", err)
+	}
+
+	if clix.DryRun {
+		rep.Message("[dry-run] Would install %s, %s, %s and %s", autostart.HelperPath(cfg.MachineName), nspawn.UnitPath(cfg.MachineName), autostart.PolkitRulePath(cfg.MachineName), autostart.UnitName(cfg.MachineName))
+		return nil
+	}
+
+	rep.Message("Checking sudo credentials...")
+	if err := nspawn.ValidateSudo(ctx, r); err != nil {
+		return fmt.Errorf("sudo authentication failed: %w", err)
+	}
+
+	// The unattended start relies on the passwordless helpers.
+	if !sudoers.IsInstalled(cfg.HostUser, cfg.MachineName) {
+		if err := sudoers.Install(r, cfg.HostUser, cfg.MachineName); err != nil {
+			return fmt.Errorf("install sudoers rule: %w", err)
+		}
+	}
+	if err := nspawn.SetupNetwork(ctx, r, cfg.RootfsPath, boot.network); err != nil {
+		return err
+	}
+	if err := autostart.InstallHelper(ctx, r, execPath, cfg.MachineName); err != nil {
+		return err
+	}
+	bootArgs := nspawn.BuildBootArgs(cfg.RootfsPath, cfg.MachineName, boot.intuneHome, boot.containerHome, boot.sockets, boot.nvidiaDevices, boot.network, boot.userNS, boot.properties)
+	if _, err := nspawn.InstallUnit(ctx, r, cfg.MachineName, bootArgs, boot.postStart); err != nil {
+		return err
+	}
+	if err := autostart.Install(ctx, r, execPath, currentProfile(), cfg.MachineName, cfg.HostUser); err != nil {
+		return err
+	}
+
+	rep.Message("Autostart enabled: the container boots at your next login.")
+	if nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		rep.Message("The running container is not managed by %s yet; it will be after the next 'intuneme stop' and 'intuneme start'.", nspawn.UnitName(cfg.MachineName))
+	}
+	return nil
+}
+
+// runAutostartPostBoot waits for the container started by the service unit to
+// finish booting and performs the steps of start that need root.
+func runAutostartPostBoot(ctx context.Context, r runner.Runner, cfg *config.Config) error {
+	if !nspawn.WaitForMachine(ctx, r, cfg.MachineName, true, time.Second, postBootTimeout) {
+		return fmt.Errorf("container %s did not register within %s", cfg.MachineName, postBootTimeout)
+	}
+	if _, err := nspawn.WaitBooted(ctx, r, cfg.MachineName, 500*time.Millisecond, postBootTimeout); err != nil {
+		return err
+	}
+
+	var nvidiaLibs []nvidia.LibMapping
+	if nvidia.IsPresent() {
+		if out, err := r.Run("ldconfig", "-p"); err != nil {
+			rep.Message("Warning: Nvidia detected but ldconfig failed: %v", err)
+		} else {
+			nvidiaLibs = nvidia.HostLibraries(out)
+		}
+	}
+	postBoot(ctx, r, cfg, nvidiaLibs)
+	return nil
+}
+
+func init() {
+	autostartPostBootCmd.Flags().StringVar(&postBootMachine, "machine", "", "container machine name")
+	autostartPostBootCmd.Flags().StringVar(&postBootUser, "user", "", "host user who owns the container")
+	autostartCmd.AddCommand(autostartEnableCmd, autostartDisableCmd, autostartPostBootCmd)
+	rootCmd.AddCommand(autostartCmd)
+}
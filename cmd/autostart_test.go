@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/autostart"
+	"github.com/frostyard/intuneme/internal/nspawn"
+)
+
+func TestUseAutostart_DropsSessionSockets(t *testing.T) {
+	wayland := nspawn.BindMount{Host: "/run/user/1000/wayland-0", Container: "/run/host-wayland"}
+	runtime := nspawn.BindMount{Host: "/data/runtime", Container: "/run/user/1000"}
+	boot := &bootSpec{
+		sockets: []nspawn.BindMount{wayland, runtime},
+		session: nspawn.Session{Sockets: nspawn.HostSockets{Wayland: wayland.Host}},
+	}
+	if err := boot.useAutostart("intuneme", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(boot.sockets, []nspawn.BindMount{runtime}) {
+		t.Errorf("sockets = %v, want only the runtime dir", boot.sockets)
+	}
+	if !slices.Contains(boot.postStart, "post-boot") || boot.postStart[0] != autostart.HelperPath("intuneme") {
+		t.Errorf("postStart = %q, want the post-boot hook run from the root-owned helper", boot.postStart)
+	}
+}
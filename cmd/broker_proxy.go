@@ -1,30 +1,37 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/frostyard/intuneme/internal/broker"
 	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/spf13/cobra"
 )
 
 var brokerProxyCmd = &cobra.Command{
 	Use:   "broker-proxy",
 	Short: "Run the D-Bus broker proxy (foreground)",
-	Long:  "Forwards com.microsoft.identity.broker1 from the container's session bus to the host session bus.",
+	Long: `Forwards com.microsoft.identity.broker1 from the container's session bus to the host session bus.
+
+While the container is paused ('intuneme pause'), calls fail with the
+org.frostyard.intuneme.Error.ContainerPaused D-Bus error, unless auto_resume
+is set in the [pause] table of config.toml, in which case the container is
+resumed first.
+
+Output is also appended to broker-proxy.log in the data root; view it with
+'intuneme logs --unit proxy'.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
@@ -33,16 +40,40 @@ var brokerProxyCmd = &cobra.Command{
 			return fmt.Errorf("broker proxy is not enabled — run 'intuneme config broker-proxy enable' first")
 		}
 
+		logFile, err := broker.SetupLog(root)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = logFile.Close() }()
+
 		pidPath := filepath.Join(root, "broker-proxy.pid")
 		if err := broker.WritePIDFile(pidPath); err != nil {
 			return fmt.Errorf("write pid file: %w", err)
 		}
 		defer func() { _ = os.Remove(pidPath) }()
 
-		return broker.Run(cmd.Context(), root)
+		return broker.Run(cmd.Context(), root, proxyOptions(cfg))
 	},
 }
 
+// proxyOptions lets the proxy see that the container is paused and, with
+// [pause] auto_resume, resume it. The proxy runs without a terminal, so sudo
+// must not prompt; the freezer helper is passwordless.
+func proxyOptions(cfg *config.Config) broker.Options {
+	r := runner.NonInteractive{Runner: newRunner()}
+	opts := broker.Options{
+		Paused: func(ctx context.Context) bool {
+			return nspawn.IsPaused(ctx, r, cfg.MachineName)
+		},
+	}
+	if cfg.Pause.AutoResume {
+		opts.Resume = func(ctx context.Context) error {
+			return nspawn.Resume(ctx, r, cfg.MachineName)
+		}
+	}
+	return opts
+}
+
 func init() {
 	rootCmd.AddCommand(brokerProxyCmd)
 }
@@ -6,9 +6,12 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/frostyard/clix"
 	"github.com/frostyard/intuneme/internal/broker"
 	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/urlhandler"
 	"github.com/spf13/cobra"
 )
 
@@ -26,20 +29,22 @@ var brokerProxyEnableCmd = &cobra.Command{
 	Use:   "enable",
 	Short: "Enable the host-side broker proxy",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
 
+		// The broker bus name can only be owned once on the host session bus,
+		// so only one profile may forward it at a time.
+		if other := brokerProxyProfile(); other != "" && other != currentProfile() {
+			return fmt.Errorf("broker proxy is already enabled for profile %q — disable it there first", other)
+		}
+
 		cfg.BrokerProxy = true
 		if err := cfg.Save(root); err != nil {
 			return fmt.Errorf("save config: %w", err)
@@ -54,7 +59,7 @@ var brokerProxyEnableCmd = &cobra.Command{
 		if err := os.MkdirAll(filepath.Dir(svcPath), 0755); err != nil {
 			return fmt.Errorf("create dbus services dir: %w", err)
 		}
-		content := broker.DBusServiceFileContent(execPath)
+		content := broker.DBusServiceFileContent(execPath, currentProfile())
 		if err := os.WriteFile(svcPath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("write dbus service file: %w", err)
 		}
@@ -71,16 +76,12 @@ var brokerProxyDisableCmd = &cobra.Command{
 	Use:   "disable",
 	Short: "Disable the host-side broker proxy",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
@@ -103,9 +104,202 @@ var brokerProxyDisableCmd = &cobra.Command{
 	},
 }
 
+// brokerProxyProfile returns the profile that has the broker proxy enabled,
+// or "" if none does.
+func brokerProxyProfile() string {
+	profiles, err := config.Profiles()
+	if err != nil {
+		return ""
+	}
+	for _, p := range profiles {
+		root, err := config.ProfileRoot(p)
+		if err != nil {
+			continue
+		}
+		cfg, err := config.LoadProfile(root, p)
+		if err == nil && cfg.BrokerProxy {
+			return p
+		}
+	}
+	return ""
+}
+
+var notificationsConfigCmd = &cobra.Command{
+	Use:   "notifications",
+	Short: "Manage forwarding of container notifications to the host desktop",
+}
+
+var notificationsEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Show notifications from container apps on the host desktop",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setNotifications(true)
+	},
+}
+
+var notificationsDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop forwarding container notifications",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setNotifications(false)
+	},
+}
+
+// setNotifications saves the notifications setting. Disabling stops the
+// running proxy; enabling takes effect at the next start, since the proxy
+// needs the container's runtime directory bind-mounted at boot.
+func setNotifications(enabled bool) error {
+	root, err := resolveRoot()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	cfg.Notifications = enabled
+	if err := cfg.Save(root); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	if !enabled {
+		stopNotificationProxy(newRunner(), root)
+		rep.Message("Notification forwarding disabled.")
+		return nil
+	}
+	rep.Message("Notification forwarding enabled.")
+	rep.Message("It starts with the container: run 'intuneme stop' and 'intuneme start' if it is running.")
+	return nil
+}
+
+var urlHandlerConfigCmd = &cobra.Command{
+	Use:   "url-handler",
+	Short: "Manage opening corporate links from host apps in the container's Edge",
+}
+
+var urlHandlerEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Make intuneme the host's handler for web links",
+	Long: `Register intuneme as the host desktop's default browser. Links to hosts on
+the domains allowlist of the [url_handler] table in config.toml then open in
+the container's Microsoft Edge; every other link opens in the browser that was
+the default before, which is recorded as host_browser.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+		r := newRunner()
+		ctx := cmd.Context()
+
+		// Only one handler can be the default browser.
+		if other := urlHandlerProfile(); other != "" && other != currentProfile() {
+			return fmt.Errorf("the URL handler is already enabled for profile %q — disable it there first", other)
+		}
+
+		id := urlhandler.DesktopID(currentProfile())
+		path, err := urlhandler.DesktopFilePath(currentProfile())
+		if err != nil {
+			return err
+		}
+		if clix.DryRun {
+			rep.Message("[dry-run] Would install %s and make it the default browser", path)
+			return nil
+		}
+
+		if current := urlhandler.DefaultBrowser(ctx, r); current != "" && current != id {
+			cfg.URLHandler.HostBrowser = current
+		}
+		if cfg.URLHandler.HostBrowser == "" {
+			rep.Warning("no default browser found on the host — set host_browser in the [url_handler] table of config.toml, or links off the allowlist will not open")
+		}
+		if err := cfg.Save(root); err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+
+		execPath, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("resolve executable path: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("create applications dir: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(urlhandler.DesktopFileContent(execPath, currentProfile())), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", id, err)
+		}
+		if err := urlhandler.SetDefault(ctx, r, id); err != nil {
+			return err
+		}
+
+		rep.Message("URL handler enabled.")
+		if len(cfg.URLHandler.Domains) == 0 {
+			rep.Message("No domains are configured yet, so every link still opens in %s.", cfg.URLHandler.HostBrowser)
+			rep.Message("Add them to the [url_handler] table of %s.", filepath.Join(root, "config.toml"))
+		} else {
+			rep.Message("Links to %s open in the container's Edge; others in %s.", strings.Join(cfg.URLHandler.Domains, ", "), cfg.URLHandler.HostBrowser)
+		}
+		return nil
+	},
+}
+
+var urlHandlerDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Restore the previous default browser",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+		if !urlhandler.Installed(currentProfile()) {
+			rep.Message("URL handler is not enabled.")
+			return nil
+		}
+		if clix.DryRun {
+			rep.Message("[dry-run] Would remove %s and restore %s as the default browser", urlhandler.DesktopID(currentProfile()), cfg.URLHandler.HostBrowser)
+			return nil
+		}
+		if err := urlhandler.Remove(cmd.Context(), newRunner(), currentProfile(), cfg.URLHandler.HostBrowser); err != nil {
+			return err
+		}
+
+		rep.Message("URL handler disabled.")
+		return nil
+	},
+}
+
+// urlHandlerProfile returns the profile whose URL handler is installed, or ""
+// if none is.
+func urlHandlerProfile() string {
+	profiles, err := config.Profiles()
+	if err != nil {
+		return ""
+	}
+	for _, p := range profiles {
+		if urlhandler.Installed(p) {
+			return p
+		}
+	}
+	return ""
+}
+
 func init() {
 	brokerProxyConfigCmd.AddCommand(brokerProxyEnableCmd)
 	brokerProxyConfigCmd.AddCommand(brokerProxyDisableCmd)
 	configCmd.AddCommand(brokerProxyConfigCmd)
+	notificationsConfigCmd.AddCommand(notificationsEnableCmd, notificationsDisableCmd)
+	configCmd.AddCommand(notificationsConfigCmd)
+	urlHandlerConfigCmd.AddCommand(urlHandlerEnableCmd, urlHandlerDisableCmd)
+	configCmd.AddCommand(urlHandlerConfigCmd)
 	rootCmd.AddCommand(configCmd)
 }
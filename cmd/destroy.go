@@ -4,14 +4,21 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/agent"
+	"github.com/frostyard/intuneme/internal/apps"
+	"github.com/frostyard/intuneme/internal/autostart"
 	"github.com/frostyard/intuneme/internal/broker"
 	"github.com/frostyard/intuneme/internal/config"
 	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/provision"
 	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/snapshot"
 	"github.com/frostyard/intuneme/internal/sudoers"
 	"github.com/frostyard/intuneme/internal/udev"
+	"github.com/frostyard/intuneme/internal/urlhandler"
 	"github.com/spf13/cobra"
 )
 
@@ -22,78 +29,101 @@ var destroyCmd = &cobra.Command{
 	Short: "Remove the container rootfs and all state",
 	Long: `Remove the container rootfs and all state.
 
-By default, removes the rootfs, udev rules, polkit rule, sudoers rule, and
-Intune enrollment state from ~/Intune. Other files in ~/Intune (Downloads,
-Edge profile) are preserved.
+By default, removes the rootfs, systemd service unit, udev rules, polkit rule,
+sudoers rule, and Intune enrollment state from ~/Intune. Other files in
+~/Intune (Downloads, Edge profile) are preserved.
 
 With --all, additionally removes the GNOME extension, polkit policy action,
 D-Bus broker service file, the ~/Intune directory, and the intuneme data root
 directory (default ~/.local/share/intuneme) entirely — a full uninstall of all
-intuneme artifacts.`,
+intuneme artifacts.
+
+With --profile, only that profile's container, rules, and directories are
+removed. Artifacts shared by all profiles (GNOME extension, polkit policy
+action) are kept by --all while other profiles still exist.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
 
 		if clix.DryRun {
-			if cfg.BrokerProxy {
-				rep.Message("[dry-run] Would stop broker proxy")
-			}
-			if nspawn.IsRunning(r, cfg.MachineName) {
-				rep.Message("[dry-run] Would stop container %s", cfg.MachineName)
-			}
-			rep.Message("[dry-run] Would remove udev rules")
-			rep.Message("[dry-run] Would remove polkit rule")
-			rep.Message("[dry-run] Would remove rootfs at %s", cfg.RootfsPath)
-			if destroyAll {
-				rep.Message("[dry-run] Would disable and remove GNOME extension")
-				rep.Message("[dry-run] Would remove polkit policy action")
-				rep.Message("[dry-run] Would remove D-Bus broker service file")
-				rep.Message("[dry-run] Would remove ~/Intune entirely")
-				rep.Message("[dry-run] Would remove %s entirely", root)
-			} else {
-				rep.Message("[dry-run] Would clean Intune state from ~/Intune")
-			}
-			return nil
+			var printPlan func()
+			r, printPlan = startPlan(ctx, r, cfg)
+			defer printPlan()
 		}
 
 		// Stop broker proxy first so host apps get clean errors.
 		if cfg.BrokerProxy {
 			pidPath := filepath.Join(root, "broker-proxy.pid")
-			broker.StopByPIDFile(pidPath)
+			if !runner.DryRun(r, "stop the broker proxy in %s", pidPath) {
+				broker.StopByPIDFile(pidPath)
+			}
+		}
+
+		if cfg.Notifications {
+			stopNotificationProxy(r, root)
 		}
 
 		// Stop if running
-		if nspawn.IsRunning(r, cfg.MachineName) {
+		if nspawn.IsRunning(ctx, r, cfg.MachineName) {
 			rep.Message("Stopping running container...")
-			if err := nspawn.Stop(r, cfg.MachineName); err != nil {
+			if err := nspawn.Stop(ctx, r, cfg.MachineName); err != nil {
 				return fmt.Errorf("failed to stop container: %w", err)
 			}
 		}
 
+		// Remove the systemd service unit, if installed.
+		if err := nspawn.RemoveUnit(ctx, r, cfg.MachineName); err != nil {
+			rep.Message("Warning: failed to remove service unit: %v", err)
+		}
+
+		// Remove the agent user service, which would otherwise keep failing
+		// to load this profile.
+		if err := agent.Remove(ctx, r, cfg.MachineName); err != nil {
+			rep.Message("Warning: failed to remove agent service: %v", err)
+		}
+
+		// Remove the autostart user unit and polkit rule.
+		if err := autostart.Remove(ctx, r, cfg.MachineName); err != nil {
+			rep.Message("Warning: failed to remove autostart: %v", err)
+		}
+
+		// Remove the URL handler, which would otherwise keep sending links
+		// to a container that no longer exists.
+		if err := urlhandler.Remove(ctx, r, currentProfile(), cfg.URLHandler.HostBrowser); err != nil {
+			rep.Message("Warning: failed to remove URL handler: %v", err)
+		}
+
+		// Remove exported apps, whose entries would launch nothing.
+		if ids, err := apps.ExportedIDs(currentProfile()); err == nil {
+			for _, id := range ids {
+				if err := apps.Unexport(r, root, currentProfile(), id); err != nil {
+					rep.Message("Warning: failed to unexport %s: %v", id, err)
+				}
+			}
+		}
+
 		// Remove udev rules and hotplug artifacts.
-		if err := udev.Remove(r); err != nil {
+		if err := udev.Remove(ctx, r, cfg.MachineName); err != nil {
 			rep.Message("Warning: failed to remove udev rules: %v", err)
 		}
 
 		// Remove polkit rule installed by init.
-		if _, err := r.Run("sudo", "rm", "-f", "/etc/polkit-1/rules.d/50-intuneme.rules"); err != nil {
+		polkitRule := filepath.Join(provision.PolkitRulesDir, provision.PolkitRuleFile(cfg.MachineName))
+		if _, err := r.Run("sudo", "rm", "-f", polkitRule); err != nil {
 			rep.Message("Warning: failed to remove polkit rule: %v", err)
 		}
 
 		// Remove sudoers rule installed by init.
-		sudoers.Remove(r)
+		sudoers.Remove(r, cfg.MachineName)
 
 		// Remove rootfs with sudo (owned by root after nspawn use)
 		rep.Message("Removing %s...", root)
@@ -101,49 +131,84 @@ intuneme artifacts.`,
 		if err != nil {
 			return fmt.Errorf("rm rootfs failed: %w\n%s", err, out)
 		}
+		if err := snapshot.RemoveTree(r, snapshot.Dir(cfg.RootfsPath)); err != nil {
+			return fmt.Errorf("remove snapshots: %w", err)
+		}
 
 		// Remove config
-		_ = os.Remove(fmt.Sprintf("%s/config.toml", root))
+		configPath := fmt.Sprintf("%s/config.toml", root)
+		if !runner.DryRun(r, "remove %s", configPath) {
+			_ = os.Remove(configPath)
+		}
 
 		// Clean intune state from ~/Intune (persists via bind mount)
 		home, err := os.UserHomeDir()
 		if err != nil {
 			return fmt.Errorf("cannot determine home directory: %w", err)
 		}
-		if !filepath.IsAbs(home) {
-			return fmt.Errorf("home directory is not an absolute path: %q", home)
+		intuneHome, err := config.IntuneHome(profileName)
+		if err != nil {
+			return err
 		}
-		intuneHome := filepath.Join(home, "Intune")
 
 		if destroyAll {
 			// --all: remove all intuneme artifacts from the host.
 
-			// Disable and remove GNOME extension (best-effort: GNOME may not be running).
-			_ = r.RunAttached("gnome-extensions", "disable", extensionUUID)
-			extDir := filepath.Join(home, ".local", "share", "gnome-shell", "extensions", extensionUUID)
-			if err := os.RemoveAll(extDir); err != nil {
-				rep.Message("Warning: failed to remove GNOME extension: %v", err)
+			// Any other profile still listed keeps using the shared artifacts.
+			// This one is skipped explicitly because a dry run leaves its
+			// config in place.
+			profiles, _ := config.Profiles()
+			var remaining []string
+			for _, p := range profiles {
+				if p != currentProfile() {
+					remaining = append(remaining, p)
+				}
 			}
+			lastProfile := len(remaining) == 0
+
+			if lastProfile {
+				// Disable and remove GNOME extension (best-effort: GNOME may not be running).
+				_ = r.RunAttached("gnome-extensions", "disable", extensionUUID)
+				extDir := filepath.Join(home, ".local", "share", "gnome-shell", "extensions", extensionUUID)
+				if !runner.DryRun(r, "remove %s", extDir) {
+					if err := os.RemoveAll(extDir); err != nil {
+						rep.Message("Warning: failed to remove GNOME extension: %v", err)
+					}
+				}
 
-			// Remove polkit policy action installed by extension install.
-			if _, err := r.Run("sudo", "rm", "-f", "/etc/polkit-1/actions/org.frostyard.intuneme.policy"); err != nil {
-				rep.Message("Warning: failed to remove polkit policy action: %v", err)
-			}
+				// Remove polkit policy action installed by extension install.
+				if _, err := r.Run("sudo", "rm", "-f", "/etc/polkit-1/actions/org.frostyard.intuneme.policy"); err != nil {
+					rep.Message("Warning: failed to remove polkit policy action: %v", err)
+				}
 
-			// Remove D-Bus service activation file.
-			dbusPath := broker.DBusServiceFilePath()
-			if err := os.Remove(dbusPath); err != nil && !os.IsNotExist(err) {
-				rep.Message("Warning: failed to remove D-Bus service file: %v", err)
+				// Remove the host networkd config shared by veth-mode containers.
+				if err := nspawn.RemoveVethNetwork(ctx, r); err != nil {
+					rep.Message("Warning: failed to remove veth network config: %v", err)
+				}
+			} else if clix.Verbose {
+				rep.Message("Keeping GNOME extension and polkit policy for remaining profiles: %s", strings.Join(remaining, ", "))
 			}
 
-			// Remove ~/Intune entirely.
-			if err := os.RemoveAll(intuneHome); err != nil {
-				rep.Message("Warning: failed to remove %s: %v", intuneHome, err)
+			// Remove D-Bus service activation file. Only one profile can own
+			// it, so leave it alone if it belongs to another profile.
+			if lastProfile || cfg.BrokerProxy {
+				dbusPath := broker.DBusServiceFilePath()
+				if !runner.DryRun(r, "remove %s", dbusPath) {
+					if err := os.Remove(dbusPath); err != nil && !os.IsNotExist(err) {
+						rep.Message("Warning: failed to remove D-Bus service file: %v", err)
+					}
+				}
 			}
 
-			// Remove data root directory entirely (rootfs already removed with sudo above).
-			if err := os.RemoveAll(root); err != nil {
-				rep.Message("Warning: failed to remove %s: %v", root, err)
+			// Remove ~/Intune and the data root entirely (rootfs already
+			// removed with sudo above).
+			for _, dir := range []string{intuneHome, root} {
+				if runner.DryRun(r, "remove %s", dir) {
+					continue
+				}
+				if err := os.RemoveAll(dir); err != nil {
+					rep.Message("Warning: failed to remove %s: %v", dir, err)
+				}
 			}
 		} else {
 			staleStateDirs := []string{
@@ -159,7 +224,9 @@ intuneme artifacts.`,
 					if clix.Verbose {
 						rep.Message("Cleaning %s...", dir)
 					}
-					_ = os.RemoveAll(dir)
+					if !runner.DryRun(r, "remove %s", dir) {
+						_ = os.RemoveAll(dir)
+					}
 				}
 			}
 		}
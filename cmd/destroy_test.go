@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/broker"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/provision"
+	"github.com/frostyard/intuneme/internal/udev"
 )
 
 // messageRecorder captures Message calls for test assertions.
@@ -28,7 +35,10 @@ func (r *messageRecorder) Message(format string, args ...any) {
 	}
 }
 
-func TestDestroyDryRun(t *testing.T) {
+// runDestroyDryRun runs destroy --dry-run against a fresh root and home and
+// returns the printed plan.
+func runDestroyDryRun(t *testing.T, all bool) (plan, root, intuneHome string) {
+	t.Helper()
 	rec := &messageRecorder{}
 	origRep := rep
 	rep = rec
@@ -39,83 +49,81 @@ func TestDestroyDryRun(t *testing.T) {
 	defer func() { clix.DryRun = origDryRun }()
 
 	origAll := destroyAll
-	destroyAll = false
+	destroyAll = all
 	defer func() { destroyAll = origAll }()
 
 	origRoot := rootDir
 	rootDir = t.TempDir()
 	defer func() { rootDir = origRoot }()
+	t.Setenv("HOME", t.TempDir())
+
+	intuneHome, err := config.IntuneHome(profileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(intuneHome, ".config", "intune"), 0755); err != nil {
+		t.Fatal(err)
+	}
 
+	destroyCmd.SetContext(context.Background())
 	if err := destroyCmd.RunE(destroyCmd, nil); err != nil {
 		t.Fatalf("destroy --dry-run failed: %v", err)
 	}
 
-	joined := strings.Join(rec.messages, "\n")
+	// Nothing may actually be removed.
+	if _, err := os.Stat(filepath.Join(intuneHome, ".config", "intune")); err != nil {
+		t.Errorf("dry run removed Intune state: %v", err)
+	}
+	return strings.Join(rec.messages, "\n"), rootDir, intuneHome
+}
+
+func TestDestroyDryRun(t *testing.T) {
+	plan, root, intuneHome := runDestroyDryRun(t, false)
+	machine := config.MachineName(profileName)
 
 	for _, want := range []string{
-		"Would remove udev rules",
-		"Would remove polkit rule",
-		"Would remove rootfs at",
-		"Would clean Intune state from ~/Intune",
+		"[dry-run] machinectl show " + machine,
+		"[dry-run] sudo rm -rf " + udev.StateDir(machine),
+		"[dry-run] sudo rm -f " + filepath.Join(provision.PolkitRulesDir, provision.PolkitRuleFile(machine)),
+		"[dry-run] sudo rm -rf " + filepath.Join(root, "rootfs"),
+		"[dry-run] remove " + filepath.Join(root, "config.toml"),
+		"[dry-run] remove " + filepath.Join(intuneHome, ".config", "intune"),
 	} {
-		if !strings.Contains(joined, want) {
-			t.Errorf("dry-run output missing %q\ngot:\n%s", want, joined)
+		if !strings.Contains(plan, want) {
+			t.Errorf("dry-run plan missing %q\ngot:\n%s", want, plan)
 		}
 	}
 
-	// Default dry-run must NOT include --all messages.
+	// Default dry-run must NOT include --all steps.
 	for _, notWant := range []string{
-		"Would disable and remove GNOME extension",
-		"Would remove polkit policy action",
-		"Would remove D-Bus broker service file",
-		"Would remove ~/Intune entirely",
+		"gnome-extensions disable",
+		"org.frostyard.intuneme.policy",
+		"[dry-run] remove " + intuneHome + "\n",
 	} {
-		if strings.Contains(joined, notWant) {
-			t.Errorf("dry-run output should not contain %q without --all\ngot:\n%s", notWant, joined)
+		if strings.Contains(plan, notWant) {
+			t.Errorf("dry-run plan should not contain %q without --all\ngot:\n%s", notWant, plan)
 		}
 	}
 }
 
 func TestDestroyDryRunAll(t *testing.T) {
-	rec := &messageRecorder{}
-	origRep := rep
-	rep = rec
-	defer func() { rep = origRep }()
-
-	origDryRun := clix.DryRun
-	clix.DryRun = true
-	defer func() { clix.DryRun = origDryRun }()
-
-	origAll := destroyAll
-	destroyAll = true
-	defer func() { destroyAll = origAll }()
-
-	origRoot := rootDir
-	rootDir = t.TempDir()
-	defer func() { rootDir = origRoot }()
-
-	if err := destroyCmd.RunE(destroyCmd, nil); err != nil {
-		t.Fatalf("destroy --all --dry-run failed: %v", err)
-	}
-
-	joined := strings.Join(rec.messages, "\n")
+	plan, root, intuneHome := runDestroyDryRun(t, true)
 
 	for _, want := range []string{
-		"Would remove udev rules",
-		"Would remove polkit rule",
-		"Would remove rootfs at",
-		"Would disable and remove GNOME extension",
-		"Would remove polkit policy action",
-		"Would remove D-Bus broker service file",
-		"Would remove ~/Intune entirely",
+		"[dry-run] sudo rm -rf " + filepath.Join(root, "rootfs"),
+		"[dry-run] gnome-extensions disable " + extensionUUID,
+		"[dry-run] sudo rm -f /etc/polkit-1/actions/org.frostyard.intuneme.policy",
+		"[dry-run] remove " + broker.DBusServiceFilePath(),
+		"[dry-run] remove " + intuneHome,
+		"[dry-run] remove " + root,
 	} {
-		if !strings.Contains(joined, want) {
-			t.Errorf("--all dry-run output missing %q\ngot:\n%s", want, joined)
+		if !strings.Contains(plan, want) {
+			t.Errorf("--all dry-run plan missing %q\ngot:\n%s", want, plan)
 		}
 	}
 
-	if strings.Contains(joined, "Would clean Intune state from ~/Intune") {
-		t.Errorf("--all dry-run should not contain default cleanup message\ngot:\n%s", joined)
+	if strings.Contains(plan, filepath.Join(intuneHome, ".config", "intune")) {
+		t.Errorf("--all dry-run should not clean individual state dirs\ngot:\n%s", plan)
 	}
 }
 
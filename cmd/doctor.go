@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/doctor"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that every part of the setup is working",
+	Long: `Run end-to-end health checks: prerequisites, the sudoers rule and nsenter
+helper, the polkit rule, the SELinux policy, udev hotplug rules, host display
+and audio sockets, the render group GID, the D-Bus activation file, the
+container session bus, keyring unlock state, and a getLinuxBrokerVersion call
+through the broker proxy.
+
+Each check prints pass, warn, fail, or skip, with a fix for anything that
+needs attention. Use --json to collect results. Exits non-zero if any check
+fails.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		execPath, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to determine executable path: %w", err)
+		}
+
+		results := doctor.Run(cmd.Context(), doctor.Env{
+			Runner:       r,
+			Root:         root,
+			Profile:      currentProfile(),
+			Config:       cfg,
+			ExecPath:     execPath,
+			ProbeTimeout: 10 * time.Second,
+		})
+
+		if !clix.OutputJSON(results) {
+			for _, res := range results {
+				line := fmt.Sprintf("[%s] %s", strings.ToUpper(string(res.Status)), res.Name)
+				if res.Detail != "" {
+					line += ": " + res.Detail
+				}
+				rep.MessagePlain("%s", line)
+				if res.Fix != "" && (res.Status == doctor.Warn || res.Status == doctor.Fail) {
+					rep.MessagePlain("       fix: %s", res.Fix)
+				}
+			}
+		}
+
+		if n := doctor.Failed(results); n > 0 {
+			return fmt.Errorf("%d check(s) failed", n)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
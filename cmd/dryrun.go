@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/nvidia"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/udev"
+	"github.com/frostyard/std/reporter"
+)
+
+// planLeaderPID stands in for the PID of a container that is not running yet.
+const planLeaderPID = "LEADER_PID"
+
+// planReporter drops progress messages while a plan is recorded, since none
+// of the work they announce happens. Warnings and errors still get through.
+type planReporter struct{ reporter.Reporter }
+
+func (planReporter) Message(string, ...any)      {}
+func (planReporter) MessagePlain(string, ...any) {}
+
+// startPlan swaps real for a Recorder so a --dry-run command walks its real
+// code path without changing anything. The returned function prints the
+// recorded plan, as text or JSON, and must be deferred by the caller.
+func startPlan(ctx context.Context, real runner.Runner, cfg *config.Config) (runner.Runner, func()) {
+	rec := newPlanRecorder(ctx, real, cfg)
+	saved := rep
+	rep = planReporter{saved}
+	return rec, func() {
+		rep = saved
+		printPlan(rec.Steps)
+	}
+}
+
+// newPlanRecorder returns a Recorder whose read-only queries are answered
+// from the host as it is now. The machine's state flips after the first
+// query, which is what start, stop and recreate wait for; the container
+// itself always reports a finished boot.
+func newPlanRecorder(ctx context.Context, real runner.Runner, cfg *config.Config) *runner.Recorder {
+	rec := &runner.Recorder{}
+	machine := cfg.MachineName
+
+	running := nspawn.IsRunning(ctx, real, machine)
+	notRunning := runner.Reply{Err: fmt.Errorf("no machine %s", machine)}
+	if running {
+		rec.Answer("machinectl show "+machine, runner.Reply{}, notRunning)
+	} else {
+		rec.Answer("machinectl show "+machine, notRunning, runner.Reply{})
+	}
+	leader := planLeaderPID
+	if running {
+		if pid, err := nspawn.LeaderPID(ctx, real, machine); err == nil {
+			leader = pid
+		}
+	}
+	rec.Answer("machinectl show "+machine+" -p Leader", runner.Reply{Output: leader + "\n"})
+	// A running container's user namespace decides how devices are forwarded.
+	if running {
+		seed(rec, real, "cat", "/proc/"+leader+"/uid_map")
+	}
+	rec.Answer("machinectl show "+machine+" -p Unit", runner.Reply{Output: nspawn.UnitName(machine) + "\n"})
+	rec.Answer("sudo systemctl --machine="+machine+" is-system-running", runner.Reply{Output: "running\n"})
+
+	// recreate carries the user's password hash over from the old rootfs.
+	if u, err := user.Current(); err == nil {
+		rec.Answer("sudo cat "+filepath.Join(cfg.RootfsPath, "etc", "shadow"), runner.Reply{Output: u.Username + ":*:::::::\n"})
+	}
+
+	// Filesystem and device queries decide between btrfs and plain
+	// directories and how devices are forwarded; they are safe to ask.
+	seed(rec, real, "stat", "-f", "-c", "%T", filepath.Dir(cfg.RootfsPath))
+	seed(rec, real, "stat", "-f", "-c", "%T", cfg.RootfsPath)
+	seed(rec, real, "stat", "-c", "%i", cfg.RootfsPath)
+	for _, yk := range udev.DetectYubikeys() {
+		for _, devnode := range yk.Devices() {
+			seed(rec, real, "stat", "-c", "0x%t 0x%T", devnode)
+		}
+	}
+	for _, vd := range udev.DetectVideoDevices() {
+		seed(rec, real, "stat", "-c", "0x%t 0x%T", vd.DevNode)
+	}
+	if nvidia.IsPresent() {
+		seed(rec, real, "ldconfig", "-p")
+	}
+	if cfg.Network == nspawn.NetworkVeth {
+		seed(rec, real, "systemctl", "is-active", "systemd-networkd")
+	}
+	return rec
+}
+
+// seed answers the exact command name args with what real returns for it.
+func seed(rec *runner.Recorder, real runner.Runner, name string, args ...string) {
+	out, err := real.Run(name, args...)
+	if err != nil {
+		err = errors.New(strings.TrimSpace(string(out)))
+	}
+	rec.Answer(strings.Join(append([]string{name}, args...), " "), runner.Reply{Output: string(out), Err: err})
+}
+
+// printPlan reports the recorded steps in the order they would run.
+func printPlan(steps []runner.Step) {
+	if clix.OutputJSON(steps) {
+		return
+	}
+	for _, s := range steps {
+		rep.Message("[dry-run] %s", s)
+	}
+}
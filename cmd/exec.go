@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	execUserFlag string
+	execTTYFlag  bool
+	execEnvFlag  []string
+	execCwdFlag  string
+)
+
+// runExec runs argv inside the running container in the foreground. user is
+// either empty (the container user) or "root"; the nsenter helper only ever
+// enters as the container user, so other accounts are rejected.
+func runExec(ctx context.Context, r runner.Runner, root, user string, argv []string, opts nspawn.ExecOptions) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(cfg.RootfsPath); err != nil {
+		return fmt.Errorf("not initialized — run 'intuneme init' first")
+	}
+
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		return fmt.Errorf("container is not running — run 'intuneme start' first")
+	}
+	if err := resumeIfPaused(ctx, r, cfg.MachineName); err != nil {
+		return err
+	}
+
+	switch user {
+	case "", cfg.HostUser:
+	case "root":
+		opts.Root = true
+	default:
+		return fmt.Errorf("unsupported user %q — only %q and \"root\" are available", user, cfg.HostUser)
+	}
+
+	return nspawn.ExecCommand(ctx, r, cfg.MachineName, cfg.HostUID, argv, opts)
+}
+
+// exitStatus maps a failed child to the status intuneme should exit with,
+// following the shell convention of 128+N for a child killed by signal N.
+func exitStatus(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, false
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), true
+	}
+	return exitErr.ExitCode(), true
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- command [args...]",
+	Short: "Run a command inside the running container",
+	Long: `Run a command inside the running container in the foreground, with its
+stdin/stdout/stderr attached. The command runs as the container user after the
+same session setup as launched apps (display, audio, D-Bus, keyring), so tools
+such as intune-agent behave as they do in the desktop session.
+
+intuneme exits with the command's exit status (128+N if it was killed by signal
+N), and SIGINT/SIGTERM sent to intuneme are forwarded to the command, which
+makes exec suitable for scripting:
+
+  intuneme exec -- dpkg-query -W -f '${Version}\n' intune-portal
+  intuneme exec --user root --cwd /var/log -- ls -l
+  intuneme exec --tty -- ykman info`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: false,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		opts := nspawn.ExecOptions{
+			TTY: execTTYFlag,
+			Env: execEnvFlag,
+			Dir: execCwdFlag,
+		}
+		err = runExec(ctx, r, root, execUserFlag, args, opts)
+		if code, ok := exitStatus(err); ok {
+			// The command ran and failed; its status is the result, not an error.
+			os.Exit(code)
+		}
+		return err
+	},
+}
+
+func init() {
+	// Flags stop at the first command word, so the "--" is optional.
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().StringVar(&execUserFlag, "user", "", "run as this user: the container user (default) or root")
+	execCmd.Flags().BoolVarP(&execTTYFlag, "tty", "t", false, "allocate a pseudo-terminal for the command")
+	execCmd.Flags().StringArrayVarP(&execEnvFlag, "env", "e", nil, "set an environment variable (KEY=VALUE, repeatable)")
+	execCmd.Flags().StringVar(&execCwdFlag, "cwd", "", "working directory inside the container")
+	rootCmd.AddCommand(execCmd)
+}
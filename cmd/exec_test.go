@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/nspawn"
+)
+
+func TestRunExec_NotRunning(t *testing.T) {
+	r := &mcpMockRunner{notRunning: true}
+	root, _ := initializedRoot(t, true)
+	err := runExec(context.Background(), r, root, "", []string{"true"}, nspawn.ExecOptions{})
+	if err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Fatalf("expected 'not running' error, got %v", err)
+	}
+}
+
+func TestRunExec_RunsInForeground(t *testing.T) {
+	r := &mcpMockRunner{}
+	root, _ := initializedRoot(t, true)
+	if err := runExec(context.Background(), r, root, "", []string{"intune-agent", "--version"}, nspawn.ExecOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	script := r.lastForegroundCommand(t)
+	if !strings.HasSuffix(script, "exec 'intune-agent' '--version'") {
+		t.Errorf("unexpected script: %s", script)
+	}
+}
+
+func TestRunExec_Root(t *testing.T) {
+	r := &mcpMockRunner{}
+	root, _ := initializedRoot(t, true)
+	if err := runExec(context.Background(), r, root, "root", []string{"id"}, nspawn.ExecOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if script := r.lastForegroundCommand(t); !strings.Contains(script, "exec sudo --preserve-env -- 'id'") {
+		t.Errorf("expected sudo wrapper, got: %s", script)
+	}
+}
+
+func TestRunExec_RejectsOtherUsers(t *testing.T) {
+	r := &mcpMockRunner{}
+	root, _ := initializedRoot(t, true)
+	err := runExec(context.Background(), r, root, "nobody", []string{"id"}, nspawn.ExecOptions{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported user") {
+		t.Fatalf("expected unsupported user error, got %v", err)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	err := exec.Command("sh", "-c", "exit 7").Run()
+	if code, ok := exitStatus(err); !ok || code != 7 {
+		t.Errorf("exit 7: got %d, %v", code, ok)
+	}
+	err = exec.Command("sh", "-c", "kill -TERM $$").Run()
+	if code, ok := exitStatus(err); !ok || code != 143 {
+		t.Errorf("SIGTERM: got %d, %v", code, ok)
+	}
+	if _, ok := exitStatus(nil); ok {
+		t.Error("nil error should not map to an exit status")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"os/user"
 	"path/filepath"
 
-	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/spf13/cobra"
 )
 
@@ -26,7 +25,7 @@ var extensionInstallCmd = &cobra.Command{
 	Use:   "install",
 	Short: "Install the GNOME Shell Quick Settings extension",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
+		r := newRunner()
 
 		u, err := user.Current()
 		if err != nil {
@@ -1,11 +1,14 @@
 import GObject from 'gi://GObject';
 import Gio from 'gi://Gio';
 import GLib from 'gi://GLib';
+import * as Main from 'resource:///org/gnome/shell/ui/main.js';
 
-const MACHINE_NAME = 'intuneme';
+const DEFAULT_PROFILE = 'default';
 const POLL_INTERVAL_SECONDS = 5;
+const REFRESH_DELAY_SECONDS = 2;
 const INTUNEME_BIN = 'intuneme';
-const INTUNEME_ROOT = `${GLib.get_home_dir()}/.local/share/intuneme`;
+const DATA_DIR = `${GLib.get_home_dir()}/.local/share`;
+const PROFILE_DIR_RE = /^intuneme(?:-([a-z0-9][a-z0-9-]*))?$/;
 
 // Terminal emulators to try, in order of preference.
 const TERMINALS = ['ghostty', 'ptyxis', 'kgx', 'gnome-terminal', 'xterm'];
@@ -55,6 +58,38 @@ function terminalExecArgs(terminal) {
     return ['--'];
 }
 
+/**
+ * List initialized intuneme profiles. Mirrors config.Profiles(): the default
+ * profile lives in ~/.local/share/intuneme, named profiles in
+ * ~/.local/share/intuneme-<profile>, and only directories with a config.toml
+ * count. The default profile is always returned first, even before init, so
+ * the toggle is available on a fresh install.
+ */
+export function listProfiles() {
+    const profiles = [];
+    try {
+        const dir = Gio.File.new_for_path(DATA_DIR);
+        const children = dir.enumerate_children(
+            'standard::name,standard::type', Gio.FileQueryInfoFlags.NONE, null);
+        let info;
+        while ((info = children.next_file(null)) !== null) {
+            if (info.get_file_type() !== Gio.FileType.DIRECTORY)
+                continue;
+            const match = info.get_name().match(PROFILE_DIR_RE);
+            if (!match || !match[1] || match[1] === DEFAULT_PROFILE)
+                continue;
+            const configPath = `${DATA_DIR}/${info.get_name()}/config.toml`;
+            if (GLib.file_test(configPath, GLib.FileTest.EXISTS))
+                profiles.push(match[1]);
+        }
+        children.close(null);
+    } catch (e) {
+        console.warn(`[intuneme] Failed to list profiles: ${e.message}`);
+    }
+    profiles.sort();
+    return [DEFAULT_PROFILE, ...profiles];
+}
+
 export const ContainerManager = GObject.registerClass({
     Properties: {
         'container-running': GObject.ParamSpec.boolean(
@@ -79,19 +114,38 @@ export const ContainerManager = GObject.registerClass({
         ),
     },
 }, class ContainerManager extends GObject.Object {
-    _init() {
+    _init(profile = DEFAULT_PROFILE) {
         super._init();
 
+        this._profile = profile;
+        this._machineName = profile === DEFAULT_PROFILE ? 'intuneme' : `intuneme-${profile}`;
+
         this._containerRunning = false;
         this._brokerRunning = false;
         this._transitioning = false;
         this._error = false;
         this._errorTimeoutId = null;
+        this._refreshSourceId = null;
 
         this._setupDBusWatch();
         this._startPolling();
-        // Do an immediate status check
-        this._pollStatus();
+        // Do an immediate status check. A container that was already running
+        // when the shell started belongs to an earlier login, so reconnect it
+        // to this session's display and audio.
+        this._pollStatus().then(() => this.refreshSession());
+    }
+
+    get profile() {
+        return this._profile;
+    }
+
+    /**
+     * Build an intuneme argv for this manager's profile.
+     */
+    _intuneme(...args) {
+        if (this._profile === DEFAULT_PROFILE)
+            return [INTUNEME_BIN, ...args];
+        return [INTUNEME_BIN, '--profile', this._profile, ...args];
     }
 
     get container_running() {
@@ -166,7 +220,7 @@ export const ContainerManager = GObject.registerClass({
                 Gio.DBusSignalFlags.NONE,
                 (_conn, _sender, _path, _iface, _signal, params) => {
                     const name = params.get_child_value(0).get_string()[0];
-                    if (name === MACHINE_NAME) {
+                    if (name === this._machineName) {
                         this._setContainerRunning(true);
                         this._setTransitioning(false);
                     }
@@ -181,7 +235,7 @@ export const ContainerManager = GObject.registerClass({
                 Gio.DBusSignalFlags.NONE,
                 (_conn, _sender, _path, _iface, _signal, params) => {
                     const name = params.get_child_value(0).get_string()[0];
-                    if (name === MACHINE_NAME) {
+                    if (name === this._machineName) {
                         this._setContainerRunning(false);
                         this._setBrokerRunning(false);
                         this._setTransitioning(false);
@@ -208,13 +262,14 @@ export const ContainerManager = GObject.registerClass({
     }
 
     async _pollStatus() {
-        const [ok, stdout] = await execCommand([INTUNEME_BIN, 'status']);
+        const [ok, stdout] = await execCommand(this._intuneme('status'));
         if (!ok)
             return;
 
         const containerMatch = stdout.match(/^Container:\s+(\w+)/m);
         if (containerMatch) {
-            const running = containerMatch[1] === 'running';
+            // A paused container is still up: it resumes on use.
+            const running = ['running', 'paused'].includes(containerMatch[1]);
             if (!this._transitioning)
                 this._setContainerRunning(running);
         }
@@ -240,7 +295,7 @@ export const ContainerManager = GObject.registerClass({
         this._setTransitioning(true);
         try {
             const proc = Gio.Subprocess.new(
-                [terminal, ...terminalExecArgs(terminal), INTUNEME_BIN, 'start'],
+                [terminal, ...terminalExecArgs(terminal), ...this._intuneme('start')],
                 Gio.SubprocessFlags.NONE,
             );
             proc.wait_async(null, (_, res) => {
@@ -274,7 +329,7 @@ export const ContainerManager = GObject.registerClass({
             return;
 
         this._setTransitioning(true);
-        const [ok, , stderr] = await execCommand([INTUNEME_BIN, 'stop']);
+        const [ok, , stderr] = await execCommand(this._intuneme('stop'));
         if (!ok) {
             console.warn(`[intuneme] stop failed: ${stderr}`);
             this._showErrorBriefly();
@@ -297,7 +352,7 @@ export const ContainerManager = GObject.registerClass({
 
         try {
             const proc = Gio.Subprocess.new(
-                [terminal, ...terminalExecArgs(terminal), INTUNEME_BIN, 'shell'],
+                [terminal, ...terminalExecArgs(terminal), ...this._intuneme('shell')],
                 Gio.SubprocessFlags.NONE,
             );
             proc.wait_async(null, null);
@@ -311,10 +366,17 @@ export const ContainerManager = GObject.registerClass({
      * Uses machinectl shell (polkit-authenticated), so no terminal is needed.
      */
     async _openApp(subcommand, label) {
-        const [ok, , stderr] = await execCommand([INTUNEME_BIN, 'open', subcommand]);
+        const [ok, , stderr] = await execCommand(this._intuneme('open', subcommand));
         if (!ok) {
             console.error(`[intuneme] Failed to launch ${label}: ${stderr}`);
             this._showErrorBriefly();
+            // intuneme reports why the app did not start, with the end of
+            // its log; drop the CLI's error banner and padding.
+            const details = stderr.split('\n')
+                .map(line => line.trim())
+                .filter(line => line && line !== 'ERROR')
+                .join('\n');
+            Main.notify(`Failed to launch ${label}`, details);
         }
     }
 
@@ -332,7 +394,35 @@ export const ContainerManager = GObject.registerClass({
         this._openApp('portal', 'Intune Portal');
     }
 
+    /**
+     * Reconnect the running container to the current display and audio via
+     * `intuneme session refresh`. Calls within REFRESH_DELAY_SECONDS of each
+     * other are coalesced, since monitor changes arrive in bursts.
+     */
+    refreshSession() {
+        if (!this._containerRunning || this._refreshSourceId)
+            return;
+
+        this._refreshSourceId = GLib.timeout_add_seconds(
+            GLib.PRIORITY_DEFAULT, REFRESH_DELAY_SECONDS, () => {
+                this._refreshSourceId = null;
+                this._runSessionRefresh();
+                return GLib.SOURCE_REMOVE;
+            },
+        );
+    }
+
+    async _runSessionRefresh() {
+        const [ok, , stderr] = await execCommand(this._intuneme('session', 'refresh'));
+        if (!ok)
+            console.warn(`[intuneme] session refresh failed: ${stderr}`);
+    }
+
     destroy() {
+        if (this._refreshSourceId) {
+            GLib.source_remove(this._refreshSourceId);
+            this._refreshSourceId = null;
+        }
         if (this._errorTimeoutId) {
             GLib.source_remove(this._errorTimeoutId);
             this._errorTimeoutId = null;
@@ -4,20 +4,28 @@ import * as QuickSettings from 'resource:///org/gnome/shell/ui/quickSettings.js'
 
 import {Extension} from 'resource:///org/gnome/shell/extensions/extension.js';
 import {IntuneToggle} from './quickToggle.js';
-import {ContainerManager} from './containerManager.js';
+import {ContainerManager, listProfiles} from './containerManager.js';
 
 const IntuneIndicator = GObject.registerClass(
 class IntuneIndicator extends QuickSettings.SystemIndicator {
     _init(extensionObject) {
         super._init();
 
-        this._manager = new ContainerManager();
-        this._toggle = new IntuneToggle(this._manager);
-        this.quickSettingsItems.push(this._toggle);
+        // One toggle per profile, each driving its own isolated container.
+        this._managers = listProfiles().map(profile => new ContainerManager(profile));
+        for (const manager of this._managers)
+            this.quickSettingsItems.push(new IntuneToggle(manager));
+    }
+
+    /**
+     * Reconnect every running container to the current display and audio.
+     */
+    refreshSessions() {
+        this._managers.forEach(manager => manager.refreshSession());
     }
 
     destroy() {
-        this._manager.destroy();
+        this._managers.forEach(manager => manager.destroy());
         this.quickSettingsItems.forEach(item => item.destroy());
         super.destroy();
     }
@@ -27,9 +35,15 @@ export default class IntuneExtension extends Extension {
     enable() {
         this._indicator = new IntuneIndicator(this);
         Main.panel.statusArea.quickSettings.addExternalIndicator(this._indicator);
+
+        // Monitor changes can move Xwayland to a new display or auth file.
+        this._monitorsChangedId = Main.layoutManager.connect('monitors-changed',
+            () => this._indicator.refreshSessions());
     }
 
     disable() {
+        Main.layoutManager.disconnect(this._monitorsChangedId);
+        this._monitorsChangedId = null;
         this._indicator.destroy();
         this._indicator = null;
     }
@@ -5,8 +5,9 @@ import * as PopupMenu from 'resource:///org/gnome/shell/ui/popupMenu.js';
 export const IntuneToggle = GObject.registerClass(
 class IntuneToggle extends QuickSettings.QuickMenuToggle {
     _init(manager) {
+        const title = manager.profile === 'default' ? 'Intune' : `Intune (${manager.profile})`;
         super._init({
-            title: 'Intune',
+            title,
             subtitle: 'Stopped',
             iconName: 'computer-symbolic',
             toggleMode: true,
@@ -15,7 +16,7 @@ class IntuneToggle extends QuickSettings.QuickMenuToggle {
         this._manager = manager;
 
         // --- Popup menu ---
-        this.menu.setHeader('computer-symbolic', 'Intune Container');
+        this.menu.setHeader('computer-symbolic', `${title} Container`);
 
         // Status section
         this._statusSection = new PopupMenu.PopupMenuSection();
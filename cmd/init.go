@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/user"
@@ -15,6 +16,7 @@ import (
 	"github.com/frostyard/intuneme/internal/provision"
 	"github.com/frostyard/intuneme/internal/puller"
 	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/snapshot"
 	"github.com/frostyard/intuneme/internal/sudoers"
 	pkgversion "github.com/frostyard/intuneme/internal/version"
 	"github.com/spf13/cobra"
@@ -29,14 +31,11 @@ var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Provision the Intune nspawn container",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
 		// Check prerequisites
@@ -53,32 +52,36 @@ var initCmd = &cobra.Command{
 			return fmt.Errorf("get current user: %w", err)
 		}
 
-		// Acquire and validate password before doing any container work.
-		password, err := readPassword(u.Username, passwordFile)
-		if err != nil {
-			return err
+		// Acquire and validate password before doing any container work. A
+		// dry run sets no password, so it does not prompt for one.
+		var password string
+		if !clix.DryRun || passwordFile != "" {
+			password, err = readPassword(u.Username, passwordFile)
+			if err != nil {
+				return err
+			}
 		}
 
-		// Load config for dry-run reporting.
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return fmt.Errorf("load config: %w", err)
 		}
 
 		if clix.DryRun {
-			rep.Message("[dry-run] Would pull OCI image and create container at %s", cfg.RootfsPath)
-			rep.Message("[dry-run] Would create container user %s", u.Username)
-			return nil
+			var printPlan func()
+			r, printPlan = startPlan(ctx, r, cfg)
+			defer printPlan()
 		}
 
-		// Create ~/Intune directory
-		home, err := os.UserHomeDir()
+		// Create ~/Intune directory (~/Intune-<profile> for named profiles)
+		intuneHome, err := config.IntuneHome(profileName)
 		if err != nil {
-			return fmt.Errorf("cannot determine home directory: %w", err)
+			return err
 		}
-		intuneHome := filepath.Join(home, "Intune")
-		if err := os.MkdirAll(intuneHome, 0755); err != nil {
-			return fmt.Errorf("create ~/Intune: %w", err)
+		if !runner.DryRun(r, "create directory %s", intuneHome) {
+			if err := os.MkdirAll(intuneHome, 0755); err != nil {
+				return fmt.Errorf("create %s: %w", intuneHome, err)
+			}
 		}
 
 		// Check if already initialized
@@ -95,28 +98,28 @@ var initCmd = &cobra.Command{
 		}
 
 		rep.Message("Pulling and extracting OCI image %s (via %s)...", image, p.Name())
-		if err := os.MkdirAll(cfg.RootfsPath, 0755); err != nil {
-			return fmt.Errorf("create rootfs dir: %w", err)
-		}
-		if err := p.PullAndExtract(r, image, cfg.RootfsPath, tmpDirInit); err != nil {
+		if err := snapshot.CreateRootfs(r, cfg.RootfsPath); err != nil {
 			return err
 		}
+		if err := p.PullAndExtract(ctx, r, image, cfg.RootfsPath, tmpDirInit); err != nil {
+			return abortInit(ctx, r, cfg.RootfsPath, err)
+		}
 
 		hostname, _ := os.Hostname()
 
-		if err := provision.ProvisionContainer(r, rep, cfg.RootfsPath, u.Username, os.Getuid(), os.Getgid(), hostname); err != nil {
-			return err
+		if err := provision.ProvisionContainer(ctx, r, rep, cfg.RootfsPath, cfg.MachineName, u.Username, os.Getuid(), os.Getgid(), hostname); err != nil {
+			return abortInit(ctx, r, cfg.RootfsPath, err)
 		}
 
 		rep.Message("Setting container user password...")
-		if err := provision.SetContainerPassword(r, cfg.RootfsPath, u.Username, password); err != nil {
-			return fmt.Errorf("set password failed: %w", err)
+		if err := provision.SetContainerPassword(ctx, r, cfg.RootfsPath, u.Username, password); err != nil {
+			return abortInit(ctx, r, cfg.RootfsPath, fmt.Errorf("set password failed: %w", err))
 		}
 
 		if clix.Verbose {
 			rep.Message("Installing sudoers rule for passwordless app launch...")
 		}
-		if err := sudoers.Install(r, u.Username); err != nil {
+		if err := sudoers.Install(r, u.Username, cfg.MachineName); err != nil {
 			rep.Warning("sudoers install failed: %v", err)
 		}
 
@@ -124,7 +127,7 @@ var initCmd = &cobra.Command{
 			if clix.Verbose {
 				rep.Message("Applying SELinux policy (required for machinectl shell on SELinux systems)...")
 			}
-			if err := provision.InstallSELinuxPolicy(r, cfg.RootfsPath); err != nil {
+			if err := provision.InstallSELinuxPolicy(ctx, r, cfg.RootfsPath); err != nil {
 				rep.Warning("SELinux policy setup failed: %v", err)
 			}
 		}
@@ -134,8 +137,10 @@ var initCmd = &cobra.Command{
 		}
 		cfg.HostUID = os.Getuid()
 		cfg.HostUser = u.Username
-		if err := cfg.Save(root); err != nil {
-			return err
+		if !runner.DryRun(r, "save %s", filepath.Join(root, "config.toml")) {
+			if err := cfg.Save(root); err != nil {
+				return err
+			}
 		}
 
 		rep.Message("Initialized intuneme at %s", root)
@@ -232,6 +237,20 @@ func readPassword(username, passwordFile string) (string, error) {
 	return "", fmt.Errorf("passwords did not match after 3 attempts")
 }
 
+// abortInit removes the half-built rootfs when init was interrupted, so the
+// next run starts clean instead of failing with "already initialized".
+// Ordinary failures keep the rootfs for inspection.
+func abortInit(ctx context.Context, r runner.Runner, rootfs string, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	rep.Message("Interrupted, removing partial rootfs at %s...", rootfs)
+	if rerr := snapshot.RemoveTree(r, rootfs); rerr != nil {
+		rep.Warning("remove partial rootfs: %v", rerr)
+	}
+	return fmt.Errorf("init interrupted: %w", err)
+}
+
 func init() {
 	initCmd.Flags().BoolVar(&forceInit, "force", false, "reinitialize even if already set up")
 	initCmd.Flags().StringVar(&passwordFile, "password-file", "", "path to file containing the container user password (first line used)")
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/broker"
+	"github.com/frostyard/intuneme/internal/logs"
+	"github.com/frostyard/intuneme/internal/notify"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsFollow bool
+	logsSince  string
+	logsUnit   string
+	logsLines  int
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show container, broker proxy, and hotplug logs",
+	Long: `Show logs from the container journal, the udev hotplug handler, and the
+host-side broker proxy (and notification proxy, when enabled), interleaved by
+timestamp.
+
+Use --unit to narrow to one source:
+  broker         the container user's microsoft-identity-broker
+  device-broker  the container's microsoft-identity-device-broker
+  agent          the container user's intune-agent
+  hotplug        the host udev hotplug handler (intuneme-hotplug)
+  proxy          the host-side broker proxy (broker-proxy.log)
+  notifications  the host-side notification proxy (notification-proxy.log)
+
+--since accepts a duration ("30m", "2h") or a time ("2006-01-02 15:04").
+The container journal is root-owned, so journal sources are read via sudo.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		since, err := logs.ParseSince(logsSince, time.Now())
+		if err != nil {
+			return err
+		}
+		notifyLog := ""
+		if cfg.Notifications {
+			notifyLog = notify.LogPath(root)
+		}
+		sources, err := logs.Sources(cfg.RootfsPath, broker.LogPath(root), notifyLog, logsUnit)
+		if err != nil {
+			return err
+		}
+
+		if clix.DryRun {
+			for _, src := range sources {
+				if src.Path != "" {
+					rep.Message("[dry-run] Would read %s", src.Path)
+				} else {
+					rep.Message("[dry-run] Would run sudo %v", logs.JournalArgs(src, since, logsLines, logsFollow))
+				}
+			}
+			return nil
+		}
+
+		for _, src := range sources {
+			if src.Path == "" {
+				if err := nspawn.ValidateSudo(ctx, r); err != nil {
+					return fmt.Errorf("sudo authentication failed: %w", err)
+				}
+				break
+			}
+		}
+
+		entries := readLogs(r, sources, since, logsLines)
+		if clix.OutputJSON(entries) {
+			return nil
+		}
+		for _, e := range entries {
+			rep.MessagePlain("%s", e.String())
+		}
+
+		if !logsFollow {
+			return nil
+		}
+		return logs.Follow(ctx, r, sources, os.Stdout)
+	},
+}
+
+// readLogs collects and merges the existing entries of all sources. A source
+// that cannot be read is reported and skipped, so one missing journal doesn't
+// hide the others.
+func readLogs(r runner.Runner, sources []logs.Source, since time.Time, lines int) []logs.Entry {
+	var collected [][]logs.Entry
+	for _, src := range sources {
+		if src.Path != "" {
+			// Include the rotated file so a recent rotation doesn't hide history.
+			for _, path := range []string{src.Path + ".1", src.Path} {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					if !os.IsNotExist(err) {
+						rep.Warning("%s: %v", src.Name, err)
+					}
+					continue
+				}
+				collected = append(collected, logs.ParseProxyLog(data, src.Name, since))
+			}
+			continue
+		}
+		out, err := r.Run("sudo", logs.JournalArgs(src, since, lines, false)...)
+		if err != nil {
+			rep.Warning("%s: journalctl failed: %v", src.Name, err)
+			continue
+		}
+		collected = append(collected, logs.ParseJournal(out, src.Name))
+	}
+	return logs.Merge(lines, collected...)
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "keep printing new log entries")
+	logsCmd.Flags().StringVar(&logsSince, "since", "", "only show entries newer than a duration (30m) or time (\"2006-01-02 15:04\")")
+	logsCmd.Flags().StringVar(&logsUnit, "unit", "", "only show one source: broker, device-broker, agent, hotplug, proxy, or notifications")
+	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 200, "number of past entries to show (0 for all)")
+	rootCmd.AddCommand(logsCmd)
+}
@@ -1,12 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/frostyard/intuneme/internal/config"
 	"github.com/frostyard/intuneme/internal/nspawn"
 	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/spf13/cobra"
@@ -23,8 +23,8 @@ var mcpBinaryFlag string
 // its stdio is wired straight to the caller (VS Code). The host binary directory
 // is bind-mounted at runtime, so the binary lives outside the rootfs and the setup
 // survives `intuneme recreate` — the bind is re-established on demand.
-func runMCP(r runner.Runner, root, binaryPath string, serverArgs []string) error {
-	cfg, err := config.Load(root)
+func runMCP(ctx context.Context, r runner.Runner, root, binaryPath string, serverArgs []string) error {
+	cfg, err := loadConfig(root)
 	if err != nil {
 		return err
 	}
@@ -33,7 +33,7 @@ func runMCP(r runner.Runner, root, binaryPath string, serverArgs []string) error
 		return fmt.Errorf("not initialized — run 'intuneme init' first")
 	}
 
-	if !nspawn.IsRunning(r, cfg.MachineName) {
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
 		return fmt.Errorf("container is not running — run 'intuneme start' first")
 	}
 
@@ -61,7 +61,7 @@ func runMCP(r runner.Runner, root, binaryPath string, serverArgs []string) error
 
 	// Re-establish the runtime bind mount if the binary isn't visible inside the
 	// container (e.g. after a fresh start or recreate). Idempotent and passwordless.
-	if err := nspawn.EnsureBind(r, cfg.MachineName, cfg.HostUser,
+	if err := nspawn.EnsureBind(ctx, r, cfg.MachineName, cfg.HostUser,
 		hostDir, nspawn.MCPMountDir, containerBin); err != nil {
 		return err
 	}
@@ -85,7 +85,7 @@ func runMCP(r runner.Runner, root, binaryPath string, serverArgs []string) error
 	}
 	command := strings.Join(parts, " ")
 
-	return nspawn.ExecForeground(r, cfg.MachineName, cfg.HostUser, cfg.HostUID, command)
+	return nspawn.ExecForeground(ctx, r, cfg.MachineName, cfg.HostUser, cfg.HostUID, command)
 }
 
 var mcpCmd = &cobra.Command{
@@ -117,16 +117,13 @@ live in mcp_args.`,
 	SilenceUsage:  true,
 	SilenceErrors: false,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
-		return runMCP(r, root, mcpBinaryFlag, args)
+		return runMCP(ctx, r, root, mcpBinaryFlag, args)
 	},
 }
 
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,7 +40,7 @@ func (m *mcpMockRunner) Run(name string, args ...string) ([]byte, error) {
 			return nil, fmt.Errorf("machine not found")
 		}
 		return []byte("Name=intuneme\n"), nil
-	case name == "sudo" && len(args) > 0 && args[0] == nspawn.NsenterHelperPath:
+	case name == "sudo" && len(args) > 0 && args[0] == nspawn.NsenterHelperPath("intuneme"):
 		// EnsureBind probe (test -e <bin>), run via the nsenter helper.
 		return nil, m.probeErr
 	case name == "machinectl" && len(args) > 0 && args[0] == "bind":
@@ -51,6 +53,21 @@ func (m *mcpMockRunner) RunAttached(name string, args ...string) error {
 	m.attachedCalls = append(m.attachedCalls, append([]string{name}, args...))
 	return nil
 }
+
+func (m *mcpMockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mcpMockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mcpMockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mcpMockRunner) RunBackground(string, ...string) error { return nil }
 func (m *mcpMockRunner) LookPath(name string) (string, error) {
 	return "/usr/bin/" + name, nil
@@ -105,7 +122,7 @@ func initializedRoot(t *testing.T, skipBinary bool) (root, binary string) {
 
 func TestRunMCP_NotInitialized(t *testing.T) {
 	r := &mcpMockRunner{}
-	err := runMCP(r, t.TempDir(), "", nil)
+	err := runMCP(context.Background(), r, t.TempDir(), "", nil)
 	if err == nil || !strings.Contains(err.Error(), "not initialized") {
 		t.Fatalf("expected 'not initialized' error, got %v", err)
 	}
@@ -114,7 +131,7 @@ func TestRunMCP_NotInitialized(t *testing.T) {
 func TestRunMCP_NotRunning(t *testing.T) {
 	r := &mcpMockRunner{notRunning: true}
 	root, _ := initializedRoot(t, false)
-	err := runMCP(r, root, "", nil)
+	err := runMCP(context.Background(), r, root, "", nil)
 	if err == nil || !strings.Contains(err.Error(), "not running") {
 		t.Fatalf("expected 'not running' error, got %v", err)
 	}
@@ -123,7 +140,7 @@ func TestRunMCP_NotRunning(t *testing.T) {
 func TestRunMCP_NoBinaryConfigured(t *testing.T) {
 	r := &mcpMockRunner{}
 	root, _ := initializedRoot(t, true)
-	err := runMCP(r, root, "", nil)
+	err := runMCP(context.Background(), r, root, "", nil)
 	if err == nil || !strings.Contains(err.Error(), "no MCP server binary configured") {
 		t.Fatalf("expected 'no MCP server binary configured' error, got %v", err)
 	}
@@ -133,7 +150,7 @@ func TestRunMCP_BinaryNotFound(t *testing.T) {
 	r := &mcpMockRunner{}
 	root, _ := initializedRoot(t, true)
 	missing := filepath.Join(t.TempDir(), "does-not-exist")
-	err := runMCP(r, root, missing, nil)
+	err := runMCP(context.Background(), r, root, missing, nil)
 	if err == nil || !strings.Contains(err.Error(), "MCP binary not found") {
 		t.Fatalf("expected 'MCP binary not found' error, got %v", err)
 	}
@@ -143,7 +160,7 @@ func TestRunMCP_BindsAndLaunches(t *testing.T) {
 	// probeErr set => binary not yet visible => bind must happen.
 	r := &mcpMockRunner{probeErr: fmt.Errorf("not found")}
 	root, _ := initializedRoot(t, false)
-	if err := runMCP(r, root, "", nil); err != nil {
+	if err := runMCP(context.Background(), r, root, "", nil); err != nil {
 		t.Fatalf("runMCP returned error: %v", err)
 	}
 	if !r.bound() {
@@ -162,7 +179,7 @@ func TestRunMCP_SkipsBindWhenPresent(t *testing.T) {
 	// probeErr nil => already bound => no bind call, still launches.
 	r := &mcpMockRunner{probeErr: nil}
 	root, _ := initializedRoot(t, false)
-	if err := runMCP(r, root, "", nil); err != nil {
+	if err := runMCP(context.Background(), r, root, "", nil); err != nil {
 		t.Fatalf("runMCP returned error: %v", err)
 	}
 	if r.bound() {
@@ -176,7 +193,7 @@ func TestRunMCP_SkipsBindWhenPresent(t *testing.T) {
 func TestRunMCP_PassesArgsVerbatim(t *testing.T) {
 	r := &mcpMockRunner{probeErr: nil}
 	root, _ := initializedRoot(t, false)
-	if err := runMCP(r, root, "", []string{"foo", "bar"}); err != nil {
+	if err := runMCP(context.Background(), r, root, "", []string{"foo", "bar"}); err != nil {
 		t.Fatalf("runMCP returned error: %v", err)
 	}
 	cmd := r.lastForegroundCommand(t)
@@ -203,7 +220,7 @@ func TestRunMCP_UsesConfigArgsByDefault(t *testing.T) {
 		t.Fatal(err)
 	}
 	r := &mcpMockRunner{probeErr: nil}
-	if err := runMCP(r, root, "", nil); err != nil {
+	if err := runMCP(context.Background(), r, root, "", nil); err != nil {
 		t.Fatalf("runMCP returned error: %v", err)
 	}
 	cmd := r.lastForegroundCommand(t)
@@ -230,7 +247,7 @@ func TestRunMCP_TrailingArgsOverrideConfigArgs(t *testing.T) {
 		t.Fatal(err)
 	}
 	r := &mcpMockRunner{probeErr: nil}
-	if err := runMCP(r, root, "", []string{"serve"}); err != nil {
+	if err := runMCP(context.Background(), r, root, "", []string{"serve"}); err != nil {
 		t.Fatalf("runMCP returned error: %v", err)
 	}
 	cmd := r.lastForegroundCommand(t)
@@ -249,7 +266,7 @@ func TestRunMCP_CustomBinaryFlagOverridesConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 	r := &mcpMockRunner{probeErr: fmt.Errorf("not found")}
-	if err := runMCP(r, root, custom, nil); err != nil {
+	if err := runMCP(context.Background(), r, root, custom, nil); err != nil {
 		t.Fatalf("runMCP returned error: %v", err)
 	}
 	cmd := r.lastForegroundCommand(t)
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/mounts"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+var mountReadOnly bool
+
+var mountCmd = &cobra.Command{
+	Use:   "mount",
+	Short: "Manage extra host directories mounted into the container",
+	Long: `Manage extra bind mounts, stored as [[mounts]] tables in config.toml and
+mounted on every boot:
+
+  [[mounts]]
+  host = "~/work/docs"
+  container = "~/docs"
+  read_only = true
+
+"~/" means the host user's home in host and the container user's home in
+container. Binding / or your whole home directory is refused, as is mounting
+over the container home or its system directories.`,
+}
+
+var mountListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured bind mounts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+		if clix.OutputJSON(cfg.Mounts) {
+			return nil
+		}
+		if len(cfg.Mounts) == 0 {
+			rep.Message("No mounts configured.")
+			return nil
+		}
+		for _, m := range cfg.Mounts {
+			mode := "rw"
+			if m.ReadOnly {
+				mode = "ro"
+			}
+			rep.MessagePlain("%s -> %s (%s)", m.Host, m.Container, mode)
+		}
+		return nil
+	},
+}
+
+var mountAddCmd = &cobra.Command{
+	Use:   "add <host-dir> <container-dir>",
+	Short: "Add a bind mount, attaching it now if the container is running",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		r := newRunner()
+		if clix.DryRun {
+			cfg, err := loadConfig(root)
+			if err != nil {
+				return err
+			}
+			var printPlan func()
+			r, printPlan = startPlan(cmd.Context(), r, cfg)
+			defer printPlan()
+		}
+		return runMountAdd(cmd.Context(), r, root, config.Mount{Host: args[0], Container: args[1], ReadOnly: mountReadOnly})
+	},
+}
+
+var mountRemoveCmd = &cobra.Command{
+	Use:   "remove <container-dir|host-dir>",
+	Short: "Remove a bind mount, detaching it now if the container is running",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		r := newRunner()
+		if clix.DryRun {
+			cfg, err := loadConfig(root)
+			if err != nil {
+				return err
+			}
+			var printPlan func()
+			r, printPlan = startPlan(cmd.Context(), r, cfg)
+			defer printPlan()
+		}
+		return runMountRemove(cmd.Context(), r, root, args[0])
+	},
+}
+
+// runMountAdd validates m, saves it to config.toml and binds it into the
+// container if it is running.
+func runMountAdd(ctx context.Context, r runner.Runner, root string, m config.Mount) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	containerHome := fmt.Sprintf("/home/%s", cfg.HostUser)
+
+	// Relative host paths are relative to where the command runs.
+	if !filepath.IsAbs(m.Host) && m.Host != "~" && !strings.HasPrefix(m.Host, "~/") {
+		if m.Host, err = filepath.Abs(m.Host); err != nil {
+			return fmt.Errorf("resolve host path: %w", err)
+		}
+	}
+	bind, err := mounts.Resolve(m, home, containerHome)
+	if err != nil {
+		return err
+	}
+	if mounts.Find(cfg.Mounts, bind.Container, home, containerHome) >= 0 {
+		return fmt.Errorf("%s is already mounted — remove it first with 'intuneme mount remove %s'", bind.Container, bind.Container)
+	}
+
+	cfg.Mounts = append(cfg.Mounts, m)
+	if _, err := mounts.BindMounts(cfg.Mounts, home, containerHome); err != nil {
+		return err
+	}
+	if !runner.DryRun(r, "save config.toml with a mount of %s at %s", bind.Host, bind.Container) {
+		if err := cfg.Save(root); err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+	}
+
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		rep.Message("Saved. %s will be mounted at %s on the next 'intuneme start'.", bind.Host, bind.Container)
+		return nil
+	}
+	if err := nspawn.Bind(ctx, r, cfg.MachineName, bind); err != nil {
+		return fmt.Errorf("saved, but mounting into the running container failed: %w", err)
+	}
+	rep.Message("Mounted %s at %s.", bind.Host, bind.Container)
+	return nil
+}
+
+// runMountRemove deletes the mount at path (its container or host directory)
+// from config.toml and unmounts it if the container is running.
+func runMountRemove(ctx context.Context, r runner.Runner, root, path string) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	containerHome := fmt.Sprintf("/home/%s", cfg.HostUser)
+
+	i := mounts.Find(cfg.Mounts, path, home, containerHome)
+	if i < 0 {
+		return fmt.Errorf("no mount configured at %s — see 'intuneme mount list'", path)
+	}
+	container, err := mounts.Expand(cfg.Mounts[i].Container, containerHome)
+	if err != nil {
+		return err
+	}
+
+	cfg.Mounts = append(cfg.Mounts[:i], cfg.Mounts[i+1:]...)
+	if !runner.DryRun(r, "save config.toml without the mount at %s", container) {
+		if err := cfg.Save(root); err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+	}
+
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		rep.Message("Removed %s.", container)
+		return nil
+	}
+	if err := nspawn.Unbind(ctx, r, cfg.MachineName, container); err != nil {
+		return fmt.Errorf("removed, but unmounting from the running container failed: %w", err)
+	}
+	rep.Message("Removed and unmounted %s.", container)
+	return nil
+}
+
+func init() {
+	mountAddCmd.Flags().BoolVar(&mountReadOnly, "read-only", false, "mount the directory read-only")
+	mountCmd.AddCommand(mountListCmd, mountAddCmd, mountRemoveCmd)
+	rootCmd.AddCommand(mountCmd)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestMountAddRemove_Stopped(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, "work", "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	root, _ := initializedRoot(t, true)
+	r := &stopMockRunner{showFailAfter: 0}
+
+	m := config.Mount{Host: "~/work/docs", Container: "~/docs", ReadOnly: true}
+	if err := runMountAdd(context.Background(), r, root, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := runMountAdd(context.Background(), r, root, m); err == nil || !strings.Contains(err.Error(), "already mounted") {
+		t.Errorf("expected duplicate mount to be rejected, got %v", err)
+	}
+	if err := runMountAdd(context.Background(), r, root, config.Mount{Host: "~", Container: "/mnt/home"}); err == nil {
+		t.Error("expected binding the home directory to be rejected")
+	}
+
+	cfg, err := config.LoadProfile(root, profileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Mounts) != 1 || cfg.Mounts[0] != m {
+		t.Fatalf("mounts not saved: %+v", cfg.Mounts)
+	}
+
+	if err := runMountRemove(context.Background(), r, root, "/home/tester/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runMountRemove(context.Background(), r, root, "/home/tester/docs"); err == nil {
+		t.Error("expected removing an unknown mount to fail")
+	}
+	cfg, err = config.LoadProfile(root, profileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Mounts) != 0 {
+		t.Errorf("mount not removed: %+v", cfg.Mounts)
+	}
+}
+
+func TestMountAddRemove_Running(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	docs := filepath.Join(home, "docs")
+	if err := os.Mkdir(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	root, _ := initializedRoot(t, true)
+	rec := &runner.Recorder{}
+	rec.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+
+	m := config.Mount{Host: docs, Container: "/mnt/docs"}
+	if err := runMountAdd(context.Background(), rec, root, m); err != nil {
+		t.Fatal(err)
+	}
+	last := rec.Steps[len(rec.Steps)-1].String()
+	if want := "machinectl bind --mkdir intuneme " + docs + " /mnt/docs"; last != want {
+		t.Errorf("last command = %q, want %q", last, want)
+	}
+	// A Recorder is a dry run: config.toml must be left alone.
+	cfg, err := config.LoadProfile(root, profileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Mounts) != 0 {
+		t.Fatalf("dry run saved mounts: %+v", cfg.Mounts)
+	}
+
+	cfg.Mounts = []config.Mount{m}
+	if err := cfg.Save(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runMountRemove(context.Background(), rec, root, docs); err != nil {
+		t.Fatal(err)
+	}
+	last = rec.Steps[len(rec.Steps)-1].String()
+	if !strings.Contains(last, "nsenter-exec 4321") || !strings.Contains(last, "umount") {
+		t.Errorf("last command = %q, want an nsenter umount", last)
+	}
+}
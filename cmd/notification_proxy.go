@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/frostyard/intuneme/internal/broker"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/notify"
+	"github.com/spf13/cobra"
+)
+
+var notificationProxyCmd = &cobra.Command{
+	Use:   "notification-proxy",
+	Short: "Run the desktop notification proxy (foreground)",
+	Long: `Owns org.freedesktop.Notifications on the container's session bus and forwards
+notifications from container apps (Intune compliance warnings, Edge downloads,
+Teams messages) to the host's notification server. Closing a notification or
+clicking one of its actions on the host is passed back to the app.
+
+'intuneme start' runs it when notifications = true is set in config.toml. It
+exits when the container stops.
+
+Output is also appended to notification-proxy.log in the data root; view it
+with 'intuneme logs --unit notifications'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		if !cfg.Notifications {
+			return fmt.Errorf("notification forwarding is not enabled — run 'intuneme config notifications enable' first")
+		}
+
+		home, err := config.IntuneHome(profileName)
+		if err != nil {
+			return err
+		}
+
+		logFile, err := broker.OpenLog(notify.LogPath(root))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = logFile.Close() }()
+
+		pidPath := notify.PIDPath(root)
+		if err := broker.WritePIDFile(pidPath); err != nil {
+			return fmt.Errorf("write pid file: %w", err)
+		}
+		defer func() { _ = os.Remove(pidPath) }()
+
+		return notify.Run(cmd.Context(), root, notify.Paths{
+			Rootfs:        cfg.RootfsPath,
+			Home:          home,
+			ContainerHome: "/home/" + cfg.HostUser,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(notificationProxyCmd)
+}
@@ -1,18 +1,37 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
-	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/apps"
 	"github.com/frostyard/intuneme/internal/nspawn"
-	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/urlhandler"
 	"github.com/spf13/cobra"
 )
 
 var openCmd = &cobra.Command{
-	Use:   "open",
+	Use:   "open <app-id>",
 	Short: "Launch an application inside the running container",
+	Long: `Launch an application inside the running container: Edge or Intune Portal
+with the subcommands below, or any application by the ID 'intuneme app list'
+shows, e.g. 'intuneme open microsoft-edge'.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return cmd.Help()
+		}
+		cfg, home, err := loadAppContext()
+		if err != nil {
+			return err
+		}
+		app, err := apps.Find(cfg.RootfsPath, home, currentProfile(), args[0])
+		if err != nil {
+			return err
+		}
+		return openInContainer(cmd.Context(), app.Command())
+	},
 }
 
 func makeOpenAppCmd(use, short, command string) *cobra.Command {
@@ -20,32 +39,82 @@ func makeOpenAppCmd(use, short, command string) *cobra.Command {
 		Use:   use,
 		Short: short,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			r := &runner.SystemRunner{}
-			root := rootDir
-			if root == "" {
-				var err error
-				root, err = config.DefaultRoot()
-				if err != nil {
-					return err
-				}
-			}
+			return openInContainer(cmd.Context(), command)
+		},
+	}
+}
+
+// openInContainer launches command in the running container of the current
+// profile, resuming it first if it is paused.
+func openInContainer(ctx context.Context, command string) error {
+	r := newRunner()
+	root, err := resolveRoot()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(cfg.RootfsPath); err != nil {
+		return fmt.Errorf("not initialized — run 'intuneme init' first")
+	}
+
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		return fmt.Errorf("container is not running — run 'intuneme start' first")
+	}
+	if err := resumeIfPaused(ctx, r, cfg.MachineName); err != nil {
+		return err
+	}
 
-			cfg, err := config.Load(root)
+	return nspawn.Exec(ctx, r, cfg.MachineName, cfg.HostUser, cfg.HostUID, command)
+}
+
+var openURLRoute bool
+
+var openURLCmd = &cobra.Command{
+	Use:   "url <url>",
+	Short: "Open a URL in Microsoft Edge inside the container",
+	Long: `Open an http or https URL in the container's Microsoft Edge.
+
+With --route, only URLs whose host is on the domains allowlist of the
+[url_handler] table in config.toml open in the container; every other URL
+opens in the host browser, as do allowlisted URLs while the container is
+stopped. This is what the link handler installed by
+'intuneme config url-handler enable' runs.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		u, err := urlhandler.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		if openURLRoute {
+			root, err := resolveRoot()
 			if err != nil {
 				return err
 			}
-
-			if _, err := os.Stat(cfg.RootfsPath); err != nil {
-				return fmt.Errorf("not initialized — run 'intuneme init' first")
+			cfg, err := loadConfig(root)
+			if err != nil {
+				return err
 			}
-
-			if !nspawn.IsRunning(r, cfg.MachineName) {
-				return fmt.Errorf("container is not running — run 'intuneme start' first")
+			r := newRunner()
+			if !urlhandler.Match(cfg.URLHandler.Domains, u) {
+				if cfg.URLHandler.HostBrowser == "" {
+					return fmt.Errorf("%s is not on the [url_handler] allowlist and no host_browser is set in config.toml", u.Host)
+				}
+				return urlhandler.OpenOnHost(cmd.Context(), r, cfg.URLHandler.HostBrowser, u)
 			}
-
-			return nspawn.Exec(r, cfg.MachineName, cfg.HostUser, cfg.HostUID, command)
-		},
-	}
+			// A click with the container stopped would otherwise be lost:
+			// there is no terminal to show the error in.
+			if cfg.URLHandler.HostBrowser != "" && !nspawn.IsRunning(cmd.Context(), r, cfg.MachineName) {
+				rep.Warning("container is not running; opening %s in the host browser", u.Host)
+				return urlhandler.OpenOnHost(cmd.Context(), r, cfg.URLHandler.HostBrowser, u)
+			}
+		}
+		return openInContainer(cmd.Context(), "microsoft-edge "+nspawn.ShellQuote(u.String()))
+	},
 }
 
 func init() {
@@ -59,5 +128,7 @@ func init() {
 		"Launch Intune Portal inside the container",
 		"intune-portal",
 	))
+	openURLCmd.Flags().BoolVar(&openURLRoute, "route", false, "open URLs not on the allowlist in the host browser")
+	openCmd.AddCommand(openURLCmd)
 	rootCmd.AddCommand(openCmd)
 }
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Freeze the running container to save battery",
+	Long: `Freeze every process in the running container with the cgroup freezer.
+The container keeps its memory, so 'intuneme resume' continues exactly where
+it left off without the slow re-enrollment checks and Edge session restore of
+a fresh start, but it uses no CPU while paused.
+
+While paused, host apps calling the broker get a "container paused" error
+unless auto_resume is set in the [pause] table of config.toml. 'intuneme open',
+'exec' and 'shell' resume the container automatically.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		return runPause(cmd.Context(), newRunner(), root)
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume a paused container",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		return runResume(cmd.Context(), newRunner(), root)
+	},
+}
+
+// runPause freezes the running container.
+func runPause(ctx context.Context, r runner.Runner, root string) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		return fmt.Errorf("container %s is not running", cfg.MachineName)
+	}
+	if nspawn.IsPaused(ctx, r, cfg.MachineName) {
+		rep.Message("Container is already paused.")
+		return nil
+	}
+	if err := nspawn.Pause(ctx, r, cfg.MachineName); err != nil {
+		return err
+	}
+	rep.Message("Container paused. Run 'intuneme resume' to continue.")
+	return nil
+}
+
+// runResume thaws a paused container.
+func runResume(ctx context.Context, r runner.Runner, root string) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		return fmt.Errorf("container %s is not running — start it with 'intuneme start'", cfg.MachineName)
+	}
+	if !nspawn.IsPaused(ctx, r, cfg.MachineName) {
+		rep.Message("Container is not paused.")
+		return nil
+	}
+	if err := nspawn.Resume(ctx, r, cfg.MachineName); err != nil {
+		return err
+	}
+	// The display or audio may have changed while the container was frozen,
+	// when 'session refresh' skips it.
+	if err := refreshSession(ctx, r, root, cfg.MachineName, cfg.HostUID); err != nil {
+		rep.Warning("refresh session: %v", err)
+	}
+	rep.Message("Container resumed.")
+	return nil
+}
+
+// resumeIfPaused thaws the running container before a command that needs it
+// to respond, such as launching an app in it.
+func resumeIfPaused(ctx context.Context, r runner.Runner, machine string) error {
+	if !nspawn.IsPaused(ctx, r, machine) {
+		return nil
+	}
+	rep.Message("Resuming paused container...")
+	return nspawn.Resume(ctx, r, machine)
+}
+
+func init() {
+	rootCmd.AddCommand(pauseCmd, resumeCmd)
+}
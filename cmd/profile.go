@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/spf13/cobra"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage named container profiles",
+	Long: `Profiles let several fully isolated Intune containers run side by side,
+for example one per tenant. Select a profile with the global --profile flag:
+
+  intuneme --profile clienta init
+  intuneme --profile clienta start
+
+Each profile has its own data root (~/.local/share/intuneme-<profile>), home
+directory (~/Intune-<profile>), machine name (intuneme-<profile>), broker runtime
+directory, udev hotplug rules, polkit rule and sudoers entry. Without --profile,
+the "default" profile uses the original single-container locations.
+
+Only one profile at a time can enable the broker proxy, because the identity
+broker name can be owned only once on the host session bus.`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List initialized profiles and their container status",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		ctx := cmd.Context()
+
+		profiles, err := config.Profiles()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		type profileInfo struct {
+			Name      string `json:"name"`
+			Root      string `json:"root"`
+			Machine   string `json:"machine"`
+			Container string `json:"container"`
+		}
+		var infos []profileInfo
+		for _, p := range profiles {
+			root, err := config.ProfileRoot(p)
+			if err != nil {
+				return err
+			}
+			cfg, err := config.LoadProfile(root, p)
+			if err != nil {
+				return err
+			}
+			status := "stopped"
+			if nspawn.IsRunning(ctx, r, cfg.MachineName) {
+				status = "running"
+			}
+			infos = append(infos, profileInfo{Name: p, Root: root, Machine: cfg.MachineName, Container: status})
+		}
+
+		if clix.OutputJSON(infos) {
+			return nil
+		}
+
+		if len(infos) == 0 {
+			rep.Message("No profiles initialized. Run 'intuneme [--profile <name>] init' to create one.")
+			return nil
+		}
+		for _, info := range infos {
+			rep.MessagePlain("%-16s %-24s %s", info.Name, info.Machine, info.Container)
+		}
+		return nil
+	},
+}
+
+func init() {
+	profileCmd.AddCommand(profileListCmd)
+	rootCmd.AddCommand(profileCmd)
+}
@@ -1,18 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	"github.com/frostyard/clix"
 	"github.com/frostyard/intuneme/internal/broker"
-	"github.com/frostyard/intuneme/internal/config"
 	"github.com/frostyard/intuneme/internal/nspawn"
 	"github.com/frostyard/intuneme/internal/provision"
 	"github.com/frostyard/intuneme/internal/puller"
 	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/snapshot"
 	pkgversion "github.com/frostyard/intuneme/internal/version"
 	"github.com/spf13/cobra"
 )
@@ -24,17 +26,14 @@ var recreateCmd = &cobra.Command{
 	Use:   "recreate",
 	Short: "Recreate the container with a fresh image, preserving enrollment state",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
@@ -50,30 +49,37 @@ var recreateCmd = &cobra.Command{
 		}
 
 		if clix.DryRun {
-			rep.Message("[dry-run] Would stop container (if running)")
-			rep.Message("[dry-run] Would backup shadow entry and broker state")
-			rep.Message("[dry-run] Would remove old rootfs at %s", cfg.RootfsPath)
-			rep.Message("[dry-run] Would pull new image and re-provision")
-			return nil
+			var printPlan func()
+			r, printPlan = startPlan(ctx, r, cfg)
+			defer printPlan()
 		}
 
 		// Validate sudo early
 		rep.Message("Checking sudo credentials...")
-		if err := nspawn.ValidateSudo(r); err != nil {
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
 			return fmt.Errorf("sudo authentication failed: %w", err)
 		}
 
 		// Stop container if running
-		if nspawn.IsRunning(r, cfg.MachineName) {
+		if nspawn.IsRunning(ctx, r, cfg.MachineName) {
 			if cfg.BrokerProxy {
 				pidPath := filepath.Join(root, "broker-proxy.pid")
-				broker.StopByPIDFile(pidPath)
+				if !runner.DryRun(r, "stop the broker proxy in %s", pidPath) {
+					broker.StopByPIDFile(pidPath)
+				}
 				rep.Message("Broker proxy stopped.")
 			}
+			if cfg.Notifications {
+				stopNotificationProxy(r, root)
+			}
 			rep.Message("Stopping container...")
-			if err := nspawn.Stop(r, cfg.MachineName); err != nil {
+			if err := nspawn.Stop(ctx, r, cfg.MachineName); err != nil {
 				return fmt.Errorf("failed to stop container: %w", err)
 			}
+			// The rootfs is about to be moved, so wait until nspawn has let go of it.
+			if !nspawn.WaitForMachine(ctx, r, cfg.MachineName, false, 500*time.Millisecond, 30*time.Second) {
+				return fmt.Errorf("container %s did not stop within 30s", cfg.MachineName)
+			}
 			rep.Message("Container stopped.")
 		}
 
@@ -81,7 +87,7 @@ var recreateCmd = &cobra.Command{
 		if clix.Verbose {
 			rep.Message("Backing up shadow entry...")
 		}
-		shadowLine, err := provision.BackupShadowEntry(r, cfg.RootfsPath, u.Username)
+		shadowLine, err := provision.BackupShadowEntry(ctx, r, cfg.RootfsPath, u.Username)
 		if err != nil {
 			return fmt.Errorf("backup shadow entry: %w", err)
 		}
@@ -89,7 +95,7 @@ var recreateCmd = &cobra.Command{
 		if clix.Verbose {
 			rep.Message("Backing up device broker state...")
 		}
-		brokerBackupDir, err := provision.BackupDeviceBrokerState(r, cfg.RootfsPath)
+		brokerBackupDir, err := provision.BackupDeviceBrokerState(ctx, r, cfg.RootfsPath)
 		if err != nil {
 			return fmt.Errorf("backup device broker state: %w", err)
 		}
@@ -104,63 +110,113 @@ var recreateCmd = &cobra.Command{
 			}
 		}
 
-		// Remove old rootfs
-		rep.Message("Removing old rootfs at %s...", cfg.RootfsPath)
-		out, err := r.Run("sudo", "rm", "-rf", cfg.RootfsPath)
+		// Snapshot the old rootfs so a failed pull or provision can be undone
+		rep.Message("Snapshotting old rootfs...")
+		snap, err := snapshot.Take(r, cfg.RootfsPath, "recreate", time.Now())
 		if err != nil {
-			return fmt.Errorf("rm rootfs failed: %w\n%s", err, out)
+			return fmt.Errorf("snapshot rootfs: %w", err)
+		}
+		if clix.Verbose {
+			rep.Message("Saved snapshot %s (%s).", snap.ID, snap.Method)
 		}
 
-		// Pull new image
+		insiders := cfg.Insiders
 		if cmd.Flags().Changed("insiders") {
-			cfg.Insiders = insidersRecreate
-			if err := cfg.Save(root); err != nil {
-				return fmt.Errorf("save config: %w", err)
-			}
+			insiders = insidersRecreate
 		}
-		image := pkgversion.ImageRef(cfg.Insiders)
-		p, err := puller.Detect(r)
-		if err != nil {
+		if err := rebuildRootfs(ctx, r, cfg.RootfsPath, cfg.MachineName, u.Username, insiders, shadowLine, brokerBackupDir); err != nil {
+			if clix.DryRun {
+				// Nothing was moved, so there is nothing to restore.
+				return err
+			}
+			rep.Warning("Recreate failed, restoring snapshot %s...", snap.ID)
+			if rerr := restoreSnapshot(r, snap, cfg.RootfsPath); rerr != nil {
+				return fmt.Errorf("%w (restoring the previous rootfs also failed: %v — run 'intuneme rollback %s')", err, rerr, snap.ID)
+			}
+			rep.Message("Previous rootfs restored.")
 			return err
 		}
 
-		rep.Message("Pulling and extracting OCI image %s (via %s)...", image, p.Name())
-		if err := os.MkdirAll(cfg.RootfsPath, 0755); err != nil {
-			return fmt.Errorf("create rootfs dir: %w", err)
-		}
-		if err := p.PullAndExtract(r, image, cfg.RootfsPath, tmpDirRecreate); err != nil {
-			return err
+		// Only switch channels once the new image is in place
+		if insiders != cfg.Insiders && !runner.DryRun(r, "save config.toml with insiders = %t", insiders) {
+			cfg.Insiders = insiders
+			if err := cfg.Save(root); err != nil {
+				return fmt.Errorf("save config: %w", err)
+			}
 		}
 
-		// Re-provision
-		hostname, _ := os.Hostname()
-
-		if err := provision.ProvisionContainer(r, rep, cfg.RootfsPath, u.Username, os.Getuid(), os.Getgid(), hostname); err != nil {
-			return err
+		removed, err := snapshot.Prune(r, cfg.RootfsPath, snapshot.DefaultKeep)
+		if err != nil {
+			rep.Warning("prune snapshots failed: %v", err)
 		}
-
-		// Restore state
 		if clix.Verbose {
-			rep.Message("Restoring shadow entry...")
-		}
-		if err := provision.RestoreShadowEntry(r, cfg.RootfsPath, shadowLine); err != nil {
-			return fmt.Errorf("restore shadow entry: %w", err)
-		}
-
-		if brokerBackupDir != "" {
-			if clix.Verbose {
-				rep.Message("Restoring device broker state...")
-			}
-			if err := provision.RestoreDeviceBrokerState(r, cfg.RootfsPath, brokerBackupDir); err != nil {
-				rep.Warning("restore device broker state failed: %v", err)
+			for _, s := range removed {
+				rep.Message("Deleted old snapshot %s.", s.ID)
 			}
 		}
 
 		rep.Message("Container recreated. Run 'intuneme start' to boot.")
+		rep.Message("The previous rootfs is kept as snapshot %s; 'intuneme rollback' restores it.", snap.ID)
 		return nil
 	},
 }
 
+// rebuildRootfs replaces the rootfs with a freshly pulled and provisioned
+// image and restores the user's shadow entry and device broker state into it.
+func rebuildRootfs(ctx context.Context, r runner.Runner, rootfs, machine, username string, insiders bool, shadowLine, brokerBackupDir string) error {
+	// A btrfs snapshot leaves the old rootfs in place
+	if err := snapshot.RemoveTree(r, rootfs); err != nil {
+		return err
+	}
+
+	image := pkgversion.ImageRef(insiders)
+	p, err := puller.Detect(r)
+	if err != nil {
+		return err
+	}
+
+	rep.Message("Pulling and extracting OCI image %s (via %s)...", image, p.Name())
+	if err := snapshot.CreateRootfs(r, rootfs); err != nil {
+		return err
+	}
+	if err := p.PullAndExtract(ctx, r, image, rootfs, tmpDirRecreate); err != nil {
+		return err
+	}
+
+	// Re-provision
+	hostname, _ := os.Hostname()
+
+	if err := provision.ProvisionContainer(ctx, r, rep, rootfs, machine, username, os.Getuid(), os.Getgid(), hostname); err != nil {
+		return err
+	}
+
+	// Restore state
+	if clix.Verbose {
+		rep.Message("Restoring shadow entry...")
+	}
+	if err := provision.RestoreShadowEntry(ctx, r, rootfs, shadowLine); err != nil {
+		return fmt.Errorf("restore shadow entry: %w", err)
+	}
+
+	if brokerBackupDir != "" {
+		if clix.Verbose {
+			rep.Message("Restoring device broker state...")
+		}
+		if err := provision.RestoreDeviceBrokerState(ctx, r, rootfs, brokerBackupDir); err != nil {
+			rep.Warning("restore device broker state failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// restoreSnapshot discards whatever is at rootfs and puts snap back.
+func restoreSnapshot(r runner.Runner, snap *snapshot.Snapshot, rootfs string) error {
+	if err := snapshot.RemoveTree(r, rootfs); err != nil {
+		return err
+	}
+	return snapshot.Restore(r, snap, rootfs)
+}
+
 func init() {
 	recreateCmd.Flags().BoolVar(&insidersRecreate, "insiders", false, "switch to the insiders channel container image")
 	recreateCmd.Flags().StringVar(&tmpDirRecreate, "tmp-dir", "", "directory for temporary files during image extraction (default: system temp dir)")
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/resources"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+var resourcesCmd = &cobra.Command{
+	Use:   "resources",
+	Short: "Manage container resource limits",
+	Long: `Manage the cgroup limits applied to the container, stored in the
+[resources] table of config.toml and passed to systemd-nspawn on every boot:
+
+  memory_max   hard memory limit, e.g. 8G or 50%
+  memory_high  memory throttling threshold, e.g. 6G
+  cpu_quota    CPU time relative to one CPU, e.g. 200% for two CPUs
+  io_weight    relative block IO weight, 1 to 10000 (default 100)
+  tasks_max    maximum number of processes and threads
+
+'intuneme status' shows current usage.`,
+}
+
+var resourcesSetCmd = &cobra.Command{
+	Use:   "set <key>=<value>...",
+	Short: "Set resource limits, applying them live if the container is running",
+	Long: `Set resource limits in config.toml. An empty value (memory_max=) removes a
+limit. If the container is running, the new limits are also applied to it
+immediately with systemctl set-property.
+
+  intuneme resources set memory_max=8G cpu_quota=200%`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		r := newRunner()
+		if clix.DryRun {
+			cfg, err := loadConfig(root)
+			if err != nil {
+				return err
+			}
+			var printPlan func()
+			r, printPlan = startPlan(cmd.Context(), r, cfg)
+			defer printPlan()
+		}
+		return runResourcesSet(cmd.Context(), r, root, args)
+	},
+}
+
+// runResourcesSet saves the key=value assignments to config.toml and applies
+// them to the container if it is running.
+func runResourcesSet(ctx context.Context, r runner.Runner, root string, assignments []string) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+
+	var props []string
+	for _, a := range assignments {
+		prop, err := resources.Set(&cfg.Resources, a)
+		if err != nil {
+			return err
+		}
+		props = append(props, prop)
+	}
+	if !runner.DryRun(r, "save config.toml with %s", strings.Join(assignments, " ")) {
+		if err := cfg.Save(root); err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+	}
+
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		rep.Message("Saved. The limits apply on the next 'intuneme start'.")
+		return nil
+	}
+	if err := resources.Apply(ctx, r, cfg.MachineName, props); err != nil {
+		return fmt.Errorf("saved, but applying to the running container failed: %w", err)
+	}
+	rep.Message("Applied %s.", strings.Join(props, " "))
+	return nil
+}
+
+func init() {
+	resourcesCmd.AddCommand(resourcesSetCmd)
+	rootCmd.AddCommand(resourcesCmd)
+}
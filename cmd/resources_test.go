@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestResourcesSet_Stopped(t *testing.T) {
+	root := t.TempDir()
+	r := &stopMockRunner{showFailAfter: 0}
+	if err := runResourcesSet(context.Background(), r, root, []string{"memory_max=8G", "tasks_max=4096"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadProfile(root, profileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Resources.MemoryMax != "8G" || cfg.Resources.TasksMax != 4096 {
+		t.Errorf("resources not saved: %+v", cfg.Resources)
+	}
+
+	if err := runResourcesSet(context.Background(), r, root, []string{"cpu_quota=lots"}); err == nil {
+		t.Error("expected an invalid value to be rejected")
+	}
+}
+
+func TestResourcesSet_Running(t *testing.T) {
+	rec := &runner.Recorder{}
+	rec.Answer("machinectl show intuneme -p Unit", runner.Reply{Output: "machine-intuneme.scope\n"})
+	root := t.TempDir()
+	if err := runResourcesSet(context.Background(), rec, root, []string{"memory_max=", "io_weight=50"}); err != nil {
+		t.Fatal(err)
+	}
+	last := rec.Steps[len(rec.Steps)-1].String()
+	want := "sudo systemctl set-property --runtime machine-intuneme.scope MemoryMax=infinity IOWeight=50"
+	if last != want {
+		t.Errorf("last command = %q, want %q", last, want)
+	}
+	// A Recorder is a dry run: config.toml must not be written.
+	if _, err := os.Stat(filepath.Join(root, "config.toml")); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote config.toml: %v", err)
+	}
+}
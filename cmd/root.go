@@ -2,11 +2,15 @@ package cmd
 
 import (
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/audit"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/frostyard/std/reporter"
 	"github.com/spf13/cobra"
 )
 
 var rootDir string
+var profileName string
 var rep reporter.Reporter
 
 var rootCmd = &cobra.Command{
@@ -14,7 +18,7 @@ var rootCmd = &cobra.Command{
 	Short: "Manage an Intune container on an immutable Linux host",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		rep = clix.NewReporter()
-		return nil
+		return config.ValidateProfile(profileName)
 	},
 }
 
@@ -22,6 +26,41 @@ func RootCmd() *cobra.Command {
 	return rootCmd
 }
 
+// resolveRoot returns the data root for the selected profile. An explicit
+// --root always wins; otherwise each profile has its own directory.
+func resolveRoot() (string, error) {
+	if rootDir != "" {
+		return rootDir, nil
+	}
+	return config.ProfileRoot(profileName)
+}
+
+// loadConfig loads config.toml from root, defaulting fields such as the machine
+// name for the selected profile.
+func loadConfig(root string) (*config.Config, error) {
+	return config.LoadProfile(root, profileName)
+}
+
+// newRunner returns the runner commands execute system commands with.
+// Privileged invocations are appended to the audit log under the data root.
+func newRunner() runner.Runner {
+	r := &runner.SystemRunner{}
+	root, err := resolveRoot()
+	if err != nil {
+		return r
+	}
+	return audit.NewRunner(r, root)
+}
+
+// currentProfile returns the selected profile name, never empty.
+func currentProfile() string {
+	if profileName == "" {
+		return config.DefaultProfile
+	}
+	return profileName
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringVar(&rootDir, "root", "", "root directory for intuneme data (default ~/.local/share/intuneme)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "named container profile; each profile is a fully isolated container (default \"default\")")
 }
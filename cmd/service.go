@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/autostart"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/spf13/cobra"
+)
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage the systemd service unit for the container",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Run the container as a managed systemd service",
+	Long: `Install a systemd service unit that boots the container with the same
+systemd-nspawn arguments 'intuneme start' would use.
+
+Once installed, 'intuneme start' boots the container through systemctl instead
+of a detached sudo process, so systemd supervises it: console output goes to
+the journal (journalctl -u <machine>.service), a reboot inside the container
+restarts it, and a crash is retried. 'intuneme stop' is unchanged.
+
+Display sockets and GPU devices can change between logins, so 'intuneme start'
+regenerates the unit whenever the arguments differ. For the same reason the
+unit cannot be enabled to start at boot, before anyone has logged in: use
+'intuneme autostart enable' to boot the container at login instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		boot, err := prepareBoot(r, root, cfg)
+		if err != nil {
+			return err
+		}
+
+		if clix.DryRun {
+			rep.Message("[dry-run] Would install %s", nspawn.UnitPath(cfg.MachineName))
+			return nil
+		}
+
+		rep.Message("Checking sudo credentials...")
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
+			return fmt.Errorf("sudo authentication failed: %w", err)
+		}
+
+		if err := nspawn.SetupNetwork(ctx, r, cfg.RootfsPath, boot.network); err != nil {
+			return err
+		}
+
+		bootArgs := nspawn.BuildBootArgs(cfg.RootfsPath, cfg.MachineName, boot.intuneHome, boot.containerHome, boot.sockets, boot.nvidiaDevices, boot.network, boot.userNS, boot.properties)
+		if _, err := nspawn.InstallUnit(ctx, r, cfg.MachineName, bootArgs, boot.postStart); err != nil {
+			return err
+		}
+
+		// Older versions could enable the unit, which then failed at every
+		// boot on the missing session sockets.
+		if _, err := r.RunContext(ctx, "systemctl", "is-enabled", "--quiet", nspawn.UnitName(cfg.MachineName)); err == nil {
+			if out, err := r.RunContext(ctx, "sudo", "systemctl", "disable", nspawn.UnitName(cfg.MachineName)); err != nil {
+				return fmt.Errorf("systemctl disable failed: %w\n%s", err, out)
+			}
+		}
+
+		rep.Message("Installed %s.", nspawn.UnitPath(cfg.MachineName))
+		if nspawn.IsRunning(ctx, r, cfg.MachineName) {
+			rep.Message("The running container is not managed by the unit yet; it will be after the next 'intuneme stop' and 'intuneme start'.")
+		}
+		return nil
+	},
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the systemd service unit for the container",
+	Long: `Disable and remove the service unit installed by 'intuneme service install'.
+'intuneme start' goes back to booting the container as a detached process.
+A container currently running under the unit keeps running until stopped.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		if !nspawn.UnitInstalled(cfg.MachineName) {
+			rep.Message("No service unit installed — nothing to remove.")
+			return nil
+		}
+		if autostart.Enabled(cfg.MachineName) {
+			return fmt.Errorf("autostart boots the container through this unit — run 'intuneme autostart disable' first")
+		}
+
+		if clix.DryRun {
+			rep.Message("[dry-run] Would remove %s", nspawn.UnitPath(cfg.MachineName))
+			return nil
+		}
+
+		rep.Message("Checking sudo credentials...")
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
+			return fmt.Errorf("sudo authentication failed: %w", err)
+		}
+
+		if err := nspawn.RemoveUnit(ctx, r, cfg.MachineName); err != nil {
+			return err
+		}
+
+		rep.Message("Removed %s.", nspawn.UnitPath(cfg.MachineName))
+		return nil
+	},
+}
+
+func init() {
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
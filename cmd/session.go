@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage the container's connection to the desktop session",
+}
+
+var sessionRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Reconnect the running container to the current display and audio",
+	Long: `Reconnect the running container to the host's current graphical session
+without restarting it. Use this when container apps can no longer open windows
+or play audio after logging out and back in, changing monitors, or Xwayland
+picking a new auth file.
+
+It rewrites the container's DISPLAY, re-binds the current Xauthority, Wayland,
+PipeWire and PulseAudio sockets, and updates the environment that D-Bus
+activated services such as the identity broker start with. The GNOME extension
+runs it automatically at login and when monitors change.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		return runSessionRefresh(cmd.Context(), newRunner(), root)
+	},
+}
+
+// runSessionRefresh rebinds the host session sockets into the running
+// container and updates its session environment.
+func runSessionRefresh(ctx context.Context, r runner.Runner, root string) error {
+	cfg, err := loadConfig(root)
+	if err != nil {
+		return err
+	}
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
+		return fmt.Errorf("container %s is not running — start it with 'intuneme start'", cfg.MachineName)
+	}
+	// Entering a frozen container would block until it is thawed, and
+	// resuming it here would undo a pause on every monitor change.
+	// 'intuneme resume' refreshes the session instead.
+	if nspawn.IsPaused(ctx, r, cfg.MachineName) {
+		rep.Message("Container is paused; 'intuneme resume' refreshes its session.")
+		return nil
+	}
+	return refreshSession(ctx, r, root, cfg.MachineName, cfg.HostUID)
+}
+
+// refreshSession rebinds the host session sockets into the container and
+// records the new session.
+func refreshSession(ctx context.Context, r runner.Runner, root, machine string, uid int) error {
+	session, err := nspawn.RefreshSession(ctx, r, machine, uid)
+	if err != nil {
+		return err
+	}
+	if err := nspawn.SaveSession(root, *session); err != nil {
+		rep.Warning("record session: %v", err)
+	}
+	if clix.Verbose {
+		for _, m := range session.Sockets.Mounts() {
+			rep.Message("Bound %s at %s", m.Host, m.Container)
+		}
+	}
+	rep.Message("Session refreshed (DISPLAY=%s).", session.Display)
+	return nil
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionRefreshCmd)
+	rootCmd.AddCommand(sessionCmd)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestRunSessionRefresh_Paused(t *testing.T) {
+	root, _ := initializedRoot(t, true)
+	rec := &runner.Recorder{}
+	rec.Answer("machinectl show intuneme -p Unit", runner.Reply{Output: "machine-intuneme.scope\n"})
+	rec.Answer("systemctl show machine-intuneme.scope -p FreezerState", runner.Reply{Output: "frozen\n"})
+	if err := runSessionRefresh(context.Background(), rec, root); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range rec.Steps {
+		if line := s.String(); strings.Contains(line, "nsenter") || strings.HasPrefix(line, "machinectl bind") {
+			t.Errorf("a paused container should not be entered, ran %q", line)
+		}
+	}
+}
@@ -4,9 +4,7 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/frostyard/intuneme/internal/config"
 	"github.com/frostyard/intuneme/internal/nspawn"
-	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/spf13/cobra"
 )
 
@@ -14,17 +12,14 @@ var shellCmd = &cobra.Command{
 	Use:   "shell",
 	Short: "Open a shell in the running container",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
@@ -33,11 +28,14 @@ var shellCmd = &cobra.Command{
 			return fmt.Errorf("not initialized — run 'intuneme init' first")
 		}
 
-		if !nspawn.IsRunning(r, cfg.MachineName) {
+		if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
 			return fmt.Errorf("container is not running — run 'intuneme start' first")
 		}
+		if err := resumeIfPaused(ctx, r, cfg.MachineName); err != nil {
+			return err
+		}
 
-		return nspawn.Shell(r, cfg.MachineName, cfg.HostUser)
+		return nspawn.Shell(ctx, r, cfg.MachineName, cfg.HostUser)
 	},
 }
 
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "Manage rootfs snapshots",
+	Long: `'intuneme recreate' snapshots the old rootfs before replacing it, and
+'intuneme rollback' snapshots the current one before restoring another.
+Snapshots live next to the rootfs in a snapshots/ directory.
+
+On btrfs, when the rootfs is a subvolume, snapshots are copy-on-write and
+cost almost nothing. Elsewhere the old rootfs is moved aside as-is and takes
+its full size on disk. recreate keeps the two newest snapshots.`,
+}
+
+var snapshotsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List rootfs snapshots, newest first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		snaps, err := snapshot.List(cfg.RootfsPath)
+		if err != nil {
+			return err
+		}
+		if clix.OutputJSON(snaps) {
+			return nil
+		}
+		if len(snaps) == 0 {
+			rep.Message("No snapshots.")
+			return nil
+		}
+		for _, s := range snaps {
+			rep.MessagePlain("%-22s %-20s %-10s %s", s.ID, s.Created.Local().Format("2006-01-02 15:04:05"), s.Method, s.Reason)
+		}
+		return nil
+	},
+}
+
+var snapshotsDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete rootfs snapshots",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		var snaps []*snapshot.Snapshot
+		for _, id := range args {
+			s, err := snapshot.Find(cfg.RootfsPath, id)
+			if err != nil {
+				return err
+			}
+			snaps = append(snaps, s)
+		}
+
+		if clix.DryRun {
+			for _, s := range snaps {
+				rep.Message("[dry-run] Would delete snapshot %s at %s", s.ID, s.Path)
+			}
+			return nil
+		}
+
+		rep.Message("Checking sudo credentials...")
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
+			return fmt.Errorf("sudo authentication failed: %w", err)
+		}
+
+		for _, s := range snaps {
+			if err := snapshot.Delete(r, s); err != nil {
+				return fmt.Errorf("delete snapshot %s: %w", s.ID, err)
+			}
+			rep.Message("Deleted snapshot %s.", s.ID)
+		}
+		return nil
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [id]",
+	Short: "Restore the rootfs from a snapshot",
+	Long: `Replace the container rootfs with a snapshot, by default the newest one
+(see 'intuneme snapshots list'). The container is stopped first if running.
+
+The current rootfs is snapshotted before it is replaced, so a rollback can
+itself be rolled back.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+
+		id := ""
+		if len(args) == 1 {
+			id = args[0]
+		}
+		snap, err := snapshot.Find(cfg.RootfsPath, id)
+		if err != nil {
+			return err
+		}
+
+		if clix.DryRun {
+			if nspawn.IsRunning(ctx, r, cfg.MachineName) {
+				rep.Message("[dry-run] Would stop container %s", cfg.MachineName)
+			}
+			rep.Message("[dry-run] Would snapshot current rootfs")
+			rep.Message("[dry-run] Would restore snapshot %s (%s) to %s", snap.ID, snap.Created.Local().Format("2006-01-02 15:04:05"), cfg.RootfsPath)
+			return nil
+		}
+
+		rep.Message("Checking sudo credentials...")
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
+			return fmt.Errorf("sudo authentication failed: %w", err)
+		}
+
+		if nspawn.IsRunning(ctx, r, cfg.MachineName) {
+			if err := runStop(ctx, r, root, 500*time.Millisecond, 30*time.Second); err != nil {
+				return err
+			}
+		}
+
+		return runRollback(r, cfg.RootfsPath, snap)
+	},
+}
+
+// runRollback snapshots the current rootfs, if any, and replaces it with snap.
+// If the restore fails the current rootfs is put back.
+func runRollback(r runner.Runner, rootfs string, snap *snapshot.Snapshot) error {
+	var current *snapshot.Snapshot
+	if _, err := os.Stat(rootfs); err == nil {
+		rep.Message("Snapshotting current rootfs...")
+		current, err = snapshot.Take(r, rootfs, "rollback", time.Now())
+		if err != nil {
+			return fmt.Errorf("snapshot rootfs: %w", err)
+		}
+	}
+
+	rep.Message("Restoring snapshot %s...", snap.ID)
+	if err := restoreSnapshot(r, snap, rootfs); err != nil {
+		if current != nil {
+			if rerr := restoreSnapshot(r, current, rootfs); rerr != nil {
+				return fmt.Errorf("%w (putting the previous rootfs back also failed: %v — it is snapshot %s)", err, rerr, current.ID)
+			}
+		}
+		return err
+	}
+
+	if current != nil {
+		rep.Message("Rolled back to %s. The replaced rootfs is snapshot %s.", snap.ID, current.ID)
+	} else {
+		rep.Message("Rolled back to %s.", snap.ID)
+	}
+	rep.Message("Run 'intuneme start' to boot.")
+	return nil
+}
+
+func init() {
+	snapshotsCmd.AddCommand(snapshotsListCmd)
+	snapshotsCmd.AddCommand(snapshotsDeleteCmd)
+	rootCmd.AddCommand(snapshotsCmd)
+	rootCmd.AddCommand(rollbackCmd)
+}
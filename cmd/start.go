@@ -1,38 +1,49 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/autostart"
 	"github.com/frostyard/intuneme/internal/broker"
 	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/httpproxy"
+	"github.com/frostyard/intuneme/internal/locale"
+	"github.com/frostyard/intuneme/internal/mounts"
+	"github.com/frostyard/intuneme/internal/notify"
 	"github.com/frostyard/intuneme/internal/nspawn"
 	"github.com/frostyard/intuneme/internal/nvidia"
 	"github.com/frostyard/intuneme/internal/provision"
+	"github.com/frostyard/intuneme/internal/resources"
 	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/frostyard/intuneme/internal/sudoers"
+	"github.com/frostyard/intuneme/internal/trust"
 	"github.com/frostyard/intuneme/internal/udev"
 	"github.com/spf13/cobra"
 )
 
+var (
+	startTimeout    time.Duration
+	startUnattended bool
+)
+
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Boot the Intune container",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
@@ -41,118 +52,118 @@ var startCmd = &cobra.Command{
 			return fmt.Errorf("not initialized — run 'intuneme init' first")
 		}
 
-		if nspawn.IsRunning(r, cfg.MachineName) {
+		// With autostart, the service unit and its post-boot hook carry
+		// everything that needs root, so start can run from a login session
+		// without a terminal for sudo to prompt on.
+		auto := autostart.Enabled(cfg.MachineName)
+		if startUnattended {
+			if !auto {
+				return fmt.Errorf("--unattended needs autostart — run 'intuneme autostart enable' first")
+			}
+			r = runner.NonInteractive{Runner: r}
+		}
+
+		if clix.DryRun {
+			var printPlan func()
+			r, printPlan = startPlan(ctx, r, cfg)
+			defer printPlan()
+		}
+
+		if nspawn.IsRunning(ctx, r, cfg.MachineName) {
+			if err := resumeIfPaused(ctx, r, cfg.MachineName); err != nil {
+				return err
+			}
 			rep.Message("Container %s is already running.", cfg.MachineName)
 			rep.Message("Use 'intuneme shell' to connect.")
 			return nil
 		}
 
-		home, err := os.UserHomeDir()
+		boot, err := prepareBoot(r, root, cfg)
 		if err != nil {
-			return fmt.Errorf("cannot determine home directory: %w", err)
-		}
-		intuneHome := home + "/Intune"
-		containerHome := fmt.Sprintf("/home/%s", cfg.HostUser)
-		sockets := nspawn.DetectHostSockets(cfg.HostUID)
-
-		// When broker proxy is enabled, bind-mount a host directory to
-		// /run/user/<uid> inside the container so the session bus socket
-		// is accessible from the host.
-		if cfg.BrokerProxy {
-			runtimeDir := broker.RuntimeDir(root)
-			if err := os.MkdirAll(runtimeDir, 0700); err != nil {
-				return fmt.Errorf("create runtime dir: %w", err)
-			}
-			hostDir, containerDir := broker.RuntimeBindMount(root, cfg.HostUID)
-			sockets = append(sockets, nspawn.BindMount{Host: hostDir, Container: containerDir})
+			return err
 		}
+		useUnit := nspawn.UnitInstalled(cfg.MachineName)
 
-		// Detect Nvidia GPU and prepare bind mounts.
-		var nvidiaDevices []nspawn.BindMount
-		var nvidiaLibs []nvidia.LibMapping
-		nvidiaEnabled := nvidia.IsPresent()
-		if nvidiaEnabled {
-			nvidiaDevices = nvidia.DetectDevices()
-			ldconfigOut, err := r.Run("ldconfig", "-p")
-			if err != nil {
-				rep.Message("Warning: Nvidia detected but ldconfig failed: %v", err)
-				nvidiaEnabled = false
-			} else {
-				nvidiaLibs = nvidia.HostLibraries(ldconfigOut)
-				if len(nvidiaLibs) == 0 {
-					rep.Message("Warning: Nvidia detected but no driver libraries found.")
-					nvidiaEnabled = false
-				} else {
-					sockets = append(sockets, nvidia.LibDirMounts(nvidiaLibs)...)
-					sockets = append(sockets, nvidia.ICDMounts(nvidia.HostICDFiles())...)
-				}
+		if !startUnattended {
+			rep.Message("Checking sudo credentials...")
+			if err := nspawn.ValidateSudo(ctx, r); err != nil {
+				return fmt.Errorf("sudo authentication failed: %w", err)
 			}
 		}
 
-		if clix.DryRun {
-			rep.Message("[dry-run] Would boot container %s", cfg.MachineName)
-			if nvidiaEnabled {
-				rep.Message("[dry-run] Would configure Nvidia GPU with %d libraries", len(nvidiaLibs))
-			}
-			if cfg.BrokerProxy {
-				rep.Message("[dry-run] Would enable linger and start broker proxy")
+		// With autostart the display marker is written by the session
+		// refresh after boot.
+		if !auto {
+			if err := nspawn.WriteDisplayMarker(ctx, r, cfg.RootfsPath, boot.session.Display); err != nil {
+				return fmt.Errorf("write display marker: %w", err)
 			}
-			return nil
 		}
-
-		rep.Message("Checking sudo credentials...")
-		if err := nspawn.ValidateSudo(r); err != nil {
-			return fmt.Errorf("sudo authentication failed: %w", err)
+		if err := nspawn.SetupNetwork(ctx, r, cfg.RootfsPath, boot.network); err != nil {
+			return err
 		}
 
-		display := nspawn.HostDisplay()
-		if err := nspawn.WriteDisplayMarker(r, cfg.RootfsPath, display); err != nil {
-			return fmt.Errorf("write display marker: %w", err)
+		switch {
+		case startUnattended:
+			// Refreshing the unit needs root; start it as installed.
+			bootArgs := nspawn.BuildBootArgs(cfg.RootfsPath, cfg.MachineName, boot.intuneHome, boot.containerHome, boot.sockets, boot.nvidiaDevices, boot.network, boot.userNS, boot.properties)
+			if !nspawn.UnitCurrent(r, cfg.MachineName, bootArgs, boot.postStart) {
+				rep.Warning("%s is out of date with config.toml — run 'intuneme autostart enable' again to update it", nspawn.UnitName(cfg.MachineName))
+			}
+			rep.Message("Booting container via %s...", nspawn.UnitName(cfg.MachineName))
+			err = nspawn.StartUnit(ctx, r, cfg.MachineName)
+		case useUnit:
+			rep.Message("Booting container via %s...", nspawn.UnitName(cfg.MachineName))
+			err = nspawn.BootUnit(ctx, r, cfg.RootfsPath, cfg.MachineName, boot.intuneHome, boot.containerHome, boot.sockets, boot.nvidiaDevices, boot.network, boot.userNS, boot.properties, boot.postStart)
+		default:
+			rep.Message("Booting container...")
+			err = nspawn.Boot(r, cfg.RootfsPath, cfg.MachineName, boot.intuneHome, boot.containerHome, boot.sockets, boot.nvidiaDevices, boot.network, boot.userNS, boot.properties)
 		}
-
-		rep.Message("Booting container...")
-		if err := nspawn.Boot(r, cfg.RootfsPath, cfg.MachineName, intuneHome, containerHome, sockets, nvidiaDevices); err != nil {
+		if err != nil {
 			return fmt.Errorf("failed to start container: %w", err)
 		}
-
-		rep.Message("Waiting for container to boot...")
-		for range 30 {
-			if nspawn.IsRunning(r, cfg.MachineName) {
-				break
+		if !auto && !runner.DryRun(r, "record session in %s", root) {
+			if err := nspawn.SaveSession(root, boot.session); err != nil {
+				rep.Warning("record session: %v", err)
 			}
-			time.Sleep(1 * time.Second)
 		}
 
-		if !nspawn.IsRunning(r, cfg.MachineName) {
-			return fmt.Errorf("container failed to start within 30 seconds")
+		rep.Message("Waiting for container to boot...")
+		bootStart := time.Now()
+		if !nspawn.WaitForMachine(ctx, r, cfg.MachineName, true, time.Second, startTimeout) {
+			return fmt.Errorf("container failed to start within %s", startTimeout)
 		}
 
-		// Clean stale Nvidia symlinks from previous boots (rootfs persists).
-		if err := nvidia.CleanStaleLinks(r, cfg.MachineName); err != nil {
-			rep.Message("Warning: failed to clean stale Nvidia links: %v", err)
+		// Registration with machined happens as soon as nspawn forks the
+		// container's init; wait for its systemd to finish booting so apps
+		// are never launched into a half-booted container.
+		state, err := nspawn.WaitBooted(ctx, r, cfg.MachineName, 500*time.Millisecond, startTimeout-time.Since(bootStart))
+		if err != nil {
+			return err
 		}
-
-		// Create Nvidia library symlinks inside container.
-		if nvidiaEnabled {
-			if err := nvidia.Setup(r, cfg.MachineName, nvidiaLibs); err != nil {
-				rep.Message("Warning: Nvidia library setup failed: %v", err)
-			} else if clix.Verbose {
-				rep.Message("Nvidia GPU libraries configured.")
-			}
+		if state == "degraded" && clix.Verbose {
+			rep.Message("Container booted in degraded state (some units failed).")
 		}
 
-		// Install udev rules for device hotplug (enables future hotplug events).
-		if err := udev.Install(r, cfg.MachineName); err != nil {
-			rep.Message("Warning: failed to install udev rules (hotplug won't work): %v", err)
-		} else if clix.Verbose {
-			rep.Message("Installed udev hotplug rules.")
+		if auto {
+			// The unit's post-boot hook has already run as root; connect
+			// the container to this login's display and audio.
+			session, err := nspawn.RefreshSession(ctx, r, cfg.MachineName, cfg.HostUID)
+			if err != nil {
+				rep.Warning("connect to the desktop session: %v", err)
+			} else if !runner.DryRun(r, "record session in %s", root) {
+				if err := nspawn.SaveSession(root, *session); err != nil {
+					rep.Warning("record session: %v", err)
+				}
+			}
+		} else {
+			postBoot(ctx, r, cfg, boot.nvidiaLibs)
 		}
 
 		// Ensure the sudoers rule for passwordless app launch exists.
 		// Normally installed by init; reinstall here if missing (upgrade
 		// from older version, or manual deletion).
-		if !sudoers.IsInstalled() {
-			if err := sudoers.Install(r, cfg.HostUser); err != nil {
+		if !sudoers.IsInstalled(cfg.HostUser, cfg.MachineName) {
+			if err := sudoers.Install(r, cfg.HostUser, cfg.MachineName); err != nil {
 				rep.Message("Warning: failed to install sudoers rule (open commands will need sudo prompt): %v", err)
 			} else if clix.Verbose {
 				rep.Message("Installed passwordless nsenter rule.")
@@ -160,77 +171,39 @@ var startCmd = &cobra.Command{
 		}
 
 		// Ensure the shared session-setup script exists. Normally installed by
-		// init; reinstall here if missing (upgrade from a version before it
-		// existed). Without it, GUI apps launched via the GNOME extension would
+		// init; reinstall here if missing or outdated (upgrade from an older
+		// version). Without it, GUI apps launched via the GNOME extension would
 		// have no DISPLAY in the broker's environment and couldn't authenticate.
 		if !provision.SessionScriptsInstalled(cfg.RootfsPath) {
-			if err := provision.InstallSessionScripts(r, cfg.RootfsPath); err != nil {
+			if err := provision.InstallSessionScripts(ctx, r, cfg.RootfsPath); err != nil {
 				rep.Message("Warning: failed to install session setup script (auth may fail when launching from the extension): %v", err)
 			} else if clix.Verbose {
 				rep.Message("Installed session setup script.")
 			}
 		}
 
-		// Ensure the container user is in groups that depend on packages
-		// installed inside the image (currently plugdev for pcscd access).
-		// Self-heals containers provisioned before plugdev was in baseGroups.
-		// EnsureUserGroups returns the list of added groups even on error
-		// (partial-success contract), so log added groups regardless of err.
-		added, err := provision.EnsureUserGroups(r, cfg.MachineName, cfg.HostUser)
-		for _, g := range added {
-			rep.Message("Added %s to %s group", cfg.HostUser, g)
-		}
-		if err != nil {
-			rep.Message("Warning: failed to reconcile user groups (smartcards may not work): %v", err)
-		}
-
-		// Forward already-plugged YubiKeys.
-		yubikeys := udev.DetectYubikeys()
-		for _, yk := range yubikeys {
-			name := yk.Name
-			if name == "" {
-				name = "Yubico device"
-			}
-			forwarded := false
-			for _, devnode := range yk.Devices() {
-				if err := udev.ForwardDevice(r, cfg.MachineName, devnode); err != nil {
-					rep.Message("Warning: failed to forward %s: %v", devnode, err)
-				} else {
-					forwarded = true
-					if clix.Verbose {
-						rep.Message("Forwarded %s (%s)", devnode, name)
-					}
-				}
-			}
-			if forwarded {
-				rep.Message("Forwarded YubiKey: %s", name)
-			}
+		// Mirror the host's timezone, locale and keyboard layout before any
+		// session starts, so the user manager and apps pick them up.
+		if err := locale.Sync(ctx, r, cfg.MachineName, cfg.HostUID, locale.Detect()); err != nil {
+			rep.Warning("sync timezone and locale: %v", err)
 		}
 
-		// Forward already-connected video devices.
-		videoDevs := udev.DetectVideoDevices()
-		videoForwarded := 0
-		for _, vd := range videoDevs {
-			if err := udev.ForwardDevice(r, cfg.MachineName, vd.DevNode); err != nil {
-				rep.Message("Warning: failed to forward %s: %v", vd.DevNode, err)
-			} else {
-				videoForwarded++
-				if clix.Verbose {
-					name := vd.Name
-					if name == "" {
-						name = vd.DevNode
-					}
-					rep.Message("Forwarded video device: %s (%s)", vd.DevNode, name)
-				}
-			}
+		// Corporate CAs and the HTTP proxy from config.toml. Re-applied on
+		// every boot, so new host anchors and proxy changes are picked up.
+		if certs, err := trust.Collect(cfg.Trust); err != nil {
+			rep.Warning("%v", err)
+		} else if err := trust.Sync(ctx, r, cfg.MachineName, cfg.HostUID, certs); err != nil {
+			rep.Warning("import CA certificates: %v", err)
 		}
-		if videoForwarded > 0 {
-			rep.Message("Forwarded %d video device(s).", videoForwarded)
-		} else if clix.Verbose {
-			rep.Message("No video devices detected.")
+		if proxy, err := httpproxy.Resolve(cfg.Proxy); err != nil {
+			rep.Warning("config.toml: %v", err)
+		} else if err := httpproxy.Sync(ctx, r, cfg.MachineName, cfg.HostUID, proxy); err != nil {
+			rep.Warning("configure proxy: %v", err)
 		}
 
-		if cfg.BrokerProxy {
+		// The broker and notification proxies reach the container's session
+		// bus through the runtime directory, so it needs a login session.
+		if cfg.BrokerProxy || cfg.Notifications {
 			rep.Message("Enabling linger for container user...")
 			if _, err := r.Run("machinectl", broker.EnableLingerArgs(cfg.MachineName, cfg.HostUser)...); err != nil {
 				return fmt.Errorf("failed to enable linger: %w", err)
@@ -245,18 +218,30 @@ var startCmd = &cobra.Command{
 
 			rep.Message("Waiting for container session bus...")
 			busPath := broker.SessionBusSocketPath(root)
-			busReady := false
-			for range 30 {
-				if _, err := os.Stat(busPath); err == nil {
-					busReady = true
-					break
+			if !runner.DryRun(r, "wait for %s", busPath) {
+				busReady := false
+				for range 30 {
+					if _, err := os.Stat(busPath); err == nil {
+						busReady = true
+						break
+					}
+					time.Sleep(1 * time.Second)
+				}
+				if !busReady {
+					return fmt.Errorf("container session bus not available after 30 seconds")
 				}
-				time.Sleep(1 * time.Second)
 			}
-			if !busReady {
-				return fmt.Errorf("container session bus not available after 30 seconds")
+		}
+
+		if cfg.Notifications {
+			if err := startNotificationProxy(r, root); err != nil {
+				rep.Warning("%v", err)
+			} else {
+				rep.Message("Forwarding container notifications to the desktop.")
 			}
+		}
 
+		if cfg.BrokerProxy {
 			if clix.Verbose {
 				rep.Message("Starting broker proxy...")
 			}
@@ -270,16 +255,18 @@ var startCmd = &cobra.Command{
 				return fmt.Errorf("failed to start broker proxy: %w", err)
 			}
 			pidPath := filepath.Join(root, "broker-proxy.pid")
-			proxyReady := false
-			for range 10 {
-				if _, alive := broker.IsRunningByPIDFile(pidPath); alive {
-					proxyReady = true
-					break
+			if !runner.DryRun(r, "wait for the broker proxy in %s", pidPath) {
+				proxyReady := false
+				for range 10 {
+					if _, alive := broker.IsRunningByPIDFile(pidPath); alive {
+						proxyReady = true
+						break
+					}
+					time.Sleep(500 * time.Millisecond)
+				}
+				if !proxyReady {
+					return fmt.Errorf("broker proxy failed to start within 5 seconds")
 				}
-				time.Sleep(500 * time.Millisecond)
-			}
-			if !proxyReady {
-				return fmt.Errorf("broker proxy failed to start within 5 seconds")
 			}
 
 			rep.Message("Container and broker proxy running.")
@@ -292,6 +279,260 @@ var startCmd = &cobra.Command{
 	},
 }
 
+// startNotificationProxy starts `intuneme notification-proxy` detached, like
+// the broker proxy, and waits for it to write its PID file.
+func startNotificationProxy(r runner.Runner, root string) error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine executable path: %w", err)
+	}
+	pidPath := notify.PIDPath(root)
+	if _, alive := broker.IsRunningByPIDFile(pidPath); alive {
+		return nil
+	}
+	// The profile locates the container user's home, for icons given by path.
+	if err := r.RunBackground("setsid", execPath, "notification-proxy", "--root", root, "--profile", currentProfile()); err != nil {
+		return fmt.Errorf("failed to start notification proxy: %w", err)
+	}
+	if runner.DryRun(r, "wait for the notification proxy in %s", pidPath) {
+		return nil
+	}
+	for range 10 {
+		if _, alive := broker.IsRunningByPIDFile(pidPath); alive {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return fmt.Errorf("notification proxy failed to start within 5 seconds — see %s", notify.LogPath(root))
+}
+
+// stopNotificationProxy stops the notification proxy if it is running.
+func stopNotificationProxy(r runner.Runner, root string) {
+	pidPath := notify.PIDPath(root)
+	if _, alive := broker.IsRunningByPIDFile(pidPath); !alive {
+		return
+	}
+	if !runner.DryRun(r, "stop the notification proxy in %s", pidPath) {
+		broker.StopByPIDFile(pidPath)
+	}
+}
+
+// bootSpec holds the host-side inputs for booting the container, gathered
+// once and shared by start and service install so both produce the same
+// systemd-nspawn arguments.
+type bootSpec struct {
+	intuneHome    string
+	containerHome string
+	sockets       []nspawn.BindMount
+	nvidiaDevices []nspawn.BindMount
+	nvidiaLibs    []nvidia.LibMapping
+	nvidiaEnabled bool
+	network       nspawn.Network
+	userNS        nspawn.UserNamespace
+	properties    []string
+	session       nspawn.Session
+	// postStart is the service unit's post-boot hook, set with autostart.
+	postStart []string
+}
+
+// prepareBoot detects host sockets and GPU devices for the container and
+// creates the broker runtime directory when the broker proxy is enabled.
+func prepareBoot(r runner.Runner, root string, cfg *config.Config) (*bootSpec, error) {
+	intuneHome, err := config.IntuneHome(profileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := resources.Validate(cfg.Resources); err != nil {
+		return nil, err
+	}
+	network, err := nspawn.ParseNetwork(cfg.Network)
+	if err != nil {
+		return nil, fmt.Errorf("config.toml: %w", err)
+	}
+	userNS, err := nspawn.ParseUserNamespace(cfg.PrivateUsers, cfg.HostUser)
+	if err != nil {
+		return nil, fmt.Errorf("config.toml: %w", err)
+	}
+	session := nspawn.HostSession(cfg.HostUID)
+	boot := &bootSpec{
+		intuneHome:    intuneHome,
+		containerHome: fmt.Sprintf("/home/%s", cfg.HostUser),
+		sockets:       session.Sockets.Mounts(),
+		session:       session,
+		network:       network,
+		userNS:        userNS,
+		properties:    resources.Properties(cfg.Resources),
+	}
+
+	if autostart.Enabled(cfg.MachineName) {
+		if err := boot.useAutostart(cfg.MachineName, cfg.HostUser); err != nil {
+			return nil, err
+		}
+	}
+
+	// When the broker or notification proxy is enabled, bind-mount a host
+	// directory to /run/user/<uid> inside the container so the session bus
+	// socket is accessible from the host.
+	if cfg.BrokerProxy || cfg.Notifications {
+		runtimeDir := broker.RuntimeDir(root)
+		if !runner.DryRun(r, "create directory %s", runtimeDir) {
+			if err := os.MkdirAll(runtimeDir, 0700); err != nil {
+				return nil, fmt.Errorf("create runtime dir: %w", err)
+			}
+		}
+		hostDir, containerDir := broker.RuntimeBindMount(root, cfg.HostUID)
+		boot.sockets = append(boot.sockets, nspawn.BindMount{Host: hostDir, Container: containerDir})
+	}
+
+	// User-defined [[mounts]] from config.toml.
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	binds, err := mounts.BindMounts(cfg.Mounts, home, boot.containerHome)
+	if err != nil {
+		return nil, err
+	}
+	boot.sockets = append(boot.sockets, binds...)
+
+	// Detect Nvidia GPU and prepare bind mounts. Like the DRI nodes, the
+	// devices would be unusable in a user namespace.
+	boot.nvidiaEnabled = nvidia.IsPresent() && !userNS.Enabled()
+	if boot.nvidiaEnabled {
+		boot.nvidiaDevices = nvidia.DetectDevices()
+		ldconfigOut, err := r.Run("ldconfig", "-p")
+		if err != nil {
+			rep.Message("Warning: Nvidia detected but ldconfig failed: %v", err)
+			boot.nvidiaEnabled = false
+		} else {
+			boot.nvidiaLibs = nvidia.HostLibraries(ldconfigOut)
+			if len(boot.nvidiaLibs) == 0 {
+				rep.Message("Warning: Nvidia detected but no driver libraries found.")
+				boot.nvidiaEnabled = false
+			} else {
+				boot.sockets = append(boot.sockets, nvidia.LibDirMounts(boot.nvidiaLibs)...)
+				boot.sockets = append(boot.sockets, nvidia.ICDMounts(nvidia.HostICDFiles())...)
+			}
+		}
+	}
+	return boot, nil
+}
+
+// postBoot performs the steps after boot that need root: Nvidia library links,
+// udev hotplug rules, container user groups and forwarding plugged-in devices.
+// With autostart they run from the service unit instead (see autostart
+// post-boot). nvidiaLibs is empty when no Nvidia GPU is in use.
+func postBoot(ctx context.Context, r runner.Runner, cfg *config.Config, nvidiaLibs []nvidia.LibMapping) {
+	// Clean stale Nvidia symlinks from previous boots (rootfs persists).
+	if err := nvidia.CleanStaleLinks(ctx, r, cfg.MachineName); err != nil {
+		rep.Message("Warning: failed to clean stale Nvidia links: %v", err)
+	}
+
+	// Create Nvidia library symlinks inside container.
+	if len(nvidiaLibs) > 0 {
+		if err := nvidia.Setup(ctx, r, cfg.MachineName, nvidiaLibs); err != nil {
+			rep.Message("Warning: Nvidia library setup failed: %v", err)
+		} else if clix.Verbose {
+			rep.Message("Nvidia GPU libraries configured.")
+		}
+	}
+
+	// Install udev rules for device hotplug (enables future hotplug events).
+	if err := udev.Install(ctx, r, cfg.MachineName); err != nil {
+		rep.Message("Warning: failed to install udev rules (hotplug won't work): %v", err)
+	} else if clix.Verbose {
+		rep.Message("Installed udev hotplug rules.")
+	}
+
+	// Ensure the container user is in groups that depend on packages
+	// installed inside the image (currently plugdev for pcscd access).
+	// Self-heals containers provisioned before plugdev was in baseGroups.
+	// EnsureUserGroups returns the list of added groups even on error
+	// (partial-success contract), so log added groups regardless of err.
+	added, err := provision.EnsureUserGroups(ctx, r, cfg.MachineName, cfg.HostUser)
+	for _, g := range added {
+		rep.Message("Added %s to %s group", cfg.HostUser, g)
+	}
+	if err != nil {
+		rep.Message("Warning: failed to reconcile user groups (smartcards may not work): %v", err)
+	}
+
+	forwardDevices(ctx, r, cfg.MachineName, udev.ForwardDevice)
+}
+
+// useAutostart shapes boot for the autostart service unit, which has to stay
+// the same across logins since refreshing it needs root. The session sockets,
+// whose paths change from one login to the next, are left out and bound by
+// the session refresh after boot instead, and the unit gets the post-boot hook.
+func (b *bootSpec) useAutostart(machine, user string) error {
+	// The session sockets are bound with machinectl bind, which cannot reach
+	// into a container with its own user namespace.
+	if b.userNS.Enabled() {
+		return fmt.Errorf("autostart does not work with private_users in config.toml — run 'intuneme autostart disable' or turn private_users off")
+	}
+	session := b.session.Sockets.Mounts()
+	b.sockets = slices.DeleteFunc(b.sockets, func(m nspawn.BindMount) bool {
+		return slices.Contains(session, m)
+	})
+	b.postStart = autostart.PostBootArgs(machine, user)
+	return nil
+}
+
+// forwardDevices forwards the YubiKeys and video devices plugged in now into
+// the running container with forward, udev.ForwardDevice or, without a
+// terminal to prompt on, udev.ForwardDeviceHelper. Later hotplug events are
+// handled by the udev rules.
+func forwardDevices(ctx context.Context, r runner.Runner, machine string, forward func(context.Context, runner.Runner, string, string) error) {
+	// Forward already-plugged YubiKeys.
+	yubikeys := udev.DetectYubikeys()
+	for _, yk := range yubikeys {
+		name := yk.Name
+		if name == "" {
+			name = "Yubico device"
+		}
+		forwarded := false
+		for _, devnode := range yk.Devices() {
+			if err := forward(ctx, r, machine, devnode); err != nil {
+				rep.Message("Warning: failed to forward %s: %v", devnode, err)
+			} else {
+				forwarded = true
+				if clix.Verbose {
+					rep.Message("Forwarded %s (%s)", devnode, name)
+				}
+			}
+		}
+		if forwarded {
+			rep.Message("Forwarded YubiKey: %s", name)
+		}
+	}
+
+	// Forward already-connected video devices.
+	videoDevs := udev.DetectVideoDevices()
+	videoForwarded := 0
+	for _, vd := range videoDevs {
+		if err := forward(ctx, r, machine, vd.DevNode); err != nil {
+			rep.Message("Warning: failed to forward %s: %v", vd.DevNode, err)
+		} else {
+			videoForwarded++
+			if clix.Verbose {
+				name := vd.Name
+				if name == "" {
+					name = vd.DevNode
+				}
+				rep.Message("Forwarded video device: %s (%s)", vd.DevNode, name)
+			}
+		}
+	}
+	if videoForwarded > 0 {
+		rep.Message("Forwarded %d video device(s).", videoForwarded)
+	} else if clix.Verbose {
+		rep.Message("No video devices detected.")
+	}
+}
+
 func init() {
+	startCmd.Flags().DurationVar(&startTimeout, "timeout", 60*time.Second, "how long to wait for the container to finish booting")
+	startCmd.Flags().BoolVar(&startUnattended, "unattended", false, "start without prompting for sudo (used by autostart)")
+	_ = startCmd.Flags().MarkHidden("unattended")
 	rootCmd.AddCommand(startCmd)
 }
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/autostart"
 	"github.com/frostyard/intuneme/internal/broker"
-	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/notify"
 	"github.com/frostyard/intuneme/internal/nspawn"
-	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/resources"
 	"github.com/spf13/cobra"
 )
 
@@ -17,17 +21,14 @@ var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show container and intune-portal status",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
@@ -36,6 +37,7 @@ var statusCmd = &cobra.Command{
 		if _, err := os.Stat(cfg.RootfsPath); err != nil {
 			if clix.OutputJSON(map[string]any{
 				"initialized": false,
+				"profile":     currentProfile(),
 			}) {
 				return nil
 			}
@@ -44,9 +46,34 @@ var statusCmd = &cobra.Command{
 			return nil
 		}
 
+		network, err := nspawn.ParseNetwork(cfg.Network)
+		if err != nil {
+			return fmt.Errorf("config.toml: %w", err)
+		}
+
 		containerStatus := "stopped"
-		if nspawn.IsRunning(r, cfg.MachineName) {
+		var usage *resources.Usage
+		var addresses []string
+		var session *nspawn.Session
+		if nspawn.IsRunning(ctx, r, cfg.MachineName) {
 			containerStatus = "running"
+			if nspawn.IsPaused(ctx, r, cfg.MachineName) {
+				containerStatus = "paused"
+			}
+			session, err = nspawn.LoadSession(root)
+			if err != nil && clix.Verbose {
+				rep.Warning("read session record: %v", err)
+			}
+			usage, err = resources.ReadUsage(ctx, r, cfg.MachineName)
+			if err != nil && clix.Verbose {
+				rep.Warning("read resource usage: %v", err)
+			}
+			if network.Private() {
+				addresses, err = nspawn.Addresses(ctx, r, cfg.MachineName)
+				if err != nil && clix.Verbose {
+					rep.Warning("read container addresses: %v", err)
+				}
+			}
 		}
 
 		brokerStatus := ""
@@ -59,37 +86,140 @@ var statusCmd = &cobra.Command{
 			}
 		}
 
+		notifyStatus := ""
+		if cfg.Notifications {
+			if pid, running := broker.IsRunningByPIDFile(notify.PIDPath(root)); running {
+				notifyStatus = fmt.Sprintf("running (PID %d)", pid)
+			} else {
+				notifyStatus = "not running"
+			}
+		}
+
+		service := ""
+		if nspawn.UnitInstalled(cfg.MachineName) {
+			service = fmt.Sprintf("%s (%s)", nspawn.UnitName(cfg.MachineName), nspawn.UnitActiveState(ctx, r, cfg.MachineName))
+		}
+
 		channel := "stable"
 		if cfg.Insiders {
 			channel = "insiders"
 		}
 
 		if clix.OutputJSON(map[string]any{
-			"initialized":  true,
-			"root":         root,
-			"rootfs":       cfg.RootfsPath,
-			"machine":      cfg.MachineName,
-			"container":    containerStatus,
-			"channel":      channel,
-			"broker_proxy": brokerStatus,
+			"initialized":   true,
+			"profile":       currentProfile(),
+			"root":          root,
+			"rootfs":        cfg.RootfsPath,
+			"machine":       cfg.MachineName,
+			"container":     containerStatus,
+			"channel":       channel,
+			"broker_proxy":  brokerStatus,
+			"notifications": notifyStatus,
+			"service":       service,
+			"autostart":     autostart.Enabled(cfg.MachineName),
+			"network":       network.String(),
+			"addresses":     addresses,
+			"session":       session,
+			"limits":        cfg.Resources,
+			"usage":         usage,
 		}) {
 			return nil
 		}
 
+		rep.MessagePlain("Profile: %s", currentProfile())
 		rep.MessagePlain("Root:    %s", root)
 		rep.MessagePlain("Rootfs:  %s", cfg.RootfsPath)
 		rep.MessagePlain("Machine: %s", cfg.MachineName)
 		rep.MessagePlain("Container: %s", containerStatus)
 		rep.MessagePlain("Channel: %s", channel)
+		if service != "" {
+			rep.MessagePlain("Service: %s", service)
+		}
+		if autostart.Enabled(cfg.MachineName) {
+			rep.MessagePlain("Autostart: enabled")
+		}
 
 		if cfg.BrokerProxy {
 			rep.MessagePlain("Broker proxy: %s", brokerStatus)
 		}
+		if cfg.Notifications {
+			rep.MessagePlain("Notification proxy: %s", notifyStatus)
+		}
+
+		if session != nil {
+			for _, line := range sessionLines(session) {
+				rep.MessagePlain("%s", line)
+			}
+		}
+
+		if network.Private() {
+			rep.MessagePlain("Network: %s", network)
+			if len(addresses) > 0 {
+				rep.MessagePlain("Address: %s", strings.Join(addresses, ", "))
+			}
+		}
+
+		if usage != nil {
+			res := cfg.Resources
+			rep.MessagePlain("Memory:  %s%s", formatBytes(usage.MemoryBytes), limitSuffix("max", res.MemoryMax))
+			rep.MessagePlain("CPU:     %s%s", (time.Duration(usage.CPUUsec) * time.Microsecond).Round(time.Second), limitSuffix("quota", res.CPUQuota))
+			rep.MessagePlain("Tasks:   %d%s", usage.Tasks, limitSuffix("max", strconv.Itoa(res.TasksMax)))
+			rep.MessagePlain("IO:      %s read, %s written", formatBytes(usage.IOReadBytes), formatBytes(usage.IOWriteBytes))
+		}
 
 		return nil
 	},
 }
 
+// sessionLines describes the display and audio paths the container uses.
+func sessionLines(s *nspawn.Session) []string {
+	display := s.Display
+	if s.Sockets.XAuthority != "" {
+		display += " (Xauthority " + s.Sockets.XAuthority + ")"
+	}
+	wayland := s.Sockets.Wayland
+	if wayland == "" {
+		wayland = "none"
+	}
+	var audio []string
+	if s.Sockets.PipeWire != "" {
+		audio = append(audio, "PipeWire "+s.Sockets.PipeWire)
+	}
+	if s.Sockets.Pulse != "" {
+		audio = append(audio, "PulseAudio "+s.Sockets.Pulse)
+	}
+	if len(audio) == 0 {
+		audio = append(audio, "none")
+	}
+	return []string{
+		"Display: " + display,
+		"Wayland: " + wayland,
+		"Audio:   " + strings.Join(audio, ", "),
+	}
+}
+
+// limitSuffix annotates a usage figure with its configured limit, if any.
+func limitSuffix(label, limit string) string {
+	if limit == "" || limit == "0" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s %s)", label, limit)
+}
+
+// formatBytes renders n with a binary unit, e.g. "1.5 GiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
 }
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/nspawn"
 )
 
 func TestStatusJSON(t *testing.T) {
@@ -43,3 +45,40 @@ func TestStatusJSON(t *testing.T) {
 		t.Fatal("expected 'initialized' key in JSON output")
 	}
 }
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{8 << 30, "8.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSessionLines(t *testing.T) {
+	s := &nspawn.Session{Display: ":1", Sockets: nspawn.HostSockets{
+		Wayland:    "/run/user/1000/wayland-1",
+		Pulse:      "/run/user/1000/pulse/native",
+		XAuthority: "/run/user/1000/.mutter-Xwaylandauth.AB12CD",
+	}}
+	got := strings.Join(sessionLines(s), "\n")
+	want := "Display: :1 (Xauthority /run/user/1000/.mutter-Xwaylandauth.AB12CD)\n" +
+		"Wayland: /run/user/1000/wayland-1\n" +
+		"Audio:   PulseAudio /run/user/1000/pulse/native"
+	if got != want {
+		t.Errorf("sessionLines =\n%s\nwant\n%s", got, want)
+	}
+
+	got = strings.Join(sessionLines(&nspawn.Session{Display: ":0"}), "\n")
+	if got != "Display: :0\nWayland: none\nAudio:   none" {
+		t.Errorf("sessionLines for an empty session = %q", got)
+	}
+}
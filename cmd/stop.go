@@ -1,90 +1,95 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"time"
 
 	"github.com/frostyard/clix"
 	"github.com/frostyard/intuneme/internal/broker"
-	"github.com/frostyard/intuneme/internal/config"
 	"github.com/frostyard/intuneme/internal/nspawn"
 	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/frostyard/intuneme/internal/udev"
 	"github.com/spf13/cobra"
 )
 
-func runStop(r runner.Runner, root string, pollInterval time.Duration, maxAttempts int) error {
-	cfg, err := config.Load(root)
+// runStop powers off the container and waits up to timeout for it to
+// deregister from systemd-machined. pollInterval bounds how long a missed
+// MachineRemoved signal can delay the wait.
+func runStop(ctx context.Context, r runner.Runner, root string, pollInterval, timeout time.Duration) error {
+	cfg, err := loadConfig(root)
 	if err != nil {
 		return err
 	}
 
-	if !nspawn.IsRunning(r, cfg.MachineName) {
+	if !nspawn.IsRunning(ctx, r, cfg.MachineName) {
 		rep.Message("Container is not running.")
 		return nil
 	}
 
-	if clix.DryRun {
-		if cfg.BrokerProxy {
-			rep.Message("[dry-run] Would stop broker proxy")
-		}
-		rep.Message("[dry-run] Would stop container %s", cfg.MachineName)
-		return nil
-	}
-
 	// Stop broker proxy first so host apps get clean errors
 	if cfg.BrokerProxy {
 		pidPath := filepath.Join(root, "broker-proxy.pid")
-		broker.StopByPIDFile(pidPath)
+		if !runner.DryRun(r, "stop the broker proxy in %s", pidPath) {
+			broker.StopByPIDFile(pidPath)
+		}
 		rep.Message("Broker proxy stopped.")
 	}
+	if cfg.Notifications {
+		stopNotificationProxy(r, root)
+	}
 
 	// Remove udev rules and hotplug artifacts. Remove() is graceful and
 	// handles missing files, so call it unconditionally to clean up any
 	// partial install state (e.g. script without rules).
-	if err := udev.Remove(r); err != nil {
+	if err := udev.Remove(ctx, r, cfg.MachineName); err != nil {
 		rep.Message("Warning: failed to remove udev rules: %v", err)
 	} else if clix.Verbose {
 		rep.Message("Removed udev hotplug rules.")
 	}
 
 	rep.Message("Stopping container...")
-	if err := nspawn.Stop(r, cfg.MachineName); err != nil {
+	if err := nspawn.Stop(ctx, r, cfg.MachineName); err != nil {
 		return err
 	}
 
 	// Wait for the container to fully deregister from systemd-machined.
 	// machinectl poweroff returns before the machine is fully gone.
-	for range maxAttempts {
-		if !nspawn.IsRunning(r, cfg.MachineName) {
-			rep.Message("Container stopped.")
-			return nil
-		}
-		time.Sleep(pollInterval)
+	if nspawn.WaitForMachine(ctx, r, cfg.MachineName, false, pollInterval, timeout) {
+		rep.Message("Container stopped.")
+		return nil
 	}
 
-	timeout := pollInterval * time.Duration(maxAttempts)
 	return fmt.Errorf("container %s did not stop within %s", cfg.MachineName, timeout)
 }
 
+var stopTimeout time.Duration
+
 var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop the container",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+		if clix.DryRun {
+			cfg, err := loadConfig(root)
 			if err != nil {
 				return err
 			}
+			var printPlan func()
+			r, printPlan = startPlan(ctx, r, cfg)
+			defer printPlan()
 		}
-		return runStop(r, root, 500*time.Millisecond, 60)
+		return runStop(ctx, r, root, 500*time.Millisecond, stopTimeout)
 	},
 }
 
 func init() {
+	stopCmd.Flags().DurationVar(&stopTimeout, "timeout", 30*time.Second, "how long to wait for the container to shut down")
 	rootCmd.AddCommand(stopCmd)
 }
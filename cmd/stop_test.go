@@ -1,13 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/runner"
 )
 
 func TestMain(m *testing.M) {
@@ -37,7 +41,22 @@ func (m *stopMockRunner) Run(name string, args ...string) ([]byte, error) {
 	return nil, nil
 }
 
-func (m *stopMockRunner) RunAttached(string, ...string) error   { return nil }
+func (m *stopMockRunner) RunAttached(string, ...string) error { return nil }
+
+func (m *stopMockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *stopMockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *stopMockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *stopMockRunner) RunBackground(string, ...string) error { return nil }
 func (m *stopMockRunner) LookPath(name string) (string, error) {
 	return "/usr/bin/" + name, nil
@@ -47,7 +66,7 @@ func TestRunStop_WaitsForShutdown(t *testing.T) {
 	// Container is "running" for first 3 show calls, then stops
 	r := &stopMockRunner{showFailAfter: 3}
 
-	err := runStop(r, t.TempDir(), 1*time.Millisecond, 100)
+	err := runStop(context.Background(), r, t.TempDir(), 1*time.Millisecond, 100*time.Millisecond)
 	if err != nil {
 		t.Fatalf("runStop returned error: %v", err)
 	}
@@ -61,7 +80,7 @@ func TestRunStop_NotRunning(t *testing.T) {
 	// Container is not running (show fails immediately)
 	r := &stopMockRunner{showFailAfter: 0}
 
-	err := runStop(r, t.TempDir(), 1*time.Millisecond, 100)
+	err := runStop(context.Background(), r, t.TempDir(), 1*time.Millisecond, 100*time.Millisecond)
 	if err != nil {
 		t.Fatalf("runStop returned error: %v", err)
 	}
@@ -73,7 +92,7 @@ func TestRunStop_PoweroffError(t *testing.T) {
 		poweroffErr:   fmt.Errorf("permission denied"),
 	}
 
-	err := runStop(r, t.TempDir(), 1*time.Millisecond, 100)
+	err := runStop(context.Background(), r, t.TempDir(), 1*time.Millisecond, 100*time.Millisecond)
 	if err == nil {
 		t.Fatal("expected error from poweroff failure")
 	}
@@ -86,15 +105,48 @@ func TestRunStop_Timeout(t *testing.T) {
 	// Container never stops — show always succeeds
 	r := &stopMockRunner{showFailAfter: 1000}
 
-	err := runStop(r, t.TempDir(), 1*time.Millisecond, 5)
+	err := runStop(context.Background(), r, t.TempDir(), 1*time.Millisecond, 5*time.Millisecond)
 	if err == nil {
 		t.Fatal("expected timeout error")
 	}
 	if !strings.Contains(err.Error(), "did not stop") {
 		t.Errorf("expected timeout message, got: %v", err)
 	}
-	// Effective timeout = 1ms * 5 = 5ms; verify it appears in the error
+	// The configured timeout appears in the error
 	if !strings.Contains(err.Error(), "5ms") {
 		t.Errorf("expected computed timeout in error message, got: %v", err)
 	}
 }
+
+func TestRunStop_Plan(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(root+"/config.toml", []byte("broker_proxy = true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec := &runner.Recorder{}
+	rec.Answer("machinectl show intuneme", runner.Reply{}, runner.Reply{Err: fmt.Errorf("machine not found")})
+
+	if err := runStop(context.Background(), rec, root, time.Millisecond, 100*time.Millisecond); err != nil {
+		t.Fatalf("runStop returned error: %v", err)
+	}
+
+	var plan []string
+	for _, s := range rec.Steps {
+		plan = append(plan, s.String())
+	}
+	got := strings.Join(plan, "\n")
+	want := []string{
+		"machinectl show intuneme",
+		"stop the broker proxy in " + root + "/broker-proxy.pid",
+		"machinectl poweroff intuneme",
+		"machinectl show intuneme",
+	}
+	last := -1
+	for _, w := range want {
+		i := slices.Index(plan[last+1:], w)
+		if i < 0 {
+			t.Fatalf("plan missing %q after step %d\ngot:\n%s", w, last, got)
+		}
+		last += i + 1
+	}
+}
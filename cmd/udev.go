@@ -4,9 +4,7 @@ import (
 	"fmt"
 
 	"github.com/frostyard/clix"
-	"github.com/frostyard/intuneme/internal/config"
 	"github.com/frostyard/intuneme/internal/nspawn"
-	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/frostyard/intuneme/internal/udev"
 	"github.com/spf13/cobra"
 )
@@ -26,41 +24,38 @@ container when plugged in.
 This is normally called automatically by 'intuneme start', but can be
 run manually to set up rules without starting the container.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
-		root := rootDir
-		if root == "" {
-			var err error
-			root, err = config.DefaultRoot()
-			if err != nil {
-				return err
-			}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
 		}
 
-		cfg, err := config.Load(root)
+		cfg, err := loadConfig(root)
 		if err != nil {
 			return err
 		}
 
 		if clix.DryRun {
-			rep.Message("[dry-run] Would install udev rules to %s and %s", udev.RulesPath(), udev.VideoRulesPath())
-			rep.Message("[dry-run] Would install helper script to %s", udev.ScriptPath())
+			rep.Message("[dry-run] Would install udev rules to %s and %s", udev.RulesPath(cfg.MachineName), udev.VideoRulesPath(cfg.MachineName))
+			rep.Message("[dry-run] Would install helper script to %s", udev.ScriptPath(cfg.MachineName))
 			return nil
 		}
 
 		rep.Message("Checking sudo credentials...")
-		if err := nspawn.ValidateSudo(r); err != nil {
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
 			return fmt.Errorf("sudo authentication failed: %w", err)
 		}
 
-		if err := udev.Install(r, cfg.MachineName); err != nil {
+		if err := udev.Install(ctx, r, cfg.MachineName); err != nil {
 			return fmt.Errorf("install udev rules: %w", err)
 		}
 
 		rep.Message("Installed udev rules for device hotplug forwarding.")
 		if clix.Verbose {
-			rep.Message("  YubiKey rules: %s", udev.RulesPath())
-			rep.Message("  Video rules:   %s", udev.VideoRulesPath())
-			rep.Message("  Script:        %s", udev.ScriptPath())
+			rep.Message("  YubiKey rules: %s", udev.RulesPath(cfg.MachineName))
+			rep.Message("  Video rules:   %s", udev.VideoRulesPath(cfg.MachineName))
+			rep.Message("  Script:        %s", udev.ScriptPath(cfg.MachineName))
 			rep.Message("  Machine:       %s", cfg.MachineName)
 		}
 
@@ -75,25 +70,35 @@ var udevRemoveCmd = &cobra.Command{
 or 'intuneme start'. This is safe to run even if the rules are not installed
 or the container is not running — it will clean up whatever it finds.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		r := &runner.SystemRunner{}
+		r := newRunner()
+		ctx := cmd.Context()
+		root, err := resolveRoot()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
 
 		if clix.DryRun {
-			rep.Message("[dry-run] Would remove udev rules from %s and %s", udev.RulesPath(), udev.VideoRulesPath())
-			rep.Message("[dry-run] Would remove helper script from %s", udev.ScriptPath())
+			rep.Message("[dry-run] Would remove udev rules from %s and %s", udev.RulesPath(cfg.MachineName), udev.VideoRulesPath(cfg.MachineName))
+			rep.Message("[dry-run] Would remove helper script from %s", udev.ScriptPath(cfg.MachineName))
 			return nil
 		}
 
-		if !udev.IsInstalled() {
+		if !udev.IsInstalled(cfg.MachineName) {
 			rep.Message("No udev rules installed — nothing to remove.")
 			return nil
 		}
 
 		rep.Message("Checking sudo credentials...")
-		if err := nspawn.ValidateSudo(r); err != nil {
+		if err := nspawn.ValidateSudo(ctx, r); err != nil {
 			return fmt.Errorf("sudo authentication failed: %w", err)
 		}
 
-		if err := udev.Remove(r); err != nil {
+		if err := udev.Remove(ctx, r, cfg.MachineName); err != nil {
 			return fmt.Errorf("remove udev rules: %w", err)
 		}
 
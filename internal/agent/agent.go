@@ -0,0 +1,246 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/godbus/dbus/v5"
+)
+
+// Event is a host change after which the container may need healing.
+type Event int
+
+const (
+	// Resumed fires when the host wakes from suspend or hibernation.
+	Resumed Event = iota
+	// NetworkUp fires when NetworkManager regains full connectivity.
+	NetworkUp
+	// TimezoneChanged fires when the host's timezone changes, e.g. by GNOME's
+	// automatic timezone while traveling.
+	TimezoneChanged
+)
+
+func (e Event) String() string {
+	switch e {
+	case Resumed:
+		return "resumed from sleep"
+	case NetworkUp:
+		return "network connected"
+	case TimezoneChanged:
+		return "timezone changed"
+	}
+	return fmt.Sprintf("event %d", int(e))
+}
+
+const (
+	login1Manager = "org.freedesktop.login1.Manager"
+	nmInterface   = "org.freedesktop.NetworkManager"
+	nmPath        = "/org/freedesktop/NetworkManager"
+	// nmConnectedGlobal is NM_STATE_CONNECTED_GLOBAL: full internet access.
+	nmConnectedGlobal = 70
+	timedateInterface = "org.freedesktop.timedate1"
+	timedatePath      = "/org/freedesktop/timedate1"
+	propertiesChanged = "org.freedesktop.DBus.Properties.PropertiesChanged"
+)
+
+// Watch subscribes to logind's PrepareForSleep, NetworkManager's StateChanged
+// and timedated's property changes on the system bus and sends an Event for
+// each resume, each return to full connectivity and each timezone change,
+// until ctx is done. A host without NetworkManager produces no NetworkUp.
+func Watch(ctx context.Context, events chan<- Event) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("connect to system bus: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchInterface(login1Manager),
+		dbus.WithMatchMember("PrepareForSleep"),
+	); err != nil {
+		return fmt.Errorf("subscribe to logind: %w", err)
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(nmPath),
+		dbus.WithMatchInterface(nmInterface),
+		dbus.WithMatchMember("StateChanged"),
+	); err != nil {
+		return fmt.Errorf("subscribe to NetworkManager: %w", err)
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(timedatePath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchArg(0, timedateInterface),
+	); err != nil {
+		return fmt.Errorf("subscribe to timedated: %w", err)
+	}
+
+	// Start from the current state so the first signal is not mistaken for a
+	// reconnect. Without NetworkManager assume connected.
+	var state uint32 = nmConnectedGlobal
+	if v, err := conn.Object(nmInterface, nmPath).GetProperty(nmInterface + ".State"); err == nil {
+		if s, ok := v.Value().(uint32); ok {
+			state = s
+		}
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("system bus connection closed")
+			}
+			if ev, ok := classify(sig, &state); ok {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// classify turns a signal into an Event. state holds NetworkManager's last
+// known state and is updated by StateChanged signals.
+func classify(sig *dbus.Signal, state *uint32) (Event, bool) {
+	switch sig.Name {
+	case login1Manager + ".PrepareForSleep":
+		// PrepareForSleep(true) is sent before sleeping, (false) after waking.
+		if len(sig.Body) == 1 {
+			if sleeping, ok := sig.Body[0].(bool); ok && !sleeping {
+				return Resumed, true
+			}
+		}
+	case nmInterface + ".StateChanged":
+		if len(sig.Body) == 1 {
+			if s, ok := sig.Body[0].(uint32); ok {
+				prev := *state
+				*state = s
+				if s == nmConnectedGlobal && prev != nmConnectedGlobal {
+					return NetworkUp, true
+				}
+			}
+		}
+	case propertiesChanged:
+		// PropertiesChanged(interface, changed, invalidated) from timedated.
+		if sig.Path != timedatePath || len(sig.Body) != 3 {
+			break
+		}
+		if iface, ok := sig.Body[0].(string); !ok || iface != timedateInterface {
+			break
+		}
+		if changed, ok := sig.Body[1].(map[string]dbus.Variant); ok {
+			if _, ok := changed["Timezone"]; ok {
+				return TimezoneChanged, true
+			}
+		}
+		if invalidated, ok := sig.Body[2].([]string); ok && slices.Contains(invalidated, "Timezone") {
+			return TimezoneChanged, true
+		}
+	}
+	return 0, false
+}
+
+// UnitName returns the systemd user unit running the agent for a machine.
+func UnitName(machine string) string {
+	return machine + "-agent.service"
+}
+
+// UnitPath returns where the machine's agent unit is installed.
+func UnitPath(machine string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "systemd", "user", UnitName(machine)), nil
+}
+
+// UnitContent renders the user unit that runs `intuneme agent` for a profile
+// for as long as the graphical session lasts, so it inherits the session's
+// display and audio environment.
+func UnitContent(execPath, profile, machine string) string {
+	exec := execPath + " agent"
+	if profile != "" && profile != config.DefaultProfile {
+		exec += " --profile " + profile
+	}
+	return fmt.Sprintf(`# Installed by 'intuneme agent install'.
+[Unit]
+Description=intuneme agent for %s: recover the container after suspend and network changes
+PartOf=graphical-session.target
+After=graphical-session.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+RestartSec=10
+
+[Install]
+WantedBy=graphical-session.target
+`, machine, exec)
+}
+
+// Install writes the machine's agent unit and enables and starts it.
+func Install(ctx context.Context, r runner.Runner, execPath, profile, machine string) error {
+	path, err := UnitPath(machine)
+	if err != nil {
+		return err
+	}
+	if !runner.DryRun(r, "write %s", path) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("create systemd user unit dir: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(UnitContent(execPath, profile, machine)), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", UnitName(machine), err)
+		}
+	}
+	if out, err := r.RunContext(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+		return fmt.Errorf("systemctl --user daemon-reload failed: %w\n%s", err, out)
+	}
+	if out, err := r.RunContext(ctx, "systemctl", "--user", "enable", "--now", UnitName(machine)); err != nil {
+		return fmt.Errorf("enable %s: %w\n%s", UnitName(machine), err, out)
+	}
+	return nil
+}
+
+// Installed reports whether the machine's agent unit is installed.
+func Installed(machine string) bool {
+	path, err := UnitPath(machine)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Remove stops, disables and deletes the machine's agent unit. A missing unit
+// is not an error.
+func Remove(ctx context.Context, r runner.Runner, machine string) error {
+	if !Installed(machine) {
+		return nil
+	}
+	path, err := UnitPath(machine)
+	if err != nil {
+		return err
+	}
+	_, _ = r.RunContext(ctx, "systemctl", "--user", "disable", "--now", UnitName(machine))
+	if !runner.DryRun(r, "remove %s", path) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", UnitName(machine), err)
+		}
+	}
+	if out, err := r.RunContext(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+		return fmt.Errorf("systemctl --user daemon-reload failed: %w\n%s", err, out)
+	}
+	return nil
+}
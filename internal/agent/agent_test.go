@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestClassify(t *testing.T) {
+	sleep := func(v bool) *dbus.Signal {
+		return &dbus.Signal{Name: login1Manager + ".PrepareForSleep", Body: []any{v}}
+	}
+	nm := func(s uint32) *dbus.Signal {
+		return &dbus.Signal{Name: nmInterface + ".StateChanged", Body: []any{s}}
+	}
+	timedate := func(changed map[string]dbus.Variant, invalidated []string) *dbus.Signal {
+		return &dbus.Signal{Path: timedatePath, Name: propertiesChanged, Body: []any{timedateInterface, changed, invalidated}}
+	}
+
+	state := uint32(nmConnectedGlobal)
+	steps := []struct {
+		sig  *dbus.Signal
+		want Event
+		ok   bool
+	}{
+		{sleep(true), 0, false},
+		{sleep(false), Resumed, true},
+		{nm(nmConnectedGlobal), 0, false}, // already connected
+		{nm(20), 0, false},                // disconnected
+		{nm(40), 0, false},                // connecting
+		{nm(nmConnectedGlobal), NetworkUp, true},
+		{timedate(map[string]dbus.Variant{"Timezone": dbus.MakeVariant("Asia/Tokyo")}, nil), TimezoneChanged, true},
+		{timedate(map[string]dbus.Variant{}, []string{"Timezone"}), TimezoneChanged, true},
+		{timedate(map[string]dbus.Variant{"NTP": dbus.MakeVariant(true)}, nil), 0, false},
+		{&dbus.Signal{Name: "org.example.Other"}, 0, false},
+	}
+	for i, s := range steps {
+		ev, ok := classify(s.sig, &state)
+		if ok != s.ok || (ok && ev != s.want) {
+			t.Errorf("step %d: classify = %v, %v; want %v, %v", i, ev, ok, s.want, s.ok)
+		}
+	}
+}
+
+func TestUnitContent(t *testing.T) {
+	content := UnitContent("/usr/bin/intuneme", "work", "intuneme-work")
+	for _, want := range []string{
+		"ExecStart=/usr/bin/intuneme agent --profile work\n",
+		"WantedBy=graphical-session.target",
+		"PartOf=graphical-session.target",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("unit missing %q:\n%s", want, content)
+		}
+	}
+	if c := UnitContent("/usr/bin/intuneme", "default", "intuneme"); !strings.Contains(c, "ExecStart=/usr/bin/intuneme agent\n") {
+		t.Errorf("default profile should have no --profile flag:\n%s", c)
+	}
+	if UnitName("intuneme-work") != "intuneme-work-agent.service" {
+		t.Errorf("UnitName = %q", UnitName("intuneme-work"))
+	}
+}
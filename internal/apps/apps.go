@@ -0,0 +1,421 @@
+package apps
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// validID matches the desktop entry names intuneme accepts as app IDs; they
+// end up in host file names and on the `intuneme open` command line.
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// fieldCode matches the placeholders of a desktop entry's Exec key, which
+// apps launched without files or URLs drop. %% stands for a literal %.
+var fieldCode = regexp.MustCompile(`%[%a-zA-Z]`)
+
+// iconSizes are the hicolor theme directories searched for an icon, best first.
+var iconSizes = []string{"scalable", "512x512", "256x256", "192x192", "128x128", "96x96", "64x64", "48x48", "32x32"}
+
+// App is an application the container provides through a desktop entry.
+type App struct {
+	// ID is the desktop entry's file name without .desktop, e.g.
+	// "microsoft-edge".
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Exec     string `json:"exec"`
+	Icon     string `json:"icon,omitempty"`
+	WMClass  string `json:"wm_class,omitempty"`
+	Exported bool   `json:"exported"`
+}
+
+// Command returns the shell command that launches the app: its Exec line
+// without field codes. Exec quoting follows the shell's double-quote rules,
+// so the line can be handed to sh as it is.
+func (a App) Command() string {
+	cmd := fieldCode.ReplaceAllStringFunc(a.Exec, func(code string) string {
+		if code == "%%" {
+			return "%"
+		}
+		return ""
+	})
+	return strings.Join(strings.Fields(cmd), " ")
+}
+
+// ExecArg quotes s as a single argument of a desktop entry's Exec key: in
+// double quotes when it has any reserved character, with % doubled so it is
+// not read as a field code, and with the string escapes of the value applied
+// on top.
+func ExecArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\r\"'\\><~|&;$*?#()`") {
+		return strings.ReplaceAll(s, "%", "%%")
+	}
+	q := strings.NewReplacer(`"`, `\"`, "`", "\\`", `$`, `\$`, `\`, `\\`).Replace(s)
+	return escape(strings.ReplaceAll(`"`+q+`"`, "%", "%%"))
+}
+
+// escape encodes s as a desktop entry string value, the reverse of unescape.
+// Other control characters, which a value cannot hold, are dropped.
+func escape(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s)
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// dataDirs returns the container's XDG data directories as host paths,
+// highest priority first: the container user's, then the system's.
+func dataDirs(rootfs, home string) []string {
+	return []string{
+		filepath.Join(home, ".local", "share"),
+		filepath.Join(rootfs, "usr", "local", "share"),
+		filepath.Join(rootfs, "usr", "share"),
+	}
+}
+
+// List returns the applications of the container whose rootfs is rootfs and
+// whose user's home is home on the host, sorted by ID. Entries hidden from
+// menus (NoDisplay, Hidden) or that are not applications are left out, like
+// a desktop's application grid does. Exported is set from the profile's
+// exported entries.
+func List(rootfs, home, profile string) ([]App, error) {
+	exported, err := ExportedIDs(profile)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var apps []App
+	for _, dir := range dataDirs(rootfs, home) {
+		entries, err := os.ReadDir(filepath.Join(dir, "applications"))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			id, ok := strings.CutSuffix(e.Name(), ".desktop")
+			if !ok || seen[id] || !validID.MatchString(id) {
+				continue
+			}
+			// A user entry shadows a system one, even a hidden one.
+			seen[id] = true
+			path := resolveInRoot(rootfs, filepath.Join(dir, "applications", e.Name()))
+			app, visible, err := parseEntry(path)
+			if err != nil || !visible {
+				continue
+			}
+			app.ID = id
+			app.Exported = slices.Contains(exported, id)
+			apps = append(apps, app)
+		}
+	}
+	slices.SortFunc(apps, func(a, b App) int { return strings.Compare(a.ID, b.ID) })
+	return apps, nil
+}
+
+// Find returns the container application with the given ID.
+func Find(rootfs, home, profile, id string) (App, error) {
+	list, err := List(rootfs, home, profile)
+	if err != nil {
+		return App{}, err
+	}
+	for _, a := range list {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return App{}, fmt.Errorf("no application %q in the container — run 'intuneme app list' to see the available IDs", id)
+}
+
+// parseEntry reads the [Desktop Entry] group of a desktop file. visible is
+// false for entries a menu would not show.
+func parseEntry(path string) (App, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return App{}, false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	keys := map[string]string{}
+	inEntry := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		if !inEntry {
+			continue
+		}
+		// Localized keys such as Name[de] are skipped: the untranslated
+		// name is the one shown next to the host's own apps.
+		if key, val, ok := strings.Cut(line, "="); ok {
+			keys[strings.TrimSpace(key)] = unescape(strings.TrimSpace(val))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return App{}, false, err
+	}
+
+	app := App{Name: keys["Name"], Exec: keys["Exec"], Icon: keys["Icon"], WMClass: keys["StartupWMClass"]}
+	visible := keys["Type"] == "Application" && app.Name != "" && app.Exec != "" &&
+		keys["NoDisplay"] != "true" && keys["Hidden"] != "true" && keys["Terminal"] != "true"
+	return app, visible, nil
+}
+
+// unescape decodes the escapes allowed in desktop entry string values.
+func unescape(s string) string {
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`).Replace(s)
+}
+
+// resolveInRoot follows symlinks in the final element of path as the
+// container would: absolute targets are relative to rootfs, not to the host.
+func resolveInRoot(rootfs, path string) string {
+	for range 8 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return path
+		}
+		if filepath.IsAbs(target) {
+			path = filepath.Join(rootfs, filepath.Clean("/"+target))
+		} else {
+			path = filepath.Join(filepath.Dir(path), target)
+		}
+	}
+	return path
+}
+
+// within reports whether path, with every symlink resolved, lies under one
+// of dirs. Icons are copied out of the container, so a desktop entry must not
+// be able to point one at a host file.
+func within(path string, dirs ...string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range dirs {
+		if d, err := filepath.EvalSymlinks(dir); err == nil {
+			if rel, err := filepath.Rel(d, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findIcon returns the host path of an app's icon, looked up like the
+// container's desktop would in the hicolor theme and pixmaps, or "".
+func findIcon(rootfs, home, icon string) string {
+	if icon == "" {
+		return ""
+	}
+	if filepath.IsAbs(icon) {
+		path := resolveInRoot(rootfs, filepath.Join(rootfs, filepath.Clean(icon)))
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && within(path, rootfs, home) {
+			return path
+		}
+		return ""
+	}
+	// A relative Icon is a theme icon name, never a path.
+	if strings.ContainsRune(icon, '/') || icon == ".." {
+		return ""
+	}
+	var candidates []string
+	for _, dir := range dataDirs(rootfs, home) {
+		for _, size := range iconSizes {
+			for _, ext := range []string{".svg", ".png"} {
+				candidates = append(candidates, filepath.Join(dir, "icons", "hicolor", size, "apps", icon+ext))
+			}
+		}
+	}
+	for _, ext := range []string{".svg", ".png", ".xpm"} {
+		candidates = append(candidates, filepath.Join(rootfs, "usr", "share", "pixmaps", icon+ext))
+	}
+	for _, c := range candidates {
+		path := resolveInRoot(rootfs, c)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && within(path, rootfs, home) {
+			return path
+		}
+	}
+	return ""
+}
+
+// hostID returns the host desktop entry name for an exported app.
+func hostID(profile, id string) string {
+	if profile == "" || profile == config.DefaultProfile {
+		return "intuneme-" + id
+	}
+	return "intuneme-" + profile + "-" + id
+}
+
+// applicationsDir returns the host user's desktop entry directory.
+func applicationsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "applications"), nil
+}
+
+// iconsDir is where exported icons are kept, in the profile's data root so
+// they go away with it.
+func iconsDir(root string) string {
+	return filepath.Join(root, "icons")
+}
+
+// DesktopFileContent renders the host desktop entry for an exported app,
+// which launches it through `intuneme open`. iconPath is the copied icon, or
+// "" to fall back to the icon name from the container.
+func DesktopFileContent(execPath, profile string, app App, iconPath string) string {
+	exec := ExecArg(execPath)
+	label := "intuneme"
+	if profile != "" && profile != config.DefaultProfile {
+		exec += " --profile " + profile
+		label = "intuneme " + profile
+	}
+	icon := iconPath
+	if icon == "" {
+		icon = app.Icon
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `# Exported by 'intuneme app export'.
+[Desktop Entry]
+Type=Application
+Name=%s (%s)
+Comment=Runs in the intuneme container
+Exec=%s open %s
+Terminal=false
+`, escape(app.Name), label, exec, app.ID)
+	if icon != "" {
+		fmt.Fprintf(&b, "Icon=%s\n", escape(icon))
+	}
+	if app.WMClass != "" {
+		fmt.Fprintf(&b, "StartupWMClass=%s\n", escape(app.WMClass))
+	}
+	fmt.Fprintf(&b, "X-Intuneme-Profile=%s\nX-Intuneme-App=%s\n", profileName(profile), app.ID)
+	return b.String()
+}
+
+func profileName(profile string) string {
+	if profile == "" {
+		return config.DefaultProfile
+	}
+	return profile
+}
+
+// Export writes a host desktop entry for app, with its icon copied out of
+// the container, so it shows up in the host's application grid. root is the
+// profile's data root.
+func Export(r runner.Runner, rootfs, home, root, execPath, profile string, app App) error {
+	dir, err := applicationsDir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, hostID(profile, app.ID)+".desktop")
+	if runner.DryRun(r, "write %s", path) {
+		return nil
+	}
+
+	var iconPath string
+	if src := findIcon(rootfs, home, app.Icon); src != "" {
+		iconPath = filepath.Join(iconsDir(root), hostID(profile, app.ID)+filepath.Ext(src))
+		if err := copyFile(src, iconPath); err != nil {
+			return fmt.Errorf("copy icon of %s: %w", app.ID, err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create applications dir: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(DesktopFileContent(execPath, profile, app, iconPath)), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Unexport removes the host desktop entry and icon of an exported app. An
+// app that is not exported is not an error.
+func Unexport(r runner.Runner, root, profile, id string) error {
+	dir, err := applicationsDir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, hostID(profile, id)+".desktop")
+	if runner.DryRun(r, "remove %s", path) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", filepath.Base(path), err)
+	}
+	icons, _ := filepath.Glob(filepath.Join(iconsDir(root), hostID(profile, id)+".*"))
+	for _, icon := range icons {
+		_ = os.Remove(icon)
+	}
+	return nil
+}
+
+// ExportedIDs returns the IDs of the profile's exported apps, found by the
+// markers DesktopFileContent writes.
+func ExportedIDs(profile string) ([]string, error) {
+	dir, err := applicationsDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "intuneme-*.desktop"))
+	var ids []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil || !bytes.Contains(data, []byte("\nX-Intuneme-Profile="+profileName(profile)+"\n")) {
+			continue
+		}
+		for line := range strings.Lines(string(data)) {
+			if id, ok := strings.CutPrefix(strings.TrimSpace(line), "X-Intuneme-App="); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// ValidateID reports whether id is usable as an app ID.
+func ValidateID(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid application ID %q", id)
+	}
+	return nil
+}
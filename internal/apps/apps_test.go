@@ -0,0 +1,194 @@
+package apps
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeContainer builds a rootfs and container home with a few desktop
+// entries and points the host home at a temporary directory.
+func fakeContainer(t *testing.T) (rootfs, home string) {
+	t.Helper()
+	rootfs, home = t.TempDir(), t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+
+	sys := filepath.Join(rootfs, "usr", "share", "applications")
+	writeFile(t, filepath.Join(rootfs, "opt", "microsoft", "msedge", "microsoft-edge.desktop"),
+		"[Desktop Entry]\nType=Application\nName=Microsoft Edge\nName[de]=Microsoft Edge DE\nExec=/usr/bin/microsoft-edge-stable %U\nIcon=microsoft-edge\nStartupWMClass=microsoft-edge\n\n[Desktop Action new-window]\nName=New Window\nExec=/usr/bin/microsoft-edge-stable --new-window\n")
+	if err := os.MkdirAll(sys, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Packages often link their entry from /opt; the link is absolute inside the container.
+	if err := os.Symlink("/opt/microsoft/msedge/microsoft-edge.desktop", filepath.Join(sys, "microsoft-edge.desktop")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(sys, "azurevpnclient.desktop"),
+		"[Desktop Entry]\nType=Application\nName=Azure VPN Client\nExec=/opt/microsoft/microsoft-azurevpnclient/microsoft-azurevpnclient\nIcon=/opt/microsoft/microsoft-azurevpnclient/icon.png\n")
+	writeFile(t, filepath.Join(rootfs, "opt", "microsoft", "microsoft-azurevpnclient", "icon.png"), "png")
+	writeFile(t, filepath.Join(sys, "helper.desktop"), "[Desktop Entry]\nType=Application\nName=Helper\nExec=helper\nNoDisplay=true\n")
+	writeFile(t, filepath.Join(sys, "intune-portal.desktop"), "[Desktop Entry]\nType=Application\nName=System Portal\nExec=intune-portal\n")
+	writeFile(t, filepath.Join(rootfs, "usr", "share", "icons", "hicolor", "256x256", "apps", "microsoft-edge.png"), "png")
+
+	user := filepath.Join(home, ".local", "share", "applications")
+	writeFile(t, filepath.Join(user, "intune-portal.desktop"), "[Desktop Entry]\nType=Application\nName=Intune Portal\nExec=intune-portal\n")
+	writeFile(t, filepath.Join(user, "msedge-teams-Default.desktop"),
+		"[Desktop Entry]\nType=Application\nName=Microsoft\\sTeams\nExec=/opt/microsoft/msedge/microsoft-edge --profile-directory=Default --app-id=teams \"--app-url=https://teams.microsoft.com/?a=1%%\"\nIcon=msedge-teams-Default\n")
+	writeFile(t, filepath.Join(home, ".local", "share", "icons", "hicolor", "128x128", "apps", "msedge-teams-Default.png"), "png")
+	return rootfs, home
+}
+
+func TestList(t *testing.T) {
+	rootfs, home := fakeContainer(t)
+	list, err := List(rootfs, home, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range list {
+		got = append(got, a.ID+"="+a.Name)
+	}
+	want := []string{"azurevpnclient=Azure VPN Client", "intune-portal=Intune Portal", "microsoft-edge=Microsoft Edge", "msedge-teams-Default=Microsoft Teams"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("List = %q, want %q", got, want)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct{ exec, want string }{
+		{"/usr/bin/microsoft-edge-stable %U", "/usr/bin/microsoft-edge-stable"},
+		{"app --name \"A B\" %f --pct=100%%", "app --name \"A B\" --pct=100%"},
+		{"intune-portal", "intune-portal"},
+	}
+	for _, tt := range tests {
+		if got := (App{Exec: tt.exec}).Command(); got != tt.want {
+			t.Errorf("Command(%q) = %q, want %q", tt.exec, got, tt.want)
+		}
+	}
+}
+
+func TestExecArg(t *testing.T) {
+	tests := []struct{ arg, want string }{
+		{"/usr/bin/intuneme", "/usr/bin/intuneme"},
+		{"/opt/100%/intuneme", "/opt/100%%/intuneme"},
+		{"/home/a b/intuneme", `"/home/a b/intuneme"`},
+		{"/tmp/$x`y`/\"z\"", `"/tmp/\\$x\\` + "`" + `y\\` + "`" + `/\\"z\\""`},
+	}
+	for _, tt := range tests {
+		if got := ExecArg(tt.arg); got != tt.want {
+			t.Errorf("ExecArg(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	rootfs, home := fakeContainer(t)
+	root := t.TempDir()
+	r := &runner.SystemRunner{}
+
+	for _, id := range []string{"microsoft-edge", "msedge-teams-Default", "azurevpnclient"} {
+		app, err := Find(rootfs, home, "work", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Export(r, rootfs, home, root, "/usr/bin/intuneme", "work", app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".local", "share", "applications", "intuneme-work-microsoft-edge.desktop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Name=Microsoft Edge (intuneme work)\n",
+		"Exec=/usr/bin/intuneme --profile work open microsoft-edge\n",
+		"Icon=" + filepath.Join(root, "icons", "intuneme-work-microsoft-edge.png") + "\n",
+		"StartupWMClass=microsoft-edge\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("desktop entry missing %q:\n%s", want, data)
+		}
+	}
+	for _, icon := range []string{"intuneme-work-msedge-teams-Default.png", "intuneme-work-azurevpnclient.png"} {
+		if _, err := os.Stat(filepath.Join(root, "icons", icon)); err != nil {
+			t.Errorf("icon not copied: %v", err)
+		}
+	}
+
+	ids, err := ExportedIDs("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "azurevpnclient,microsoft-edge,msedge-teams-Default" {
+		t.Errorf("ExportedIDs(work) = %q", ids)
+	}
+	if ids, _ := ExportedIDs("default"); len(ids) != 0 {
+		t.Errorf("ExportedIDs(default) = %q, want none", ids)
+	}
+
+	if err := Unexport(r, root, "work", "microsoft-edge"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "icons", "intuneme-work-microsoft-edge.png")); !os.IsNotExist(err) {
+		t.Errorf("icon not removed: %v", err)
+	}
+	list, _ := List(rootfs, home, "work")
+	for _, a := range list {
+		if a.Exported != (a.ID == "azurevpnclient" || a.ID == "msedge-teams-Default") {
+			t.Errorf("%s: Exported = %v", a.ID, a.Exported)
+		}
+	}
+}
+
+func TestFindIcon_StaysInContainer(t *testing.T) {
+	rootfs, home := fakeContainer(t)
+	outside := filepath.Join(filepath.Dir(rootfs), "secret.png")
+	writeFile(t, outside, "secret")
+	link := filepath.Join(rootfs, "usr", "share", "pixmaps", "escape.png")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "..", "..", "..", "secret.png"), link); err != nil {
+		t.Fatal(err)
+	}
+	for _, icon := range []string{"/../secret", "/../secret.png", "../../../../../secret", "escape"} {
+		if got := findIcon(rootfs, home, icon); got != "" {
+			t.Errorf("findIcon(%q) = %q, want nothing outside the container", icon, got)
+		}
+	}
+	if got := findIcon(rootfs, home, "microsoft-edge"); got == "" {
+		t.Error("findIcon(microsoft-edge) found nothing")
+	}
+}
+
+func TestDesktopFileContent_Escapes(t *testing.T) {
+	app := App{ID: "evil", Name: "Evil\nExec=sh -c id", Icon: "icon\nExec=x", WMClass: "w\\m\x07"}
+	content := DesktopFileContent("/home/a b/intuneme", "", app, "")
+	for _, want := range []string{
+		"Name=Evil\\nExec=sh -c id (intuneme)\n",
+		"Exec=\"/home/a b/intuneme\" open evil\n",
+		"Icon=icon\\nExec=x\n",
+		"StartupWMClass=w\\\\m\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("desktop entry missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Count(content, "\nExec=") != 1 {
+		t.Errorf("desktop entry has an injected Exec line:\n%s", content)
+	}
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestRunner_RecordsOnlyPrivileged(t *testing.T) {
+	root := t.TempDir()
+	inner := &runner.Recorder{}
+	r := NewRunner(inner, root)
+
+	if _, err := r.Run("machinectl", "show", "intuneme"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RunContext(context.Background(), "sudo", "udevadm", "control", "--reload-rules"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunAttached("sudo", "-v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunBackground("sudo", "systemd-nspawn", "-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunStream(context.Background(), io.Discard, "sudo", "journalctl", "-f"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.Steps) != 5 {
+		t.Fatalf("expected every command to reach the wrapped runner, got %v", inner.Steps)
+	}
+
+	entries, err := Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 privileged entries, got %d: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Command != "sudo" || strings.Join(e.Args, " ") != "udevadm control --reload-rules" || e.ExitStatus != 0 {
+		t.Errorf("unexpected first entry: %+v", e)
+	}
+	if !entries[2].Background {
+		t.Error("expected RunBackground entry to be marked background")
+	}
+	if e := entries[3]; strings.Join(e.Args, " ") != "journalctl -f" || e.Background {
+		t.Errorf("unexpected RunStream entry: %+v", e)
+	}
+}
+
+func TestRunner_RecordsFailure(t *testing.T) {
+	root := t.TempDir()
+	inner := &runner.Recorder{}
+	inner.Answer("sudo false", runner.Reply{Err: errors.New("boom")})
+	r := NewRunner(inner, root)
+	if _, err := r.Run("sudo", "false"); err == nil {
+		t.Fatal("expected the wrapped error to be returned")
+	}
+	entries, _ := Read(root)
+	if len(entries) != 1 || entries[0].ExitStatus != -1 || entries[0].Error != "boom" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestRunner_Appends(t *testing.T) {
+	root := t.TempDir()
+	for range 2 {
+		r := NewRunner(&runner.Recorder{}, root)
+		if _, err := r.Run("sudo", "true"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := Read(root)
+	if len(entries) != 2 {
+		t.Errorf("expected entries from both runs, got %d", len(entries))
+	}
+	fi, err := os.Stat(Path(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("audit log mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+func TestRunner_Duration(t *testing.T) {
+	root := t.TempDir()
+	r := NewRunner(&runner.Recorder{}, root)
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	calls := 0
+	r.now = func() time.Time {
+		calls++
+		return base.Add(time.Duration(calls-1) * 250 * time.Millisecond)
+	}
+	if _, err := r.Run("sudo", "true"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := Read(root)
+	if len(entries) != 1 || entries[0].DurationMS != 250 || !entries[0].Time.Equal(base) {
+		t.Errorf("unexpected entry: %+v", entries)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{[]string{"install", "-m", "0644", "/tmp/x", "/etc/y"}, []string{"install", "-m", "0644", "/tmp/x", "/etc/y"}},
+		{[]string{"helper", "1", "exec env 'API_TOKEN=abc123' 'curl'"}, []string{"helper", "1", "exec env 'API_TOKEN=" + redacted + "' 'curl'"}},
+		{[]string{"tool", "--password", "hunter2", "--secret=xyz"}, []string{"tool", "--password", redacted, "--secret=" + redacted}},
+		{[]string{"curl", "https://user:pw@proxy.example.com:8080/"}, []string{"curl", "https://user:" + redacted + "@proxy.example.com:8080/"}},
+		{[]string{"DB_PASSWORD=x", "HOME=/root"}, []string{"DB_PASSWORD=" + redacted, "HOME=/root"}},
+	}
+	for _, tt := range tests {
+		got := Redact(tt.in)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRead_Missing(t *testing.T) {
+	entries, err := Read(t.TempDir())
+	if err != nil || entries != nil {
+		t.Errorf("Read on missing log = (%v, %v), want (nil, nil)", entries, err)
+	}
+}
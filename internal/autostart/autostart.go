@@ -0,0 +1,205 @@
+package autostart
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/provision"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/sudo"
+)
+
+// UnitName returns the systemd user unit that starts a machine at login.
+func UnitName(machine string) string {
+	return machine + "-autostart.service"
+}
+
+// UnitPath returns where the machine's autostart unit is installed.
+func UnitPath(machine string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "systemd", "user", UnitName(machine)), nil
+}
+
+// Enabled reports whether autostart is enabled for the machine, i.e. whether
+// its user unit is installed.
+func Enabled(machine string) bool {
+	path, err := UnitPath(machine)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// profileArgs returns the --profile flag for a non-default profile.
+func profileArgs(profile string) []string {
+	if profile == "" || profile == config.DefaultProfile {
+		return nil
+	}
+	return []string{"--profile", profile}
+}
+
+// UnitContent renders the user unit that runs `intuneme start --unattended`
+// when the graphical session starts. It stays active after start returns so
+// the broker proxy and login session it spawns live as long as the session.
+func UnitContent(execPath, profile, machine string) string {
+	exec := execPath + " start --unattended"
+	for _, arg := range profileArgs(profile) {
+		exec += " " + arg
+	}
+	return fmt.Sprintf(`# Installed by 'intuneme autostart enable'.
+[Unit]
+Description=Start the intuneme container %s at login
+PartOf=graphical-session.target
+After=graphical-session.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=%s
+TimeoutStartSec=5min
+
+[Install]
+WantedBy=graphical-session.target
+`, machine, exec)
+}
+
+// HelperPath returns the root-owned copy of intuneme that the machine's
+// service unit runs as its post-boot hook. The unit runs it as root and the
+// polkit rule lets the user start the unit, so it must not be a binary the
+// user can replace, such as one in ~/go/bin.
+func HelperPath(machine string) string {
+	return nspawn.NsenterHelperDir(machine) + "/intuneme"
+}
+
+// PostBootArgs returns the command the container's service unit runs as root
+// once the container has started, to do the privileged part of
+// `intuneme start` that the unattended start cannot. Everything it needs is
+// on its command line, in the root-owned unit, so it reads nothing the user
+// can write, not even config.toml.
+func PostBootArgs(machine, user string) []string {
+	return []string{HelperPath(machine), "autostart", "post-boot", "--machine", machine, "--user", user}
+}
+
+// InstallHelper copies execPath to HelperPath, root-owned and not writable by
+// anyone else, and checks that no directory above it is either.
+func InstallHelper(ctx context.Context, r runner.Runner, execPath, machine string) error {
+	path := HelperPath(machine)
+	if out, err := r.RunContext(ctx, "sudo", "install", "-d", "-m", "0755", "-o", "root", "-g", "root", filepath.Dir(path)); err != nil {
+		return fmt.Errorf("create %s: %w\n%s", filepath.Dir(path), err, out)
+	}
+	if out, err := r.RunContext(ctx, "sudo", "install", "-m", "0755", "-o", "root", "-g", "root", execPath, path); err != nil {
+		return fmt.Errorf("install %s: %w\n%s", path, err, out)
+	}
+	if runner.DryRun(r, "check that only root can write %s", path) {
+		return nil
+	}
+	return checkRootOwned(path)
+}
+
+// checkRootOwned returns an error unless path and every directory above it
+// are owned by root and writable by nobody else. A group-writable directory is
+// accepted only for group root.
+func checkRootOwned(path string) error {
+	for p := path; ; p = filepath.Dir(p) {
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("cannot read the owner of %s", p)
+		}
+		perm := fi.Mode().Perm()
+		if fi.Mode()&os.ModeSymlink != 0 || st.Uid != 0 || perm&0o002 != 0 || perm&0o020 != 0 && st.Gid != 0 {
+			return fmt.Errorf("refusing to run %s as root: %s can be modified by users other than root", path, p)
+		}
+		if p == "/" {
+			return nil
+		}
+	}
+}
+
+// PolkitRulePath returns the polkit rule that lets the user manage the
+// machine's service unit.
+func PolkitRulePath(machine string) string {
+	return filepath.Join(provision.PolkitRulesDir, "50-"+machine+"-autostart.rules")
+}
+
+// PolkitRule renders a rule that lets user start, stop and otherwise manage
+// the machine's service unit, and no other, without authenticating.
+func PolkitRule(machine, user string) string {
+	return fmt.Sprintf(`// Installed by 'intuneme autostart enable': lets %[2]s manage %[1]s
+// without a password, so the container can start at login.
+polkit.addRule(function(action, subject) {
+    if (action.id == "org.freedesktop.systemd1.manage-units" &&
+        action.lookup("unit") == "%[1]s" &&
+        subject.user == "%[2]s") {
+        return polkit.Result.YES;
+    }
+});
+`, nspawn.UnitName(machine), user)
+}
+
+// Install writes the polkit rule and the user unit and enables the unit, so
+// the container starts at the next login. The service unit itself is
+// installed by the caller.
+func Install(ctx context.Context, r runner.Runner, execPath, profile, machine, user string) error {
+	if err := sudo.WriteFile(ctx, r, PolkitRulePath(machine), []byte(PolkitRule(machine, user)), 0644); err != nil {
+		return fmt.Errorf("install polkit rule: %w", err)
+	}
+	path, err := UnitPath(machine)
+	if err != nil {
+		return err
+	}
+	if !runner.DryRun(r, "write %s", path) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("create systemd user unit dir: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(UnitContent(execPath, profile, machine)), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", UnitName(machine), err)
+		}
+	}
+	if out, err := r.RunContext(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+		return fmt.Errorf("systemctl --user daemon-reload failed: %w\n%s", err, out)
+	}
+	if out, err := r.RunContext(ctx, "systemctl", "--user", "enable", UnitName(machine)); err != nil {
+		return fmt.Errorf("enable %s: %w\n%s", UnitName(machine), err, out)
+	}
+	return nil
+}
+
+// Remove disables and deletes the user unit and removes the polkit rule and
+// the post-boot helper. A missing unit, rule or helper is not an error.
+func Remove(ctx context.Context, r runner.Runner, machine string) error {
+	if path, err := UnitPath(machine); err == nil && Enabled(machine) {
+		_, _ = r.RunContext(ctx, "systemctl", "--user", "disable", UnitName(machine))
+		if !runner.DryRun(r, "remove %s", path) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("remove %s: %w", UnitName(machine), err)
+			}
+		}
+		if out, err := r.RunContext(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+			return fmt.Errorf("systemctl --user daemon-reload failed: %w\n%s", err, out)
+		}
+	}
+	if _, err := os.Stat(PolkitRulePath(machine)); err == nil {
+		if out, err := r.RunContext(ctx, "sudo", "rm", "-f", PolkitRulePath(machine)); err != nil {
+			return fmt.Errorf("remove polkit rule: %w\n%s", err, out)
+		}
+	}
+	if _, err := os.Stat(HelperPath(machine)); err == nil {
+		if out, err := r.RunContext(ctx, "sudo", "rm", "-f", HelperPath(machine)); err != nil {
+			return fmt.Errorf("remove %s: %w\n%s", HelperPath(machine), err, out)
+		}
+	}
+	return nil
+}
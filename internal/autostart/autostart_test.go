@@ -0,0 +1,80 @@
+package autostart
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestUnitContent(t *testing.T) {
+	content := UnitContent("/usr/bin/intuneme", "work", "intuneme-work")
+	for _, want := range []string{
+		"ExecStart=/usr/bin/intuneme start --unattended --profile work\n",
+		"Type=oneshot",
+		"RemainAfterExit=yes",
+		"WantedBy=graphical-session.target",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("unit missing %q:\n%s", want, content)
+		}
+	}
+	if c := UnitContent("/usr/bin/intuneme", "default", "intuneme"); !strings.Contains(c, "ExecStart=/usr/bin/intuneme start --unattended\n") {
+		t.Errorf("default profile should have no --profile flag:\n%s", c)
+	}
+}
+
+func TestPostBootArgs(t *testing.T) {
+	got := PostBootArgs("intuneme-work", "alice")
+	want := []string{"/usr/local/libexec/intuneme-work/intuneme", "autostart", "post-boot", "--machine", "intuneme-work", "--user", "alice"}
+	if !slices.Equal(got, want) {
+		t.Errorf("PostBootArgs = %q, want %q", got, want)
+	}
+}
+
+func TestInstallHelper(t *testing.T) {
+	rec := &runner.Recorder{}
+	if err := InstallHelper(context.Background(), rec, "/home/alice/go/bin/intuneme", "intuneme"); err != nil {
+		t.Fatal(err)
+	}
+	want := "sudo install -m 0755 -o root -g root /home/alice/go/bin/intuneme /usr/local/libexec/intuneme/intuneme"
+	if len(rec.Steps) < 2 || rec.Steps[1].String() != want {
+		t.Errorf("steps = %v, want the helper copied with %q", rec.Steps, want)
+	}
+}
+
+func TestCheckRootOwned(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("files created by root are root-owned")
+	}
+	path := filepath.Join(t.TempDir(), "intuneme")
+	if err := os.WriteFile(path, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRootOwned(path); err == nil {
+		t.Error("checkRootOwned accepted a file owned by the user")
+	}
+	if err := checkRootOwned("/"); err != nil {
+		t.Errorf("checkRootOwned(/) = %v", err)
+	}
+}
+
+func TestPolkitRule(t *testing.T) {
+	rule := PolkitRule("intuneme-work", "alice")
+	for _, want := range []string{
+		`action.id == "org.freedesktop.systemd1.manage-units"`,
+		`action.lookup("unit") == "intuneme-work.service"`,
+		`subject.user == "alice"`,
+	} {
+		if !strings.Contains(rule, want) {
+			t.Errorf("rule missing %q:\n%s", want, rule)
+		}
+	}
+	if PolkitRulePath("intuneme-work") != "/etc/polkit-1/rules.d/50-intuneme-work-autostart.rules" {
+		t.Errorf("PolkitRulePath = %q", PolkitRulePath("intuneme-work"))
+	}
+}
@@ -0,0 +1,42 @@
+package broker
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// maxLogSize is the size at which a proxy log is rotated to <name>.1 when
+// the proxy starts.
+const maxLogSize = 1 << 20
+
+// LogPath returns the broker-proxy log file under the data root. The proxy is
+// started detached (setsid or D-Bus activation), so its stderr is discarded;
+// this file is where `intuneme logs` finds its output.
+func LogPath(root string) string {
+	return filepath.Join(root, "broker-proxy.log")
+}
+
+// SetupLog points the standard logger at the broker-proxy log file (and
+// stderr, for foreground runs), rotating the previous file if it has grown
+// past maxLogSize. Timestamps are UTC with microseconds, the format
+// `intuneme logs` parses. The caller closes the returned file.
+func SetupLog(root string) (*os.File, error) {
+	return OpenLog(LogPath(root))
+}
+
+// OpenLog is SetupLog for another host proxy's log file at path.
+func OpenLog(path string) (*os.File, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Size() > maxLogSize {
+		_ = os.Rename(path, path+".1")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", filepath.Base(path), err)
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, f))
+	log.SetFlags(log.LUTC | log.Ldate | log.Ltime | log.Lmicroseconds)
+	return f, nil
+}
@@ -8,9 +8,12 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/introspect"
 )
@@ -19,6 +22,10 @@ const (
 	BusName       = "com.microsoft.identity.broker1"
 	ObjectPath    = "/com/microsoft/identity/broker1"
 	InterfaceName = "com.microsoft.identity.Broker1"
+
+	// ErrContainerPaused is the D-Bus error returned for calls made while the
+	// container is paused and the proxy is not allowed to resume it.
+	ErrContainerPaused = "org.frostyard.intuneme.Error.ContainerPaused"
 )
 
 // introspectXML describes the Broker1 interface for D-Bus introspection.
@@ -97,9 +104,15 @@ func ContainerBusAddress(root string) string {
 }
 
 // DBusServiceFileContent returns the content of a D-Bus service activation file
-// that launches the broker-proxy subcommand.
-func DBusServiceFileContent(execPath string) string {
-	return fmt.Sprintf("[D-BUS Service]\nName=%s\nExec=%s broker-proxy\n", BusName, execPath)
+// that launches the broker-proxy subcommand. The broker bus name is unique on the
+// host session bus, so activation always targets a single profile; profile is
+// omitted from the command line for the default profile.
+func DBusServiceFileContent(execPath, profile string) string {
+	exec := execPath + " broker-proxy"
+	if profile != "" && profile != config.DefaultProfile {
+		exec += " --profile " + profile
+	}
+	return fmt.Sprintf("[D-BUS Service]\nName=%s\nExec=%s\n", BusName, exec)
 }
 
 // DBusServiceFilePath returns the path where the D-Bus service activation file
@@ -161,24 +174,113 @@ func StopByPIDFile(pidPath string) {
 	_ = os.Remove(pidPath)
 }
 
+// ActivityPath returns the file whose modification time records the last call
+// the proxy forwarded. The agent's idle policy reads it.
+func ActivityPath(root string) string {
+	return filepath.Join(root, "broker-activity")
+}
+
+// LastActivity returns when the proxy last forwarded a call, or false if it
+// never has.
+func LastActivity(root string) (time.Time, bool) {
+	info, err := os.Stat(ActivityPath(root))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// recordActivity marks a forwarded call in ActivityPath. Best-effort.
+func recordActivity(root string) {
+	path := ActivityPath(root)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); os.IsNotExist(err) {
+		_ = os.WriteFile(path, nil, 0o644)
+	}
+}
+
+// Options controls how Run treats a paused container.
+type Options struct {
+	// Paused reports whether the container is paused. Nil means it never is.
+	Paused func(ctx context.Context) bool
+	// Resume resumes a paused container before a call is forwarded. When nil,
+	// calls made while the container is paused fail with ErrContainerPaused.
+	Resume func(ctx context.Context) error
+}
+
 // forwarder proxies D-Bus method calls from the host session bus to the
 // container's microsoft-identity-broker instance.
 type forwarder struct {
+	root string
+	opts Options
+
+	mu            sync.Mutex
 	containerConn *dbus.Conn
 }
 
+// conn returns the connection to the container's session bus, dialing it if
+// the proxy started while the container was paused.
+func (f *forwarder) conn() (*dbus.Conn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.containerConn == nil {
+		conn, err := DialContainerBus(f.root)
+		if err != nil {
+			return nil, err
+		}
+		f.containerConn = conn
+	}
+	return f.containerConn, nil
+}
+
+// ready makes sure the container can answer a call, resuming it if it is
+// paused and Options allows that.
+func (f *forwarder) ready(method, correlationID string) *dbus.Error {
+	// Bounded, so a hung machinectl or freezer write cannot block the D-Bus
+	// handler forever.
+	ctx, cancel := context.WithTimeout(context.Background(), runner.QueryTimeout)
+	defer cancel()
+	if f.opts.Paused == nil || !f.opts.Paused(ctx) {
+		return nil
+	}
+	if f.opts.Resume == nil {
+		log.Printf("%s (correlation %s) rejected: container is paused", method, correlationID)
+		return dbus.NewError(ErrContainerPaused, []any{"the intuneme container is paused — run 'intuneme resume'"})
+	}
+	log.Printf("%s (correlation %s): resuming paused container", method, correlationID)
+	if err := f.opts.Resume(ctx); err != nil {
+		log.Printf("resume failed: %v", err)
+		return dbus.NewError(ErrContainerPaused, []any{fmt.Sprintf("the intuneme container is paused and could not be resumed: %v", err)})
+	}
+	return nil
+}
+
 func (f *forwarder) forward(method, protocolVersion, correlationID, requestJSON string) (string, *dbus.Error) {
-	call := f.containerConn.Object(BusName, dbus.ObjectPath(ObjectPath)).Call(
+	if err := f.ready(method, correlationID); err != nil {
+		return "", err
+	}
+	recordActivity(f.root)
+	containerConn, err := f.conn()
+	if err != nil {
+		log.Printf("%s (correlation %s) failed: %v", method, correlationID, err)
+		return "", dbus.MakeFailedError(err)
+	}
+
+	start := time.Now()
+	call := containerConn.Object(BusName, dbus.ObjectPath(ObjectPath)).Call(
 		InterfaceName+"."+method, 0,
 		protocolVersion, correlationID, requestJSON,
 	)
 	if call.Err != nil {
+		log.Printf("%s (correlation %s) failed after %s: %v", method, correlationID, time.Since(start).Round(time.Millisecond), call.Err)
 		return "", dbus.MakeFailedError(call.Err)
 	}
 	var response string
 	if err := call.Store(&response); err != nil {
+		log.Printf("%s (correlation %s) returned an unexpected reply: %v", method, correlationID, err)
 		return "", dbus.MakeFailedError(err)
 	}
+	log.Printf("%s (correlation %s) ok in %s", method, correlationID, time.Since(start).Round(time.Millisecond))
 	return response, nil
 }
 
@@ -217,22 +319,43 @@ func (f *forwarder) GetLinuxBrokerVersion(protocolVersion, correlationID, reques
 	return f.forward("getLinuxBrokerVersion", protocolVersion, correlationID, requestJSON)
 }
 
-// Run connects to the container's D-Bus and the host session bus, exports the
-// forwarder, claims the broker bus name, and blocks until ctx is cancelled.
-func Run(ctx context.Context, root string) error {
+// DialContainerBus connects to the container's session bus.
+func DialContainerBus(root string) (*dbus.Conn, error) {
 	addr := ContainerBusAddress(root)
-	containerConn, err := dbus.Dial(addr)
+	conn, err := dbus.Dial(addr)
 	if err != nil {
-		return fmt.Errorf("dial container bus at %s: %w", addr, err)
+		return nil, fmt.Errorf("dial container bus at %s: %w", addr, err)
 	}
-	defer func() { _ = containerConn.Close() }()
-
-	if err := containerConn.Auth(nil); err != nil {
-		return fmt.Errorf("auth on container bus: %w", err)
+	if err := conn.Auth(nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("auth on container bus: %w", err)
 	}
-	if err := containerConn.Hello(); err != nil {
-		return fmt.Errorf("hello on container bus: %w", err)
+	if err := conn.Hello(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("hello on container bus: %w", err)
 	}
+	return conn, nil
+}
+
+// Run connects to the container's D-Bus and the host session bus, exports the
+// forwarder, claims the broker bus name, and blocks until ctx is cancelled.
+// A paused container's bus cannot answer, so then the container connection is
+// deferred to the first call.
+func Run(ctx context.Context, root string, opts Options) error {
+	addr := ContainerBusAddress(root)
+	fwd := &forwarder{root: root, opts: opts}
+	if opts.Paused == nil || !opts.Paused(ctx) {
+		containerConn, err := DialContainerBus(root)
+		if err != nil {
+			return err
+		}
+		fwd.containerConn = containerConn
+	}
+	defer func() {
+		if fwd.containerConn != nil {
+			_ = fwd.containerConn.Close()
+		}
+	}()
 
 	hostConn, err := dbus.ConnectSessionBus()
 	if err != nil {
@@ -240,8 +363,6 @@ func Run(ctx context.Context, root string) error {
 	}
 	defer func() { _ = hostConn.Close() }()
 
-	fwd := &forwarder{containerConn: containerConn}
-
 	// godbus dispatches by exact method name. The Broker1 D-Bus interface uses
 	// camelCase (e.g. "getLinuxBrokerVersion") but Go requires exported methods
 	// to be PascalCase. ExportWithMap bridges the two.
@@ -276,3 +397,29 @@ func Run(ctx context.Context, root string) error {
 	log.Println("Broker proxy shutting down")
 	return nil
 }
+
+// HostBrokerVersion calls getLinuxBrokerVersion on the broker name as seen on
+// the host session bus, i.e. through the proxy when it is running. It is an
+// end-to-end probe: a reply means host apps can reach the container's broker.
+func HostBrokerVersion(ctx context.Context) (string, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return "", fmt.Errorf("connect host session bus: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Don't trigger D-Bus activation: the probe should report the proxy as
+	// it is, not start it.
+	call := conn.Object(BusName, dbus.ObjectPath(ObjectPath)).CallWithContext(ctx,
+		InterfaceName+".getLinuxBrokerVersion", dbus.FlagNoAutoStart,
+		"0.0", "intuneme-doctor", "{}",
+	)
+	if call.Err != nil {
+		return "", call.Err
+	}
+	var response string
+	if err := call.Store(&response); err != nil {
+		return "", err
+	}
+	return response, nil
+}
@@ -1,12 +1,14 @@
 package broker
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBrokerMethods(t *testing.T) {
@@ -41,7 +43,7 @@ func TestContainerBusAddress(t *testing.T) {
 }
 
 func TestDBusServiceFileContent(t *testing.T) {
-	content := DBusServiceFileContent("/usr/local/bin/intuneme")
+	content := DBusServiceFileContent("/usr/local/bin/intuneme", "default")
 	if !strings.Contains(content, BusName) {
 		t.Errorf("missing bus name in service file content:\n%s", content)
 	}
@@ -53,6 +55,13 @@ func TestDBusServiceFileContent(t *testing.T) {
 	}
 }
 
+func TestDBusServiceFileContent_Profile(t *testing.T) {
+	content := DBusServiceFileContent("/usr/local/bin/intuneme", "clienta")
+	if !strings.Contains(content, "Exec=/usr/local/bin/intuneme broker-proxy --profile clienta\n") {
+		t.Errorf("missing profile in exec line:\n%s", content)
+	}
+}
+
 func TestDBusServiceFilePath(t *testing.T) {
 	path := DBusServiceFilePath()
 	home, err := os.UserHomeDir()
@@ -111,3 +120,49 @@ func TestStopByPIDFile_MissingFile(t *testing.T) {
 	// Should not panic on missing file
 	StopByPIDFile("/nonexistent/path/test.pid")
 }
+
+func TestForwarderReady_Paused(t *testing.T) {
+	paused := func(context.Context) bool { return true }
+
+	f := &forwarder{opts: Options{Paused: paused}}
+	if err := f.ready("getAccounts", "c1"); err == nil || err.Name != ErrContainerPaused {
+		t.Errorf("ready() = %v, want %s", err, ErrContainerPaused)
+	}
+
+	resumed := false
+	f = &forwarder{opts: Options{Paused: paused, Resume: func(context.Context) error {
+		resumed = true
+		return nil
+	}}}
+	if err := f.ready("getAccounts", "c2"); err != nil {
+		t.Errorf("ready() with auto-resume = %v, want nil", err)
+	}
+	if !resumed {
+		t.Error("auto-resume did not resume the container")
+	}
+
+	f = &forwarder{}
+	if err := f.ready("getAccounts", "c3"); err != nil {
+		t.Errorf("ready() without a pause check = %v, want nil", err)
+	}
+}
+
+func TestLastActivity(t *testing.T) {
+	root := t.TempDir()
+	if _, ok := LastActivity(root); ok {
+		t.Fatal("LastActivity reported activity before any call")
+	}
+	recordActivity(root)
+	first, ok := LastActivity(root)
+	if !ok {
+		t.Fatal("LastActivity did not see the recorded call")
+	}
+	past := first.Add(-time.Hour)
+	if err := os.Chtimes(ActivityPath(root), past, past); err != nil {
+		t.Fatal(err)
+	}
+	recordActivity(root)
+	if again, _ := LastActivity(root); !again.After(past) {
+		t.Errorf("recordActivity did not update the time: %v", again)
+	}
+}
@@ -4,10 +4,32 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
 
+// DefaultProfile is the profile used when --profile is not given. Its data
+// root, machine name and ~/Intune directory are the original single-container
+// locations, so installs that predate profiles keep working unchanged.
+const DefaultProfile = "default"
+
+// baseName is the shared prefix for every per-profile name: the data root
+// directory, the machine name and the ~/Intune home. Non-default profiles
+// append "-<profile>" to it.
+const baseName = "intuneme"
+
+// validProfile restricts profile names to characters that are safe in machine
+// names, file paths, sudoers.d file names and udev rule file names.
+var validProfile = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// validMachine applies the profile name rules to machine_name, with room for
+// the "intuneme-" prefix. The machine name ends up in sudoers rules, udev
+// rules, polkit rules and root-run scripts, so config.toml must not be able
+// to smuggle anything else into them.
+var validMachine = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
 type Config struct {
 	MachineName string `toml:"machine_name"`
 	RootfsPath  string `toml:"rootfs_path"`
@@ -15,6 +37,9 @@ type Config struct {
 	HostUser    string `toml:"host_user"`
 	BrokerProxy bool   `toml:"broker_proxy"`
 	Insiders    bool   `toml:"insiders"`
+	// Notifications forwards desktop notifications that container apps send
+	// on the container's session bus to the host's notification server.
+	Notifications bool `toml:"notifications,omitempty"`
 	// MCPBinary is the host path to a self-contained MCP server binary that
 	// `intuneme mcp` runs inside the container. Empty means none is configured
 	// (must be supplied via --binary). The directory holding it is bind-mounted
@@ -26,6 +51,131 @@ type Config struct {
 	// ["mcp"] makes `intuneme mcp` run `<binary> mcp`. Keeps the VS Code config
 	// minimal (just ["mcp"]) by moving the server's own subcommand here.
 	MCPArgs []string `toml:"mcp_args"`
+	// Network selects the container's network: "host" (or empty) shares the
+	// host's namespace, "veth" gives it a private NATed link, and
+	// "bridge:<name>" attaches it to an existing host bridge.
+	Network string `toml:"network,omitempty"`
+	// PrivateUsers runs the container in its own user namespace: "off" (or
+	// empty) keeps host IDs, "pick" lets systemd-nspawn choose a free range at
+	// boot, and "subuid" uses the host user's range from /etc/subuid.
+	PrivateUsers string `toml:"private_users,omitempty"`
+	// Resources are the cgroup limits applied to the container when it boots.
+	Resources Resources `toml:"resources"`
+	// Mounts are extra host directories bind-mounted into the container, from
+	// the [[mounts]] tables of config.toml.
+	Mounts []Mount `toml:"mounts,omitempty"`
+	// Pause is the [pause] table: how a paused container is woken and when
+	// the agent pauses it on its own.
+	Pause Pause `toml:"pause"`
+	// Trust is the [trust] table: host CA certificates added to the
+	// container's trust stores, e.g. for a TLS-inspecting proxy.
+	Trust Trust `toml:"trust"`
+	// Proxy is the [proxy] table: the HTTP proxy the container's apps use.
+	Proxy Proxy `toml:"proxy"`
+	// URLHandler is the [url_handler] table: which links clicked on the host
+	// open in the container's Edge.
+	URLHandler URLHandler `toml:"url_handler"`
+}
+
+// URLHandler holds the [url_handler] table of config.toml.
+type URLHandler struct {
+	// Domains is the allowlist of hosts whose links open in the container,
+	// e.g. "dev.azure.com" or "*.sharepoint.com".
+	Domains []string `toml:"domains,omitempty" json:"domains,omitempty"`
+	// HostBrowser is the desktop entry that opens every other link, e.g.
+	// "firefox.desktop". Recorded by `intuneme config url-handler enable`
+	// from the previous default browser.
+	HostBrowser string `toml:"host_browser,omitempty" json:"host_browser,omitempty"`
+}
+
+// Trust holds the [trust] table of config.toml.
+type Trust struct {
+	// HostAnchors imports every certificate the host administrator added to
+	// the host's trust store (/etc/pki/ca-trust/source/anchors or
+	// /usr/local/share/ca-certificates).
+	HostAnchors bool `toml:"host_anchors,omitempty" json:"host_anchors,omitempty"`
+	// CAFiles are further PEM or DER certificate files or bundles to import.
+	CAFiles []string `toml:"ca_files,omitempty" json:"ca_files,omitempty"`
+}
+
+// Proxy holds the [proxy] table of config.toml. Set values win over the
+// ones taken from the host with FromHost.
+type Proxy struct {
+	// FromHost copies http_proxy, https_proxy and no_proxy from the
+	// environment intuneme runs in.
+	FromHost bool   `toml:"from_host,omitempty" json:"from_host,omitempty"`
+	HTTP     string `toml:"http,omitempty" json:"http,omitempty"`
+	HTTPS    string `toml:"https,omitempty" json:"https,omitempty"`
+	NoProxy  string `toml:"no_proxy,omitempty" json:"no_proxy,omitempty"`
+}
+
+// Pause holds the [pause] table of config.toml.
+type Pause struct {
+	// AutoResume makes the broker proxy resume a paused container when a host
+	// app calls the broker, instead of failing the call.
+	AutoResume bool `toml:"auto_resume,omitempty" json:"auto_resume,omitempty"`
+	// IdleMinutes makes the agent pause the container after this many minutes
+	// with no broker calls and no Edge or Company Portal window. Zero disables.
+	IdleMinutes int `toml:"idle_minutes,omitempty" json:"idle_minutes,omitempty"`
+}
+
+// Mount is one [[mounts]] entry: a host directory and where it appears inside
+// the container. Either path may start with "~/", meaning the host user's home
+// or the container user's home respectively.
+type Mount struct {
+	Host      string `toml:"host" json:"host"`
+	Container string `toml:"container" json:"container"`
+	ReadOnly  bool   `toml:"read_only,omitempty" json:"read_only,omitempty"`
+}
+
+// Resources holds the [resources] table of config.toml. Each field maps to the
+// systemd resource-control property of the same name; zero values leave the
+// systemd default in place.
+type Resources struct {
+	// MemoryMax is the hard memory limit, e.g. "8G" or "50%".
+	MemoryMax string `toml:"memory_max,omitempty" json:"memory_max,omitempty"`
+	// MemoryHigh is the throttling threshold, e.g. "6G" or "40%".
+	MemoryHigh string `toml:"memory_high,omitempty" json:"memory_high,omitempty"`
+	// CPUQuota caps CPU time relative to one CPU, e.g. "200%" for two CPUs.
+	CPUQuota string `toml:"cpu_quota,omitempty" json:"cpu_quota,omitempty"`
+	// IOWeight is the relative block IO weight, 1 to 10000 (default 100).
+	IOWeight int `toml:"io_weight,omitempty" json:"io_weight,omitempty"`
+	// TasksMax caps the number of processes and threads.
+	TasksMax int `toml:"tasks_max,omitempty" json:"tasks_max,omitempty"`
+}
+
+// ValidateProfile reports whether name is usable as a profile name.
+// The empty string is accepted and means DefaultProfile.
+func ValidateProfile(name string) error {
+	if name == "" || name == DefaultProfile {
+		return nil
+	}
+	if !validProfile.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q — use lowercase letters, digits and dashes (max 32 characters)", name)
+	}
+	return nil
+}
+
+// ValidateMachineName reports whether name is usable as a machine name.
+func ValidateMachineName(name string) error {
+	if !validMachine.MatchString(name) {
+		return fmt.Errorf("invalid machine_name %q — use lowercase letters, digits and dashes (max 64 characters)", name)
+	}
+	return nil
+}
+
+// profileSuffix returns the suffix appended to baseName for the profile:
+// empty for the default profile, "-<profile>" otherwise.
+func profileSuffix(profile string) string {
+	if profile == "" || profile == DefaultProfile {
+		return ""
+	}
+	return "-" + profile
+}
+
+// MachineName returns the default systemd-nspawn machine name for a profile.
+func MachineName(profile string) string {
+	return baseName + profileSuffix(profile)
 }
 
 func DefaultRoot() (string, error) {
@@ -33,12 +183,90 @@ func DefaultRoot() (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("cannot determine home directory: %w", err)
 	}
-	return filepath.Join(home, ".local", "share", "intuneme"), nil
+	return filepath.Join(home, ".local", "share", baseName), nil
 }
 
+// ProfileRoot returns the data root for a profile. Profiles live side by side
+// with the default root (~/.local/share/intuneme-<profile>) rather than inside
+// it, so removing one profile's data never touches another's.
+func ProfileRoot(profile string) (string, error) {
+	if err := ValidateProfile(profile); err != nil {
+		return "", err
+	}
+	root, err := DefaultRoot()
+	if err != nil {
+		return "", err
+	}
+	return root + profileSuffix(profile), nil
+}
+
+// IntuneHome returns the host directory bind-mounted as the container user's
+// home for a profile: ~/Intune for the default profile, ~/Intune-<profile>
+// otherwise.
+func IntuneHome(profile string) (string, error) {
+	if err := ValidateProfile(profile); err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	if !filepath.IsAbs(home) {
+		return "", fmt.Errorf("home directory is not an absolute path: %q", home)
+	}
+	return filepath.Join(home, "Intune"+profileSuffix(profile)), nil
+}
+
+// Profiles returns the names of all profiles that have a config.toml, with
+// DefaultProfile first when present.
+func Profiles() ([]string, error) {
+	root, err := DefaultRoot()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Dir(root))
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		var profile string
+		switch name := e.Name(); {
+		case name == baseName:
+			profile = DefaultProfile
+		case strings.HasPrefix(name, baseName+"-"):
+			profile = strings.TrimPrefix(name, baseName+"-")
+			if !validProfile.MatchString(profile) || profile == DefaultProfile {
+				continue
+			}
+		default:
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(root), e.Name(), "config.toml")); err != nil {
+			continue
+		}
+		if profile == DefaultProfile {
+			profiles = append([]string{profile}, profiles...)
+		} else {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles, nil
+}
+
+// Load reads config.toml from root using the default profile's defaults.
 func Load(root string) (*Config, error) {
+	return LoadProfile(root, DefaultProfile)
+}
+
+// LoadProfile reads config.toml from root. Fields missing from the file fall
+// back to the defaults for the given profile.
+func LoadProfile(root, profile string) (*Config, error) {
 	cfg := &Config{
-		MachineName: "intuneme",
+		MachineName: MachineName(profile),
 		RootfsPath:  filepath.Join(root, "rootfs"),
 		HostUID:     os.Getuid(),
 		HostUser:    os.Getenv("USER"),
@@ -53,6 +281,12 @@ func Load(root string) (*Config, error) {
 		if cfg.RootfsPath == "" {
 			cfg.RootfsPath = filepath.Join(root, "rootfs")
 		}
+		if cfg.MachineName == "" {
+			cfg.MachineName = MachineName(profile)
+		}
+		if err := ValidateMachineName(cfg.MachineName); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
 	}
 
 	return cfg, nil
@@ -143,3 +143,109 @@ func FuzzLoad(f *testing.F) {
 		_, _ = Load(tmp)
 	})
 }
+
+func TestValidateProfile(t *testing.T) {
+	for _, name := range []string{"", "default", "clienta", "client-b", "a1"} {
+		if err := ValidateProfile(name); err != nil {
+			t.Errorf("ValidateProfile(%q) unexpected error: %v", name, err)
+		}
+	}
+	for _, name := range []string{"ClientA", "-x", "a/b", "../x", "a b", "a.b", "abcdefghijklmnopqrstuvwxyz0123456789"} {
+		if err := ValidateProfile(name); err == nil {
+			t.Errorf("ValidateProfile(%q) expected error", name)
+		}
+	}
+}
+
+func TestMachineName(t *testing.T) {
+	if got := MachineName(""); got != "intuneme" {
+		t.Errorf("MachineName(\"\") = %q, want intuneme", got)
+	}
+	if got := MachineName(DefaultProfile); got != "intuneme" {
+		t.Errorf("MachineName(default) = %q, want intuneme", got)
+	}
+	if got := MachineName("clienta"); got != "intuneme-clienta" {
+		t.Errorf("MachineName(clienta) = %q, want intuneme-clienta", got)
+	}
+}
+
+func TestProfileRoot(t *testing.T) {
+	def, err := DefaultRoot()
+	if err != nil {
+		t.Fatalf("DefaultRoot() error: %v", err)
+	}
+	got, err := ProfileRoot(DefaultProfile)
+	if err != nil || got != def {
+		t.Errorf("ProfileRoot(default) = %q, %v; want %q", got, err, def)
+	}
+	got, err = ProfileRoot("clienta")
+	if err != nil || got != def+"-clienta" {
+		t.Errorf("ProfileRoot(clienta) = %q, %v; want %q", got, err, def+"-clienta")
+	}
+	if _, err := ProfileRoot("../etc"); err == nil {
+		t.Error("ProfileRoot should reject invalid names")
+	}
+}
+
+func TestIntuneHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	got, err := IntuneHome("")
+	if err != nil || got != filepath.Join(home, "Intune") {
+		t.Errorf("IntuneHome(\"\") = %q, %v", got, err)
+	}
+	got, err = IntuneHome("clienta")
+	if err != nil || got != filepath.Join(home, "Intune-clienta") {
+		t.Errorf("IntuneHome(clienta) = %q, %v", got, err)
+	}
+}
+
+func TestLoadRejectsInvalidMachineName(t *testing.T) {
+	for _, name := range []string{"intune me", "intuneme;rm -rf /", "../intuneme", "Intuneme", `x"y`} {
+		tmp := t.TempDir()
+		toml := "machine_name = '" + name + "'\n"
+		if err := os.WriteFile(filepath.Join(tmp, "config.toml"), []byte(toml), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if _, err := Load(tmp); err == nil {
+			t.Errorf("Load accepted machine_name %q", name)
+		}
+	}
+}
+
+func TestLoadProfileMachineDefault(t *testing.T) {
+	tmp := t.TempDir()
+	cfg, err := LoadProfile(tmp, "clienta")
+	if err != nil {
+		t.Fatalf("LoadProfile error: %v", err)
+	}
+	if cfg.MachineName != "intuneme-clienta" {
+		t.Errorf("MachineName = %q, want intuneme-clienta", cfg.MachineName)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	share := filepath.Join(home, ".local", "share")
+	for _, dir := range []string{"intuneme", "intuneme-clienta", "intuneme-noconfig", "intuneme-Bad", "other"} {
+		if err := os.MkdirAll(filepath.Join(share, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if dir == "intuneme-noconfig" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(share, dir, "config.toml"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Profiles()
+	if err != nil {
+		t.Fatalf("Profiles() error: %v", err)
+	}
+	want := []string{"default", "clienta"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Profiles() = %v, want %v", got, want)
+	}
+}
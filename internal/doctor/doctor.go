@@ -0,0 +1,357 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/broker"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/prereq"
+	"github.com/frostyard/intuneme/internal/provision"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/sudoers"
+	"github.com/frostyard/intuneme/internal/udev"
+)
+
+// Status is the outcome of a single check.
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+	Skip Status = "skip"
+)
+
+// Result is the outcome of one check. Fix is a concrete command or action
+// that resolves a warn or fail.
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Env is what the checks inspect.
+type Env struct {
+	Runner  runner.Runner
+	Root    string
+	Profile string
+	Config  *config.Config
+	// ExecPath is the intuneme binary the D-Bus activation file should launch.
+	ExecPath string
+	// ProbeTimeout bounds the end-to-end broker call.
+	ProbeTimeout time.Duration
+}
+
+// check is a named diagnostic. needsRunning checks are skipped while the
+// container is stopped; needsInit checks are skipped before init.
+type check struct {
+	name         string
+	needsInit    bool
+	needsRunning bool
+	run          func(ctx context.Context, env Env) Result
+}
+
+var checks = []check{
+	{name: "Prerequisites", run: checkPrereqs},
+	{name: "Initialized", run: checkInitialized},
+	{name: "Container running", needsInit: true, run: checkRunning},
+	{name: "Sudoers rule", needsInit: true, run: checkSudoers},
+	{name: "Polkit rule", needsInit: true, run: checkPolkit},
+	{name: "SELinux policy", needsInit: true, run: checkSELinux},
+	{name: "Udev hotplug rules", needsInit: true, run: checkUdev},
+	{name: "Host display and audio sockets", run: checkSockets},
+	{name: "Render group GID", needsInit: true, run: checkRenderGID},
+	{name: "D-Bus activation file", needsInit: true, run: checkDBusServiceFile},
+	{name: "Container session bus", needsRunning: true, run: checkSessionBus},
+	{name: "Keyring unlocked", needsRunning: true, run: checkKeyring},
+	{name: "Broker reachable via proxy", needsRunning: true, run: checkBrokerProxy},
+}
+
+// Run executes every check in order. Cancelling ctx aborts the commands the
+// checks run. sudo runs with -n, so a check that would need a password fails
+// instead of prompting.
+func Run(ctx context.Context, env Env) []Result {
+	if _, ok := env.Runner.(runner.NonInteractive); !ok {
+		env.Runner = runner.NonInteractive{Runner: env.Runner}
+	}
+	initialized := isInitialized(env)
+	running := initialized && nspawn.IsRunning(ctx, env.Runner, env.Config.MachineName)
+
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		var res Result
+		switch {
+		case c.needsInit && !initialized:
+			res = Result{Status: Skip, Detail: "not initialized"}
+		case c.needsRunning && !running:
+			res = Result{Status: Skip, Detail: "container not running"}
+		default:
+			res = c.run(ctx, env)
+		}
+		res.Name = c.name
+		results = append(results, res)
+	}
+	return results
+}
+
+// Failed reports how many results have status Fail.
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == Fail {
+			n++
+		}
+	}
+	return n
+}
+
+func isInitialized(env Env) bool {
+	_, err := os.Stat(env.Config.RootfsPath)
+	return err == nil
+}
+
+// profileFlag returns the --profile argument to include in fix hints.
+func profileFlag(env Env) string {
+	if env.Profile == "" || env.Profile == config.DefaultProfile {
+		return ""
+	}
+	return " --profile " + env.Profile
+}
+
+func checkPrereqs(ctx context.Context, env Env) Result {
+	errs := prereq.Check(env.Runner)
+	if len(errs) == 0 {
+		return Result{Status: Pass, Detail: "systemd-nspawn and machinectl found"}
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return Result{Status: Fail, Detail: strings.Join(msgs, "; "), Fix: "Install the systemd-container package"}
+}
+
+func checkInitialized(ctx context.Context, env Env) Result {
+	if isInitialized(env) {
+		return Result{Status: Pass, Detail: env.Config.RootfsPath}
+	}
+	return Result{Status: Fail, Detail: "no rootfs at " + env.Config.RootfsPath, Fix: "Run 'intuneme" + profileFlag(env) + " init'"}
+}
+
+func checkRunning(ctx context.Context, env Env) Result {
+	if nspawn.IsRunning(ctx, env.Runner, env.Config.MachineName) {
+		return Result{Status: Pass, Detail: env.Config.MachineName}
+	}
+	return Result{Status: Warn, Detail: "container-side checks are skipped", Fix: "Run 'intuneme" + profileFlag(env) + " start'"}
+}
+
+func checkSudoers(ctx context.Context, env Env) Result {
+	if sudoers.IsInstalled(env.Config.HostUser, env.Config.MachineName) {
+		return Result{Status: Pass, Detail: nspawn.NsenterHelperPath(env.Config.MachineName)}
+	}
+	return Result{
+		Status: Fail,
+		Detail: "passwordless nsenter rule or helper missing; app launch from the GNOME extension will fail",
+		Fix:    "Run 'intuneme" + profileFlag(env) + " start' (it reinstalls the rule)",
+	}
+}
+
+func checkPolkit(ctx context.Context, env Env) Result {
+	path := filepath.Join(provision.PolkitRulesDir, provision.PolkitRuleFile(env.Config.MachineName))
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Result{
+			Status: Fail,
+			Detail: path + " missing; machinectl shell/bind will prompt for a password",
+			Fix:    "Run 'intuneme" + profileFlag(env) + " recreate' to reinstall it",
+		}
+	}
+	// polkitd runs as its own user and silently ignores rules it can't read.
+	if fi.Mode().Perm()&0o004 == 0 {
+		return Result{Status: Fail, Detail: path + " is not world-readable; polkitd ignores it", Fix: "sudo chmod 644 " + path}
+	}
+	return Result{Status: Pass, Detail: path}
+}
+
+func checkSELinux(ctx context.Context, env Env) Result {
+	if !provision.SELinuxEnabled() {
+		return Result{Status: Pass, Detail: "SELinux not enabled"}
+	}
+	rootfs := env.Config.RootfsPath
+	out, err := env.Runner.Run("stat", "-c", "%C", rootfs)
+	if err != nil || !strings.Contains(string(out), "container_file_t") {
+		return Result{
+			Status: Fail,
+			Detail: "rootfs is not labeled container_file_t",
+			Fix:    fmt.Sprintf("sudo semanage fcontext -a -t container_file_t '%s(/.*)?' && sudo restorecon -RF %s", rootfs, rootfs),
+		}
+	}
+	out, err = env.Runner.Run("sudo", "semodule", "-l")
+	if err != nil {
+		return Result{Status: Warn, Detail: "could not list SELinux modules (needs sudo)", Fix: "Run 'sudo -v' and re-run doctor"}
+	}
+	if !strings.Contains(string(out), "intuneme-machined") {
+		return Result{Status: Fail, Detail: "intuneme-machined policy module not installed; machinectl shell will fail", Fix: "Run 'bash scripts/fix-selinux.sh --rootfs " + rootfs + "' from the intuneme source tree"}
+	}
+	return Result{Status: Pass, Detail: "rootfs labeled, intuneme-machined module installed"}
+}
+
+func checkUdev(ctx context.Context, env Env) Result {
+	machine := env.Config.MachineName
+	installed := udev.IsInstalled(machine)
+	running := nspawn.IsRunning(ctx, env.Runner, machine)
+	switch {
+	case installed && !fileExists(udev.ScriptPath(machine)):
+		return Result{Status: Fail, Detail: "rules installed but " + udev.ScriptPath(machine) + " is missing", Fix: "Run 'intuneme" + profileFlag(env) + " udev install'"}
+	case installed:
+		return Result{Status: Pass, Detail: udev.RulesPath(machine)}
+	case running:
+		return Result{Status: Warn, Detail: "container running but hotplug rules not installed; YubiKeys and webcams plugged in now won't be forwarded", Fix: "Run 'intuneme" + profileFlag(env) + " udev install'"}
+	}
+	return Result{Status: Pass, Detail: "not installed (installed by start)"}
+}
+
+func checkSockets(ctx context.Context, env Env) Result {
+	found := map[string]bool{}
+	for _, m := range nspawn.DetectHostSockets(env.Config.HostUID) {
+		found[m.Container] = true
+	}
+	x11 := fileExists(x11Socket(nspawn.HostDisplay()))
+
+	var have, missing []string
+	for _, s := range []struct {
+		label string
+		ok    bool
+	}{
+		{"X11", x11},
+		{"Xauthority", found["/run/host-xauthority"]},
+		{"Wayland", found["/run/host-wayland"]},
+		{"PipeWire", found["/run/host-pipewire"]},
+		{"PulseAudio", found["/run/host-pulse"]},
+	} {
+		if s.ok {
+			have = append(have, s.label)
+		} else {
+			missing = append(missing, s.label)
+		}
+	}
+	detail := "found: " + strings.Join(have, ", ")
+	if len(missing) > 0 {
+		detail += "; missing: " + strings.Join(missing, ", ")
+	}
+
+	switch {
+	case !x11:
+		return Result{Status: Fail, Detail: detail, Fix: "Run intuneme from a graphical session with XWayland or X11 (check $DISPLAY)"}
+	case !found["/run/host-xauthority"]:
+		return Result{Status: Warn, Detail: detail, Fix: "Set $XAUTHORITY or log in to a session that creates an Xauthority file"}
+	case !found["/run/host-pipewire"] && !found["/run/host-pulse"]:
+		return Result{Status: Warn, Detail: detail + "; no audio in the container", Fix: "Start PipeWire or PulseAudio in your session"}
+	}
+	return Result{Status: Pass, Detail: detail}
+}
+
+func checkRenderGID(ctx context.Context, env Env) Result {
+	hostGID, err := provision.FindHostRenderGID()
+	if err != nil || hostGID < 0 {
+		return Result{Status: Pass, Detail: "no render group on host"}
+	}
+	containerGID, err := provision.ContainerRenderGID(env.Config.RootfsPath)
+	if err != nil {
+		return Result{Status: Warn, Detail: fmt.Sprintf("cannot read container groups: %v", err)}
+	}
+	if containerGID != hostGID {
+		return Result{
+			Status: Fail,
+			Detail: fmt.Sprintf("host render GID %d, container %d; GPU acceleration in Edge will fail", hostGID, containerGID),
+			Fix:    "Run 'intuneme" + profileFlag(env) + " recreate'",
+		}
+	}
+	return Result{Status: Pass, Detail: fmt.Sprintf("GID %d", hostGID)}
+}
+
+func checkDBusServiceFile(ctx context.Context, env Env) Result {
+	path := broker.DBusServiceFilePath()
+	data, err := os.ReadFile(path)
+	if !env.Config.BrokerProxy {
+		if err == nil && string(data) == broker.DBusServiceFileContent(env.ExecPath, env.Profile) {
+			return Result{Status: Warn, Detail: "broker proxy disabled but activation file still points at this profile", Fix: "Run 'intuneme" + profileFlag(env) + " config broker-proxy disable'"}
+		}
+		return Result{Status: Skip, Detail: "broker proxy disabled"}
+	}
+	fix := "Run 'intuneme" + profileFlag(env) + " config broker-proxy enable' to rewrite it"
+	if err != nil {
+		return Result{Status: Fail, Detail: path + " missing; host apps can't activate the proxy", Fix: fix}
+	}
+	if want := broker.DBusServiceFileContent(env.ExecPath, env.Profile); string(data) != want {
+		return Result{Status: Warn, Detail: path + " does not launch " + env.ExecPath + " for this profile", Fix: fix}
+	}
+	return Result{Status: Pass, Detail: path}
+}
+
+func checkSessionBus(ctx context.Context, env Env) Result {
+	cfg := env.Config
+	if cfg.BrokerProxy {
+		path := broker.SessionBusSocketPath(env.Root)
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return Result{Status: Pass, Detail: path}
+		}
+		return Result{Status: Fail, Detail: "container session bus not visible at " + broker.SessionBusSocketPath(env.Root), Fix: "Run 'intuneme" + profileFlag(env) + " stop' and 'intuneme" + profileFlag(env) + " start'"}
+	}
+	socket := fmt.Sprintf("/run/user/%d/bus", cfg.HostUID)
+	if _, err := nspawn.ExecOutput(ctx, env.Runner, cfg.MachineName, cfg.HostUID, "test -S "+socket); err != nil {
+		return Result{Status: Warn, Detail: "no user session in the container yet", Fix: "Run 'intuneme" + profileFlag(env) + " open edge' or 'intuneme" + profileFlag(env) + " shell' to start one"}
+	}
+	return Result{Status: Pass, Detail: socket + " (in container)"}
+}
+
+func checkKeyring(ctx context.Context, env Env) Result {
+	out, err := nspawn.ExecOutput(ctx, env.Runner, env.Config.MachineName, env.Config.HostUID,
+		"busctl --user get-property org.freedesktop.secrets /org/freedesktop/secrets/collection/login org.freedesktop.Secret.Collection Locked")
+	fix := "Run 'intuneme" + profileFlag(env) + " shell' to unlock it with the container password"
+	switch strings.TrimSpace(string(out)) {
+	case "b false":
+		return Result{Status: Pass, Detail: "login keyring unlocked"}
+	case "b true":
+		return Result{Status: Fail, Detail: "login keyring locked; the identity broker can't read credentials", Fix: fix}
+	}
+	if err != nil {
+		return Result{Status: Warn, Detail: "login keyring not available (no session or keyring daemon)", Fix: fix}
+	}
+	return Result{Status: Warn, Detail: "unexpected reply: " + strings.TrimSpace(string(out))}
+}
+
+func checkBrokerProxy(ctx context.Context, env Env) Result {
+	if !env.Config.BrokerProxy {
+		return Result{Status: Skip, Detail: "broker proxy disabled"}
+	}
+	pidPath := filepath.Join(env.Root, "broker-proxy.pid")
+	if _, alive := broker.IsRunningByPIDFile(pidPath); !alive {
+		return Result{Status: Fail, Detail: "broker proxy not running", Fix: "Run 'intuneme" + profileFlag(env) + " start'"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, env.ProbeTimeout)
+	defer cancel()
+	version, err := broker.HostBrokerVersion(ctx)
+	if err != nil {
+		return Result{Status: Fail, Detail: "getLinuxBrokerVersion failed: " + err.Error(), Fix: "Check 'intuneme" + profileFlag(env) + " logs --unit proxy' and 'intuneme" + profileFlag(env) + " logs --unit broker'"}
+	}
+	return Result{Status: Pass, Detail: strings.TrimSpace(version)}
+}
+
+// x11Socket returns the socket path for a local display such as ":1" or
+// ":1.0".
+func x11Socket(display string) string {
+	num, _, _ := strings.Cut(strings.TrimPrefix(display, ":"), ".")
+	return "/tmp/.X11-unix/X" + num
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,158 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func testEnv(t *testing.T, r runner.Runner, profile string) Env {
+	t.Helper()
+	root := t.TempDir()
+	return Env{
+		Runner:  r,
+		Root:    root,
+		Profile: profile,
+		Config: &config.Config{
+			MachineName: config.MachineName(profile),
+			RootfsPath:  filepath.Join(root, "rootfs"),
+			HostUID:     1000,
+			HostUser:    "alice",
+		},
+		ExecPath:     "/usr/bin/intuneme",
+		ProbeTimeout: time.Second,
+	}
+}
+
+func resultByName(t *testing.T, results []Result, name string) Result {
+	t.Helper()
+	for _, r := range results {
+		if r.Name == name {
+			return r
+		}
+	}
+	t.Fatalf("no result named %q", name)
+	return Result{}
+}
+
+func TestRun_NotInitialized(t *testing.T) {
+	r := &runner.Recorder{}
+	env := testEnv(t, r, "clienta")
+	results := Run(context.Background(), env)
+
+	if len(results) != len(checks) {
+		t.Fatalf("expected %d results, got %d", len(checks), len(results))
+	}
+	init := resultByName(t, results, "Initialized")
+	if init.Status != Fail {
+		t.Errorf("Initialized status = %s, want fail", init.Status)
+	}
+	if init.Fix != "Run 'intuneme --profile clienta init'" {
+		t.Errorf("fix hint should carry the profile, got %q", init.Fix)
+	}
+	for _, name := range []string{"Sudoers rule", "Polkit rule", "Keyring unlocked", "Broker reachable via proxy"} {
+		if res := resultByName(t, results, name); res.Status != Skip {
+			t.Errorf("%s status = %s, want skip before init", name, res.Status)
+		}
+	}
+}
+
+func TestRun_NonInteractive(t *testing.T) {
+	r := &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Leader --value", runner.Reply{Output: "4242"})
+	env := testEnv(t, r, "")
+	if err := os.MkdirAll(env.Config.RootfsPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	Run(context.Background(), env)
+
+	ran := 0
+	for _, step := range r.Steps {
+		if cmd := step.String(); strings.HasPrefix(cmd, "sudo ") {
+			ran++
+			if !strings.HasPrefix(cmd, "sudo -n ") {
+				t.Errorf("%q would prompt for a password", cmd)
+			}
+		}
+	}
+	if ran == 0 {
+		t.Fatal("expected the container checks to run sudo")
+	}
+}
+
+func TestFailed(t *testing.T) {
+	results := []Result{{Status: Pass}, {Status: Fail}, {Status: Warn}, {Status: Fail}, {Status: Skip}}
+	if got := Failed(results); got != 2 {
+		t.Errorf("Failed() = %d, want 2", got)
+	}
+}
+
+func TestCheckKeyring(t *testing.T) {
+	tests := []struct {
+		out  string
+		err  error
+		want Status
+	}{
+		{"b false\n", nil, Pass},
+		{"b true\n", nil, Fail},
+		{"", fmt.Errorf("exit status 1"), Warn},
+	}
+	for _, tt := range tests {
+		r := &runner.Recorder{}
+		r.Answer("machinectl show intuneme -p Leader --value", runner.Reply{Output: "4242"})
+		if tt.err != nil {
+			r.Answer("sudo /usr/local/libexec/intuneme/nsenter-exec", runner.Reply{Err: tt.err})
+		} else {
+			r.Answer("sudo /usr/local/libexec/intuneme/nsenter-exec", runner.Reply{Output: tt.out})
+		}
+		res := checkKeyring(context.Background(), testEnv(t, r, ""))
+		if res.Status != tt.want {
+			t.Errorf("keyring reply %q: status = %s, want %s", tt.out, res.Status, tt.want)
+		}
+		if tt.want != Pass && !strings.Contains(res.Fix, "intuneme shell") {
+			t.Errorf("expected shell fix hint, got %q", res.Fix)
+		}
+	}
+}
+
+func TestCheckBrokerProxy_Disabled(t *testing.T) {
+	res := checkBrokerProxy(context.Background(), testEnv(t, &runner.Recorder{}, ""))
+	if res.Status != Skip {
+		t.Errorf("status = %s, want skip when broker proxy disabled", res.Status)
+	}
+}
+
+func TestCheckBrokerProxy_NotRunning(t *testing.T) {
+	env := testEnv(t, &runner.Recorder{}, "")
+	env.Config.BrokerProxy = true
+	res := checkBrokerProxy(context.Background(), env)
+	if res.Status != Fail || !strings.Contains(res.Fix, "intuneme start") {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestCheckSessionBus_BrokerProxy(t *testing.T) {
+	env := testEnv(t, &runner.Recorder{}, "")
+	env.Config.BrokerProxy = true
+	if res := checkSessionBus(context.Background(), env); res.Status != Fail {
+		t.Errorf("status = %s, want fail when the bus socket is missing", res.Status)
+	}
+}
+
+func TestX11Socket(t *testing.T) {
+	for display, want := range map[string]string{
+		":0":   "/tmp/.X11-unix/X0",
+		":1.0": "/tmp/.X11-unix/X1",
+	} {
+		if got := x11Socket(display); got != want {
+			t.Errorf("x11Socket(%q) = %q, want %q", display, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package httpproxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// Container-side files written for a proxy. The drop-in gives the device
+// broker, a system service that no session environment reaches, the same
+// settings.
+const (
+	aptConfPath     = "/etc/apt/apt.conf.d/80intuneme-proxy"
+	deviceBroker    = "microsoft-identity-device-broker.service"
+	brokerDropInDir = "/etc/systemd/system/" + deviceBroker + ".d"
+	brokerDropIn    = brokerDropInDir + "/intuneme-proxy.conf"
+	dropInContent   = "# Installed by intuneme: proxy settings from config.toml.\n[Service]\nEnvironmentFile=-" + nspawn.ProxyEnvPath + "\n"
+)
+
+// validValue matches proxy URLs and no_proxy lists. Quotes, whitespace and
+// shell metacharacters are refused since the values end up in shell and
+// systemd environment files.
+var validValue = regexp.MustCompile(`^[A-Za-z0-9._~:/?#\[\]@!&+,;=%*-]*$`)
+
+// Settings is a resolved proxy configuration. The zero value means no proxy.
+type Settings struct {
+	HTTP    string
+	HTTPS   string
+	NoProxy string
+}
+
+// Enabled reports whether any proxy is set.
+func (s Settings) Enabled() bool {
+	return s.HTTP != "" || s.HTTPS != ""
+}
+
+// Resolve combines the [proxy] table with the environment intuneme runs in:
+// values set in config.toml win, and with from_host the rest comes from
+// http_proxy, https_proxy and no_proxy (or their upper-case forms).
+func Resolve(p config.Proxy) (Settings, error) {
+	s := Settings{HTTP: p.HTTP, HTTPS: p.HTTPS, NoProxy: p.NoProxy}
+	if p.FromHost {
+		if s.HTTP == "" {
+			s.HTTP = hostEnv("http_proxy")
+		}
+		if s.HTTPS == "" {
+			s.HTTPS = hostEnv("https_proxy")
+		}
+		if s.NoProxy == "" {
+			s.NoProxy = hostEnv("no_proxy")
+		}
+	}
+	for name, v := range map[string]string{"http": s.HTTP, "https": s.HTTPS, "no_proxy": s.NoProxy} {
+		if !validValue.MatchString(v) {
+			return Settings{}, fmt.Errorf("invalid proxy %s value %q", name, v)
+		}
+	}
+	return s, nil
+}
+
+// hostEnv returns the lower-case variable name, or its upper-case form.
+func hostEnv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv(strings.ToUpper(name))
+}
+
+// envFile renders the environment file at nspawn.ProxyEnvPath, which is both
+// sourced by shells and read by systemd, so values are double-quoted. Both
+// spellings are set since tools disagree on which one they read.
+func (s Settings) envFile() string {
+	var b strings.Builder
+	for _, kv := range [][2]string{{"http_proxy", s.HTTP}, {"https_proxy", s.HTTPS}, {"no_proxy", s.NoProxy}} {
+		if kv[1] != "" {
+			fmt.Fprintf(&b, "%s=\"%s\"\n%s=\"%s\"\n", kv[0], kv[1], strings.ToUpper(kv[0]), kv[1])
+		}
+	}
+	return b.String()
+}
+
+// aptConf renders apt's proxy configuration.
+func (s Settings) aptConf() string {
+	var b strings.Builder
+	if s.HTTP != "" {
+		fmt.Fprintf(&b, "Acquire::http::Proxy \"%s\";\n", s.HTTP)
+	}
+	if s.HTTPS != "" {
+		fmt.Fprintf(&b, "Acquire::https::Proxy \"%s\";\n", s.HTTPS)
+	}
+	return b.String()
+}
+
+// Sync writes s into the running machine: the session environment file,
+// apt's configuration and the device broker's drop-in. Nothing is touched
+// when the settings are unchanged; otherwise the device broker is restarted
+// to pick them up. Sessions read the file whenever they start an app.
+//
+// The proxy URLs may carry credentials, so both files are readable only by
+// root and the container user's group. Each is created with that mode before
+// its content is written.
+func Sync(ctx context.Context, r runner.Runner, machine string, uid int, s Settings) error {
+	env := s.envFile()
+	q := nspawn.ShellQuote
+	write := func(content, path string) string {
+		return fmt.Sprintf(`sudo install -m 0640 -g "$(id -g)" /dev/null %s && printf '%%s' %s | sudo tee %s >/dev/null`, path, q(content), path)
+	}
+	apply := fmt.Sprintf("sudo rm -f %s %s", nspawn.ProxyEnvPath, aptConfPath)
+	if s.Enabled() {
+		apply = write(env, nspawn.ProxyEnvPath) + " && " + write(s.aptConf(), aptConfPath)
+	}
+	// $(cat) drops the trailing newline, so compare without it. A file left
+	// world-readable by an older version is rewritten.
+	script := fmt.Sprintf(`{ [ ! -e %s ] || [ "$(stat -c %%a %s)" = 640 ]; } && [ "$(cat %s 2>/dev/null)" = %s ] && exit 0
+%s || exit 1
+sudo mkdir -p %s && printf '%%s' %s | sudo tee %s >/dev/null || exit 1
+sudo systemctl daemon-reload
+sudo systemctl try-restart %s`,
+		nspawn.ProxyEnvPath, nspawn.ProxyEnvPath, nspawn.ProxyEnvPath, q(strings.TrimSuffix(env, "\n")),
+		apply,
+		brokerDropInDir, q(dropInContent), brokerDropIn,
+		deviceBroker)
+	if out, err := nspawn.ExecOutput(ctx, r, machine, uid, script); err != nil {
+		return fmt.Errorf("apply proxy settings: %w\n%s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package httpproxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("http_proxy", "")
+	t.Setenv("HTTP_PROXY", "http://host-proxy:3128")
+	t.Setenv("https_proxy", "http://host-proxy:3128")
+	t.Setenv("no_proxy", "localhost,.corp.example")
+
+	s, err := Resolve(config.Proxy{FromHost: true, HTTPS: "http://tls-proxy:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Settings{HTTP: "http://host-proxy:3128", HTTPS: "http://tls-proxy:8080", NoProxy: "localhost,.corp.example"}
+	if s != want {
+		t.Errorf("Resolve = %+v, want %+v", s, want)
+	}
+
+	if s, _ := Resolve(config.Proxy{}); s.Enabled() {
+		t.Errorf("without from_host the host environment must be ignored, got %+v", s)
+	}
+	if _, err := Resolve(config.Proxy{HTTP: "http://proxy:3128 $(reboot)"}); err == nil {
+		t.Error("expected an error for a value with shell metacharacters")
+	}
+}
+
+func TestSync(t *testing.T) {
+	r := &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+	s := Settings{HTTP: "http://proxy:3128", HTTPS: "http://proxy:3128", NoProxy: "localhost"}
+	if err := Sync(context.Background(), r, "intuneme", 1000, s); err != nil {
+		t.Fatal(err)
+	}
+	script := strings.Join(r.Steps[len(r.Steps)-1].Args, " ")
+	for _, want := range []string{
+		"https_proxy=\"http://proxy:3128\"\nHTTPS_PROXY=\"http://proxy:3128\"",
+		"no_proxy=\"localhost\"",
+		"sudo tee " + nspawn.ProxyEnvPath,
+		`sudo install -m 0640 -g "$(id -g)" /dev/null ` + nspawn.ProxyEnvPath,
+		`sudo install -m 0640 -g "$(id -g)" /dev/null ` + aptConfPath,
+		"Acquire::https::Proxy \"http://proxy:3128\";",
+		"EnvironmentFile=-" + nspawn.ProxyEnvPath,
+		"sudo systemctl try-restart microsoft-identity-device-broker.service",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("sync script missing %q:\n%s", want, script)
+		}
+	}
+
+	r = &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+	if err := Sync(context.Background(), r, "intuneme", 1000, Settings{}); err != nil {
+		t.Fatal(err)
+	}
+	if script := strings.Join(r.Steps[len(r.Steps)-1].Args, " "); !strings.Contains(script, "sudo rm -f "+nspawn.ProxyEnvPath+" "+aptConfPath) {
+		t.Errorf("no proxy should remove the settings:\n%s", script)
+	}
+}
@@ -0,0 +1,263 @@
+package locale
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/sudo"
+)
+
+// Vars are the locale environment variables copied from the host session.
+// LC_ALL is left out: it overrides everything and is meant for one-off use.
+var Vars = []string{
+	"LANG", "LANGUAGE", "LC_CTYPE", "LC_NUMERIC", "LC_TIME", "LC_COLLATE",
+	"LC_MONETARY", "LC_MESSAGES", "LC_PAPER", "LC_NAME", "LC_ADDRESS",
+	"LC_TELEPHONE", "LC_MEASUREMENT", "LC_IDENTIFICATION",
+}
+
+// keyboardVars are the XKB settings of /etc/default/keyboard.
+var keyboardVars = []string{"XKBMODEL", "XKBLAYOUT", "XKBVARIANT", "XKBOPTIONS"}
+
+// Host files consulted by Detect. Variables so tests can point them elsewhere.
+var (
+	localtimePath = "/etc/localtime"
+	timezonePath  = "/etc/timezone"
+	// localeConfPaths hold the system locale, used when the session sets none.
+	localeConfPaths = []string{"/etc/locale.conf", "/etc/default/locale"}
+	// keyboardPaths hold the system XKB layout: systemd's and Debian's.
+	keyboardPaths = []string{"/etc/vconsole.conf", "/etc/default/keyboard"}
+)
+
+var (
+	validTimezone = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+	validValue    = regexp.MustCompile(`^[A-Za-z0-9_.,:@+-]*$`)
+)
+
+// Settings are the host settings mirrored into the container.
+type Settings struct {
+	// Timezone is the IANA zone name, e.g. "Europe/Berlin". Empty if unknown.
+	Timezone string
+	// Env holds the set locale variables from Vars, e.g. LANG=de_DE.UTF-8.
+	Env map[string]string
+	// Keyboard holds the set XKB variables, e.g. XKBLAYOUT=de.
+	Keyboard map[string]string
+}
+
+// Detect reads the host's settings. The locale comes from the session
+// environment, which is what desktop apps on the host use, falling back to
+// the system locale. Values that are unknown or unsafe to write are skipped.
+func Detect() Settings {
+	s := Settings{
+		Timezone: hostTimezone(),
+		Env:      map[string]string{},
+		Keyboard: map[string]string{},
+	}
+	for _, v := range Vars {
+		if val := os.Getenv(v); val != "" && validValue.MatchString(val) {
+			s.Env[v] = val
+		}
+	}
+	if len(s.Env) == 0 {
+		for _, path := range localeConfPaths {
+			if vals := readAssignments(path, Vars); len(vals) > 0 {
+				s.Env = vals
+				break
+			}
+		}
+	}
+	for _, path := range keyboardPaths {
+		if vals := readAssignments(path, keyboardVars); vals["XKBLAYOUT"] != "" {
+			s.Keyboard = vals
+			break
+		}
+	}
+	return s
+}
+
+// hostTimezone returns the zone /etc/localtime points to, or the contents of
+// /etc/timezone on systems that copy the zone file instead of linking it.
+func hostTimezone() string {
+	if target, err := os.Readlink(localtimePath); err == nil {
+		if _, zone, ok := strings.Cut(target, "zoneinfo/"); ok && validTimezone.MatchString(zone) {
+			return zone
+		}
+	}
+	if data, err := os.ReadFile(timezonePath); err == nil {
+		if zone := strings.TrimSpace(string(data)); validTimezone.MatchString(zone) {
+			return zone
+		}
+	}
+	return ""
+}
+
+// readAssignments returns the KEY=value lines of a shell-style config file
+// whose key is in keys, with quotes removed.
+func readAssignments(path string, keys []string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	vals := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || !slices.Contains(keys, key) {
+			continue
+		}
+		val = strings.Trim(val, `"'`)
+		if val != "" && validValue.MatchString(val) {
+			vals[key] = val
+		}
+	}
+	return vals
+}
+
+// Locales returns the locales the container needs generated, e.g.
+// "de_DE.UTF-8", in a stable order. C and POSIX are built in.
+func (s Settings) Locales() []string {
+	var locales []string
+	for _, v := range Vars {
+		val := s.Env[v]
+		if v == "LANGUAGE" || val == "" || val == "C" || val == "POSIX" || strings.HasPrefix(val, "C.") {
+			continue
+		}
+		if !slices.Contains(locales, val) {
+			locales = append(locales, val)
+		}
+	}
+	return locales
+}
+
+// localeFile renders /etc/default/locale.
+func (s Settings) localeFile() string {
+	return assignments(s.Env, Vars)
+}
+
+// keyboardFile renders /etc/default/keyboard.
+func (s Settings) keyboardFile() string {
+	return assignments(s.Keyboard, keyboardVars)
+}
+
+func assignments(vals map[string]string, keys []string) string {
+	var b strings.Builder
+	b.WriteString("# Copied from the host by intuneme.\n")
+	for _, k := range keys {
+		if v := vals[k]; v != "" {
+			fmt.Fprintf(&b, "%s=%q\n", k, v)
+		}
+	}
+	return b.String()
+}
+
+// WriteRootfs writes the settings into a container rootfs that is not
+// running, as part of provisioning. Locales are generated at the first start,
+// since that needs the container's own tools.
+func WriteRootfs(ctx context.Context, r runner.Runner, rootfsPath string, s Settings) error {
+	etc := filepath.Join(rootfsPath, "etc")
+	if s.Timezone != "" {
+		if out, err := r.RunContext(ctx, "sudo", "ln", "-sf", "/usr/share/zoneinfo/"+s.Timezone, filepath.Join(etc, "localtime")); err != nil {
+			return fmt.Errorf("link timezone: %w\n%s", err, out)
+		}
+		if err := sudo.WriteFile(ctx, r, filepath.Join(etc, "timezone"), []byte(s.Timezone+"\n"), 0644); err != nil {
+			return fmt.Errorf("write timezone: %w", err)
+		}
+	}
+	if len(s.Env) > 0 {
+		if err := sudo.WriteFile(ctx, r, filepath.Join(etc, "default", "locale"), []byte(s.localeFile()), 0644); err != nil {
+			return fmt.Errorf("write locale: %w", err)
+		}
+	}
+	if len(s.Keyboard) > 0 {
+		if err := sudo.WriteFile(ctx, r, filepath.Join(etc, "default", "keyboard"), []byte(s.keyboardFile()), 0644); err != nil {
+			return fmt.Errorf("write keyboard layout: %w", err)
+		}
+	}
+	return nil
+}
+
+// Sync applies the settings to the running machine and generates any locale
+// it lacks. It goes through the nsenter helper and the container user's
+// passwordless sudo, so it needs no host password and also runs from the
+// agent when the host changes timezone.
+func Sync(ctx context.Context, r runner.Runner, machine string, uid int, s Settings) error {
+	var script []string
+	if s.Timezone != "" {
+		// The zone must exist in the container, or every app falls back to UTC.
+		zone := nspawn.ShellQuote("/usr/share/zoneinfo/" + s.Timezone)
+		script = append(script,
+			"if [ -f "+zone+" ]; then sudo ln -sf "+zone+" /etc/localtime && printf '%s\\n' "+nspawn.ShellQuote(s.Timezone)+" | sudo tee /etc/timezone >/dev/null || exit 1; fi")
+	}
+	if len(s.Env) > 0 {
+		script = append(script, "printf '%s' "+nspawn.ShellQuote(s.localeFile())+" | sudo tee /etc/default/locale >/dev/null || exit 1")
+	}
+	if len(s.Keyboard) > 0 {
+		script = append(script, "printf '%s' "+nspawn.ShellQuote(s.keyboardFile())+" | sudo tee /etc/default/keyboard >/dev/null || exit 1")
+	}
+	if len(script) > 0 {
+		if out, err := nspawn.ExecOutput(ctx, r, machine, uid, strings.Join(script, "\n")); err != nil {
+			return fmt.Errorf("apply host timezone and locale: %w\n%s", err, out)
+		}
+	}
+
+	wanted := s.Locales()
+	if len(wanted) == 0 {
+		return nil
+	}
+	out, err := nspawn.ExecOutput(ctx, r, machine, uid, "locale -a")
+	if err != nil {
+		return fmt.Errorf("list container locales: %w\n%s", err, out)
+	}
+	missing := missingLocales(wanted, string(out))
+	if len(missing) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(missing))
+	for i, l := range missing {
+		quoted[i] = nspawn.ShellQuote(l)
+	}
+	if out, err := nspawn.ExecOutput(ctx, r, machine, uid, "sudo locale-gen "+strings.Join(quoted, " ")); err != nil {
+		return fmt.Errorf("generate locales %s: %w\n%s", strings.Join(missing, ", "), err, out)
+	}
+	return nil
+}
+
+// missingLocales returns the wanted locales absent from `locale -a` output,
+// which lists names normalized by glibc: "de_DE.UTF-8" appears as "de_DE.utf8".
+func missingLocales(wanted []string, available string) []string {
+	have := map[string]bool{}
+	for _, l := range strings.Fields(available) {
+		have[normalize(l)] = true
+	}
+	var missing []string
+	for _, l := range wanted {
+		if !have[normalize(l)] {
+			missing = append(missing, l)
+		}
+	}
+	return missing
+}
+
+// normalize applies glibc's codeset normalization: lowercase, without
+// punctuation, so "UTF-8" and "utf8" compare equal.
+func normalize(locale string) string {
+	name, codeset, ok := strings.Cut(locale, ".")
+	if !ok {
+		return locale
+	}
+	modifier := ""
+	if i := strings.IndexByte(codeset, '@'); i >= 0 {
+		codeset, modifier = codeset[:i], codeset[i:]
+	}
+	codeset = strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(codeset))
+	return name + "." + codeset + modifier
+}
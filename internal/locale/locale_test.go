@@ -0,0 +1,116 @@
+package locale
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// useHostFiles points Detect at files in a temp dir for the test.
+func useHostFiles(t *testing.T, localtime, keyboard string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldLocaltime, oldTimezone, oldLocale, oldKeyboard := localtimePath, timezonePath, localeConfPaths, keyboardPaths
+	t.Cleanup(func() {
+		localtimePath, timezonePath, localeConfPaths, keyboardPaths = oldLocaltime, oldTimezone, oldLocale, oldKeyboard
+	})
+	localtimePath = filepath.Join(dir, "localtime")
+	timezonePath = filepath.Join(dir, "timezone")
+	localeConfPaths = []string{filepath.Join(dir, "locale.conf")}
+	keyboardPaths = []string{filepath.Join(dir, "keyboard")}
+	if localtime != "" {
+		if err := os.Symlink(localtime, localtimePath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(keyboardPaths[0], []byte(keyboard), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range Vars {
+		t.Setenv(v, "")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	useHostFiles(t, "../usr/share/zoneinfo/Europe/Berlin", "XKBMODEL=\"pc105\"\nXKBLAYOUT=\"de\"\nXKBVARIANT=\"nodeadkeys\"\n")
+	t.Setenv("LANG", "en_US.UTF-8")
+	t.Setenv("LC_TIME", "de_DE.UTF-8")
+	t.Setenv("LC_PAPER", "$(reboot)")
+
+	s := Detect()
+	if s.Timezone != "Europe/Berlin" {
+		t.Errorf("Timezone = %q", s.Timezone)
+	}
+	if s.Env["LANG"] != "en_US.UTF-8" || s.Env["LC_TIME"] != "de_DE.UTF-8" {
+		t.Errorf("Env = %v", s.Env)
+	}
+	if _, ok := s.Env["LC_PAPER"]; ok {
+		t.Error("unsafe value should be skipped")
+	}
+	if s.Keyboard["XKBLAYOUT"] != "de" || s.Keyboard["XKBVARIANT"] != "nodeadkeys" {
+		t.Errorf("Keyboard = %v", s.Keyboard)
+	}
+	if got := s.Locales(); !slices.Equal(got, []string{"en_US.UTF-8", "de_DE.UTF-8"}) {
+		t.Errorf("Locales = %v", got)
+	}
+}
+
+func TestDetect_SystemFallbacks(t *testing.T) {
+	useHostFiles(t, "", "")
+	if err := os.WriteFile(timezonePath, []byte("America/New_York\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(localeConfPaths[0], []byte("LANG=fr_FR.UTF-8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := Detect()
+	if s.Timezone != "America/New_York" || s.Env["LANG"] != "fr_FR.UTF-8" || len(s.Keyboard) != 0 {
+		t.Errorf("Detect = %+v", s)
+	}
+}
+
+func TestMissingLocales(t *testing.T) {
+	available := "C\nC.utf8\nen_US.utf8\nPOSIX\n"
+	got := missingLocales([]string{"en_US.UTF-8", "de_DE.UTF-8", "sr_RS.UTF-8@latin"}, available)
+	if !slices.Equal(got, []string{"de_DE.UTF-8", "sr_RS.UTF-8@latin"}) {
+		t.Errorf("missingLocales = %v", got)
+	}
+}
+
+func TestSync(t *testing.T) {
+	r := &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+	r.Answer("sudo /usr/local/libexec/intuneme/nsenter-exec 4321 export XDG_RUNTIME_DIR=/run/user/1000\nexport DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/1000/bus\nlocale -a", runner.Reply{Output: "C.utf8\nen_US.utf8\n"})
+	s := Settings{
+		Timezone: "Asia/Tokyo",
+		Env:      map[string]string{"LANG": "en_US.UTF-8", "LC_TIME": "ja_JP.UTF-8"},
+		Keyboard: map[string]string{"XKBLAYOUT": "jp"},
+	}
+	if err := Sync(context.Background(), r, "intuneme", 1000, s); err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, step := range r.Steps {
+		commands = append(commands, strings.Join(append([]string{step.Command}, step.Args...), " "))
+	}
+	all := strings.Join(commands, "\n")
+	for _, want := range []string{
+		"sudo ln -sf '/usr/share/zoneinfo/Asia/Tokyo' /etc/localtime",
+		"LC_TIME=\"ja_JP.UTF-8\"",
+		"sudo tee /etc/default/locale",
+		"XKBLAYOUT=\"jp\"",
+		"sudo tee /etc/default/keyboard",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing %q in:\n%s", want, all)
+		}
+	}
+	if last := commands[len(commands)-1]; !strings.HasSuffix(last, "sudo locale-gen 'ja_JP.UTF-8'") {
+		t.Errorf("last command = %q, want locale-gen of the missing locale only", last)
+	}
+}
@@ -0,0 +1,113 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// filePollInterval is how often Follow checks file sources for new lines.
+const filePollInterval = 500 * time.Millisecond
+
+// Follow streams new entries from all sources to w until ctx is cancelled.
+// Lines are written in arrival order; each source is read concurrently.
+// Journal sources run journalctl through sudo with r, so credentials should be
+// validated first.
+func Follow(ctx context.Context, r runner.Runner, sources []Source, w io.Writer) error {
+	var mu sync.Mutex
+	emit := func(e Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintln(w, e.String())
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(sources))
+	for _, src := range sources {
+		wg.Go(func() {
+			var err error
+			if src.Path != "" {
+				err = followFile(ctx, src, emit)
+			} else {
+				err = followJournal(ctx, r, src, emit)
+			}
+			if err != nil && ctx.Err() == nil {
+				errs <- fmt.Errorf("%s: %w", src.Name, err)
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func followJournal(ctx context.Context, r runner.Runner, src Source, emit func(Entry)) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.RunStream(ctx, pw, "sudo", JournalArgs(src, time.Time{}, 0, true)...))
+	}()
+	// Closing the reader makes journalctl's writes fail should the scan stop
+	// early on an overlong line, so it cannot block forever.
+	defer func() { _ = pr.Close() }()
+	sc := bufio.NewScanner(pr)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if e, ok := ParseJournalLine(sc.Bytes(), src.Name); ok {
+			emit(e)
+		}
+	}
+	return sc.Err()
+}
+
+// followFile tails a log file from its current end, like tail -F: a file
+// that does not exist yet or is truncated/rotated is picked up from the start.
+func followFile(ctx context.Context, src Source, emit func(Entry)) error {
+	var offset int64
+	if fi, err := os.Stat(src.Path); err == nil {
+		offset = fi.Size()
+	}
+	var partial string
+	ticker := time.NewTicker(filePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(src.Path)
+		if err != nil {
+			continue
+		}
+		if fi.Size() < offset {
+			offset, partial = 0, ""
+		}
+		if fi.Size() == offset {
+			continue
+		}
+		f, err := os.Open(src.Path)
+		if err != nil {
+			continue
+		}
+		data := make([]byte, fi.Size()-offset)
+		n, _ := f.ReadAt(data, offset)
+		_ = f.Close()
+		offset += int64(n)
+
+		text := partial + string(data[:n])
+		lines := strings.Split(text, "\n")
+		partial = lines[len(lines)-1]
+		for _, line := range lines[:len(lines)-1] {
+			if e, ok := ParseProxyLine(line, src.Name); ok {
+				emit(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units accepted by `intuneme logs --unit`.
+const (
+	UnitBroker       = "broker"
+	UnitDeviceBroker = "device-broker"
+	UnitAgent        = "agent"
+	UnitHotplug      = "hotplug"
+	UnitProxy        = "proxy"
+	UnitNotify       = "notifications"
+)
+
+// Units returns the names accepted by --unit, in display order.
+func Units() []string {
+	return []string{UnitBroker, UnitDeviceBroker, UnitAgent, UnitHotplug, UnitProxy, UnitNotify}
+}
+
+// HotplugTag is the syslog identifier the udev hotplug script logs under on
+// the host.
+const HotplugTag = "intuneme-hotplug"
+
+// ProxyTimeLayout is the timestamp format of broker-proxy and
+// notification-proxy log lines. It is
+// what the standard log package writes with LUTC|Ldate|Ltime|Lmicroseconds.
+const ProxyTimeLayout = "2006/01/02 15:04:05.000000"
+
+// Source is one log stream. Journal sources are read with journalctl (via
+// sudo, since the container journal is root-owned); file sources are read
+// directly.
+type Source struct {
+	Name string
+	// Args are journalctl arguments selecting the stream, without output
+	// format or time options. Empty for file sources.
+	Args []string
+	// Path is the log file for file sources.
+	Path string
+}
+
+// Sources returns the log sources for unit, or all of them when unit is empty.
+// rootfs is the container rootfs (its persistent journal lives in
+// var/log/journal, readable whether or not the container runs), proxyLog
+// the broker-proxy log file and notifyLog the notification-proxy log file, or
+// "" when notification forwarding is off.
+func Sources(rootfs, proxyLog, notifyLog, unit string) ([]Source, error) {
+	journalDir := filepath.Join(rootfs, "var", "log", "journal")
+	container := func(filter ...string) []string {
+		return append([]string{"--directory=" + journalDir}, filter...)
+	}
+	hotplug := Source{Name: UnitHotplug, Args: []string{"--identifier=" + HotplugTag}}
+	proxy := Source{Name: UnitProxy, Path: proxyLog}
+	notify := Source{Name: UnitNotify, Path: notifyLog}
+
+	switch unit {
+	case "":
+		all := []Source{
+			{Name: "container", Args: container()},
+			hotplug,
+			proxy,
+		}
+		if notifyLog != "" {
+			all = append(all, notify)
+		}
+		return all, nil
+	case UnitBroker:
+		return []Source{{Name: unit, Args: container("--user-unit=microsoft-identity-broker.service")}}, nil
+	case UnitDeviceBroker:
+		return []Source{{Name: unit, Args: container("--unit=microsoft-identity-device-broker.service")}}, nil
+	case UnitAgent:
+		return []Source{{Name: unit, Args: container("--user-unit=intune-agent.service")}}, nil
+	case UnitHotplug:
+		return []Source{hotplug}, nil
+	case UnitProxy:
+		return []Source{proxy}, nil
+	case UnitNotify:
+		if notifyLog == "" {
+			return nil, fmt.Errorf("notification forwarding is not enabled")
+		}
+		return []Source{notify}, nil
+	}
+	return nil, fmt.Errorf("unknown unit %q — use one of: %s", unit, strings.Join(Units(), ", "))
+}
+
+// JournalArgs returns the full journalctl argument list for a journal source.
+// A zero since means no lower bound and lines <= 0 means no limit. With
+// follow, journalctl prints only new entries and keeps running.
+func JournalArgs(src Source, since time.Time, lines int, follow bool) []string {
+	args := append([]string{"journalctl", "--no-pager", "--output=json"}, src.Args...)
+	if follow {
+		return append(args, "--follow", "--lines=0")
+	}
+	if !since.IsZero() {
+		args = append(args, "--since="+since.Local().Format("2006-01-02 15:04:05"))
+	}
+	if lines > 0 {
+		args = append(args, fmt.Sprintf("--lines=%d", lines))
+	}
+	return args
+}
+
+// Entry is a single log line from any source.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Ident   string    `json:"ident,omitempty"`
+	Message string    `json:"message"`
+}
+
+// String formats the entry for display.
+func (e Entry) String() string {
+	ts := e.Time.Local().Format("2006-01-02 15:04:05.000")
+	if e.Ident != "" {
+		return fmt.Sprintf("%s [%s] %s: %s", ts, e.Source, e.Ident, e.Message)
+	}
+	return fmt.Sprintf("%s [%s] %s", ts, e.Source, e.Message)
+}
+
+// ParseJournalLine decodes one line of `journalctl --output=json`.
+func ParseJournalLine(line []byte, source string) (Entry, bool) {
+	var fields map[string]any
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Entry{}, false
+	}
+	usecStr, _ := fields["__REALTIME_TIMESTAMP"].(string)
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	ident := journalString(fields["SYSLOG_IDENTIFIER"])
+	if ident == "" {
+		ident = journalString(fields["_COMM"])
+	}
+	return Entry{
+		Time:    time.UnixMicro(usec),
+		Source:  source,
+		Ident:   ident,
+		Message: journalString(fields["MESSAGE"]),
+	}, true
+}
+
+// journalString returns a journal field as text. journalctl encodes fields
+// that are not valid UTF-8 as an array of byte values.
+func journalString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []any:
+		b := make([]byte, 0, len(v))
+		for _, n := range v {
+			if f, ok := n.(float64); ok {
+				b = append(b, byte(f))
+			}
+		}
+		return string(b)
+	}
+	return ""
+}
+
+// ParseJournal decodes `journalctl --output=json` output.
+func ParseJournal(data []byte, source string) []Entry {
+	var entries []Entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if e, ok := ParseJournalLine(sc.Bytes(), source); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// ParseProxyLine decodes one broker-proxy log line ("<timestamp> <message>",
+// timestamp in UTC).
+func ParseProxyLine(line, source string) (Entry, bool) {
+	if len(line) <= len(ProxyTimeLayout) {
+		return Entry{}, false
+	}
+	t, err := time.ParseInLocation(ProxyTimeLayout, line[:len(ProxyTimeLayout)], time.UTC)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Time: t, Source: source, Message: strings.TrimSpace(line[len(ProxyTimeLayout):])}, true
+}
+
+// ParseProxyLog decodes a broker-proxy log file, dropping entries before since.
+func ParseProxyLog(data []byte, source string, since time.Time) []Entry {
+	var entries []Entry
+	for line := range strings.Lines(string(data)) {
+		e, ok := ParseProxyLine(strings.TrimRight(line, "\n"), source)
+		if !ok || e.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Merge interleaves entries from several sources by timestamp and keeps the
+// last lines entries (all of them when lines <= 0). Entries with equal
+// timestamps keep their per-source order.
+func Merge(lines int, sources ...[]Entry) []Entry {
+	var all []Entry
+	for _, s := range sources {
+		all = append(all, s...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	if lines > 0 && len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return all
+}
+
+// ParseSince parses a --since value: a duration back from now ("30m", "2h")
+// or an absolute local time ("2006-01-02 15:04:05", "2006-01-02 15:04",
+// "2006-01-02") or RFC 3339.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q — use a duration like 30m or a time like \"2006-01-02 15:04\"", s)
+}
@@ -0,0 +1,177 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestSources(t *testing.T) {
+	all, err := Sources("/r/rootfs", "/r/broker-proxy.log", "", "")
+	if err != nil {
+		t.Fatalf("Sources: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 sources, got %d", len(all))
+	}
+	if all[0].Args[0] != "--directory=/r/rootfs/var/log/journal" {
+		t.Errorf("container source should read the rootfs journal, got %v", all[0].Args)
+	}
+	if all[2].Path != "/r/broker-proxy.log" {
+		t.Errorf("proxy source path = %q", all[2].Path)
+	}
+
+	withNotify, err := Sources("/r/rootfs", "/r/broker-proxy.log", "/r/notification-proxy.log", "")
+	if err != nil || len(withNotify) != 4 || withNotify[3].Path != "/r/notification-proxy.log" {
+		t.Errorf("Sources with notifications = %v, %v", withNotify, err)
+	}
+	if _, err := Sources("/r/rootfs", "/r/broker-proxy.log", "", UnitNotify); err == nil {
+		t.Error("expected an error for the notifications unit while forwarding is off")
+	}
+
+	broker, err := Sources("/r/rootfs", "/r/broker-proxy.log", "", UnitBroker)
+	if err != nil {
+		t.Fatalf("Sources(broker): %v", err)
+	}
+	if got := strings.Join(broker[0].Args, " "); !strings.Contains(got, "--user-unit=microsoft-identity-broker.service") {
+		t.Errorf("broker source args = %s", got)
+	}
+
+	if _, err := Sources("/r/rootfs", "/r/broker-proxy.log", "", "bogus"); err == nil {
+		t.Error("expected error for unknown unit")
+	}
+}
+
+func TestJournalArgs(t *testing.T) {
+	src := Source{Name: UnitHotplug, Args: []string{"--identifier=" + HotplugTag}}
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+
+	got := strings.Join(JournalArgs(src, since, 50, false), " ")
+	want := "journalctl --no-pager --output=json --identifier=intuneme-hotplug --since=2026-01-02 03:04:05 --lines=50"
+	if got != want {
+		t.Errorf("JournalArgs() = %q, want %q", got, want)
+	}
+
+	got = strings.Join(JournalArgs(src, since, 50, true), " ")
+	if !strings.HasSuffix(got, "--follow --lines=0") || strings.Contains(got, "--since") {
+		t.Errorf("follow args = %q", got)
+	}
+}
+
+func TestParseJournal(t *testing.T) {
+	data := []byte(`{"__REALTIME_TIMESTAMP":"1767322800000000","SYSLOG_IDENTIFIER":"microsoft-identity-broker","MESSAGE":"started"}
+not json
+{"__REALTIME_TIMESTAMP":"1767322801000000","_COMM":"bash","MESSAGE":[104,105]}
+{"MESSAGE":"no timestamp"}
+`)
+	entries := ParseJournal(data, "container")
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Ident != "microsoft-identity-broker" || entries[0].Message != "started" {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Ident != "bash" || entries[1].Message != "hi" {
+		t.Errorf("byte-array message not decoded: %+v", entries[1])
+	}
+	if !entries[0].Time.Equal(time.UnixMicro(1767322800000000)) {
+		t.Errorf("unexpected time: %v", entries[0].Time)
+	}
+}
+
+func TestParseProxyLog(t *testing.T) {
+	data := []byte("2026/01/02 10:00:00.000001 Broker proxy running\n" +
+		"garbage\n" +
+		"2026/01/02 11:00:00.000000 getAccounts (correlation x) ok in 12ms\n")
+	since := time.Date(2026, 1, 2, 10, 30, 0, 0, time.UTC)
+
+	entries := ParseProxyLog(data, UnitProxy, since)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry after since filter, got %d", len(entries))
+	}
+	if entries[0].Message != "getAccounts (correlation x) ok in 12ms" {
+		t.Errorf("unexpected message %q", entries[0].Message)
+	}
+	if entries[0].Time.Location() != time.UTC || entries[0].Time.Hour() != 11 {
+		t.Errorf("proxy timestamps should be parsed as UTC, got %v", entries[0].Time)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	a := []Entry{{Time: base, Message: "a1"}, {Time: base.Add(2 * time.Second), Message: "a2"}}
+	b := []Entry{{Time: base.Add(time.Second), Message: "b1"}, {Time: base.Add(3 * time.Second), Message: "b2"}}
+
+	var got []string
+	for _, e := range Merge(0, a, b) {
+		got = append(got, e.Message)
+	}
+	if strings.Join(got, ",") != "a1,b1,a2,b2" {
+		t.Errorf("Merge() order = %v", got)
+	}
+
+	last := Merge(2, a, b)
+	if len(last) != 2 || last[0].Message != "a2" || last[1].Message != "b2" {
+		t.Errorf("Merge(2) = %+v", last)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"30m", now.Add(-30 * time.Minute)},
+		{"-2h", now.Add(-2 * time.Hour)},
+		{"2026-01-02 10:15", time.Date(2026, 1, 2, 10, 15, 0, 0, time.Local)},
+		{"2026-01-01", time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"2026-01-02T09:00:00Z", time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseSince(tt.in, now)
+		if err != nil {
+			t.Errorf("ParseSince(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseSince(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := ParseSince("yesterday-ish", now); err == nil {
+		t.Error("expected error for unparseable value")
+	}
+}
+
+func TestEntryString(t *testing.T) {
+	e := Entry{Time: time.Date(2026, 1, 2, 10, 0, 0, 0, time.Local), Source: "container", Ident: "sshd", Message: "hi"}
+	if got := e.String(); got != "2026-01-02 10:00:00.000 [container] sshd: hi" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestFollow_Journal(t *testing.T) {
+	r := &runner.Recorder{}
+	r.Answer("sudo journalctl", runner.Reply{Output: `{"__REALTIME_TIMESTAMP":"1767322800000000","SYSLOG_IDENTIFIER":"microsoft-identity-broker","MESSAGE":"started"}` + "\n"})
+	sources, err := Sources("/r/rootfs", "/r/broker-proxy.log", "", UnitBroker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := Follow(context.Background(), r, sources, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Steps) != 1 || !strings.HasPrefix(r.Steps[0].String(), "sudo journalctl") || !strings.Contains(r.Steps[0].String(), "--follow") {
+		t.Errorf("journalctl should run through the runner, got %v", r.Steps)
+	}
+	if !strings.Contains(out.String(), "started") {
+		t.Errorf("followed output = %q", out.String())
+	}
+}
@@ -0,0 +1,131 @@
+package mounts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+)
+
+// reservedContainerDirs are container paths a mount may not replace: the
+// directories the container's own system lives in.
+var reservedContainerDirs = []string{
+	"/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/opt", "/proc",
+	"/root", "/run", "/sbin", "/sys", "/tmp", "/usr", "/var",
+}
+
+// Resolve expands and validates one mount. home is the host user's home
+// directory and containerHome the container user's home, which "~/" expands to
+// on the host and container side respectively.
+//
+// The checks guard against binding more than intended: the host side may not
+// be / or the home directory (or any directory containing it), and the
+// container side may not cover the container's system directories or the
+// container home, which is already ~/Intune.
+func Resolve(m config.Mount, home, containerHome string) (nspawn.BindMount, error) {
+	host, err := Expand(m.Host, home)
+	if err != nil {
+		return nspawn.BindMount{}, fmt.Errorf("mount host path: %w", err)
+	}
+	container, err := Expand(m.Container, containerHome)
+	if err != nil {
+		return nspawn.BindMount{}, fmt.Errorf("mount container path: %w", err)
+	}
+	// systemd-nspawn splits --bind=src:dst:options at colons and the options
+	// at commas, and has no way to escape either.
+	for _, p := range []string{host, container} {
+		if strings.ContainsAny(p, ":,") {
+			return nspawn.BindMount{}, fmt.Errorf("mount path %s contains ':' or ',', which systemd-nspawn cannot bind", p)
+		}
+	}
+
+	// Compare the paths with symlinks resolved too: on hosts where /home links
+	// to /var/home, /home/me is the home directory under another name, and so
+	// is any link pointing back at it.
+	realHost, realHome := host, home
+	if p, err := filepath.EvalSymlinks(host); err == nil {
+		realHost = p
+	}
+	if p, err := filepath.EvalSymlinks(home); err == nil {
+		realHome = p
+	}
+	if host == "/" || contains(host, home) || realHost == "/" || contains(realHost, realHome) {
+		return nspawn.BindMount{}, fmt.Errorf("refusing to bind %s — it would expose your entire home directory; bind a subdirectory instead", host)
+	}
+	info, err := os.Stat(host)
+	if err != nil {
+		return nspawn.BindMount{}, fmt.Errorf("mount host path %s: %w", host, err)
+	}
+	if !info.IsDir() {
+		return nspawn.BindMount{}, fmt.Errorf("mount host path %s is not a directory", host)
+	}
+
+	if container == "/" || contains(container, containerHome) {
+		return nspawn.BindMount{}, fmt.Errorf("refusing to mount over %s — it would hide the container home; use a subdirectory such as %s", container, filepath.Join(containerHome, filepath.Base(host)))
+	}
+	for _, dir := range reservedContainerDirs {
+		if contains(dir, container) {
+			return nspawn.BindMount{}, fmt.Errorf("refusing to mount over %s — it is part of the container's system", container)
+		}
+	}
+
+	return nspawn.BindMount{Host: host, Container: container, ReadOnly: m.ReadOnly}, nil
+}
+
+// BindMounts resolves every mount in the config, rejecting two mounts at the
+// same container path.
+func BindMounts(mounts []config.Mount, home, containerHome string) ([]nspawn.BindMount, error) {
+	binds := make([]nspawn.BindMount, 0, len(mounts))
+	seen := make(map[string]bool)
+	for _, m := range mounts {
+		b, err := Resolve(m, home, containerHome)
+		if err != nil {
+			return nil, fmt.Errorf("config.toml [[mounts]]: %w", err)
+		}
+		if seen[b.Container] {
+			return nil, fmt.Errorf("config.toml [[mounts]]: %s is mounted more than once", b.Container)
+		}
+		seen[b.Container] = true
+		binds = append(binds, b)
+	}
+	return binds, nil
+}
+
+// Find returns the index of the mount whose container path (or, failing that,
+// host path) resolves to path, or -1.
+func Find(mounts []config.Mount, path, home, containerHome string) int {
+	for i, m := range mounts {
+		if p, err := Expand(m.Container, containerHome); err == nil && p == filepath.Clean(path) {
+			return i
+		}
+	}
+	abs, err := Expand(path, home)
+	if err != nil {
+		return -1
+	}
+	for i, m := range mounts {
+		if p, err := Expand(m.Host, home); err == nil && p == abs {
+			return i
+		}
+	}
+	return -1
+}
+
+// Expand resolves a leading "~" against home and requires an absolute result.
+func Expand(path, home string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = home + path[1:]
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%q is not an absolute path", path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// contains reports whether dir is path or one of its ancestors.
+func contains(dir, path string) bool {
+	return dir == path || dir == "/" || strings.HasPrefix(path, dir+"/")
+}
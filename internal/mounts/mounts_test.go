@@ -0,0 +1,135 @@
+package mounts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+)
+
+func TestResolve(t *testing.T) {
+	home := t.TempDir()
+	docs := filepath.Join(home, "work", "docs")
+	if err := os.MkdirAll(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(home, "notes.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		mount   config.Mount
+		want    nspawn.BindMount
+		wantErr string
+	}{
+		{"tilde paths", config.Mount{Host: "~/work/docs", Container: "~/docs", ReadOnly: true},
+			nspawn.BindMount{Host: docs, Container: "/home/me/docs", ReadOnly: true}, ""},
+		{"absolute paths", config.Mount{Host: docs + "/", Container: "/mnt/docs"},
+			nspawn.BindMount{Host: docs, Container: "/mnt/docs"}, ""},
+		{"home", config.Mount{Host: "~", Container: "/mnt/home"}, nspawn.BindMount{}, "entire home"},
+		{"home with slash", config.Mount{Host: home + "/", Container: "/mnt/home"}, nspawn.BindMount{}, "entire home"},
+		{"root", config.Mount{Host: "/", Container: "/mnt/root"}, nspawn.BindMount{}, "entire home"},
+		{"home parent", config.Mount{Host: filepath.Dir(home), Container: "/mnt/x"}, nspawn.BindMount{}, "entire home"},
+		{"relative host", config.Mount{Host: "work/docs", Container: "/mnt/docs"}, nspawn.BindMount{}, "absolute"},
+		{"missing host", config.Mount{Host: "~/nope", Container: "/mnt/docs"}, nspawn.BindMount{}, "no such file"},
+		{"file host", config.Mount{Host: file, Container: "/mnt/docs"}, nspawn.BindMount{}, "not a directory"},
+		{"container home", config.Mount{Host: docs, Container: "~"}, nspawn.BindMount{}, "container home"},
+		{"container home parent", config.Mount{Host: docs, Container: "/home"}, nspawn.BindMount{}, "container home"},
+		{"container root", config.Mount{Host: docs, Container: "/"}, nspawn.BindMount{}, "container home"},
+		{"container system dir", config.Mount{Host: docs, Container: "/usr"}, nspawn.BindMount{}, "system"},
+		{"inside system dir", config.Mount{Host: docs, Container: "/etc/ssl/certs"}, nspawn.BindMount{}, "system"},
+		{"colon in host", config.Mount{Host: "~/work/a:b", Container: "/mnt/docs"}, nspawn.BindMount{}, "cannot bind"},
+		{"colon in container", config.Mount{Host: docs, Container: "/mnt/docs:/etc"}, nspawn.BindMount{}, "cannot bind"},
+		{"comma in container", config.Mount{Host: docs, Container: "/mnt/docs,rw"}, nspawn.BindMount{}, "cannot bind"},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.mount, home, "/home/me")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Resolve = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolve_SymlinkedHome(t *testing.T) {
+	// Like Silverblue: /home links to /var/home and $HOME is under /var/home.
+	tmp := t.TempDir()
+	home := filepath.Join(tmp, "var", "home", "me")
+	docs := filepath.Join(home, "docs")
+	if err := os.MkdirAll(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(tmp, "var", "home"), filepath.Join(tmp, "home")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(home, filepath.Join(home, "me-again")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{filepath.Join(tmp, "home", "me"), "~/me-again", filepath.Join(tmp, "home")} {
+		_, err := Resolve(config.Mount{Host: host, Container: "/mnt/x"}, home, "/home/me")
+		if err == nil || !strings.Contains(err.Error(), "entire home") {
+			t.Errorf("Resolve(%s) = %v, want the home directory refused", host, err)
+		}
+	}
+	if _, err := Resolve(config.Mount{Host: filepath.Join(tmp, "home", "me", "docs"), Container: "/mnt/docs"}, home, "/home/me"); err != nil {
+		t.Errorf("a subdirectory through the /home link should be allowed: %v", err)
+	}
+}
+
+func TestBindMounts_Duplicate(t *testing.T) {
+	home := t.TempDir()
+	for _, d := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(home, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms := []config.Mount{
+		{Host: "~/a", Container: "/mnt/x"},
+		{Host: "~/b", Container: "/mnt/x/"},
+	}
+	if _, err := BindMounts(ms, home, "/home/me"); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("expected duplicate container path error, got %v", err)
+	}
+	binds, err := BindMounts(ms[:1], home, "/home/me")
+	if err != nil || len(binds) != 1 {
+		t.Errorf("BindMounts = %v, %v", binds, err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	ms := []config.Mount{
+		{Host: "~/a", Container: "~/a"},
+		{Host: "/srv/b", Container: "/mnt/b"},
+	}
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/home/me/a", 0},
+		{"/mnt/b/", 1},
+		{"~/a", 0},
+		{"/srv/b", 1},
+		{"/mnt/c", -1},
+		{"relative", -1},
+	}
+	for _, tt := range tests {
+		if got := Find(ms, tt.path, "/home/u", "/home/me"); got != tt.want {
+			t.Errorf("Find(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
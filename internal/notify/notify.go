@@ -0,0 +1,302 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/frostyard/intuneme/internal/broker"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	BusName       = "org.freedesktop.Notifications"
+	ObjectPath    = "/org/freedesktop/Notifications"
+	InterfaceName = "org.freedesktop.Notifications"
+)
+
+// introspectXML describes the methods and signals of the Desktop
+// Notifications Specification that the proxy serves.
+const introspectXML = `<node>
+  <interface name="` + InterfaceName + `">
+    <method name="GetCapabilities">
+      <arg name="capabilities" type="as" direction="out"/>
+    </method>
+    <method name="Notify">
+      <arg name="app_name" type="s" direction="in"/>
+      <arg name="replaces_id" type="u" direction="in"/>
+      <arg name="app_icon" type="s" direction="in"/>
+      <arg name="summary" type="s" direction="in"/>
+      <arg name="body" type="s" direction="in"/>
+      <arg name="actions" type="as" direction="in"/>
+      <arg name="hints" type="a{sv}" direction="in"/>
+      <arg name="expire_timeout" type="i" direction="in"/>
+      <arg name="id" type="u" direction="out"/>
+    </method>
+    <method name="CloseNotification">
+      <arg name="id" type="u" direction="in"/>
+    </method>
+    <method name="GetServerInformation">
+      <arg name="name" type="s" direction="out"/>
+      <arg name="vendor" type="s" direction="out"/>
+      <arg name="version" type="s" direction="out"/>
+      <arg name="spec_version" type="s" direction="out"/>
+    </method>
+    <signal name="NotificationClosed">
+      <arg name="id" type="u"/>
+      <arg name="reason" type="u"/>
+    </signal>
+    <signal name="ActionInvoked">
+      <arg name="id" type="u"/>
+      <arg name="action_key" type="s"/>
+    </signal>
+    <signal name="ActivationToken">
+      <arg name="id" type="u"/>
+      <arg name="activation_token" type="s"/>
+    </signal>
+  </interface>
+  ` + introspect.IntrospectDataString + `
+</node>`
+
+// Signals forwarded from the host's notification server to the container.
+var forwardedSignals = []string{"NotificationClosed", "ActionInvoked", "ActivationToken"}
+
+// pathHints are the hints that carry a file path, which must be translated
+// like app_icon.
+var pathHints = []string{"image-path", "image_path"}
+
+// LogPath returns the notification-proxy log file under the data root.
+func LogPath(root string) string {
+	return filepath.Join(root, "notification-proxy.log")
+}
+
+// PIDPath returns the notification-proxy PID file under the data root.
+func PIDPath(root string) string {
+	return filepath.Join(root, "notification-proxy.pid")
+}
+
+// Paths locates the container's files on the host, so that icons referred to
+// by path can be shown by the host's notification server.
+type Paths struct {
+	// Rootfs is the container's root filesystem.
+	Rootfs string
+	// Home is the host directory mounted as the container user's home, and
+	// ContainerHome where it is mounted.
+	Home          string
+	ContainerHome string
+}
+
+// HostPath returns the host path of a file the container refers to by an
+// absolute path or file:// URL, or "" if it does not exist on the host or
+// resolves, through symlinks, to a file outside Rootfs and Home. Icon names
+// and other values are returned unchanged.
+func (p Paths) HostPath(ref string) string {
+	path := ref
+	if strings.HasPrefix(ref, "file://") {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return ""
+		}
+		path = u.Path
+	}
+	if !filepath.IsAbs(path) {
+		return ref
+	}
+	path = filepath.Clean(path)
+	host := filepath.Join(p.Rootfs, path)
+	if rest, ok := strings.CutPrefix(path, p.ContainerHome+"/"); ok && p.ContainerHome != "" {
+		host = filepath.Join(p.Home, rest)
+	}
+	// Symlinks are resolved on the host, so one pointing out of the
+	// container, absolute or through "..", must not reach a host file.
+	resolved, err := filepath.EvalSymlinks(host)
+	if err != nil {
+		return ""
+	}
+	for _, dir := range []string{p.Rootfs, p.Home} {
+		if dir == "" {
+			continue
+		}
+		if d, err := filepath.EvalSymlinks(dir); err == nil {
+			if rel, err := filepath.Rel(d, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+				return host
+			}
+		}
+	}
+	return ""
+}
+
+// forwarder serves org.freedesktop.Notifications on the container's session
+// bus by calling the host's notification server.
+type forwarder struct {
+	host  dbus.BusObject
+	paths Paths
+
+	mu  sync.Mutex
+	ids map[uint32]bool // notifications sent from the container and still open
+}
+
+func (f *forwarder) call(method string, args ...any) *dbus.Call {
+	return f.host.Call(InterfaceName+"."+method, 0, args...)
+}
+
+func (f *forwarder) GetCapabilities() ([]string, *dbus.Error) {
+	var caps []string
+	if err := f.call("GetCapabilities").Store(&caps); err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	return caps, nil
+}
+
+func (f *forwarder) Notify(appName string, replacesID uint32, appIcon, summary, body string, actions []string, hints map[string]dbus.Variant, expireTimeout int32) (uint32, *dbus.Error) {
+	appIcon = f.paths.HostPath(appIcon)
+	for _, name := range pathHints {
+		if v, ok := hints[name]; ok {
+			if s, ok := v.Value().(string); ok {
+				if host := f.paths.HostPath(s); host != "" {
+					hints[name] = dbus.MakeVariant(host)
+				} else {
+					delete(hints, name)
+				}
+			}
+		}
+	}
+	if hints == nil {
+		hints = map[string]dbus.Variant{}
+	}
+	// Replacing works only on the container's own notifications.
+	if replacesID != 0 && !f.owns(replacesID, false) {
+		replacesID = 0
+	}
+
+	var id uint32
+	if err := f.call("Notify", appName, replacesID, appIcon, summary, body, actions, hints, expireTimeout).Store(&id); err != nil {
+		log.Printf("Notify from %s failed: %v", appName, err)
+		return 0, dbus.MakeFailedError(err)
+	}
+	f.mu.Lock()
+	f.ids[id] = true
+	f.mu.Unlock()
+	// The summary is left out: it can hold message previews, and the log
+	// is kept in the data root.
+	log.Printf("Notify from %s (id %d)", appName, id)
+	return id, nil
+}
+
+func (f *forwarder) CloseNotification(id uint32) *dbus.Error {
+	if !f.owns(id, false) {
+		return dbus.MakeFailedError(fmt.Errorf("notification %d was not sent from the container", id))
+	}
+	if err := f.call("CloseNotification", id).Err; err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (f *forwarder) GetServerInformation() (string, string, string, string, *dbus.Error) {
+	var name, vendor, version, spec string
+	if err := f.call("GetServerInformation").Store(&name, &vendor, &version, &spec); err != nil {
+		return "", "", "", "", dbus.MakeFailedError(err)
+	}
+	return name, vendor, version, spec, nil
+}
+
+// owns reports whether id is a notification the container sent. A closed
+// notification is forgotten, since the host may reuse its ID.
+func (f *forwarder) owns(id uint32, closed bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.ids[id] {
+		return false
+	}
+	if closed {
+		delete(f.ids, id)
+	}
+	return true
+}
+
+// relay emits on the container bus the host's signals about notifications
+// the container sent. Signals about the host's own notifications are not
+// passed on.
+func (f *forwarder) relay(container *dbus.Conn, sig *dbus.Signal) {
+	name, ok := strings.CutPrefix(sig.Name, InterfaceName+".")
+	if !ok || len(sig.Body) == 0 {
+		return
+	}
+	id, ok := sig.Body[0].(uint32)
+	if !ok || !f.owns(id, name == "NotificationClosed") {
+		return
+	}
+	if err := container.Emit(ObjectPath, sig.Name, sig.Body...); err != nil {
+		log.Printf("forward %s for id %d: %v", name, id, err)
+	}
+}
+
+// Run owns org.freedesktop.Notifications on the container's session bus and
+// forwards notifications to the host's notification server until ctx is
+// cancelled or the container's bus goes away.
+func Run(ctx context.Context, root string, paths Paths) error {
+	containerConn, err := broker.DialContainerBus(root)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = containerConn.Close() }()
+
+	hostConn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("connect host session bus: %w", err)
+	}
+	defer func() { _ = hostConn.Close() }()
+
+	fwd := &forwarder{
+		host:  hostConn.Object(BusName, dbus.ObjectPath(ObjectPath)),
+		paths: paths,
+		ids:   map[uint32]bool{},
+	}
+	if err := containerConn.Export(fwd, dbus.ObjectPath(ObjectPath), InterfaceName); err != nil {
+		return fmt.Errorf("export forwarder: %w", err)
+	}
+	if err := containerConn.Export(introspect.Introspectable(introspectXML), dbus.ObjectPath(ObjectPath), "org.freedesktop.DBus.Introspectable"); err != nil {
+		return fmt.Errorf("export introspectable: %w", err)
+	}
+
+	for _, name := range forwardedSignals {
+		if err := hostConn.AddMatchSignal(
+			dbus.WithMatchObjectPath(dbus.ObjectPath(ObjectPath)),
+			dbus.WithMatchInterface(InterfaceName),
+			dbus.WithMatchMember(name),
+		); err != nil {
+			return fmt.Errorf("subscribe to %s: %w", name, err)
+		}
+	}
+	signals := make(chan *dbus.Signal, 32)
+	hostConn.Signal(signals)
+
+	reply, err := containerConn.RequestName(BusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return fmt.Errorf("request bus name %s: %w", BusName, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("bus name %s is already owned in the container — is a notification daemon running there?", BusName)
+	}
+
+	log.Printf("Notification proxy running: forwarding %s from %s", BusName, broker.ContainerBusAddress(root))
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Notification proxy shutting down")
+			return nil
+		case <-containerConn.Context().Done():
+			return errors.New("container session bus closed")
+		case sig := <-signals:
+			fwd.relay(containerConn, sig)
+		}
+	}
+}
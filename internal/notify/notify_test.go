@@ -0,0 +1,206 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestHostPath(t *testing.T) {
+	tmp := t.TempDir()
+	paths := Paths{
+		Rootfs:        filepath.Join(tmp, "rootfs"),
+		Home:          filepath.Join(tmp, "home"),
+		ContainerHome: "/home/alice",
+	}
+	for _, f := range []string{
+		filepath.Join(paths.Rootfs, "usr/share/icons/teams.png"),
+		filepath.Join(paths.Home, ".cache/avatar.png"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secret := filepath.Join(tmp, "secret.png")
+	if err := os.WriteFile(secret, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		filepath.Join(paths.Rootfs, "usr/share/icons/abs.png"): secret,
+		filepath.Join(paths.Rootfs, "usr/share/icons/rel.png"): "../../../../secret.png",
+		filepath.Join(paths.Home, ".cache/link.png"):           "../../secret.png",
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"/usr/share/icons/teams.png", filepath.Join(paths.Rootfs, "usr/share/icons/teams.png")},
+		{"file:///usr/share/icons/teams.png", filepath.Join(paths.Rootfs, "usr/share/icons/teams.png")},
+		{"/home/alice/.cache/avatar.png", filepath.Join(paths.Home, ".cache/avatar.png")},
+		{"file:///home/alice/.cache/avatar.png", filepath.Join(paths.Home, ".cache/avatar.png")},
+		{"/usr/share/icons/missing.png", ""},
+		{"/home/alice/../../etc/shadow", ""},
+		{"/usr/share/icons/abs.png", ""},
+		{"/usr/share/icons/rel.png", ""},
+		{"/home/alice/.cache/link.png", ""},
+		{"microsoft-edge", "microsoft-edge"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := paths.HostPath(tt.ref); got != tt.want {
+			t.Errorf("HostPath(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+// fakeHost records calls made to the host's notification server.
+type fakeHost struct {
+	dbus.BusObject
+	calls []*dbus.Call
+	reply []any
+}
+
+func (h *fakeHost) Call(method string, flags dbus.Flags, args ...any) *dbus.Call {
+	c := &dbus.Call{Method: method, Args: args, Body: h.reply}
+	h.calls = append(h.calls, c)
+	return c
+}
+
+func (h *fakeHost) CallWithContext(_ context.Context, method string, flags dbus.Flags, args ...any) *dbus.Call {
+	return h.Call(method, flags, args...)
+}
+
+func TestNotify(t *testing.T) {
+	tmp := t.TempDir()
+	icon := filepath.Join(tmp, "usr/share/icons/teams.png")
+	if err := os.MkdirAll(filepath.Dir(icon), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(icon, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	host := &fakeHost{reply: []any{uint32(7)}}
+	f := &forwarder{host: host, paths: Paths{Rootfs: tmp}, ids: map[uint32]bool{}}
+	hints := map[string]dbus.Variant{
+		"image-path": dbus.MakeVariant("/usr/share/icons/teams.png"),
+		"image_path": dbus.MakeVariant("/missing.png"),
+		"urgency":    dbus.MakeVariant(byte(1)),
+	}
+	id, derr := f.Notify("Teams", 0, "/usr/share/icons/teams.png", "Meeting", "Starts now", nil, hints, -1)
+	if derr != nil {
+		t.Fatalf("Notify: %v", derr)
+	}
+	if id != 7 {
+		t.Errorf("id = %d, want 7", id)
+	}
+
+	if len(host.calls) != 1 || host.calls[0].Method != InterfaceName+".Notify" {
+		t.Fatalf("host calls = %v, want one Notify", host.calls)
+	}
+	args := host.calls[0].Args
+	if args[2] != icon {
+		t.Errorf("app_icon = %v, want %q", args[2], icon)
+	}
+	sent := args[6].(map[string]dbus.Variant)
+	if got := sent["image-path"].Value(); got != icon {
+		t.Errorf("image-path hint = %v, want %q", got, icon)
+	}
+	if _, ok := sent["image_path"]; ok {
+		t.Error("image_path hint for a missing file should be dropped")
+	}
+	if _, ok := sent["urgency"]; !ok {
+		t.Error("urgency hint should be passed on")
+	}
+
+	if !f.owns(7, false) {
+		t.Error("owns(7) = false after Notify")
+	}
+	if f.owns(8, false) {
+		t.Error("owns(8) = true for a notification the container did not send")
+	}
+	if !f.owns(7, true) {
+		t.Error("owns(7, closed) = false")
+	}
+	if f.owns(7, false) {
+		t.Error("owns(7) = true after the notification was closed")
+	}
+}
+
+func TestNotify_OnlyOwnNotifications(t *testing.T) {
+	host := &fakeHost{reply: []any{uint32(5)}}
+	f := &forwarder{host: host, ids: map[uint32]bool{}}
+
+	// The host's notification 3 is not the container's to replace or close.
+	if _, derr := f.Notify("app", 3, "", "summary", "", nil, nil, 0); derr != nil {
+		t.Fatalf("Notify: %v", derr)
+	}
+	if got := host.calls[0].Args[1]; got != uint32(0) {
+		t.Errorf("replaces_id = %v, want 0 for a host notification", got)
+	}
+	if derr := f.CloseNotification(3); derr == nil {
+		t.Error("CloseNotification(3) should fail for a host notification")
+	}
+	if len(host.calls) != 1 {
+		t.Errorf("host calls = %d, want only the Notify", len(host.calls))
+	}
+
+	if _, derr := f.Notify("app", 5, "", "summary", "", nil, nil, 0); derr != nil {
+		t.Fatalf("Notify: %v", derr)
+	}
+	if got := host.calls[1].Args[1]; got != uint32(5) {
+		t.Errorf("replaces_id = %v, want 5 for the container's own notification", got)
+	}
+	if derr := f.CloseNotification(5); derr != nil {
+		t.Errorf("CloseNotification(5): %v", derr)
+	}
+}
+
+func TestNotify_DoesNotLogContent(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	host := &fakeHost{reply: []any{uint32(9)}}
+	f := &forwarder{host: host, ids: map[uint32]bool{}}
+	if _, derr := f.Notify("Teams", 0, "", "Alice: salary review", "see attached", nil, nil, 0); derr != nil {
+		t.Fatalf("Notify: %v", derr)
+	}
+	if got := buf.String(); strings.Contains(got, "salary") || strings.Contains(got, "attached") || !strings.Contains(got, "Teams") {
+		t.Errorf("log = %q, want the app name without the notification's text", got)
+	}
+}
+
+func TestNotify_NilHints(t *testing.T) {
+	host := &fakeHost{reply: []any{uint32(1)}}
+	f := &forwarder{host: host, ids: map[uint32]bool{}}
+	if _, derr := f.Notify("app", 0, "", "summary", "", nil, nil, 0); derr != nil {
+		t.Fatalf("Notify: %v", derr)
+	}
+	if hints, ok := host.calls[0].Args[6].(map[string]dbus.Variant); !ok || hints == nil {
+		t.Errorf("hints = %#v, want an empty map", host.calls[0].Args[6])
+	}
+}
+
+func TestRelay_IgnoresHostNotifications(t *testing.T) {
+	f := &forwarder{ids: map[uint32]bool{}}
+	// A nil connection would panic if relay tried to emit the signal.
+	f.relay(nil, &dbus.Signal{Name: InterfaceName + ".NotificationClosed", Body: []any{uint32(3), uint32(1)}})
+	f.relay(nil, &dbus.Signal{Name: InterfaceName + ".ActionInvoked", Body: []any{uint32(3), "default"}})
+	f.relay(nil, &dbus.Signal{Name: "org.example.Other.Signal", Body: []any{uint32(3)}})
+}
@@ -0,0 +1,140 @@
+package nspawn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	machinedPath  = "/org/freedesktop/machine1"
+	machinedIface = "org.freedesktop.machine1.Manager"
+)
+
+// connectSystemBus is a variable so tests can force the polling fallback.
+var connectSystemBus = dbus.ConnectSystemBus
+
+// watchMachines subscribes to machined's MachineNew and MachineRemoved
+// signals on the system bus. The returned func closes the subscription.
+func watchMachines() (<-chan *dbus.Signal, func(), error) {
+	conn, err := connectSystemBus()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(machinedPath),
+		dbus.WithMatchInterface(machinedIface),
+	); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	ch := make(chan *dbus.Signal, 16)
+	conn.Signal(ch)
+	return ch, func() {
+		conn.RemoveSignal(ch)
+		_ = conn.Close()
+	}, nil
+}
+
+// machineSignal reports the registration state a machined signal announces
+// for machine. ok is false for signals about other machines.
+func machineSignal(sig *dbus.Signal, machine string) (running, ok bool) {
+	if sig == nil || len(sig.Body) == 0 {
+		return false, false
+	}
+	if name, _ := sig.Body[0].(string); name != machine {
+		return false, false
+	}
+	switch sig.Name {
+	case machinedIface + ".MachineNew":
+		return true, true
+	case machinedIface + ".MachineRemoved":
+		return false, true
+	}
+	return false, false
+}
+
+// WaitForMachine blocks until the machine's registration with systemd-machined
+// matches running, or timeout elapses. It returns as soon as machined announces
+// the change via MachineNew/MachineRemoved. The state is still re-checked every
+// pollInterval, which covers a missed signal and is the only mechanism when the
+// system bus is unavailable. Reports whether the state was reached; a
+// cancelled ctx ends the wait early and reports false.
+func WaitForMachine(ctx context.Context, r runner.Runner, machine string, running bool, pollInterval, timeout time.Duration) bool {
+	// Subscribe before the first check so a change in between is not missed.
+	signals, closeWatch, err := watchMachines()
+	if err == nil {
+		defer closeWatch()
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if IsRunning(ctx, r, machine) == running {
+			return true
+		}
+		select {
+		case sig := <-signals:
+			if state, ok := machineSignal(sig, machine); ok && state == running {
+				return true
+			}
+		case <-ticker.C:
+		case <-deadline.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// SystemState returns the container's overall boot state as reported by
+// `systemctl is-system-running` (e.g. "starting", "running", "degraded").
+// is-system-running exits non-zero for every state but "running", so the
+// output is used whenever there is any.
+func SystemState(ctx context.Context, r runner.Runner, machine string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, runner.QueryTimeout)
+	defer cancel()
+	out, err := r.RunContext(ctx, "sudo", "systemctl", "--machine="+machine, "is-system-running")
+	state := strings.TrimSpace(string(out))
+	if state == "" {
+		if err == nil {
+			err = fmt.Errorf("empty response")
+		}
+		return "", fmt.Errorf("systemctl is-system-running failed: %w", err)
+	}
+	return state, nil
+}
+
+// WaitBooted blocks until the container's systemd has finished booting, i.e.
+// is-system-running reports "running" or "degraded". Apps launched before that
+// may start without a session bus or identity broker. Returns the final state.
+func WaitBooted(ctx context.Context, r runner.Runner, machine string, pollInterval, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	state := "unknown"
+	for {
+		if s, err := SystemState(ctx, r, machine); err == nil {
+			state = s
+			switch state {
+			case "running", "degraded":
+				return state, nil
+			case "maintenance", "stopping":
+				return state, fmt.Errorf("container %s is %s", machine, state)
+			}
+		}
+		if time.Now().After(deadline) {
+			return state, fmt.Errorf("container %s did not finish booting within %s (state: %s)", machine, timeout, state)
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return state, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package nspawn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// noSystemBus forces WaitForMachine onto its polling fallback.
+func noSystemBus(t *testing.T) {
+	t.Helper()
+	orig := connectSystemBus
+	connectSystemBus = func(...dbus.ConnOption) (*dbus.Conn, error) {
+		return nil, errors.New("no system bus")
+	}
+	t.Cleanup(func() { connectSystemBus = orig })
+}
+
+func TestMachineSignal(t *testing.T) {
+	tests := []struct {
+		name        string
+		sig         *dbus.Signal
+		wantRunning bool
+		wantOK      bool
+	}{
+		{"new", &dbus.Signal{Name: machinedIface + ".MachineNew", Body: []any{"intuneme", dbus.ObjectPath("/x")}}, true, true},
+		{"removed", &dbus.Signal{Name: machinedIface + ".MachineRemoved", Body: []any{"intuneme", dbus.ObjectPath("/x")}}, false, true},
+		{"other machine", &dbus.Signal{Name: machinedIface + ".MachineNew", Body: []any{"other"}}, false, false},
+		{"other signal", &dbus.Signal{Name: "org.freedesktop.DBus.NameAcquired", Body: []any{"intuneme"}}, false, false},
+		{"empty body", &dbus.Signal{Name: machinedIface + ".MachineNew"}, false, false},
+		{"nil", nil, false, false},
+	}
+	for _, tt := range tests {
+		running, ok := machineSignal(tt.sig, "intuneme")
+		if running != tt.wantRunning || ok != tt.wantOK {
+			t.Errorf("%s: machineSignal() = (%v, %v), want (%v, %v)", tt.name, running, ok, tt.wantRunning, tt.wantOK)
+		}
+	}
+}
+
+// showCountRunner reports the machine as registered for the first n
+// machinectl show calls.
+type showCountRunner struct {
+	mockRunner
+	shows, n int
+}
+
+func (m *showCountRunner) Run(name string, args ...string) ([]byte, error) {
+	if name == "machinectl" && len(args) > 0 && args[0] == "show" {
+		m.shows++
+		if m.shows > m.n {
+			return nil, fmt.Errorf("machine not found")
+		}
+		return []byte("Name=intuneme\n"), nil
+	}
+	return m.mockRunner.Run(name, args...)
+}
+
+func (m *showCountRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func TestWaitForMachine_PollFallback(t *testing.T) {
+	noSystemBus(t)
+	r := &showCountRunner{n: 3}
+	if !WaitForMachine(context.Background(), r, "intuneme", false, time.Millisecond, time.Second) {
+		t.Fatal("expected machine to deregister")
+	}
+	if r.shows != 4 {
+		t.Errorf("expected 4 show calls, got %d", r.shows)
+	}
+}
+
+func TestWaitForMachine_Timeout(t *testing.T) {
+	noSystemBus(t)
+	r := &showCountRunner{n: 1 << 30}
+	if WaitForMachine(context.Background(), r, "intuneme", false, time.Millisecond, 5*time.Millisecond) {
+		t.Fatal("expected timeout")
+	}
+}
+
+func TestWaitBooted(t *testing.T) {
+	for _, state := range []string{"running", "degraded"} {
+		r := &mockRunner{outputs: map[string]string{
+			"sudo systemctl --machine=intuneme is-system-running": state + "\n",
+		}}
+		got, err := WaitBooted(context.Background(), r, "intuneme", time.Millisecond, time.Second)
+		if err != nil || got != state {
+			t.Errorf("WaitBooted() = (%q, %v), want (%q, nil)", got, err, state)
+		}
+	}
+}
+
+func TestWaitBooted_Timeout(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{
+		"sudo systemctl --machine=intuneme is-system-running": "starting\n",
+	}}
+	state, err := WaitBooted(context.Background(), r, "intuneme", time.Millisecond, 5*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if state != "starting" || !strings.Contains(err.Error(), "state: starting") {
+		t.Errorf("unexpected result: state=%q err=%v", state, err)
+	}
+}
+
+func TestWaitBooted_Maintenance(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{
+		"sudo systemctl --machine=intuneme is-system-running": "maintenance\n",
+	}}
+	if _, err := WaitBooted(context.Background(), r, "intuneme", time.Millisecond, time.Second); err == nil {
+		t.Fatal("expected error for maintenance state")
+	}
+}
+
+func TestWaitForMachine_Cancelled(t *testing.T) {
+	noSystemBus(t)
+	r := &showCountRunner{n: 1 << 30}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if WaitForMachine(ctx, r, "intuneme", false, time.Hour, time.Hour) {
+		t.Fatal("expected cancelled wait to report false")
+	}
+}
+
+func TestWaitBooted_Cancelled(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{
+		"sudo systemctl --machine=intuneme is-system-running": "starting\n",
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WaitBooted(ctx, r, "intuneme", time.Hour, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
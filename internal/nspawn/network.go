@@ -0,0 +1,190 @@
+package nspawn
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/sudo"
+)
+
+// Network modes accepted by the network setting in config.toml.
+const (
+	// NetworkHost shares the host's network namespace (the default).
+	NetworkHost = "host"
+	// NetworkVeth gives the container a private namespace joined to the host
+	// by a veth pair, addressed and NATed by the host's systemd-networkd.
+	NetworkVeth = "veth"
+	// networkBridgePrefix precedes the name of an existing host bridge the
+	// container's veth is attached to, e.g. "bridge:br0".
+	networkBridgePrefix = "bridge:"
+)
+
+// VethNetworkPath is the systemd-networkd config intuneme installs for the
+// host side of container veth links. It is shared by all profiles.
+const VethNetworkPath = "/etc/systemd/network/79-intuneme-ve.network"
+
+// validBridge matches Linux interface names.
+var validBridge = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+
+// Network is a parsed network setting.
+type Network struct {
+	Mode   string // NetworkHost, NetworkVeth or "bridge"
+	Bridge string // host bridge name in bridge mode
+}
+
+// ParseNetwork parses the network setting: "host" (or empty), "veth", or
+// "bridge:<name>".
+func ParseNetwork(s string) (Network, error) {
+	switch {
+	case s == "" || s == NetworkHost:
+		return Network{Mode: NetworkHost}, nil
+	case s == NetworkVeth:
+		return Network{Mode: NetworkVeth}, nil
+	case strings.HasPrefix(s, networkBridgePrefix):
+		name := strings.TrimPrefix(s, networkBridgePrefix)
+		if !validBridge.MatchString(name) {
+			return Network{}, fmt.Errorf("invalid bridge name %q in network setting", name)
+		}
+		return Network{Mode: "bridge", Bridge: name}, nil
+	}
+	return Network{}, fmt.Errorf("invalid network setting %q — use \"host\", \"veth\" or \"bridge:<name>\"", s)
+}
+
+// Private reports whether the container gets its own network namespace.
+func (n Network) Private() bool {
+	return n.Mode == NetworkVeth || n.Mode == "bridge"
+}
+
+// String returns the setting as written in config.toml.
+func (n Network) String() string {
+	if n.Mode == "bridge" {
+		return networkBridgePrefix + n.Bridge
+	}
+	if n.Mode == "" {
+		return NetworkHost
+	}
+	return n.Mode
+}
+
+// bootArgs returns the systemd-nspawn options for n. A private namespace cannot
+// reach the host's 127.0.0.53 stub resolver, so the container gets the host's
+// upstream DNS servers instead.
+func (n Network) bootArgs() []string {
+	switch n.Mode {
+	case NetworkVeth:
+		return []string{"--network-veth", "--resolv-conf=replace-uplink"}
+	case "bridge":
+		return []string{"--network-bridge=" + n.Bridge, "--resolv-conf=replace-uplink"}
+	}
+	return nil
+}
+
+// vethNetworkContent configures the host end of each container veth the way
+// systemd's own 80-container-ve.network does, for hosts that do not ship it: a
+// /28 from networkd's pool with a DHCP server for the container, and
+// masquerading (which also enables IPv4 forwarding) so the container reaches
+// the outside through the host. It matches every container veth like that file
+// does, since systemd-nspawn truncates or hashes "ve-<machine>" to fit the 15
+// character interface name limit, which profile machine names exceed.
+const vethNetworkContent = `# Installed by intuneme for containers using network = "veth".
+[Match]
+Name=ve-*
+Driver=veth
+
+[Network]
+Address=0.0.0.0/28
+LinkLocalAddressing=yes
+DHCPServer=yes
+IPMasquerade=ipv4
+LLDP=yes
+EmitLLDP=customer-bridge
+`
+
+// containerNetworkdLink is the symlink that enables systemd-networkd inside
+// the container, whose stock 80-container-host0.network runs DHCP on host0.
+const containerNetworkdLink = "etc/systemd/system/multi-user.target.wants/systemd-networkd.service"
+
+// SetupNetwork prepares the host and rootfs for n before boot. veth mode needs
+// systemd-networkd running on the host to address and NAT the link; both
+// private modes need networkd in the container to take a DHCP lease.
+func SetupNetwork(ctx context.Context, r runner.Runner, rootfs string, n Network) error {
+	if !n.Private() {
+		return nil
+	}
+	if n.Mode == NetworkVeth {
+		out, _ := r.RunContext(ctx, "systemctl", "is-active", "systemd-networkd")
+		if strings.TrimSpace(string(out)) != "active" {
+			return fmt.Errorf("network = \"veth\" needs systemd-networkd on the host — enable it with 'sudo systemctl enable --now systemd-networkd', or use \"bridge:<name>\"")
+		}
+		if existing, err := os.ReadFile(VethNetworkPath); err != nil || string(existing) != vethNetworkContent {
+			if err := sudo.WriteFile(ctx, r, VethNetworkPath, []byte(vethNetworkContent), 0644); err != nil {
+				return fmt.Errorf("install %s: %w", VethNetworkPath, err)
+			}
+			if out, err := r.RunContext(ctx, "sudo", "networkctl", "reload"); err != nil {
+				return fmt.Errorf("networkctl reload failed: %w\n%s", err, out)
+			}
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, containerNetworkdLink)); err != nil {
+		if out, err := r.RunContext(ctx, "sudo", "systemctl", "--root="+rootfs, "enable", "systemd-networkd.service"); err != nil {
+			return fmt.Errorf("enable systemd-networkd in container: %w\n%s", err, out)
+		}
+	}
+	return nil
+}
+
+// RemoveVethNetwork deletes the host networkd config for container veths.
+func RemoveVethNetwork(ctx context.Context, r runner.Runner) error {
+	if _, err := os.Stat(VethNetworkPath); err != nil {
+		return nil
+	}
+	if out, err := r.RunContext(ctx, "sudo", "rm", "-f", VethNetworkPath); err != nil {
+		return fmt.Errorf("remove %s: %w\n%s", VethNetworkPath, err, out)
+	}
+	_, _ = r.RunContext(ctx, "sudo", "networkctl", "reload")
+	return nil
+}
+
+// Addresses returns the container's IP addresses as reported by machined,
+// which reads them from the container's network namespace.
+func Addresses(ctx context.Context, r runner.Runner, machine string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, runner.QueryTimeout)
+	defer cancel()
+	out, err := r.RunContext(ctx, "machinectl", "status", machine, "--no-pager", "--lines=0")
+	if err != nil {
+		return nil, fmt.Errorf("machinectl status failed: %w", err)
+	}
+	return parseAddresses(string(out)), nil
+}
+
+// statusKey matches a "Key: value" line of machinectl status output.
+var statusKey = regexp.MustCompile(`^\s*[A-Za-z]+:\s`)
+
+// parseAddresses extracts the Address field of machinectl status output. The
+// first address follows "Address:" and each further one sits alone on an
+// indented continuation line.
+func parseAddresses(out string) []string {
+	var addrs []string
+	in := false
+	for _, line := range strings.Split(out, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(trimmed, "Address:"); ok {
+			in = true
+			addrs = append(addrs, strings.TrimSpace(v))
+			continue
+		}
+		if !in {
+			continue
+		}
+		if trimmed == "" || statusKey.MatchString(line) {
+			break
+		}
+		addrs = append(addrs, trimmed)
+	}
+	return addrs
+}
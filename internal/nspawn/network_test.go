@@ -0,0 +1,141 @@
+package nspawn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNetwork(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Network
+		wantErr bool
+	}{
+		{"", Network{Mode: NetworkHost}, false},
+		{"host", Network{Mode: NetworkHost}, false},
+		{"veth", Network{Mode: NetworkVeth}, false},
+		{"bridge:br0", Network{Mode: "bridge", Bridge: "br0"}, false},
+		{"bridge:", Network{}, true},
+		{"bridge:br0;rm", Network{}, true},
+		{"bridge:averyveryverylongname", Network{}, true},
+		{"none", Network{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseNetwork(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseNetwork(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseNetwork(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuildBootArgs_Network(t *testing.T) {
+	tests := []struct {
+		network Network
+		want    string
+	}{
+		{Network{Mode: NetworkHost}, ""},
+		{Network{Mode: NetworkVeth}, "--network-veth --resolv-conf=replace-uplink"},
+		{Network{Mode: "bridge", Bridge: "br0"}, "--network-bridge=br0 --resolv-conf=replace-uplink"},
+	}
+	for _, tt := range tests {
+		args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/u/Intune", "/home/u", nil, nil, nil, tt.network, UserNamespace{}, nil)
+		joined := strings.Join(args, " ")
+		if tt.want == "" {
+			if strings.Contains(joined, "--network") || strings.Contains(joined, "--resolv-conf") {
+				t.Errorf("host network should add no options: %s", joined)
+			}
+			continue
+		}
+		if !strings.Contains(joined, tt.want+" --console=pipe -b") {
+			t.Errorf("%s: missing %q in: %s", tt.network, tt.want, joined)
+		}
+	}
+}
+
+func TestSetupNetwork_Host(t *testing.T) {
+	r := &mockRunner{}
+	if err := SetupNetwork(context.Background(), r, t.TempDir(), Network{Mode: NetworkHost}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.commands) != 0 {
+		t.Errorf("host network should run nothing, ran %v", r.commands)
+	}
+}
+
+func TestSetupNetwork_VethNeedsNetworkd(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{"systemctl is-active systemd-networkd": "inactive\n"}}
+	err := SetupNetwork(context.Background(), r, t.TempDir(), Network{Mode: NetworkVeth})
+	if err == nil || !strings.Contains(err.Error(), "systemd-networkd") {
+		t.Fatalf("expected systemd-networkd error, got %v", err)
+	}
+}
+
+func TestSetupNetwork_Veth(t *testing.T) {
+	if _, err := os.Stat(VethNetworkPath); err == nil {
+		t.Skip("host already has " + VethNetworkPath)
+	}
+	rootfs := t.TempDir()
+	r := &mockRunner{outputs: map[string]string{"systemctl is-active systemd-networkd": "active\n"}}
+	if err := SetupNetwork(context.Background(), r, rootfs, Network{Mode: NetworkVeth}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(r.fileContent, "IPMasquerade=ipv4") || !strings.Contains(r.fileContent, "Name=ve-*\n") {
+		t.Errorf("unexpected network file:\n%s", r.fileContent)
+	}
+	joined := strings.Join(r.commands, "\n")
+	for _, want := range []string{
+		"sudo networkctl reload",
+		"sudo systemctl --root=" + rootfs + " enable systemd-networkd.service",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing %q in:\n%s", want, joined)
+		}
+	}
+}
+
+func TestSetupNetwork_BridgeNetworkdEnabled(t *testing.T) {
+	rootfs := t.TempDir()
+	link := filepath.Join(rootfs, containerNetworkdLink)
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/usr/lib/systemd/system/systemd-networkd.service", link); err != nil {
+		t.Fatal(err)
+	}
+	r := &mockRunner{}
+	if err := SetupNetwork(context.Background(), r, rootfs, Network{Mode: "bridge", Bridge: "br0"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.commands) != 0 {
+		t.Errorf("bridge with networkd already enabled should run nothing, ran %v", r.commands)
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	out := `intuneme(1a2b3c)
+           Since: Thu 2026-10-15 09:12:01 CEST; 2h ago
+          Leader: 4321 (systemd)
+         Service: systemd-nspawn; class container
+            Root: /home/u/.local/share/intuneme/rootfs
+           Iface: ve-intuneme
+         Address: 192.168.45.118
+                  fe80::d4a1:2cff:fe3b:91e4
+              OS: Ubuntu 24.04.1 LTS
+            Unit: machine-intuneme.scope
+`
+	got := parseAddresses(out)
+	want := []string{"192.168.45.118", "fe80::d4a1:2cff:fe3b:91e4"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("parseAddresses = %v, want %v", got, want)
+	}
+	if got := parseAddresses("intuneme(1a2b3c)\n    Leader: 4321 (systemd)\n"); len(got) != 0 {
+		t.Errorf("expected no addresses, got %v", got)
+	}
+}
@@ -1,11 +1,16 @@
 package nspawn
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/frostyard/intuneme/internal/sudo"
@@ -28,7 +33,7 @@ var xauthorityPatterns = []string{
 }
 
 // findXAuthority locates the host's Xauthority file.
-func findXAuthority(uid int) string {
+func findXAuthority(runtimeDir string) string {
 	// Check env first
 	if xa := os.Getenv("XAUTHORITY"); xa != "" {
 		if _, err := os.Stat(xa); err == nil {
@@ -36,7 +41,6 @@ func findXAuthority(uid int) string {
 		}
 	}
 	// Glob for known patterns in runtime dir
-	runtimeDir := fmt.Sprintf("/run/user/%d", uid)
 	for _, pattern := range xauthorityPatterns {
 		matches, _ := filepath.Glob(filepath.Join(runtimeDir, pattern))
 		if len(matches) > 0 {
@@ -57,6 +61,10 @@ func findXAuthority(uid int) string {
 // Written by the CLI before boot; read by intuneme-profile.sh and the broker service.
 const displayMarkerPath = "etc/intuneme-host-display"
 
+// ProxyEnvPath is the container-side environment file holding the HTTP proxy
+// settings from config.toml. Sourced by every session; absent without a proxy.
+const ProxyEnvPath = "/etc/intuneme-proxy"
+
 // HostDisplay returns the host's DISPLAY value, falling back to ":0".
 // It validates that the corresponding X11 socket exists.
 func HostDisplay() string {
@@ -83,44 +91,104 @@ func HostDisplay() string {
 // WriteDisplayMarker writes the host DISPLAY value into the container rootfs
 // so that container scripts and services can read it.
 // Uses sudo install because the rootfs /etc/ is owned by root.
-func WriteDisplayMarker(r runner.Runner, rootfs, display string) error {
+func WriteDisplayMarker(ctx context.Context, r runner.Runner, rootfs, display string) error {
 	if !validDisplay.MatchString(display) {
 		return fmt.Errorf("invalid display value: %q", display)
 	}
 
 	content := fmt.Sprintf("DISPLAY=%s\n", display)
 	path := filepath.Join(rootfs, displayMarkerPath)
-	return sudo.WriteFile(r, path, []byte(content), 0644)
+	return sudo.WriteFile(ctx, r, path, []byte(content), 0644)
 }
 
-// DetectHostSockets checks which optional host sockets/files exist and returns
-// bind mount pairs for them.
-func DetectHostSockets(uid int) []BindMount {
-	runtimeDir := fmt.Sprintf("/run/user/%d", uid)
-	checks := []struct {
-		hostPath      string
-		containerPath string
-	}{
-		{runtimeDir + "/wayland-0", "/run/host-wayland"},
-		{runtimeDir + "/pipewire-0", "/run/host-pipewire"},
-		{runtimeDir + "/pulse/native", "/run/host-pulse"},
+// HostSockets are the host display and audio endpoints bound into the
+// container. Empty fields were not found.
+type HostSockets struct {
+	Wayland    string `json:"wayland,omitempty"`
+	PipeWire   string `json:"pipewire,omitempty"`
+	Pulse      string `json:"pulse,omitempty"`
+	XAuthority string `json:"xauthority,omitempty"`
+}
+
+// ResolveHostSockets finds the session's sockets the way its clients would:
+// from WAYLAND_DISPLAY, PIPEWIRE_REMOTE and PULSE_SERVER, relative to
+// XDG_RUNTIME_DIR, falling back to the conventional wayland-0, pipewire-0 and
+// pulse/native. Only sockets that exist are returned.
+func ResolveHostSockets(uid int) HostSockets {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", uid)
 	}
+	return HostSockets{
+		Wayland:    existing(runtimePath(runtimeDir, os.Getenv("WAYLAND_DISPLAY"), "wayland-0")),
+		PipeWire:   existing(runtimePath(runtimeDir, os.Getenv("PIPEWIRE_REMOTE"), "pipewire-0")),
+		Pulse:      existing(pulsePath(runtimeDir, os.Getenv("PULSE_SERVER"))),
+		XAuthority: findXAuthority(runtimeDir),
+	}
+}
 
-	var mounts []BindMount
-	for _, c := range checks {
-		if _, err := os.Stat(c.hostPath); err == nil {
-			mounts = append(mounts, BindMount{Host: c.hostPath, Container: c.containerPath})
+// runtimePath resolves a socket name as libwayland and libpipewire do: an
+// absolute value is used as is, anything else is relative to the runtime dir.
+func runtimePath(runtimeDir, value, fallback string) string {
+	if value == "" {
+		value = fallback
+	}
+	if filepath.IsAbs(value) {
+		return value
+	}
+	return filepath.Join(runtimeDir, value)
+}
+
+// pulsePath returns the first local socket in a PULSE_SERVER list such as
+// "{machine-id}unix:/path tcp:host". Network servers cannot be bind-mounted
+// and are skipped; with no local entry the default socket is used.
+func pulsePath(runtimeDir, server string) string {
+	for _, entry := range strings.Fields(server) {
+		if strings.HasPrefix(entry, "{") {
+			if i := strings.IndexByte(entry, '}'); i >= 0 {
+				entry = entry[i+1:]
+			}
+		}
+		entry = strings.TrimPrefix(entry, "unix:")
+		if filepath.IsAbs(entry) {
+			return entry
 		}
 	}
+	return filepath.Join(runtimeDir, "pulse", "native")
+}
 
-	// Xauthority: required for X11 display access
-	if xa := findXAuthority(uid); xa != "" {
-		mounts = append(mounts, BindMount{Host: xa, Container: "/run/host-xauthority"})
+// existing returns path if it exists, or "".
+func existing(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
 	}
+	return path
+}
 
+// Mounts returns the bind mounts for the sockets found. Container paths are
+// fixed so the session setup script finds them regardless of the host names.
+func (s HostSockets) Mounts() []BindMount {
+	var mounts []BindMount
+	for _, m := range []BindMount{
+		{Host: s.Wayland, Container: "/run/host-wayland"},
+		{Host: s.PipeWire, Container: "/run/host-pipewire"},
+		{Host: s.Pulse, Container: "/run/host-pulse"},
+		// Xauthority: required for X11 display access
+		{Host: s.XAuthority, Container: "/run/host-xauthority"},
+	} {
+		if m.Host != "" {
+			mounts = append(mounts, m)
+		}
+	}
 	return mounts
 }
 
+// DetectHostSockets checks which optional host sockets/files exist and returns
+// bind mount pairs for them.
+func DetectHostSockets(uid int) []BindMount {
+	return ResolveHostSockets(uid).Mounts()
+}
+
 // DetectDRIDevices scans for DRM card and render devices. Returns individual
 // device bind mounts instead of a directory bind so nspawn can grant each node
 // in the cgroup DeviceAllow list.
@@ -138,17 +206,30 @@ func DetectDRIDevices() []BindMount {
 // BuildBootArgs returns the systemd-nspawn arguments to boot the container.
 // DRI devices are detected internally; nvidiaDevices are detected by the caller
 // because Nvidia also needs host library and ICD setup.
-func BuildBootArgs(rootfs, machine, intuneHome, containerHome string, sockets []BindMount, nvidiaDevices []BindMount) []string {
-	return buildBootArgs(rootfs, machine, intuneHome, containerHome, sockets, DetectDRIDevices(), nvidiaDevices)
+func BuildBootArgs(rootfs, machine, intuneHome, containerHome string, sockets []BindMount, nvidiaDevices []BindMount, network Network, userNS UserNamespace, properties []string) []string {
+	var driDevices []BindMount
+	// Host GPU nodes belong to IDs a user namespace does not map, so the
+	// container could not open them; it renders in software instead.
+	if !userNS.Enabled() {
+		driDevices = DetectDRIDevices()
+	}
+	return buildBootArgs(rootfs, machine, intuneHome, containerHome, sockets, driDevices, nvidiaDevices, network, userNS, properties)
 }
 
-func buildBootArgs(rootfs, machine, intuneHome, containerHome string, sockets, driDevices, nvidiaDevices []BindMount) []string {
+func buildBootArgs(rootfs, machine, intuneHome, containerHome string, sockets, driDevices, nvidiaDevices []BindMount, network Network, userNS UserNamespace, properties []string) []string {
+	// In a user namespace the home and socket binds are idmapped so the host
+	// user's files and sockets belong to the same UID inside the container.
+	idmap := ""
+	if userNS.Enabled() {
+		idmap = ":idmap"
+	}
 	args := []string{
 		"-D", rootfs,
 		fmt.Sprintf("--machine=%s", machine),
-		fmt.Sprintf("--bind=%s:%s", intuneHome, containerHome),
+		fmt.Sprintf("--bind=%s:%s%s", intuneHome, containerHome, idmap),
 		"--bind=/tmp/.X11-unix",
 	}
+	args = append(args, userNS.bootArgs()...)
 	// Bind DRI devices individually and grant rwm in the cgroup. systemd-nspawn's
 	// automatic device policy grants only rw for these nodes, but WebKitGTK's
 	// auth browser needs DRM ioctls that create GBM/KMS buffers.
@@ -163,11 +244,16 @@ func buildBootArgs(rootfs, machine, intuneHome, containerHome string, sockets, d
 	}
 	for _, s := range sockets {
 		if s.ReadOnly {
-			args = append(args, fmt.Sprintf("--bind-ro=%s:%s", s.Host, s.Container))
+			args = append(args, fmt.Sprintf("--bind-ro=%s:%s%s", s.Host, s.Container, idmap))
 		} else {
-			args = append(args, fmt.Sprintf("--bind=%s:%s", s.Host, s.Container))
+			args = append(args, fmt.Sprintf("--bind=%s:%s%s", s.Host, s.Container, idmap))
 		}
 	}
+	args = append(args, network.bootArgs()...)
+	// Resource limits from config.toml, e.g. MemoryMax=8G.
+	for _, prop := range properties {
+		args = append(args, "--property="+prop)
+	}
 	args = append(args, "--console=pipe", "-b")
 	return args
 }
@@ -178,8 +264,10 @@ func BuildShellArgs(machine, user string) []string {
 	return []string{"shell", fmt.Sprintf("%s@%s", user, machine), "/bin/bash", "--login"}
 }
 
-func machinectlValue(r runner.Runner, machine, property string) (string, error) {
-	out, err := r.Run("machinectl", "show", machine, "-p", property, "--value")
+func machinectlValue(ctx context.Context, r runner.Runner, machine, property string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, runner.QueryTimeout)
+	defer cancel()
+	out, err := r.RunContext(ctx, "machinectl", "show", machine, "-p", property, "--value")
 	if err != nil {
 		return "", fmt.Errorf("machinectl show failed: %w", err)
 	}
@@ -193,32 +281,112 @@ func machinectlValue(r runner.Runner, machine, property string) (string, error)
 
 // LeaderPID returns the PID of the container's init process (Leader) as reported
 // by machinectl, which is used to enter the container's namespaces via nsenter.
-func LeaderPID(r runner.Runner, machine string) (string, error) {
-	return machinectlValue(r, machine, "Leader")
+func LeaderPID(ctx context.Context, r runner.Runner, machine string) (string, error) {
+	return machinectlValue(ctx, r, machine, "Leader")
 }
 
 // MachineUnit returns the systemd unit currently backing the machine.
-func MachineUnit(r runner.Runner, machine string) (string, error) {
-	return machinectlValue(r, machine, "Unit")
+func MachineUnit(ctx context.Context, r runner.Runner, machine string) (string, error) {
+	return machinectlValue(ctx, r, machine, "Unit")
 }
 
+// launchLogDir is where Exec logs the output of each launched app, relative
+// to the container user's home (~/Intune on the host). Logs older than a week
+// are removed at the next launch.
+const launchLogDir = ".cache/intuneme/launch"
+
+// launchGrace is how long Exec watches a launched app for an immediate exit,
+// in steps of launchPoll.
+const (
+	launchGrace = 2 * time.Second
+	launchPoll  = 200 * time.Millisecond
+)
+
+// launchFailed starts the line the launch script prints when the app exits
+// with an error during the grace period.
+const launchFailed = "intuneme-launch-failed"
+
 // Exec runs a command non-interactively inside the container as the given user.
 // Uses nsenter to enter the container's namespaces and launch the command in the
 // background. Requires passwordless sudo for nsenter (installed by intuneme start
 // via /etc/sudoers.d/intuneme-exec).
-func Exec(r runner.Runner, machine, user string, uid int, command string) error {
-	leaderPID, err := LeaderPID(r, machine)
+//
+// The command's output goes to a log under ~/.cache/intuneme/launch in the
+// container. If it exits with an error within launchGrace, Exec returns an
+// error holding its status and the end of the log, so a missing binary or a
+// crash at startup is not reported as a successful launch.
+func Exec(ctx context.Context, r runner.Runner, machine, user string, uid int, command string) error {
+	leaderPID, err := LeaderPID(ctx, r, machine)
 	if err != nil {
 		return err
 	}
-	script := buildSessionEnvScript(uid) +
-		fmt.Sprintf("\nnohup %s >/dev/null 2>&1 &", command)
-	if _, err := r.Run("sudo", buildNsenterArgs(leaderPID, script)...); err != nil {
+	script := buildSessionEnvScript(uid) + "\n" + buildLaunchScript(command, launchGrace, launchPoll)
+	out, err := r.RunContext(ctx, "sudo", buildNsenterArgs(machine, leaderPID, script)...)
+	if err != nil {
+		if msg, ok := launchFailure(command, string(out)); ok {
+			return errors.New(msg)
+		}
 		return fmt.Errorf("exec in container failed: %w", err)
 	}
 	return nil
 }
 
+// buildLaunchScript returns the script that starts command in the background
+// with its output logged, and fails if it exits with an error within grace,
+// checked every poll. The exit status is written by a subshell that outlives
+// the script; a zombie would still answer kill -0, so the script polls for
+// that file instead. Ignoring SIGHUP in the subshell does what nohup did, and its
+// output is detached so the caller does not wait for the app to exit.
+func buildLaunchScript(command string, grace, poll time.Duration) string {
+	return fmt.Sprintf(`dir="$HOME/%[1]s"
+mkdir -p "$dir" && find "$dir" -type f -mtime +7 -delete 2>/dev/null
+base="$dir/$(date +%%Y%%m%%d-%%H%%M%%S)-$$"
+log="$base.log"
+printf '$ %%s\n' %[2]s >"$log"
+(trap '' HUP; (%[3]s
+) </dev/null >>"$log" 2>&1; echo $? >"$base.status") >/dev/null 2>&1 &
+i=0
+while [ "$i" -lt %[4]d ]; do
+    sleep %[5]s
+    if [ -f "$base.status" ]; then
+        status=$(cat "$base.status")
+        [ "$status" = 0 ] && exit 0
+        echo "%[6]s status=$status log=~/%[1]s/${log##*/}"
+        tail -n 20 "$log"
+        exit 1
+    fi
+    i=$((i + 1))
+done`, launchLogDir, ShellQuote(command), command, int(grace/poll), strconv.FormatFloat(poll.Seconds(), 'f', -1, 64), launchFailed)
+}
+
+// launchFailure turns the launch script's report of an app that exited right
+// away into an error message, or returns false if out holds none.
+func launchFailure(command, out string) (string, bool) {
+	// The report follows whatever the session setup printed.
+	i := strings.Index(out, launchFailed+" ")
+	if i < 0 {
+		return "", false
+	}
+	head, tail, _ := strings.Cut(out[i+len(launchFailed)+1:], "\n")
+	status, log, _ := strings.Cut(strings.TrimSpace(head), " ")
+	status = strings.TrimPrefix(status, "status=")
+	log = strings.TrimPrefix(log, "log=")
+
+	name := command
+	if f := strings.Fields(command); len(f) > 0 {
+		name = path.Base(f[0])
+	}
+	msg := fmt.Sprintf("%s exited with status %s right after launch", name, status)
+	if status == "127" {
+		msg = fmt.Sprintf("%s was not found in the container", name)
+	}
+	msg += fmt.Sprintf(" (log: %s in the container)", log)
+	if tail = strings.TrimSpace(tail); tail != "" {
+		msg += ":\n" + tail
+	}
+	return msg, true
+}
+
 // ExecForeground runs a command inside the container in the FOREGROUND with the
 // caller's stdin/stdout/stderr attached. Unlike Exec it does not background the
 // process; this is required for stdio-transport servers (e.g. MCP) where the
@@ -226,18 +394,106 @@ func Exec(r runner.Runner, machine, user string, uid int, command string) error
 // (nsenter here is non-allocating), which keeps the JSON-RPC framing intact.
 // Reuses the same nsenter shape as Exec, so the intuneme-exec sudoers rule
 // authorizes it passwordless.
-func ExecForeground(r runner.Runner, machine, user string, uid int, command string) error {
-	leaderPID, err := LeaderPID(r, machine)
+// Like ExecCommand, it leaves SIGINT and SIGTERM to the command rather than
+// stopping it when ctx is cancelled.
+func ExecForeground(ctx context.Context, r runner.Runner, machine, user string, uid int, command string) error {
+	leaderPID, err := LeaderPID(ctx, r, machine)
 	if err != nil {
 		return err
 	}
 	script := buildSessionEnvScript(uid) + fmt.Sprintf("\nexec %s", command)
-	if err := r.RunAttached("sudo", buildNsenterArgs(leaderPID, script)...); err != nil {
+	if err := r.RunAttachedContext(context.WithoutCancel(ctx), "sudo", buildNsenterArgs(machine, leaderPID, script)...); err != nil {
 		return fmt.Errorf("foreground exec in container failed: %w", err)
 	}
 	return nil
 }
 
+// validEnvName matches a portable environment variable name.
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ExecOptions controls how ExecCommand runs a command inside the container.
+type ExecOptions struct {
+	Root bool     // run as root via the container user's passwordless sudo
+	TTY  bool     // allocate a pseudo-terminal inside the container
+	Env  []string // extra KEY=VALUE pairs set for the command
+	Dir  string   // working directory inside the container
+}
+
+// ExecCommand runs argv inside the container in the foreground with the
+// caller's stdio attached, after the same session prologue as Exec. The
+// argument vector is quoted verbatim, so no shell expansion happens inside the
+// container. The returned error wraps the child's *exec.ExitError so callers
+// can propagate its exit status.
+func ExecCommand(ctx context.Context, r runner.Runner, machine string, uid int, argv []string, opts ExecOptions) error {
+	script, err := buildExecScript(uid, argv, opts)
+	if err != nil {
+		return err
+	}
+	leaderPID, err := LeaderPID(ctx, r, machine)
+	if err != nil {
+		return err
+	}
+	// The first Ctrl-C also cancels ctx. The runner forwards the SIGINT to the
+	// command, which decides how to handle it; cancelling would add a SIGTERM
+	// and, after the grace period, a SIGKILL on top.
+	if err := r.RunAttachedContext(context.WithoutCancel(ctx), "sudo", buildNsenterArgs(machine, leaderPID, script)...); err != nil {
+		return fmt.Errorf("exec in container failed: %w", err)
+	}
+	return nil
+}
+
+// buildExecScript renders the script ExecCommand hands to the nsenter helper.
+// The helper always drops to the container user, so root is reached through
+// that user's in-container sudo; a TTY is allocated with script(1) because the
+// helper's su does not allocate one.
+func buildExecScript(uid int, argv []string, opts ExecOptions) (string, error) {
+	if len(argv) == 0 {
+		return "", fmt.Errorf("no command given")
+	}
+
+	var parts []string
+	if opts.Root {
+		parts = append(parts, "sudo", "--preserve-env", "--")
+	}
+	if len(opts.Env) > 0 {
+		parts = append(parts, "env")
+		for _, kv := range opts.Env {
+			name, _, ok := strings.Cut(kv, "=")
+			if !ok || !validEnvName.MatchString(name) {
+				return "", fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", kv)
+			}
+			parts = append(parts, ShellQuote(kv))
+		}
+	}
+	for _, a := range argv {
+		parts = append(parts, ShellQuote(a))
+	}
+	command := strings.Join(parts, " ")
+	if opts.TTY {
+		command = "script -qefc " + ShellQuote(command) + " /dev/null"
+	}
+
+	script := buildSessionEnvScript(uid)
+	if opts.Dir != "" {
+		script += "\ncd -- " + ShellQuote(opts.Dir) + " || exit 1"
+	}
+	return script + "\nexec " + command, nil
+}
+
+// ExecOutput runs a command inside the container as the container user (the one
+// baked into the nsenter helper) and returns
+// its combined output. Unlike Exec it does not run the session setup script,
+// so it observes the session as it is (used by diagnostics); only the runtime
+// dir and session bus address are set.
+func ExecOutput(ctx context.Context, r runner.Runner, machine string, uid int, command string) ([]byte, error) {
+	leaderPID, err := LeaderPID(ctx, r, machine)
+	if err != nil {
+		return nil, err
+	}
+	script := fmt.Sprintf("export XDG_RUNTIME_DIR=/run/user/%d\nexport DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/%d/bus\n%s", uid, uid, command)
+	return r.RunContext(ctx, "sudo", buildNsenterArgs(machine, leaderPID, script)...)
+}
+
 // MCPMountDir is the fixed container path where the host directory holding an
 // MCP server binary is bind-mounted by EnsureBind. The mount is runtime-only
 // (gone on poweroff) so the binary never enters the rootfs and survives
@@ -250,24 +506,59 @@ const MCPMountDir = "/opt/intuneme-mcp"
 // `machinectl bind` if it does not. `machinectl bind` is authorized passwordless
 // by the intuneme polkit rule (org.freedesktop.machine1.manage-machines), so this
 // re-establishes the mount automatically after a recreate without a prompt.
-func EnsureBind(r runner.Runner, machine, user, hostDir, containerDir, probePath string) error {
-	leaderPID, err := LeaderPID(r, machine)
+func EnsureBind(ctx context.Context, r runner.Runner, machine, user, hostDir, containerDir, probePath string) error {
+	leaderPID, err := LeaderPID(ctx, r, machine)
 	if err != nil {
 		return err
 	}
-	probe := buildNsenterArgs(leaderPID, "test -e "+ShellQuote(probePath))
-	if _, err := r.Run("sudo", probe...); err == nil {
+	probe := buildNsenterArgs(machine, leaderPID, "test -e "+ShellQuote(probePath))
+	if _, err := r.RunContext(ctx, "sudo", probe...); err == nil {
 		return nil // already bound and visible
 	}
-	if out, err := r.Run("machinectl", "bind", "--read-only", "--mkdir",
-		machine, hostDir, containerDir); err != nil {
-		return fmt.Errorf("bind %s into container %s: %w\n%s", hostDir, machine, err, out)
+	return Bind(ctx, r, machine, BindMount{Host: hostDir, Container: containerDir, ReadOnly: true})
+}
+
+// Bind mounts m into the running machine with `machinectl bind`, creating the
+// container directory if needed. The mount lasts until the container stops.
+// machined cannot bind into a container with its own user namespace, so that
+// case fails up front with a hint instead of machinectl's generic error.
+func Bind(ctx context.Context, r runner.Runner, machine string, m BindMount) error {
+	if shift, err := UIDShift(ctx, r, machine); err == nil && shift != 0 {
+		return fmt.Errorf("bind %s into container %s: machinectl bind does not support containers with private_users; [[mounts]] in config.toml are mounted at the next start", m.Host, machine)
+	}
+	return bind(ctx, r, machine, m)
+}
+
+// bind runs `machinectl bind` for m without the user namespace check.
+func bind(ctx context.Context, r runner.Runner, machine string, m BindMount) error {
+	args := []string{"bind"}
+	if m.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	args = append(args, "--mkdir", machine, m.Host, m.Container)
+	if out, err := r.RunContext(ctx, "machinectl", args...); err != nil {
+		return fmt.Errorf("bind %s into container %s: %w\n%s", m.Host, machine, err, out)
+	}
+	return nil
+}
+
+// Unbind unmounts containerDir inside the running machine. machinectl has no
+// counterpart to bind, so the umount runs in the container's mount namespace
+// through the nsenter helper, as root via the container user's sudo.
+func Unbind(ctx context.Context, r runner.Runner, machine, containerDir string) error {
+	leaderPID, err := LeaderPID(ctx, r, machine)
+	if err != nil {
+		return err
+	}
+	script := "mountpoint -q " + ShellQuote(containerDir) + " || exit 0; sudo umount " + ShellQuote(containerDir)
+	if out, err := r.RunContext(ctx, "sudo", buildNsenterArgs(machine, leaderPID, script)...); err != nil {
+		return fmt.Errorf("unmount %s in container %s: %w\n%s", containerDir, machine, err, out)
 	}
 	return nil
 }
 
 // buildSessionEnvScript returns the shell prologue that initializes a container
-// session the same way an interactive login would: display/audio/D-Bus/keyring.
+// session the same way an interactive login would: display/audio/proxy/D-Bus/keyring.
 // Shared by Exec (background GUI apps) and ExecForeground (stdio servers).
 // Session-setup output is redirected to stderr so it never pollutes stdout: for
 // foreground stdio servers stdout must carry only JSON-RPC.
@@ -286,6 +577,11 @@ if [ -d /run/host-nvidia ]; then
     export __NV_PRIME_RENDER_OFFLOAD=1
     export __GLX_VENDOR_LIBRARY_NAME=nvidia
 fi
+if [ -f %[4]s ]; then
+    set -a
+    . %[4]s
+    set +a
+fi
 # Initialize the session the same way an interactive login would. This is a
 # non-login shell, so /etc/profile.d is never sourced; without this the D-Bus
 # activation environment lacks DISPLAY/XAUTHORITY and the GTK identity broker
@@ -293,18 +589,24 @@ fi
 if [ -x /usr/local/bin/intuneme-session-setup ]; then
     /usr/local/bin/intuneme-session-setup >&2
 fi`,
-		display, uidStr, uidStr,
+		display, uidStr, uidStr, ProxyEnvPath,
 	)
 }
 
-// NsenterHelperDir is the directory holding the privileged nsenter helper script.
-const NsenterHelperDir = "/usr/local/libexec/intuneme"
+// NsenterHelperDir returns the directory holding the privileged nsenter helper
+// script for a machine. Each machine (profile) gets its own directory so that
+// removing one profile's helper never breaks another's.
+func NsenterHelperDir(machine string) string {
+	return "/usr/local/libexec/" + machine
+}
 
-// NsenterHelperPath is the fixed, root-owned helper script that performs the
+// NsenterHelperPath returns the fixed, root-owned helper script that performs the
 // nsenter+su into the container. The intuneme-exec sudoers rule authorizes this
 // single path with no wildcards (sudo-rs forbids interior argument wildcards),
 // so all per-call variation (leader PID, script) is passed as arguments instead.
-const NsenterHelperPath = NsenterHelperDir + "/nsenter-exec"
+func NsenterHelperPath(machine string) string {
+	return NsenterHelperDir(machine) + "/nsenter-exec"
+}
 
 // NsenterHelperScript renders the helper script contents for the given container
 // user. The user is baked in at install time, so the only runtime inputs are the
@@ -318,15 +620,21 @@ func NsenterHelperScript(user string) string {
 # (the intuneme-exec sudoers rule). Keeping the nsenter+su shape fixed here lets
 # the sudoers rule reference a single wildcard-free path, which sudo-rs requires.
 set -euo pipefail
-exec /usr/bin/nsenter -t "$1" -m -u -i -n -p -- /bin/su -s /bin/bash %s -c "$2"
+# A container with private_users has its own user namespace; enter it too so
+# su, and everything the script runs, gets the container's shifted IDs.
+userns=""
+if [ "$(readlink "/proc/$1/ns/user")" != "$(readlink /proc/self/ns/user)" ]; then
+	userns="-U"
+fi
+exec /usr/bin/nsenter -t "$1" $userns -m -u -i -n -p -- /bin/su -s /bin/bash %s -c "$2"
 `, user, user)
 }
 
 // buildNsenterArgs returns the argument vector (sans the leading "sudo") that
-// invokes the privileged helper to enter the container's namespaces and run
-// script. The shape matches the intuneme-exec sudoers rule exactly.
-func buildNsenterArgs(leaderPID, script string) []string {
-	return []string{NsenterHelperPath, leaderPID, script}
+// invokes the machine's privileged helper to enter the container's namespaces
+// and run script. The shape matches the intuneme-exec sudoers rule exactly.
+func buildNsenterArgs(machine, leaderPID, script string) []string {
+	return []string{NsenterHelperPath(machine), leaderPID, script}
 }
 
 // ShellQuote single-quotes s for safe interpolation into a /bin/sh command.
@@ -335,31 +643,39 @@ func ShellQuote(s string) string {
 }
 
 // Boot starts the nspawn container in the background using sudo.
-func Boot(r runner.Runner, rootfs, machine, intuneHome, containerHome string, sockets, nvidiaDevices []BindMount) error {
-	args := append([]string{"systemd-nspawn"}, BuildBootArgs(rootfs, machine, intuneHome, containerHome, sockets, nvidiaDevices)...)
+func Boot(r runner.Runner, rootfs, machine, intuneHome, containerHome string, sockets, nvidiaDevices []BindMount, network Network, userNS UserNamespace, properties []string) error {
+	args := append([]string{"systemd-nspawn"}, BuildBootArgs(rootfs, machine, intuneHome, containerHome, sockets, nvidiaDevices, network, userNS, properties)...)
 	return r.RunBackground("sudo", args...)
 }
 
 // ValidateSudo prompts for the sudo password if needed.
-func ValidateSudo(r runner.Runner) error {
-	return r.RunAttached("sudo", "-v")
+func ValidateSudo(ctx context.Context, r runner.Runner) error {
+	return r.RunAttachedContext(ctx, "sudo", "-v")
 }
 
 // IsRunning checks if the machine is registered with machinectl.
-func IsRunning(r runner.Runner, machine string) bool {
-	_, err := r.Run("machinectl", "show", machine)
+func IsRunning(ctx context.Context, r runner.Runner, machine string) bool {
+	ctx, cancel := context.WithTimeout(ctx, runner.QueryTimeout)
+	defer cancel()
+	_, err := r.RunContext(ctx, "machinectl", "show", machine)
 	return err == nil
 }
 
 // Shell opens an interactive session in the container via machinectl shell.
-func Shell(r runner.Runner, machine, user string) error {
+func Shell(ctx context.Context, r runner.Runner, machine, user string) error {
 	args := BuildShellArgs(machine, user)
-	return r.RunAttached("machinectl", args...)
+	return r.RunAttachedContext(ctx, "machinectl", args...)
 }
 
-// Stop powers off the container.
-func Stop(r runner.Runner, machine string) error {
-	out, err := r.Run("machinectl", "poweroff", machine)
+// Stop powers off the container, resuming it first if it is paused since a
+// frozen container cannot act on the poweroff request.
+func Stop(ctx context.Context, r runner.Runner, machine string) error {
+	if IsPaused(ctx, r, machine) {
+		if err := Resume(ctx, r, machine); err != nil {
+			return err
+		}
+	}
+	out, err := r.RunContext(ctx, "machinectl", "poweroff", machine)
 	if err != nil {
 		return fmt.Errorf("machinectl poweroff failed: %w\n%s", err, out)
 	}
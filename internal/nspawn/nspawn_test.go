@@ -1,10 +1,18 @@
 package nspawn
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/runner"
 )
 
 type mockRunner struct {
@@ -25,17 +33,19 @@ func (m *mockRunner) Run(name string, args ...string) ([]byte, error) {
 			m.fileContent = string(data)
 		}
 	}
-	for prefix, err := range m.errors {
+	var out []byte
+	for prefix, o := range m.outputs {
 		if strings.HasPrefix(cmd, prefix) {
-			return nil, err
+			out = []byte(o)
+			break
 		}
 	}
-	for prefix, out := range m.outputs {
+	for prefix, err := range m.errors {
 		if strings.HasPrefix(cmd, prefix) {
-			return []byte(out), nil
+			return out, err
 		}
 	}
-	return nil, nil
+	return out, nil
 }
 
 func (m *mockRunner) RunAttached(name string, args ...string) error {
@@ -43,6 +53,20 @@ func (m *mockRunner) RunAttached(name string, args ...string) error {
 	return nil
 }
 
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mockRunner) RunBackground(name string, args ...string) error {
 	m.commands = append(m.commands, name+" "+strings.Join(args, " "))
 	return nil
@@ -56,7 +80,7 @@ func TestBuildBootArgs(t *testing.T) {
 	sockets := []BindMount{
 		{Host: "/run/user/1000/wayland-0", Container: "/run/host-wayland"},
 	}
-	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", sockets, nil)
+	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", sockets, nil, Network{}, UserNamespace{}, nil)
 
 	joined := strings.Join(args, " ")
 	if !strings.Contains(joined, "--machine=intuneme") {
@@ -81,7 +105,7 @@ func TestBuildBootArgs_DRIDevices(t *testing.T) {
 		{Host: "/dev/dri/card0", Container: "/dev/dri/card0"},
 		{Host: "/dev/dri/renderD128", Container: "/dev/dri/renderD128"},
 	}
-	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, driDevices, nil)
+	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, driDevices, nil, Network{}, UserNamespace{}, nil)
 
 	joined := strings.Join(args, " ")
 	for _, dev := range driDevices {
@@ -95,7 +119,7 @@ func TestBuildBootArgs_DRIDevices(t *testing.T) {
 }
 
 func TestBuildBootArgsNoSockets(t *testing.T) {
-	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, nil)
+	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, nil, Network{}, UserNamespace{}, nil)
 
 	joined := strings.Join(args, " ")
 	if !strings.Contains(joined, "--machine=intuneme") {
@@ -134,7 +158,7 @@ func TestLeaderPID(t *testing.T) {
 		},
 	}
 
-	pid, err := LeaderPID(r, "intuneme")
+	pid, err := LeaderPID(context.Background(), r, "intuneme")
 	if err != nil {
 		t.Fatalf("LeaderPID failed: %v", err)
 	}
@@ -150,7 +174,7 @@ func TestMachineUnit(t *testing.T) {
 		},
 	}
 
-	unit, err := MachineUnit(r, "intuneme")
+	unit, err := MachineUnit(context.Background(), r, "intuneme")
 	if err != nil {
 		t.Fatalf("MachineUnit failed: %v", err)
 	}
@@ -179,7 +203,7 @@ func TestWriteDisplayMarker(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	r := &mockRunner{}
-	if err := WriteDisplayMarker(r, tmpDir, ":1"); err != nil {
+	if err := WriteDisplayMarker(context.Background(), r, tmpDir, ":1"); err != nil {
 		t.Fatalf("WriteDisplayMarker failed: %v", err)
 	}
 
@@ -213,7 +237,7 @@ func TestWriteDisplayMarker_InvalidDisplay(t *testing.T) {
 		"",
 	}
 	for _, display := range tests {
-		if err := WriteDisplayMarker(r, t.TempDir(), display); err == nil {
+		if err := WriteDisplayMarker(context.Background(), r, t.TempDir(), display); err == nil {
 			t.Errorf("expected error for display %q, got nil", display)
 		}
 	}
@@ -223,7 +247,7 @@ func TestDetectHostSockets_PulseAudio(t *testing.T) {
 	sockets := []BindMount{
 		{Host: "/run/user/1000/pulse/native", Container: "/run/host-pulse"},
 	}
-	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", sockets, nil)
+	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", sockets, nil, Network{}, UserNamespace{}, nil)
 
 	joined := strings.Join(args, " ")
 	if !strings.Contains(joined, "--bind=/run/user/1000/pulse/native:/run/host-pulse") {
@@ -236,7 +260,7 @@ func TestBuildBootArgs_NvidiaDevices(t *testing.T) {
 		{Host: "/dev/nvidia0", Container: "/dev/nvidia0"},
 		{Host: "/dev/nvidiactl", Container: "/dev/nvidiactl"},
 	}
-	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, nvidiaDevs)
+	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, nvidiaDevs, Network{}, UserNamespace{}, nil)
 
 	joined := strings.Join(args, " ")
 	// Verify device binds.
@@ -261,7 +285,7 @@ func TestBuildBootArgs_ReadOnlyBinds(t *testing.T) {
 		{Host: "/usr/share/vulkan/icd.d/nvidia_icd.json", Container: "/usr/share/vulkan/icd.d/nvidia_icd.json", ReadOnly: true},
 		{Host: "/run/user/1000/wayland-0", Container: "/run/host-wayland"},
 	}
-	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", sockets, nil)
+	args := BuildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", sockets, nil, Network{}, UserNamespace{}, nil)
 
 	joined := strings.Join(args, " ")
 	if !strings.Contains(joined, "--bind-ro=/usr/lib/x86_64-linux-gnu:/run/host-nvidia/0") {
@@ -276,7 +300,7 @@ func TestBuildBootArgs_ReadOnlyBinds(t *testing.T) {
 }
 
 func TestBuildBootArgs_NoNvidiaDevices(t *testing.T) {
-	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, nil, nil)
+	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, nil, nil, Network{}, UserNamespace{}, nil)
 
 	joined := strings.Join(args, " ")
 	if strings.Contains(joined, "DeviceAllow=/dev/nvidia") {
@@ -287,9 +311,17 @@ func TestBuildBootArgs_NoNvidiaDevices(t *testing.T) {
 	}
 }
 
+func TestBuildBootArgs_Properties(t *testing.T) {
+	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/testuser/Intune", "/home/testuser", nil, nil, nil, Network{}, UserNamespace{}, []string{"MemoryMax=8G", "TasksMax=4096"})
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "--property=MemoryMax=8G --property=TasksMax=4096 --console=pipe -b") {
+		t.Errorf("resource properties missing or misplaced in: %s", joined)
+	}
+}
+
 func TestBuildNsenterArgs(t *testing.T) {
-	args := buildNsenterArgs("4321", "echo hi")
-	want := []string{NsenterHelperPath, "4321", "echo hi"}
+	args := buildNsenterArgs("intuneme", "4321", "echo hi")
+	want := []string{"/usr/local/libexec/intuneme/nsenter-exec", "4321", "echo hi"}
 	if len(args) != len(want) {
 		t.Fatalf("expected %d args, got %d: %v", len(want), len(args), args)
 	}
@@ -313,7 +345,8 @@ func TestNsenterHelperScript(t *testing.T) {
 		t.Errorf("helper script must start with a bash shebang, got:\n%s", script)
 	}
 	for _, want := range []string{
-		`/usr/bin/nsenter -t "$1" -m -u -i -n -p --`,
+		`/usr/bin/nsenter -t "$1" $userns -m -u -i -n -p --`,
+		`readlink "/proc/$1/ns/user"`,
 		`/bin/su -s /bin/bash testuser -c "$2"`,
 		"set -euo pipefail",
 	} {
@@ -325,3 +358,192 @@ func TestNsenterHelperScript(t *testing.T) {
 		t.Errorf("helper script should not contain wildcards, got:\n%s", script)
 	}
 }
+
+func TestNsenterHelperPath_PerMachine(t *testing.T) {
+	if got := NsenterHelperPath("intuneme-clienta"); got != "/usr/local/libexec/intuneme-clienta/nsenter-exec" {
+		t.Errorf("NsenterHelperPath() = %q", got)
+	}
+	if NsenterHelperPath("intuneme") == NsenterHelperPath("intuneme-clienta") {
+		t.Error("helper paths must differ between machines")
+	}
+}
+
+func TestBuildExecScript(t *testing.T) {
+	script, err := buildExecScript(1000, []string{"dpkg-query", "-W", "it's"}, ExecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "intuneme-session-setup") {
+		t.Errorf("missing session prologue in: %s", script)
+	}
+	if !strings.HasSuffix(script, `exec 'dpkg-query' '-W' 'it'\''s'`) {
+		t.Errorf("unexpected command line in: %s", script)
+	}
+}
+
+func TestBuildExecScript_Options(t *testing.T) {
+	opts := ExecOptions{Root: true, TTY: true, Env: []string{"FOO=a b"}, Dir: "/var/log"}
+	script, err := buildExecScript(1000, []string{"ls"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "cd -- '/var/log' || exit 1") {
+		t.Errorf("missing cwd in: %s", script)
+	}
+	want := `exec script -qefc 'sudo --preserve-env -- env '\''FOO=a b'\'' '\''ls'\''' /dev/null`
+	if !strings.HasSuffix(script, want) {
+		t.Errorf("got script:\n%s\nwant suffix:\n%s", script, want)
+	}
+}
+
+func TestBuildExecScript_Invalid(t *testing.T) {
+	if _, err := buildExecScript(1000, nil, ExecOptions{}); err == nil {
+		t.Error("expected error for empty command")
+	}
+	if _, err := buildExecScript(1000, []string{"ls"}, ExecOptions{Env: []string{"NOEQUALS"}}); err == nil {
+		t.Error("expected error for malformed env")
+	}
+	if _, err := buildExecScript(1000, []string{"ls"}, ExecOptions{Env: []string{"1X=y"}}); err == nil {
+		t.Error("expected error for invalid env name")
+	}
+}
+
+func TestResolveHostSockets(t *testing.T) {
+	runtimeDir := t.TempDir()
+	other := t.TempDir()
+	for _, p := range []string{
+		filepath.Join(runtimeDir, "wayland-1"),
+		filepath.Join(other, "pipewire-custom"),
+		filepath.Join(other, "pulse.sock"),
+	} {
+		if err := os.WriteFile(p, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	t.Setenv("WAYLAND_DISPLAY", "wayland-1")
+	t.Setenv("PIPEWIRE_REMOTE", filepath.Join(other, "pipewire-custom"))
+	t.Setenv("PULSE_SERVER", "tcp:localhost {abc123}unix:"+filepath.Join(other, "pulse.sock"))
+	t.Setenv("XAUTHORITY", "")
+
+	s := ResolveHostSockets(1000)
+	if s.Wayland != filepath.Join(runtimeDir, "wayland-1") {
+		t.Errorf("Wayland = %q", s.Wayland)
+	}
+	if s.PipeWire != filepath.Join(other, "pipewire-custom") {
+		t.Errorf("PipeWire = %q", s.PipeWire)
+	}
+	if s.Pulse != filepath.Join(other, "pulse.sock") {
+		t.Errorf("Pulse = %q", s.Pulse)
+	}
+
+	// An absolute WAYLAND_DISPLAY is used as is; missing sockets are dropped.
+	t.Setenv("WAYLAND_DISPLAY", filepath.Join(other, "nested-0"))
+	t.Setenv("PIPEWIRE_REMOTE", "")
+	t.Setenv("PULSE_SERVER", "")
+	s = ResolveHostSockets(1000)
+	if s.Wayland != "" || s.PipeWire != "" || s.Pulse != "" {
+		t.Errorf("expected no sockets, got %+v", s)
+	}
+}
+
+func TestHostSocketsMounts(t *testing.T) {
+	s := HostSockets{Wayland: "/run/user/1000/wayland-1", Pulse: "/tmp/pulse.sock"}
+	got := s.Mounts()
+	want := []BindMount{
+		{Host: "/run/user/1000/wayland-1", Container: "/run/host-wayland"},
+		{Host: "/tmp/pulse.sock", Container: "/run/host-pulse"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Mounts = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mount %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBuildLaunchScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	run := func(command string) (string, error) {
+		c := exec.Command("sh", "-c", buildLaunchScript(command, 500*time.Millisecond, 50*time.Millisecond))
+		c.Env = append(os.Environ(), "HOME="+t.TempDir())
+		out, err := c.CombinedOutput()
+		return string(out), err
+	}
+
+	if out, err := run("sleep 2"); err != nil {
+		t.Errorf("app still running after the grace period should succeed: %v\n%s", err, out)
+	}
+	if out, err := run("true"); err != nil {
+		t.Errorf("app exiting with status 0 should succeed: %v\n%s", err, out)
+	}
+
+	out, err := run("echo 'cannot open display' >&2; exit 3")
+	if err == nil {
+		t.Fatalf("app exiting with status 3 should fail:\n%s", out)
+	}
+	msg, ok := launchFailure("my-app --flag", out)
+	if !ok {
+		t.Fatalf("no launch failure in output:\n%s", out)
+	}
+	for _, want := range []string{"my-app exited with status 3 right after launch", "~/.cache/intuneme/launch/", "cannot open display"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error missing %q:\n%s", want, msg)
+		}
+	}
+
+	out, _ = run("intuneme-no-such-binary")
+	if msg, _ := launchFailure("intuneme-no-such-binary", out); !strings.HasPrefix(msg, "intuneme-no-such-binary was not found in the container") {
+		t.Errorf("unexpected error for a missing binary:\n%s", msg)
+	}
+}
+
+func TestExec_LaunchFailure(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{"machinectl show intuneme -p Leader": "4321\n"}}
+	r.errors = map[string]error{"sudo /usr/local/libexec/intuneme/nsenter-exec": errors.New("exit status 1")}
+	r.outputs["sudo /usr/local/libexec/intuneme/nsenter-exec"] = "session setup noise\n" + launchFailed + " status=1 log=~/.cache/intuneme/launch/x.log\n$ microsoft-edge\nSegmentation fault\n"
+	err := Exec(context.Background(), r, "intuneme", "alice", 1000, "microsoft-edge")
+	if err == nil || !strings.Contains(err.Error(), "microsoft-edge exited with status 1") || !strings.Contains(err.Error(), "Segmentation fault") {
+		t.Errorf("Exec error = %v", err)
+	}
+}
+
+// trapRunner answers the leader query and runs every attached command as a
+// shell that exits with status 7 on SIGINT, standing in for an app that
+// cleans up on Ctrl-C.
+type trapRunner struct {
+	runner.SystemRunner
+}
+
+func (trapRunner) RunContext(context.Context, string, ...string) ([]byte, error) {
+	return []byte("4321\n"), nil
+}
+
+func (t trapRunner) RunAttachedContext(ctx context.Context, _ string, _ ...string) error {
+	return t.SystemRunner.RunAttachedContext(ctx, "sh", "-c", "trap 'exit 7' INT; while :; do sleep 0.1; done")
+}
+
+func TestExecCommand_CtrlCReachesCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Ctrl-C: the signal reaches intuneme, which forwards it, and the CLI's
+	// context is cancelled with it.
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+		cancel()
+	}()
+
+	err := ExecCommand(ctx, &trapRunner{}, "intuneme", 1000, []string{"app"}, ExecOptions{})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 7 {
+		t.Errorf("ExecCommand = %v, want the command's own exit status 7", err)
+	}
+}
@@ -0,0 +1,92 @@
+package nspawn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// FreezerHelperPath returns the fixed, root-owned helper that freezes and thaws
+// the machine's unit. Like NsenterHelperPath it is authorized by the machine's
+// sudoers rule, so the broker proxy and the agent can pause and resume the
+// container without a password prompt.
+func FreezerHelperPath(machine string) string {
+	return NsenterHelperDir(machine) + "/freezer"
+}
+
+// FreezerHelperScript renders the freezer helper for a machine. The machine is
+// baked in at install time and the only runtime input is the action ($1), so
+// the helper cannot be pointed at any other unit.
+func FreezerHelperScript(machine string) string {
+	return fmt.Sprintf(`#!/bin/bash
+# Installed by intuneme. Freezes or thaws the cgroup of the %s container's
+# systemd unit. Invoked through passwordless sudo (the intuneme-exec sudoers rule).
+set -euo pipefail
+case "${1:-}" in
+freeze | thaw) ;;
+*)
+	echo "usage: $0 freeze|thaw" >&2
+	exit 2
+	;;
+esac
+unit=$(/usr/bin/machinectl show %s -p Unit --value)
+exec /usr/bin/systemctl "$1" "$unit"
+`, machine, machine)
+}
+
+// Pause freezes every process in the running container with the cgroup
+// freezer. Memory stays allocated, so Resume picks up exactly where it left
+// off, but the container uses no CPU in between.
+func Pause(ctx context.Context, r runner.Runner, machine string) error {
+	if out, err := r.RunContext(ctx, "sudo", FreezerHelperPath(machine), "freeze"); err != nil {
+		return fmt.Errorf("freeze %s failed: %w\n%s", machine, err, out)
+	}
+	return nil
+}
+
+// Resume thaws a container frozen by Pause.
+func Resume(ctx context.Context, r runner.Runner, machine string) error {
+	if out, err := r.RunContext(ctx, "sudo", FreezerHelperPath(machine), "thaw"); err != nil {
+		return fmt.Errorf("thaw %s failed: %w\n%s", machine, err, out)
+	}
+	return nil
+}
+
+// IsPaused reports whether the running machine's unit is frozen or freezing.
+// Any error (machine not running, systemd too old to report FreezerState)
+// counts as not paused.
+func IsPaused(ctx context.Context, r runner.Runner, machine string) bool {
+	unit, err := MachineUnit(ctx, r, machine)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, runner.QueryTimeout)
+	defer cancel()
+	out, err := r.RunContext(ctx, "systemctl", "show", unit, "-p", "FreezerState", "--value")
+	if err != nil {
+		return false
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "frozen", "freezing":
+		return true
+	}
+	return false
+}
+
+// appProcesses are the process names of the container's own windowed apps.
+var appProcesses = []string{"msedge", "intune-portal"}
+
+// AppsOpen reports whether any of the container's windowed apps (Edge, the
+// Company Portal) is running. It must only be called on a container that is
+// not paused, since it runs pgrep inside it.
+func AppsOpen(ctx context.Context, r runner.Runner, machine string, uid int) (bool, error) {
+	script := fmt.Sprintf("pgrep -x %s >/dev/null && echo open || echo closed",
+		ShellQuote(strings.Join(appProcesses, "|")))
+	out, err := ExecOutput(ctx, r, machine, uid, script)
+	if err != nil {
+		return false, fmt.Errorf("check for open apps: %w", err)
+	}
+	return strings.TrimSpace(string(out)) == "open", nil
+}
@@ -0,0 +1,97 @@
+package nspawn
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestIsPaused(t *testing.T) {
+	for state, want := range map[string]bool{
+		"running\n":  false,
+		"frozen\n":   true,
+		"freezing\n": true,
+		"thawing\n":  false,
+		"":           false,
+	} {
+		r := &mockRunner{outputs: map[string]string{
+			"machinectl show intuneme -p Unit":                      "machine-intuneme.scope\n",
+			"systemctl show machine-intuneme.scope -p FreezerState": state,
+		}}
+		if got := IsPaused(context.Background(), r, "intuneme"); got != want {
+			t.Errorf("FreezerState %q: IsPaused = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestIsPaused_NotRunning(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{}}
+	if IsPaused(context.Background(), r, "intuneme") {
+		t.Error("a machine without a unit should not be paused")
+	}
+	for _, c := range r.commands {
+		if strings.HasPrefix(c, "systemctl") {
+			t.Errorf("unexpected systemctl query without a unit: %s", c)
+		}
+	}
+}
+
+func TestPauseResume_UseFreezerHelper(t *testing.T) {
+	r := &mockRunner{}
+	if err := Pause(context.Background(), r, "intuneme-work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Resume(context.Background(), r, "intuneme-work"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"sudo /usr/local/libexec/intuneme-work/freezer freeze",
+		"sudo /usr/local/libexec/intuneme-work/freezer thaw",
+	}
+	if strings.Join(r.commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", r.commands, want)
+	}
+}
+
+func TestFreezerHelperScript(t *testing.T) {
+	script := FreezerHelperScript("intuneme-work")
+	if !strings.Contains(script, "machinectl show intuneme-work -p Unit --value") {
+		t.Errorf("helper does not look up the machine's unit:\n%s", script)
+	}
+	if !strings.Contains(script, "freeze | thaw) ;;") {
+		t.Errorf("helper must only accept freeze and thaw:\n%s", script)
+	}
+}
+
+func TestStop_ThawsPausedContainer(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{
+		"machinectl show intuneme -p Unit":                      "machine-intuneme.scope\n",
+		"systemctl show machine-intuneme.scope -p FreezerState": "frozen\n",
+	}}
+	if err := Stop(context.Background(), r, "intuneme"); err != nil {
+		t.Fatal(err)
+	}
+	n := len(r.commands)
+	if n < 2 || r.commands[n-2] != "sudo "+FreezerHelperPath("intuneme")+" thaw" || r.commands[n-1] != "machinectl poweroff intuneme" {
+		t.Errorf("expected thaw before poweroff, got %q", r.commands)
+	}
+}
+
+func TestAppsOpen(t *testing.T) {
+	for out, want := range map[string]bool{"open\n": true, "closed\n": false} {
+		r := &mockRunner{outputs: map[string]string{
+			"machinectl show intuneme -p Leader":    "4321\n",
+			"sudo " + NsenterHelperPath("intuneme"): out,
+		}}
+		got, err := AppsOpen(context.Background(), r, "intuneme", 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("output %q: AppsOpen = %v, want %v", out, got, want)
+		}
+		if !strings.Contains(r.commands[len(r.commands)-1], "pgrep -x 'msedge|intune-portal'") {
+			t.Errorf("unexpected check command: %s", r.commands[len(r.commands)-1])
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package nspawn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// sessionMountPaths are the container paths DetectHostSockets binds the host's
+// display and audio sockets to.
+var sessionMountPaths = []string{
+	"/run/host-wayland",
+	"/run/host-pipewire",
+	"/run/host-pulse",
+	"/run/host-xauthority",
+}
+
+// sessionFile is the file in the data root recording the session the
+// container was last connected to.
+const sessionFile = "session.json"
+
+// Session is the host display and sockets the container is connected to.
+type Session struct {
+	Display string      `json:"display"`
+	Sockets HostSockets `json:"sockets"`
+}
+
+// HostSession returns the host's current display and sockets.
+func HostSession(uid int) Session {
+	return Session{Display: HostDisplay(), Sockets: ResolveHostSockets(uid)}
+}
+
+// SaveSession records s in root for status to report. start and session
+// refresh call it each time they connect the container to a session.
+func SaveSession(root string, s Session) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, sessionFile), append(data, '\n'), 0644)
+}
+
+// LoadSession returns the session recorded in root, or nil if none is.
+func LoadSession(root string) (*Session, error) {
+	data, err := os.ReadFile(filepath.Join(root, sessionFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", sessionFile, err)
+	}
+	return &s, nil
+}
+
+// RefreshSession points a running container at the host's current graphical
+// session: after a re-login, a monitor change or a new Xwayland auth file the
+// sockets and Xauthority bound at boot are stale, and apps can no longer open
+// windows. It rewrites the display marker, re-binds whatever DetectHostSockets
+// finds now, and reruns the session setup so the systemd user manager and the
+// D-Bus activation environment (which the identity broker inherits) pick up
+// the new values. It returns the session the container is now connected to.
+//
+// Everything runs through the nsenter helper and `machinectl bind`, both
+// passwordless, so the GNOME extension can call it without a prompt.
+func RefreshSession(ctx context.Context, r runner.Runner, machine string, uid int) (*Session, error) {
+	session := HostSession(uid)
+	display := session.Display
+	if !validDisplay.MatchString(display) {
+		return nil, fmt.Errorf("invalid display value: %q", display)
+	}
+	leaderPID, err := LeaderPID(ctx, r, machine)
+	if err != nil {
+		return nil, err
+	}
+	// machinectl bind cannot reach into a container with its own user
+	// namespace; its sockets can only be bound at boot.
+	if shift, err := leaderUIDShift(ctx, r, leaderPID); err == nil && shift != 0 {
+		return nil, fmt.Errorf("container %s uses private_users, so its display and audio can only be connected at boot — restart it with 'intuneme stop' and 'intuneme start'", machine)
+	}
+
+	// Drop the old binds before binding again: a socket recreated by a new
+	// login is a new inode, and binding on top would stack another mount on
+	// every refresh.
+	quoted := make([]string, len(sessionMountPaths))
+	for i, p := range sessionMountPaths {
+		quoted[i] = ShellQuote(p)
+	}
+	prepare := fmt.Sprintf(`printf 'DISPLAY=%%s\n' %s | sudo tee /%s >/dev/null || exit 1
+for p in %s; do
+    while mountpoint -q "$p"; do sudo umount "$p" || break; done
+done`, ShellQuote(display), displayMarkerPath, strings.Join(quoted, " "))
+	if out, err := r.RunContext(ctx, "sudo", buildNsenterArgs(machine, leaderPID, prepare)...); err != nil {
+		return nil, fmt.Errorf("reset session mounts in container %s: %w\n%s", machine, err, out)
+	}
+
+	for _, m := range session.Sockets.Mounts() {
+		if err := bind(ctx, r, machine, m); err != nil {
+			return nil, err
+		}
+	}
+
+	script := buildSessionEnvScript(uid) + "\ntrue"
+	if out, err := r.RunContext(ctx, "sudo", buildNsenterArgs(machine, leaderPID, script)...); err != nil {
+		return nil, fmt.Errorf("update session environment in container %s: %w\n%s", machine, err, out)
+	}
+	return &session, nil
+}
@@ -0,0 +1,70 @@
+package nspawn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRefreshSession(t *testing.T) {
+	xauth := filepath.Join(t.TempDir(), "Xauthority")
+	if err := os.WriteFile(xauth, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XAUTHORITY", xauth)
+	t.Setenv("DISPLAY", "")
+
+	r := &mockRunner{outputs: map[string]string{"machinectl show intuneme -p Leader": "4321\n"}}
+	// A UID without a runtime dir, so only the Xauthority file is found.
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	session, err := RefreshSession(context.Background(), r, "intuneme", 999999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (HostSockets{XAuthority: xauth}); session.Sockets != want || session.Display != ":0" {
+		t.Fatalf("session = %+v", session)
+	}
+
+	if len(r.commands) != 5 {
+		t.Fatalf("expected leader query, uid map, reset, bind and setup; got %v", r.commands)
+	}
+	reset := r.commands[2]
+	for _, want := range []string{"nsenter-exec 4321", "DISPLAY=", "sudo tee /etc/intuneme-host-display", "sudo umount", "/run/host-wayland"} {
+		if !strings.Contains(reset, want) {
+			t.Errorf("reset script missing %q: %s", want, reset)
+		}
+	}
+	if want := "machinectl bind --mkdir intuneme " + xauth + " /run/host-xauthority"; r.commands[3] != want {
+		t.Errorf("bind = %q, want %q", r.commands[3], want)
+	}
+	if !strings.Contains(r.commands[4], "intuneme-session-setup") {
+		t.Errorf("session setup not rerun: %s", r.commands[4])
+	}
+}
+
+func TestRefreshSession_NotRunning(t *testing.T) {
+	r := &mockRunner{}
+	if _, err := RefreshSession(context.Background(), r, "intuneme", 1000); err == nil {
+		t.Error("expected an error when the machine has no leader")
+	}
+}
+
+func TestSaveLoadSession(t *testing.T) {
+	root := t.TempDir()
+	if s, err := LoadSession(root); err != nil || s != nil {
+		t.Fatalf("LoadSession with no record = %+v, %v", s, err)
+	}
+	want := Session{Display: ":1", Sockets: HostSockets{Wayland: "/run/user/1000/wayland-1"}}
+	if err := SaveSession(root, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadSession(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != want {
+		t.Errorf("LoadSession = %+v, want %+v", *got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package nspawn
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/sudo"
+)
+
+// UnitDir is where the container's systemd service unit is installed.
+const UnitDir = "/etc/systemd/system"
+
+// UnitName returns the systemd service unit name for a machine.
+func UnitName(machine string) string {
+	return machine + ".service"
+}
+
+// UnitPath returns the full path of the machine's service unit file.
+func UnitPath(machine string) string {
+	return UnitDir + "/" + UnitName(machine)
+}
+
+// UnitInstalled reports whether the machine's service unit file exists. When it
+// does, start boots the container through systemctl instead of a detached sudo
+// process.
+func UnitInstalled(machine string) bool {
+	_, err := os.Stat(UnitPath(machine))
+	return err == nil
+}
+
+// UnitContent renders a service unit that boots the container with the given
+// systemd-nspawn arguments (as returned by BuildBootArgs). It follows the shape
+// of systemd's own systemd-nspawn@.service: --keep-unit registers the machine
+// with machined under this service instead of a transient scope, and exit
+// status 133 (reboot inside the container) restarts it.
+//
+// With --keep-unit, nspawn cannot set cgroup properties on its own unit, so
+// every --property= argument becomes a unit directive instead. The device policy
+// matches what nspawn applies to the scope it would otherwise create.
+//
+// postStart, when set, is run as root after the container starts
+// (ExecStartPost=). Its failure is ignored so it cannot take the container down.
+//
+// The unit has no [Install] section: it binds the login session's display and
+// audio sockets, which do not exist at boot, so it must not be enabled.
+func UnitContent(nspawnPath, machine string, bootArgs, postStart []string) string {
+	execArgs := []string{nspawnPath, "--quiet", "--keep-unit"}
+	var properties []string
+	for _, arg := range bootArgs {
+		if prop, ok := strings.CutPrefix(arg, "--property="); ok {
+			properties = append(properties, prop)
+			continue
+		}
+		execArgs = append(execArgs, arg)
+	}
+
+	quoted := make([]string, len(execArgs))
+	for i, arg := range execArgs {
+		quoted[i] = unitQuote(arg)
+	}
+	var execStartPost string
+	if len(postStart) > 0 {
+		quotedPost := make([]string, len(postStart))
+		for i, arg := range postStart {
+			quotedPost[i] = unitQuote(arg)
+		}
+		execStartPost = "ExecStartPost=-" + strings.Join(quotedPost, " ") + "\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `# Installed by intuneme. Regenerated by 'intuneme start' whenever the boot
+# arguments change (display sockets, GPU devices), so edits here are lost.
+[Unit]
+Description=intuneme container %s
+After=network.target systemd-machined.service
+Wants=systemd-machined.service
+PartOf=machines.target
+Before=machines.target
+
+[Service]
+ExecStart=%s
+%sKillMode=mixed
+Type=notify
+Restart=on-failure
+RestartSec=5
+RestartForceExitStatus=133
+SuccessExitStatus=133
+Slice=machine.slice
+Delegate=yes
+TasksMax=16384
+WatchdogSec=3min
+DevicePolicy=closed
+DeviceAllow=/dev/net/tun rwm
+DeviceAllow=char-pts rw
+`, machine, strings.Join(quoted, " "), execStartPost)
+	for _, prop := range properties {
+		fmt.Fprintf(&b, "%s\n", unitEscape(prop))
+	}
+	return b.String()
+}
+
+// unitEscape escapes the characters systemd expands in unit settings:
+// specifiers (%) and environment variables ($).
+func unitEscape(s string) string {
+	return strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+}
+
+// unitQuote escapes s for use as a single ExecStart= argument, adding double
+// quotes when it contains whitespace or quote characters.
+func unitQuote(s string) string {
+	s = unitEscape(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// unitContent renders the machine's unit with the host's systemd-nspawn.
+func unitContent(r runner.Runner, machine string, bootArgs, postStart []string) (string, error) {
+	nspawnPath, err := r.LookPath("systemd-nspawn")
+	if err != nil {
+		return "", fmt.Errorf("systemd-nspawn not found: %w", err)
+	}
+	return UnitContent(nspawnPath, machine, bootArgs, postStart), nil
+}
+
+// UnitCurrent reports whether the installed unit already matches the given
+// boot arguments, i.e. whether InstallUnit would leave it alone.
+func UnitCurrent(r runner.Runner, machine string, bootArgs, postStart []string) bool {
+	content, err := unitContent(r, machine, bootArgs, postStart)
+	if err != nil {
+		return false
+	}
+	existing, err := os.ReadFile(UnitPath(machine))
+	return err == nil && string(existing) == content
+}
+
+// InstallUnit writes the machine's service unit for the given boot arguments and
+// reloads systemd. The file is only rewritten (and systemd only reloaded) when
+// the content differs from what is installed; changed reports whether it did.
+func InstallUnit(ctx context.Context, r runner.Runner, machine string, bootArgs, postStart []string) (changed bool, err error) {
+	content, err := unitContent(r, machine, bootArgs, postStart)
+	if err != nil {
+		return false, err
+	}
+	if existing, err := os.ReadFile(UnitPath(machine)); err == nil && string(existing) == content {
+		return false, nil
+	}
+	if err := sudo.WriteFile(ctx, r, UnitPath(machine), []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("install %s: %w", UnitName(machine), err)
+	}
+	if out, err := r.RunContext(ctx, "sudo", "systemctl", "daemon-reload"); err != nil {
+		return true, fmt.Errorf("systemctl daemon-reload failed: %w\n%s", err, out)
+	}
+	return true, nil
+}
+
+// RemoveUnit disables and deletes the machine's service unit. Intentionally
+// graceful: a missing unit is not an error.
+func RemoveUnit(ctx context.Context, r runner.Runner, machine string) error {
+	if !UnitInstalled(machine) {
+		return nil
+	}
+	_, _ = r.RunContext(ctx, "sudo", "systemctl", "disable", UnitName(machine))
+	if out, err := r.RunContext(ctx, "sudo", "rm", "-f", UnitPath(machine)); err != nil {
+		return fmt.Errorf("remove %s: %w\n%s", UnitName(machine), err, out)
+	}
+	if out, err := r.RunContext(ctx, "sudo", "systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("systemctl daemon-reload failed: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// BootUnit refreshes the machine's service unit with the current boot arguments
+// and starts it. Unlike Boot, systemd supervises the container: console output
+// goes to the journal and the restart policy applies.
+func BootUnit(ctx context.Context, r runner.Runner, rootfs, machine, intuneHome, containerHome string, sockets, nvidiaDevices []BindMount, network Network, userNS UserNamespace, properties, postStart []string) error {
+	args := BuildBootArgs(rootfs, machine, intuneHome, containerHome, sockets, nvidiaDevices, network, userNS, properties)
+	if _, err := InstallUnit(ctx, r, machine, args, postStart); err != nil {
+		return err
+	}
+	if out, err := r.RunContext(ctx, "sudo", "systemctl", "start", UnitName(machine)); err != nil {
+		return fmt.Errorf("systemctl start %s failed: %w\n%s", UnitName(machine), err, out)
+	}
+	return nil
+}
+
+// StartUnit starts the machine's installed service unit as the calling user,
+// without sudo and without refreshing the unit. It relies on the polkit rule
+// installed by 'intuneme autostart enable', which lets the user manage that
+// one unit, so it works from a login session with no terminal.
+func StartUnit(ctx context.Context, r runner.Runner, machine string) error {
+	if out, err := r.RunContext(ctx, "systemctl", "start", UnitName(machine)); err != nil {
+		return fmt.Errorf("systemctl start %s failed: %w\n%s", UnitName(machine), err, out)
+	}
+	return nil
+}
+
+// UnitActiveState returns the ActiveState of the machine's service unit
+// (e.g. "active", "inactive", "failed").
+func UnitActiveState(ctx context.Context, r runner.Runner, machine string) string {
+	ctx, cancel := context.WithTimeout(ctx, runner.QueryTimeout)
+	defer cancel()
+	out, err := r.RunContext(ctx, "systemctl", "show", UnitName(machine), "-p", "ActiveState", "--value")
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(out))
+}
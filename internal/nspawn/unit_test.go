@@ -0,0 +1,114 @@
+package nspawn
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUnitPath(t *testing.T) {
+	if got := UnitPath("intuneme"); got != "/etc/systemd/system/intuneme.service" {
+		t.Errorf("UnitPath(intuneme) = %q", got)
+	}
+	if got := UnitName("intuneme-clienta"); got != "intuneme-clienta.service" {
+		t.Errorf("UnitName(intuneme-clienta) = %q", got)
+	}
+}
+
+func TestUnitContent(t *testing.T) {
+	dri := []BindMount{{Host: "/dev/dri/card0", Container: "/dev/dri/card0"}}
+	args := buildBootArgs("/home/u/.local/share/intuneme/rootfs", "intuneme", "/home/u/Intune", "/home/u", nil, dri, nil, Network{}, UserNamespace{}, nil)
+	content := UnitContent("/usr/bin/systemd-nspawn", "intuneme", args, nil)
+
+	checks := []string{
+		"ExecStart=/usr/bin/systemd-nspawn --quiet --keep-unit -D /home/u/.local/share/intuneme/rootfs --machine=intuneme",
+		"--bind=/dev/dri/card0 ",
+		"--console=pipe -b\n",
+		"Type=notify",
+		"RestartForceExitStatus=133",
+		"Restart=on-failure",
+		"Slice=machine.slice",
+		"DevicePolicy=closed",
+		"\nDeviceAllow=/dev/dri/card0 rwm\n",
+	}
+	for _, want := range checks {
+		if !strings.Contains(content, want) {
+			t.Errorf("unit content missing %q:\n%s", want, content)
+		}
+	}
+	// The unit binds session sockets that do not exist at boot.
+	if strings.Contains(content, "[Install]") {
+		t.Errorf("unit must not be installable to start at boot:\n%s", content)
+	}
+	// Properties can't be passed to nspawn with --keep-unit.
+	if strings.Contains(content, "--property=") {
+		t.Errorf("unit ExecStart must not contain --property=:\n%s", content)
+	}
+}
+
+func TestUnitContent_ResourceLimits(t *testing.T) {
+	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/u/Intune", "/home/u", nil, nil, nil, Network{}, UserNamespace{}, []string{"MemoryMax=8G", "CPUQuota=200%"})
+	content := UnitContent("/usr/bin/systemd-nspawn", "intuneme", args, nil)
+	for _, want := range []string{"\nMemoryMax=8G\n", "\nCPUQuota=200%%\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("unit content missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestUnitContent_PostStart(t *testing.T) {
+	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/u/Intune", "/home/u", nil, nil, nil, Network{}, UserNamespace{}, nil)
+	content := UnitContent("/usr/bin/systemd-nspawn", "intuneme", args, []string{"/usr/bin/intuneme", "--root", "/home/u/My Data", "autostart", "post-boot"})
+	want := "\nExecStartPost=-/usr/bin/intuneme --root \"/home/u/My Data\" autostart post-boot\n"
+	if !strings.Contains(content, want) {
+		t.Errorf("unit content missing %q:\n%s", want, content)
+	}
+	if c := UnitContent("/usr/bin/systemd-nspawn", "intuneme", args, nil); strings.Contains(c, "ExecStartPost") {
+		t.Errorf("unit without a hook must not have ExecStartPost:\n%s", c)
+	}
+}
+
+func TestUnitQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"--bind=/a:/b", "--bind=/a:/b"},
+		{"--bind=/home/u/My Files:/x", `"--bind=/home/u/My Files:/x"`},
+		{"/tmp/100%", "/tmp/100%%"},
+		{"$HOME", "$$HOME"},
+		{`a"b`, `"a\"b"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := unitQuote(tt.in); got != tt.want {
+			t.Errorf("unitQuote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBootUnit(t *testing.T) {
+	r := &mockRunner{}
+	err := BootUnit(context.Background(), r, "/tmp/rootfs", "intuneme-test-nonexistent", "/home/u/Intune", "/home/u", nil, nil, Network{}, UserNamespace{}, nil, nil)
+	if err != nil {
+		t.Fatalf("BootUnit failed: %v", err)
+	}
+	if !strings.Contains(r.fileContent, "ExecStart=/usr/bin/systemd-nspawn --quiet --keep-unit -D /tmp/rootfs") {
+		t.Errorf("unexpected unit written:\n%s", r.fileContent)
+	}
+	want := []string{
+		"sudo install -m 0644",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl start intuneme-test-nonexistent.service",
+	}
+	for _, w := range want {
+		found := false
+		for _, c := range r.commands {
+			if strings.HasPrefix(c, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing command %q in %v", w, r.commands)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package nspawn
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// User namespace modes accepted by the private_users setting in config.toml.
+const (
+	// PrivateUsersOff runs the container with the host's user IDs (the default).
+	PrivateUsersOff = "off"
+	// PrivateUsersPick lets systemd-nspawn pick a free 64K UID/GID range at
+	// every boot.
+	PrivateUsersPick = "pick"
+	// PrivateUsersSubUID uses the host user's first range in /etc/subuid.
+	PrivateUsersSubUID = "subuid"
+)
+
+// userNSRange is the number of IDs mapped into the container: 0-65535, enough
+// for root, system users, the container user and nobody.
+const userNSRange = 65536
+
+// subuidPath is the subordinate UID file consulted in subuid mode.
+var subuidPath = "/etc/subuid"
+
+// UserNamespace is a parsed private_users setting.
+type UserNamespace struct {
+	Mode string // PrivateUsersOff, PrivateUsersPick or PrivateUsersSubUID
+	Base int    // first host UID of the range in subuid mode
+}
+
+// ParseUserNamespace parses the private_users setting: "off" (or empty),
+// "pick", or "subuid". In subuid mode the range is looked up for user.
+func ParseUserNamespace(s, user string) (UserNamespace, error) {
+	switch s {
+	case "", PrivateUsersOff:
+		return UserNamespace{Mode: PrivateUsersOff}, nil
+	case PrivateUsersPick:
+		return UserNamespace{Mode: PrivateUsersPick}, nil
+	case PrivateUsersSubUID:
+		base, err := subordinateBase(subuidPath, user)
+		if err != nil {
+			return UserNamespace{}, err
+		}
+		return UserNamespace{Mode: PrivateUsersSubUID, Base: base}, nil
+	}
+	return UserNamespace{}, fmt.Errorf("invalid private_users setting %q — use \"off\", \"pick\" or \"subuid\"", s)
+}
+
+// Enabled reports whether the container runs in its own user namespace.
+func (u UserNamespace) Enabled() bool {
+	return u.Mode == PrivateUsersPick || u.Mode == PrivateUsersSubUID
+}
+
+// bootArgs returns the systemd-nspawn options for u. The rootfs keeps its
+// host ownership and is mounted idmapped, so files intuneme writes into it
+// from the host as root still belong to root inside the container.
+func (u UserNamespace) bootArgs() []string {
+	switch u.Mode {
+	case PrivateUsersPick:
+		return []string{"--private-users=pick", "--private-users-ownership=map"}
+	case PrivateUsersSubUID:
+		return []string{fmt.Sprintf("--private-users=%d:%d", u.Base, userNSRange), "--private-users-ownership=map"}
+	}
+	return nil
+}
+
+// subordinateBase returns the start of the first range of at least
+// userNSRange IDs delegated to user in the subuid file at path.
+func subordinateBase(path, user string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("private_users = \"subuid\": %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) != 3 || fields[0] != user {
+			continue
+		}
+		base, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || base <= 0 {
+			continue
+		}
+		if count >= userNSRange {
+			return base, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	return 0, fmt.Errorf("private_users = \"subuid\": %s has no range of %d IDs for %s — add one with 'sudo usermod --add-subuids'", path, userNSRange, user)
+}
+
+// UIDShift returns the host UID that root inside the running machine maps to,
+// or 0 when the container shares the host's user namespace.
+func UIDShift(ctx context.Context, r runner.Runner, machine string) (int, error) {
+	leaderPID, err := LeaderPID(ctx, r, machine)
+	if err != nil {
+		return 0, err
+	}
+	return leaderUIDShift(ctx, r, leaderPID)
+}
+
+// leaderUIDShift is UIDShift for a known leader PID.
+func leaderUIDShift(ctx context.Context, r runner.Runner, leaderPID string) (int, error) {
+	out, err := r.RunContext(ctx, "cat", "/proc/"+leaderPID+"/uid_map")
+	if err != nil {
+		return 0, fmt.Errorf("read uid map of process %s: %w", leaderPID, err)
+	}
+	return parseUIDShift(string(out))
+}
+
+// parseUIDShift returns the host ID that ID 0 maps to in a uid_map. The
+// initial namespace maps 0 to itself.
+func parseUIDShift(uidMap string) (int, error) {
+	for line := range strings.Lines(uidMap) {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "0" {
+			shift, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0, fmt.Errorf("unexpected uid_map line %q", strings.TrimSpace(line))
+			}
+			return shift, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,102 @@
+package nspawn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseUserNamespace(t *testing.T) {
+	subuid := filepath.Join(t.TempDir(), "subuid")
+	if err := os.WriteFile(subuid, []byte("other:100000:65536\ntester:165536:1000\ntester:231072:65536\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := subuidPath
+	subuidPath = subuid
+	t.Cleanup(func() { subuidPath = old })
+
+	tests := []struct {
+		in, user string
+		want     UserNamespace
+		wantErr  bool
+	}{
+		{"", "tester", UserNamespace{Mode: PrivateUsersOff}, false},
+		{"off", "tester", UserNamespace{Mode: PrivateUsersOff}, false},
+		{"pick", "tester", UserNamespace{Mode: PrivateUsersPick}, false},
+		// The first range is too small for the container's 64K IDs.
+		{"subuid", "tester", UserNamespace{Mode: PrivateUsersSubUID, Base: 231072}, false},
+		{"subuid", "nobody", UserNamespace{}, true},
+		{"yes", "tester", UserNamespace{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUserNamespace(tt.in, tt.user)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUserNamespace(%q, %q) error = %v, wantErr %v", tt.in, tt.user, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseUserNamespace(%q, %q) = %+v, want %+v", tt.in, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestBuildBootArgs_UserNamespace(t *testing.T) {
+	sockets := []BindMount{
+		{Host: "/run/user/1000/wayland-0", Container: "/run/host-wayland"},
+		{Host: "/usr/lib/nvidia", Container: "/run/host-nvidia", ReadOnly: true},
+	}
+	args := buildBootArgs("/tmp/rootfs", "intuneme", "/home/u/Intune", "/home/u", sockets, nil, nil, Network{}, UserNamespace{Mode: PrivateUsersSubUID, Base: 231072}, nil)
+	for _, want := range []string{
+		"--private-users=231072:65536",
+		"--private-users-ownership=map",
+		"--bind=/home/u/Intune:/home/u:idmap",
+		"--bind=/run/user/1000/wayland-0:/run/host-wayland:idmap",
+		"--bind-ro=/usr/lib/nvidia:/run/host-nvidia:idmap",
+		"--bind=/tmp/.X11-unix",
+	} {
+		if !slices.Contains(args, want) {
+			t.Errorf("missing %q in %v", want, args)
+		}
+	}
+
+	args = buildBootArgs("/tmp/rootfs", "intuneme", "/home/u/Intune", "/home/u", sockets, nil, nil, Network{}, UserNamespace{}, nil)
+	if joined := strings.Join(args, " "); strings.Contains(joined, "private-users") || strings.Contains(joined, ":idmap") {
+		t.Errorf("user namespace options without private_users: %s", joined)
+	}
+}
+
+func TestParseUIDShift(t *testing.T) {
+	tests := []struct {
+		uidMap string
+		want   int
+	}{
+		{"         0          0 4294967295\n", 0},
+		{"         0 1878523904      65536\n", 1878523904},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseUIDShift(tt.uidMap)
+		if err != nil || got != tt.want {
+			t.Errorf("parseUIDShift(%q) = %d, %v, want %d", tt.uidMap, got, err, tt.want)
+		}
+	}
+}
+
+func TestBind_RefusesUserNamespace(t *testing.T) {
+	r := &mockRunner{outputs: map[string]string{
+		"machinectl show intuneme -p Leader": "4321\n",
+		"cat /proc/4321/uid_map":             "0 1878523904 65536\n",
+	}}
+	err := Bind(context.Background(), r, "intuneme", BindMount{Host: "/srv/data", Container: "/srv/data"})
+	if err == nil || !strings.Contains(err.Error(), "private_users") {
+		t.Fatalf("Bind error = %v, want a private_users error", err)
+	}
+	for _, c := range r.commands {
+		if strings.HasPrefix(c, "machinectl bind") {
+			t.Errorf("machinectl bind must not run: %s", c)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package nvidia
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -16,21 +17,21 @@ const containerLibDir = "/usr/lib/x86_64-linux-gnu"
 // that point into /run/host-nvidia/. This must be called on every start
 // (even non-Nvidia boots) because the rootfs persists across boots and
 // stale symlinks from a previous Nvidia session could break the loader.
-func CleanStaleLinks(r runner.Runner, machine string) error {
-	leaderPID, err := nspawn.LeaderPID(r, machine)
+func CleanStaleLinks(ctx context.Context, r runner.Runner, machine string) error {
+	leaderPID, err := nspawn.LeaderPID(ctx, r, machine)
 	if err != nil {
 		return err
 	}
 
 	// Remove symlinks targeting /run/host-nvidia/*.
-	if _, err := r.Run("sudo", "nsenter", "-t", leaderPID, "-m", "--",
+	if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", leaderPID, "-m", "--",
 		"find", containerLibDir, "-maxdepth", "1",
 		"-lname", "/run/host-nvidia/*", "-delete"); err != nil {
 		return fmt.Errorf("removing stale nvidia symlinks: %w", err)
 	}
 
 	// Remove the mount point directory itself if it exists.
-	if _, err := r.Run("sudo", "nsenter", "-t", leaderPID, "-m", "--",
+	if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", leaderPID, "-m", "--",
 		"rm", "-rf", "/run/host-nvidia"); err != nil {
 		return fmt.Errorf("removing /run/host-nvidia: %w", err)
 	}
@@ -41,8 +42,8 @@ func CleanStaleLinks(r runner.Runner, machine string) error {
 // Setup creates symlinks inside the container for each Nvidia library,
 // pointing from the container's lib dir into the bind-mounted host directories.
 // It also runs ldconfig to update the dynamic linker cache.
-func Setup(r runner.Runner, machine string, libs []LibMapping) error {
-	leaderPID, err := nspawn.LeaderPID(r, machine)
+func Setup(ctx context.Context, r runner.Runner, machine string, libs []LibMapping) error {
+	leaderPID, err := nspawn.LeaderPID(ctx, r, machine)
 	if err != nil {
 		return err
 	}
@@ -56,7 +57,7 @@ func Setup(r runner.Runner, machine string, libs []LibMapping) error {
 
 		// Skip if a regular file (not a symlink) already exists — don't
 		// clobber package-owned files.
-		out, err := r.Run("sudo", "nsenter", "-t", leaderPID, "-m", "--",
+		out, err := r.RunContext(ctx, "sudo", "nsenter", "-t", leaderPID, "-m", "--",
 			"test", "-f", linkPath, "-a", "!", "-L", linkPath)
 		if err == nil && len(strings.TrimSpace(string(out))) == 0 {
 			// Regular file exists, skip.
@@ -64,16 +65,16 @@ func Setup(r runner.Runner, machine string, libs []LibMapping) error {
 		}
 
 		// Remove any existing file/symlink and create the new symlink.
-		_, _ = r.Run("sudo", "nsenter", "-t", leaderPID, "-m", "--",
+		_, _ = r.RunContext(ctx, "sudo", "nsenter", "-t", leaderPID, "-m", "--",
 			"rm", "-f", linkPath)
-		if _, err := r.Run("sudo", "nsenter", "-t", leaderPID, "-m", "--",
+		if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", leaderPID, "-m", "--",
 			"ln", "-s", target, linkPath); err != nil {
 			return fmt.Errorf("symlink %s -> %s: %w", linkPath, target, err)
 		}
 	}
 
 	// Update the dynamic linker cache.
-	if _, err := r.Run("sudo", "nsenter", "-t", leaderPID, "-m", "--",
+	if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", leaderPID, "-m", "--",
 		"ldconfig"); err != nil {
 		return fmt.Errorf("ldconfig failed: %w", err)
 	}
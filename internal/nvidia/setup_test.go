@@ -1,7 +1,9 @@
 package nvidia
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -44,6 +46,20 @@ func (m *mockRunner) RunAttached(name string, args ...string) error {
 	return nil
 }
 
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mockRunner) RunBackground(name string, args ...string) error {
 	m.commands = append(m.commands, name+" "+strings.Join(args, " "))
 	return nil
@@ -59,7 +75,7 @@ func (e *mockError) Error() string { return "mock error" }
 
 func TestCleanStaleLinks(t *testing.T) {
 	r := newMockRunner()
-	if err := CleanStaleLinks(r, "intuneme"); err != nil {
+	if err := CleanStaleLinks(context.Background(), r, "intuneme"); err != nil {
 		t.Fatalf("CleanStaleLinks failed: %v", err)
 	}
 
@@ -95,7 +111,7 @@ func TestSetup(t *testing.T) {
 		{Basename: "libnvoptix.so.1", HostPath: "/usr/lib64/libnvoptix.so.1"},
 	}
 
-	if err := Setup(r, "intuneme", libs); err != nil {
+	if err := Setup(context.Background(), r, "intuneme", libs); err != nil {
 		t.Fatalf("Setup failed: %v", err)
 	}
 
@@ -143,7 +159,7 @@ func TestLibDirMountsAndSetupAgreeOnIndexMapping(t *testing.T) {
 	}
 
 	r := newMockRunner()
-	if err := Setup(r, "intuneme", libs); err != nil {
+	if err := Setup(context.Background(), r, "intuneme", libs); err != nil {
 		t.Fatalf("Setup failed: %v", err)
 	}
 
@@ -199,12 +215,12 @@ func setupSymlinkIndex(commands []string, basename string) (int, bool) {
 
 func TestCleanStaleLinks_PropagatesErrors(t *testing.T) {
 	r := &errorRunner{failOn: "find"}
-	if err := CleanStaleLinks(r, "intuneme"); err == nil {
+	if err := CleanStaleLinks(context.Background(), r, "intuneme"); err == nil {
 		t.Error("expected error from find command, got nil")
 	}
 
 	r = &errorRunner{failOn: "rm"}
-	if err := CleanStaleLinks(r, "intuneme"); err == nil {
+	if err := CleanStaleLinks(context.Background(), r, "intuneme"); err == nil {
 		t.Error("expected error from rm command, got nil")
 	}
 }
@@ -225,7 +241,22 @@ func (e *errorRunner) Run(name string, args ...string) ([]byte, error) {
 	return nil, nil
 }
 
-func (e *errorRunner) RunAttached(string, ...string) error   { return nil }
+func (e *errorRunner) RunAttached(string, ...string) error { return nil }
+
+func (e *errorRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return e.Run(name, args...)
+}
+
+func (e *errorRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return e.RunAttached(name, args...)
+}
+
+func (e *errorRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := e.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (e *errorRunner) RunBackground(string, ...string) error { return nil }
 func (e *errorRunner) LookPath(name string) (string, error)  { return "/usr/bin/" + name, nil }
 
@@ -239,7 +270,7 @@ func TestSetup_SkipsExistingRegularFile(t *testing.T) {
 	testCmd := "sudo nsenter -t 42 -m -- test -f /usr/lib/x86_64-linux-gnu/libcuda.so.1 -a ! -L /usr/lib/x86_64-linux-gnu/libcuda.so.1"
 	r.outputs[testCmd] = []byte("")
 
-	if err := Setup(r, "intuneme", libs); err != nil {
+	if err := Setup(context.Background(), r, "intuneme", libs); err != nil {
 		t.Fatalf("Setup failed: %v", err)
 	}
 
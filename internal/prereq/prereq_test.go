@@ -1,7 +1,9 @@
 package prereq
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 )
@@ -18,6 +20,20 @@ func (m *mockRunner) RunAttached(name string, args ...string) error {
 	return nil
 }
 
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mockRunner) RunBackground(name string, args ...string) error {
 	return nil
 }
@@ -1,6 +1,7 @@
 package provision
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -18,7 +19,7 @@ const deviceBrokerRelPath = "var/lib/microsoft-identity-device-broker"
 // rootfs to a temporary directory. Returns the temp directory path, or ""
 // if the broker directory doesn't exist (no enrollment to preserve).
 // The caller is responsible for cleaning up the temp directory.
-func BackupDeviceBrokerState(r runner.Runner, rootfs string) (string, error) {
+func BackupDeviceBrokerState(ctx context.Context, r runner.Runner, rootfs string) (string, error) {
 	brokerDir := filepath.Join(rootfs, deviceBrokerRelPath)
 	if _, err := os.Stat(brokerDir); errors.Is(err, fs.ErrNotExist) {
 		return "", nil
@@ -30,7 +31,7 @@ func BackupDeviceBrokerState(r runner.Runner, rootfs string) (string, error) {
 	}
 
 	dest := filepath.Join(tmpDir, "microsoft-identity-device-broker")
-	if _, err := r.Run("sudo", "cp", "-a", brokerDir, dest); err != nil {
+	if _, err := r.RunContext(ctx, "sudo", "cp", "-a", brokerDir, dest); err != nil {
 		_ = os.RemoveAll(tmpDir)
 		return "", fmt.Errorf("backup device broker state: %w", err)
 	}
@@ -40,10 +41,10 @@ func BackupDeviceBrokerState(r runner.Runner, rootfs string) (string, error) {
 // RestoreDeviceBrokerState copies the backed-up device broker state back
 // into the new rootfs. The backupDir should be the path returned by
 // BackupDeviceBrokerState.
-func RestoreDeviceBrokerState(r runner.Runner, rootfs, backupDir string) error {
+func RestoreDeviceBrokerState(ctx context.Context, r runner.Runner, rootfs, backupDir string) error {
 	src := filepath.Join(backupDir, "microsoft-identity-device-broker")
 	dest := filepath.Join(rootfs, deviceBrokerRelPath)
-	if _, err := r.Run("sudo", "cp", "-a", src, dest); err != nil {
+	if _, err := r.RunContext(ctx, "sudo", "cp", "-a", src, dest); err != nil {
 		return fmt.Errorf("restore device broker state: %w", err)
 	}
 	return nil
@@ -53,8 +54,8 @@ func RestoreDeviceBrokerState(r runner.Runner, rootfs, backupDir string) error {
 // full line for the given username. This preserves the password hash so it
 // can be restored after re-provisioning. Uses sudo because the rootfs shadow
 // file is owned by root after nspawn use.
-func BackupShadowEntry(r runner.Runner, rootfs, username string) (string, error) {
-	data, err := r.Run("sudo", "cat", filepath.Join(rootfs, "etc", "shadow"))
+func BackupShadowEntry(ctx context.Context, r runner.Runner, rootfs, username string) (string, error) {
+	data, err := r.RunContext(ctx, "sudo", "cat", filepath.Join(rootfs, "etc", "shadow"))
 	if err != nil {
 		return "", fmt.Errorf("read shadow: %w", err)
 	}
@@ -72,11 +73,11 @@ func BackupShadowEntry(r runner.Runner, rootfs, username string) (string, error)
 
 // RestoreShadowEntry reads the new rootfs shadow file, replaces the line
 // for the user extracted from shadowLine, and writes it back via sudo.
-func RestoreShadowEntry(r runner.Runner, rootfs, shadowLine string) error {
+func RestoreShadowEntry(ctx context.Context, r runner.Runner, rootfs, shadowLine string) error {
 	username, _, _ := strings.Cut(shadowLine, ":")
 
 	shadowPath := filepath.Join(rootfs, "etc", "shadow")
-	data, err := r.Run("sudo", "cat", shadowPath)
+	data, err := r.RunContext(ctx, "sudo", "cat", shadowPath)
 	if err != nil {
 		return fmt.Errorf("read shadow: %w", err)
 	}
@@ -95,5 +96,5 @@ func RestoreShadowEntry(r runner.Runner, rootfs, shadowLine string) error {
 		return fmt.Errorf("user %q not found in new shadow file", username)
 	}
 
-	return sudo.WriteFile(r, shadowPath, []byte(strings.Join(lines, "\n")), 0640)
+	return sudo.WriteFile(ctx, r, shadowPath, []byte(strings.Join(lines, "\n")), 0640)
 }
@@ -1,6 +1,7 @@
 package provision
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -41,7 +42,7 @@ func TestBackupShadowEntry(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockRunner{outputs: [][]byte{[]byte(tt.shadow)}}
-			got, err := BackupShadowEntry(r, "/fake/rootfs", tt.username)
+			got, err := BackupShadowEntry(context.Background(), r, "/fake/rootfs", tt.username)
 			if tt.wantErr {
 				if err == nil {
 					t.Fatal("expected error, got nil")
@@ -88,7 +89,7 @@ func TestRestoreShadowEntry(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockRunner{outputs: [][]byte{[]byte(tt.shadow)}}
-			err := RestoreShadowEntry(r, "/fake/rootfs", tt.shadowLine)
+			err := RestoreShadowEntry(context.Background(), r, "/fake/rootfs", tt.shadowLine)
 			if tt.wantErr {
 				if err == nil {
 					t.Fatal("expected error, got nil")
@@ -119,7 +120,7 @@ func TestBackupDeviceBrokerState(t *testing.T) {
 	}
 
 	r := &mockRunner{}
-	tmpDir, err := BackupDeviceBrokerState(r, rootfs)
+	tmpDir, err := BackupDeviceBrokerState(context.Background(), r, rootfs)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -142,7 +143,7 @@ func TestBackupDeviceBrokerStateNoBrokerDir(t *testing.T) {
 	// No broker dir exists
 
 	r := &mockRunner{}
-	tmpDir, err := BackupDeviceBrokerState(r, rootfs)
+	tmpDir, err := BackupDeviceBrokerState(context.Background(), r, rootfs)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -159,7 +160,7 @@ func TestRestoreDeviceBrokerState(t *testing.T) {
 	backupDir := t.TempDir()
 
 	r := &mockRunner{}
-	err := RestoreDeviceBrokerState(r, rootfs, backupDir)
+	err := RestoreDeviceBrokerState(context.Background(), r, rootfs, backupDir)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -50,6 +50,23 @@ if [ -S /run/host-pulse ]; then
     export PULSE_SERVER=unix:/run/host-pulse
 fi
 
+# Locale — copied from the host by intuneme start. A non-login shell never
+# reads it otherwise, so apps launched from the host would use the C locale.
+if [ -f /etc/default/locale ]; then
+    set -a
+    # shellcheck source=/dev/null
+    . /etc/default/locale
+    set +a
+fi
+
+# HTTP proxy — from the [proxy] table of config.toml, written by intuneme start.
+if [ -f /etc/intuneme-proxy ]; then
+    set -a
+    # shellcheck source=/dev/null
+    . /etc/intuneme-proxy
+    set +a
+fi
+
 # Nvidia GPU (libraries symlinked from host by intuneme start)
 if [ -d /run/host-nvidia ]; then
     export __NV_PRIME_RENDER_OFFLOAD=1
@@ -60,7 +77,10 @@ fi
 # environment. The latter is what D-Bus-activated services (the identity broker)
 # inherit — without it the broker has no DISPLAY and crashes on activation.
 _env_vars="DISPLAY XAUTHORITY NO_AT_BRIDGE GTK_A11Y PATH WAYLAND_DISPLAY \
-PIPEWIRE_REMOTE PULSE_SERVER __NV_PRIME_RENDER_OFFLOAD __GLX_VENDOR_LIBRARY_NAME"
+PIPEWIRE_REMOTE PULSE_SERVER __NV_PRIME_RENDER_OFFLOAD __GLX_VENDOR_LIBRARY_NAME \
+LANG LANGUAGE LC_CTYPE LC_NUMERIC LC_TIME LC_COLLATE LC_MONETARY LC_MESSAGES \
+LC_PAPER LC_NAME LC_ADDRESS LC_TELEPHONE LC_MEASUREMENT LC_IDENTIFICATION \
+http_proxy https_proxy no_proxy HTTP_PROXY HTTPS_PROXY NO_PROXY"
 # Only pass variables that are actually set, so we don't clear them.
 _set_vars=""
 for _v in $_env_vars; do
@@ -1,14 +1,19 @@
 package provision
 
 import (
+	"bytes"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/intuneme/internal/locale"
 	"github.com/frostyard/intuneme/internal/nspawn"
 	"github.com/frostyard/intuneme/internal/runner"
 	"github.com/frostyard/intuneme/internal/sudo"
@@ -27,20 +32,20 @@ var intuneSessionSetupScript []byte
 const sessionSetupPath = "usr/local/bin/intuneme-session-setup"
 
 // sudoMkdirAll creates directories with sudo.
-func sudoMkdirAll(r runner.Runner, path string) error {
-	_, err := r.Run("sudo", "mkdir", "-p", path)
+func sudoMkdirAll(ctx context.Context, r runner.Runner, path string) error {
+	_, err := r.RunContext(ctx, "sudo", "mkdir", "-p", path)
 	return err
 }
 
 // sudoSymlink creates a symlink with sudo, removing any existing link first.
-func sudoSymlink(r runner.Runner, target, link string) error {
-	_, err := r.Run("sudo", "ln", "-sf", target, link)
+func sudoSymlink(ctx context.Context, r runner.Runner, target, link string) error {
+	_, err := r.RunContext(ctx, "sudo", "ln", "-sf", target, link)
 	return err
 }
 
-func WriteFixups(r runner.Runner, rootfsPath, user string, uid, gid int, hostname string) error {
+func WriteFixups(ctx context.Context, r runner.Runner, rootfsPath, user string, uid, gid int, hostname string) error {
 	// /etc/hostname
-	if err := sudo.WriteFile(r,
+	if err := sudo.WriteFile(ctx, r,
 		filepath.Join(rootfsPath, "etc", "hostname"),
 		[]byte(hostname+"\n"), 0644,
 	); err != nil {
@@ -49,7 +54,7 @@ func WriteFixups(r runner.Runner, rootfsPath, user string, uid, gid int, hostnam
 
 	// /etc/hosts
 	hosts := fmt.Sprintf("127.0.0.1 %s localhost\n", hostname)
-	if err := sudo.WriteFile(r,
+	if err := sudo.WriteFile(ctx, r,
 		filepath.Join(rootfsPath, "etc", "hosts"),
 		[]byte(hosts), 0644,
 	); err != nil {
@@ -72,31 +77,31 @@ WantedBy=multi-user.target
 `, uid, gid, user)
 
 	svcPath := filepath.Join(rootfsPath, "etc", "systemd", "system", "fix-home-ownership.service")
-	if err := sudo.WriteFile(r, svcPath, []byte(svc), 0644); err != nil {
+	if err := sudo.WriteFile(ctx, r, svcPath, []byte(svc), 0644); err != nil {
 		return fmt.Errorf("write fix-home-ownership.service: %w", err)
 	}
 
 	// Enable the service (symlink)
 	wantsDir := filepath.Join(rootfsPath, "etc", "systemd", "system", "multi-user.target.wants")
-	if err := sudoMkdirAll(r, wantsDir); err != nil {
+	if err := sudoMkdirAll(ctx, r, wantsDir); err != nil {
 		return fmt.Errorf("mkdir multi-user wants dir: %w", err)
 	}
-	if err := sudoSymlink(r, svcPath, filepath.Join(wantsDir, "fix-home-ownership.service")); err != nil {
+	if err := sudoSymlink(ctx, r, svcPath, filepath.Join(wantsDir, "fix-home-ownership.service")); err != nil {
 		return fmt.Errorf("symlink fix-home-ownership.service: %w", err)
 	}
 
 	// Install the session setup scripts (shared script + profile.d entry point).
-	if err := InstallSessionScripts(r, rootfsPath); err != nil {
+	if err := InstallSessionScripts(ctx, r, rootfsPath); err != nil {
 		return err
 	}
 
 	// Passwordless sudo for the container user
 	sudoersDir := filepath.Join(rootfsPath, "etc", "sudoers.d")
-	if err := sudoMkdirAll(r, sudoersDir); err != nil {
+	if err := sudoMkdirAll(ctx, r, sudoersDir); err != nil {
 		return fmt.Errorf("mkdir sudoers.d: %w", err)
 	}
 	sudoersRule := fmt.Sprintf("%s ALL=(ALL) NOPASSWD: ALL\n", user)
-	if err := sudo.WriteFile(r, filepath.Join(sudoersDir, "intuneme"), []byte(sudoersRule), 0440); err != nil {
+	if err := sudo.WriteFile(ctx, r, filepath.Join(sudoersDir, "intuneme"), []byte(sudoersRule), 0440); err != nil {
 		return fmt.Errorf("write sudoers.d/intuneme: %w", err)
 	}
 
@@ -107,37 +112,37 @@ WantedBy=multi-user.target
 // profile.d entry point that sources it. Both the interactive login path and
 // the nsenter launch path (nspawn.Exec) rely on the shared script existing at
 // /usr/local/bin/intuneme-session-setup. Idempotent — safe to re-run.
-func InstallSessionScripts(r runner.Runner, rootfsPath string) error {
+func InstallSessionScripts(ctx context.Context, r runner.Runner, rootfsPath string) error {
 	binDir := filepath.Join(rootfsPath, filepath.Dir(sessionSetupPath))
-	if err := sudoMkdirAll(r, binDir); err != nil {
+	if err := sudoMkdirAll(ctx, r, binDir); err != nil {
 		return fmt.Errorf("mkdir %s: %w", binDir, err)
 	}
-	if err := sudo.WriteFile(r, filepath.Join(rootfsPath, sessionSetupPath), intuneSessionSetupScript, 0755); err != nil {
+	if err := sudo.WriteFile(ctx, r, filepath.Join(rootfsPath, sessionSetupPath), intuneSessionSetupScript, 0755); err != nil {
 		return fmt.Errorf("write %s: %w", sessionSetupPath, err)
 	}
 
 	profileDir := filepath.Join(rootfsPath, "etc", "profile.d")
-	if err := sudoMkdirAll(r, profileDir); err != nil {
+	if err := sudoMkdirAll(ctx, r, profileDir); err != nil {
 		return fmt.Errorf("mkdir profile.d: %w", err)
 	}
-	if err := sudo.WriteFile(r, filepath.Join(profileDir, "intuneme.sh"), intuneProfileScript, 0755); err != nil {
+	if err := sudo.WriteFile(ctx, r, filepath.Join(profileDir, "intuneme.sh"), intuneProfileScript, 0755); err != nil {
 		return fmt.Errorf("write profile.d/intuneme.sh: %w", err)
 	}
 	return nil
 }
 
-// SessionScriptsInstalled reports whether the shared session-setup script is
-// present in the rootfs. Used by `start` to self-heal containers provisioned
-// before the script existed.
+// SessionScriptsInstalled reports whether the shared session-setup script in
+// the rootfs is present and matches this version's. Used by `start` to
+// self-heal containers provisioned before the script existed or changed.
 func SessionScriptsInstalled(rootfsPath string) bool {
-	_, err := os.Stat(filepath.Join(rootfsPath, sessionSetupPath))
-	return err == nil
+	data, err := os.ReadFile(filepath.Join(rootfsPath, sessionSetupPath))
+	return err == nil && bytes.Equal(data, intuneSessionSetupScript)
 }
 
 // SetContainerPassword sets the user's password inside the container via chpasswd.
 // Without a password, the account is locked and machinectl shell/login won't work interactively.
 // The password is passed via a temp file bound read-only into the container to avoid shell injection.
-func SetContainerPassword(r runner.Runner, rootfsPath, user, password string) error {
+func SetContainerPassword(ctx context.Context, r runner.Runner, rootfsPath, user, password string) error {
 	tmp, err := os.CreateTemp("", "intuneme-chpasswd-*")
 	if err != nil {
 		return fmt.Errorf("create chpasswd temp file: %w", err)
@@ -152,7 +157,7 @@ func SetContainerPassword(r runner.Runner, rootfsPath, user, password string) er
 		return fmt.Errorf("close chpasswd temp file: %w", err)
 	}
 
-	return r.RunAttached("sudo", "systemd-nspawn", "--console=pipe",
+	return r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe",
 		"--bind-ro="+tmp.Name()+":/run/chpasswd-input",
 		"-D", rootfsPath,
 		"bash", "-c", "chpasswd < /run/chpasswd-input",
@@ -191,13 +196,13 @@ func requiredRuntimeGroups() []string {
 // Operates on a *running* container — uses nsenter into the container's
 // mount namespace, matching the pattern in internal/udev/udev.go:ForwardDevice
 // and internal/nvidia/setup.go.
-func EnsureUserGroups(r runner.Runner, machine, user string) ([]string, error) {
-	pid, err := nspawn.LeaderPID(r, machine)
+func EnsureUserGroups(ctx context.Context, r runner.Runner, machine, user string) ([]string, error) {
+	pid, err := nspawn.LeaderPID(ctx, r, machine)
 	if err != nil {
 		return nil, fmt.Errorf("ensure user groups: %w", err)
 	}
 
-	out, err := r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+	out, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 		"id", "-nG", user)
 	if err != nil {
 		return nil, fmt.Errorf("read groups for %s: %w", user, err)
@@ -212,7 +217,7 @@ func EnsureUserGroups(r runner.Runner, machine, user string) ([]string, error) {
 		if current[g] {
 			continue
 		}
-		if _, err := r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+		if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 			"usermod", "-aG", g, user); err != nil {
 			return added, fmt.Errorf("add %s to %s: %w", user, g, err)
 		}
@@ -224,10 +229,14 @@ func EnsureUserGroups(r runner.Runner, machine, user string) ([]string, error) {
 // CreateContainerUser ensures a user with the matching UID exists inside the rootfs.
 // If a user with the target UID already exists (e.g., "ubuntu" from the OCI image),
 // it is renamed and reconfigured. Otherwise a new user is created.
-func CreateContainerUser(r runner.Runner, rep reporter.Reporter, rootfsPath, user string, uid, gid int) error {
+func CreateContainerUser(ctx context.Context, r runner.Runner, rep reporter.Reporter, rootfsPath, user string, uid, gid int) error {
 	// Check if a user with this UID already exists in the rootfs passwd
 	passwdPath := filepath.Join(rootfsPath, "etc", "passwd")
 	existingUser, err := findUserByUID(passwdPath, uid)
+	if errors.Is(err, fs.ErrNotExist) && runner.DryRun(r, "look up UID %d in the new image's %s", uid, passwdPath) {
+		// Nothing is extracted while planning, so plan for a fresh user.
+		err = nil
+	}
 	if err != nil {
 		return fmt.Errorf("check existing users: %w", err)
 	}
@@ -235,20 +244,20 @@ func CreateContainerUser(r runner.Runner, rep reporter.Reporter, rootfsPath, use
 	if existingUser != "" && existingUser != user {
 		// Rename the existing user and fix up their home directory
 		rep.Message("Renaming existing user %q to %q...", existingUser, user)
-		if err := r.RunAttached("sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
+		if err := r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
 			"usermod", "--login", user, "--home", fmt.Sprintf("/home/%s", user), "--move-home", existingUser,
 		); err != nil {
 			return fmt.Errorf("usermod (rename) failed: %w", err)
 		}
 		// Ensure correct groups
-		if err := r.RunAttached("sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
+		if err := r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
 			"usermod", "--groups", userGroups(rootfsPath), "--append", user,
 		); err != nil {
 			return fmt.Errorf("usermod (groups) failed: %w", err)
 		}
 	} else if existingUser == "" {
 		// No user with this UID — create one
-		if err := r.RunAttached("sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
+		if err := r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
 			"useradd",
 			"--uid", fmt.Sprintf("%d", uid),
 			"--create-home",
@@ -260,7 +269,7 @@ func CreateContainerUser(r runner.Runner, rep reporter.Reporter, rootfsPath, use
 		}
 	} else {
 		// User already exists with the right name — just ensure groups
-		if err := r.RunAttached("sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
+		if err := r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
 			"usermod", "--groups", userGroups(rootfsPath), "--append", user,
 		); err != nil {
 			return fmt.Errorf("usermod (groups) failed: %w", err)
@@ -351,11 +360,17 @@ func FindHostRenderGID() (int, error) {
 	return findGroupGID("/etc/group", "render")
 }
 
+// ContainerRenderGID returns the GID of the "render" group in the container
+// rootfs, or -1 if the group does not exist.
+func ContainerRenderGID(rootfsPath string) (int, error) {
+	return findGroupGID(filepath.Join(rootfsPath, "etc", "group"), "render")
+}
+
 // EnsureRenderGroup ensures a "render" group with the given GID exists in the container.
 // If the group is missing it is created; if it exists with a different GID it is modified.
 // If the target GID is already occupied by another group, that group is reassigned to a
 // free system GID first.
-func EnsureRenderGroup(r runner.Runner, rep reporter.Reporter, rootfsPath string, gid int) error {
+func EnsureRenderGroup(ctx context.Context, r runner.Runner, rep reporter.Reporter, rootfsPath string, gid int) error {
 	containerGroupPath := filepath.Join(rootfsPath, "etc", "group")
 	existingGID, err := findGroupGID(containerGroupPath, "render")
 	if err != nil {
@@ -377,7 +392,7 @@ func EnsureRenderGroup(r runner.Runner, rep reporter.Reporter, rootfsPath string
 			return fmt.Errorf("find free GID for %s: %w", conflicting, err)
 		}
 		rep.Message("Reassigning group %q from GID %d to %d...", conflicting, gid, freeGID)
-		if err := r.RunAttached("sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
+		if err := r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
 			"groupmod", "--gid", fmt.Sprintf("%d", freeGID), conflicting); err != nil {
 			return fmt.Errorf("reassign group %s: %w", conflicting, err)
 		}
@@ -385,10 +400,10 @@ func EnsureRenderGroup(r runner.Runner, rep reporter.Reporter, rootfsPath string
 
 	gidStr := fmt.Sprintf("%d", gid)
 	if existingGID >= 0 {
-		return r.RunAttached("sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
+		return r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
 			"groupmod", "--gid", gidStr, "render")
 	}
-	return r.RunAttached("sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
+	return r.RunAttachedContext(ctx, "sudo", "systemd-nspawn", "--console=pipe", "-D", rootfsPath,
 		"groupadd", "--gid", gidStr, "render")
 }
 
@@ -410,16 +425,16 @@ func SELinuxEnabled() bool {
 //  1. The rootfs tree is relabeled to container_file_t so systemd-machined can read it.
 //  2. A policy module is installed that allows systemd_machined_t to open and use PTY
 //     devices (user_devpts_t), which is required for machinectl shell to work.
-func InstallSELinuxPolicy(r runner.Runner, rootfsPath string) error {
+func InstallSELinuxPolicy(ctx context.Context, r runner.Runner, rootfsPath string) error {
 	// 1. Persist the file context so restorecon knows the target label.
-	if _, err := r.Run("sudo", "semanage", "fcontext", "-a", "-t", "container_file_t",
+	if _, err := r.RunContext(ctx, "sudo", "semanage", "fcontext", "-a", "-t", "container_file_t",
 		rootfsPath+"(/.*)?"); err != nil {
 		// If the context already exists semanage exits non-zero; treat as non-fatal.
 		_ = err
 	}
 
 	// 2. Relabel the rootfs tree.
-	if err := r.RunAttached("sudo", "restorecon", "-RF", rootfsPath); err != nil {
+	if err := r.RunAttachedContext(ctx, "sudo", "restorecon", "-RF", rootfsPath); err != nil {
 		return fmt.Errorf("restorecon failed: %w", err)
 	}
 
@@ -456,21 +471,30 @@ allow systemd_machined_t user_tmp_t:lnk_file { read };
 	// Compile and package the policy module.
 	modFile := filepath.Join(tmpDir, "intuneme-machined.mod")
 	ppFile := filepath.Join(tmpDir, "intuneme-machined.pp")
-	if _, err := r.Run("checkmodule", "-M", "-m", "-o", modFile, teFile); err != nil {
+	if _, err := r.RunContext(ctx, "checkmodule", "-M", "-m", "-o", modFile, teFile); err != nil {
 		return fmt.Errorf("checkmodule failed: %w", err)
 	}
-	if _, err := r.Run("semodule_package", "-o", ppFile, "-m", modFile); err != nil {
+	if _, err := r.RunContext(ctx, "semodule_package", "-o", ppFile, "-m", modFile); err != nil {
 		return fmt.Errorf("semodule_package failed: %w", err)
 	}
-	if err := r.RunAttached("sudo", "semodule", "-X", "300", "-i", ppFile); err != nil {
+	if err := r.RunAttachedContext(ctx, "sudo", "semodule", "-X", "300", "-i", ppFile); err != nil {
 		return fmt.Errorf("semodule install failed: %w", err)
 	}
 
 	return nil
 }
 
-// InstallPolkitRule installs the polkit rule on the host using sudo.
-func InstallPolkitRule(r runner.Runner, rulesDir string) error {
+// PolkitRulesDir is the host directory where the intuneme polkit rule is installed.
+const PolkitRulesDir = "/etc/polkit-1/rules.d"
+
+// PolkitRuleFile returns the polkit rule file name for a machine. Each profile
+// installs its own copy so destroying one profile leaves the others working.
+func PolkitRuleFile(machine string) string {
+	return "50-" + machine + ".rules"
+}
+
+// InstallPolkitRule installs the machine's polkit rule on the host using sudo.
+func InstallPolkitRule(ctx context.Context, r runner.Runner, rulesDir, machine string) error {
 	rule := `polkit.addRule(function(action, subject) {
     if ((action.id == "org.freedesktop.machine1.manage-machines" ||
          action.id == "org.freedesktop.machine1.manage-images" ||
@@ -498,14 +522,14 @@ func InstallPolkitRule(r runner.Runner, rulesDir string) error {
 	}
 
 	// Create directory with sudo
-	if err := r.RunAttached("sudo", "mkdir", "-p", rulesDir); err != nil {
+	if err := r.RunAttachedContext(ctx, "sudo", "mkdir", "-p", rulesDir); err != nil {
 		return fmt.Errorf("create polkit rules dir: %w", err)
 	}
 
 	// Install with correct permissions — polkitd runs as the polkitd user
 	// and needs read access (644), but sudo cp inherits root's umask (often 077).
-	dest := filepath.Join(rulesDir, "50-intuneme.rules")
-	if err := r.RunAttached("sudo", "install", "-m", "0644", tmpFile.Name(), dest); err != nil {
+	dest := filepath.Join(rulesDir, PolkitRuleFile(machine))
+	if err := r.RunAttachedContext(ctx, "sudo", "install", "-m", "0644", tmpFile.Name(), dest); err != nil {
 		return fmt.Errorf("install polkit rule failed: %w", err)
 	}
 	return nil
@@ -514,33 +538,39 @@ func InstallPolkitRule(r runner.Runner, rulesDir string) error {
 // ProvisionContainer runs the shared provisioning sequence used by both init
 // and recreate: GPU render group setup, container user creation, fixups, and
 // polkit rule installation.
-func ProvisionContainer(r runner.Runner, rep reporter.Reporter, rootfsPath, username string, uid, gid int, hostname string) error {
+func ProvisionContainer(ctx context.Context, r runner.Runner, rep reporter.Reporter, rootfsPath, machine, username string, uid, gid int, hostname string) error {
 	// Ensure container has a render group matching the host for GPU access
 	if renderGID, err := FindHostRenderGID(); err == nil && renderGID >= 0 {
 		if clix.Verbose {
 			rep.Message("Configuring GPU render group...")
 		}
-		if err := EnsureRenderGroup(r, rep, rootfsPath, renderGID); err != nil {
+		if err := EnsureRenderGroup(ctx, r, rep, rootfsPath, renderGID); err != nil {
 			rep.Warning("render group setup failed: %v", err)
 		}
 	}
 
 	rep.Message("Creating container user...")
-	if err := CreateContainerUser(r, rep, rootfsPath, username, uid, gid); err != nil {
+	if err := CreateContainerUser(ctx, r, rep, rootfsPath, username, uid, gid); err != nil {
 		return err
 	}
 
 	if clix.Verbose {
 		rep.Message("Applying fixups...")
 	}
-	if err := WriteFixups(r, rootfsPath, username, uid, gid, hostname+"LXC"); err != nil {
+	if err := WriteFixups(ctx, r, rootfsPath, username, uid, gid, hostname+"LXC"); err != nil {
 		return err
 	}
 
+	// Timezone, locale and keyboard layout from the host. Start keeps them in
+	// sync and generates the locales.
+	if err := locale.WriteRootfs(ctx, r, rootfsPath, locale.Detect()); err != nil {
+		rep.Warning("timezone and locale setup failed: %v", err)
+	}
+
 	if clix.Verbose {
 		rep.Message("Installing polkit rules...")
 	}
-	if err := InstallPolkitRule(r, "/etc/polkit-1/rules.d"); err != nil {
+	if err := InstallPolkitRule(ctx, r, PolkitRulesDir, machine); err != nil {
 		rep.Warning("polkit install failed: %v", err)
 	}
 
@@ -1,7 +1,9 @@
 package provision
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -30,6 +32,20 @@ func (m *mockRunner) RunAttached(name string, args ...string) error {
 	return nil
 }
 
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mockRunner) RunBackground(name string, args ...string) error {
 	m.commands = append(m.commands, name+" "+strings.Join(args, " "))
 	return nil
@@ -43,7 +59,7 @@ func TestWriteFixups(t *testing.T) {
 	r := &mockRunner{}
 	rootfs := "/tmp/test-rootfs"
 
-	err := WriteFixups(r, rootfs, "testuser", 1000, 1000, "testhost")
+	err := WriteFixups(context.Background(), r, rootfs, "testuser", 1000, 1000, "testhost")
 	if err != nil {
 		t.Fatalf("WriteFixups error: %v", err)
 	}
@@ -82,7 +98,7 @@ func TestWriteFixups(t *testing.T) {
 
 func TestInstallSessionScripts(t *testing.T) {
 	r := &mockRunner{}
-	if err := InstallSessionScripts(r, "/tmp/test-rootfs"); err != nil {
+	if err := InstallSessionScripts(context.Background(), r, "/tmp/test-rootfs"); err != nil {
 		t.Fatalf("InstallSessionScripts error: %v", err)
 	}
 	allCmds := strings.Join(r.commands, "\n")
@@ -112,6 +128,12 @@ func TestSessionScriptsInstalled(t *testing.T) {
 	if err := os.WriteFile(scriptPath, []byte("#!/bin/bash\n"), 0755); err != nil {
 		t.Fatal(err)
 	}
+	if SessionScriptsInstalled(rootfs) {
+		t.Error("SessionScriptsInstalled = true for an outdated script")
+	}
+	if err := os.WriteFile(scriptPath, intuneSessionSetupScript, 0755); err != nil {
+		t.Fatal(err)
+	}
 	if !SessionScriptsInstalled(rootfs) {
 		t.Error("SessionScriptsInstalled = false after install")
 	}
@@ -141,7 +163,7 @@ func TestSessionSetupScriptContent(t *testing.T) {
 
 func TestSetContainerPassword(t *testing.T) {
 	r := &mockRunner{}
-	err := SetContainerPassword(r, "/rootfs", "alice", "H@rdPa$$w0rd!")
+	err := SetContainerPassword(context.Background(), r, "/rootfs", "alice", "H@rdPa$$w0rd!")
 	if err != nil {
 		t.Fatalf("SetContainerPassword error: %v", err)
 	}
@@ -167,7 +189,7 @@ func TestSetContainerPassword(t *testing.T) {
 func TestSetContainerPasswordSpecialChars(t *testing.T) {
 	// A password with a single-quote would break the old shell interpolation approach.
 	r := &mockRunner{}
-	err := SetContainerPassword(r, "/rootfs", "alice", "It'sAGr8Pass!")
+	err := SetContainerPassword(context.Background(), r, "/rootfs", "alice", "It'sAGr8Pass!")
 	if err != nil {
 		t.Fatalf("SetContainerPassword error: %v", err)
 	}
@@ -347,7 +369,7 @@ func TestEnsureRenderGroup(t *testing.T) {
 		}
 
 		r := &mockRunner{}
-		err := EnsureRenderGroup(r, reporter.NoopReporter{}, tmp, 991)
+		err := EnsureRenderGroup(context.Background(), r, reporter.NoopReporter{}, tmp, 991)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -371,7 +393,7 @@ func TestEnsureRenderGroup(t *testing.T) {
 		}
 
 		r := &mockRunner{}
-		err := EnsureRenderGroup(r, reporter.NoopReporter{}, tmp, 991)
+		err := EnsureRenderGroup(context.Background(), r, reporter.NoopReporter{}, tmp, 991)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -391,7 +413,7 @@ func TestEnsureRenderGroup(t *testing.T) {
 		}
 
 		r := &mockRunner{}
-		err := EnsureRenderGroup(r, reporter.NoopReporter{}, tmp, 991)
+		err := EnsureRenderGroup(context.Background(), r, reporter.NoopReporter{}, tmp, 991)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -416,7 +438,7 @@ func TestEnsureRenderGroup(t *testing.T) {
 		}
 
 		r := &mockRunner{}
-		err := EnsureRenderGroup(r, reporter.NoopReporter{}, tmp, 992)
+		err := EnsureRenderGroup(context.Background(), r, reporter.NoopReporter{}, tmp, 992)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -445,7 +467,7 @@ func TestEnsureRenderGroup(t *testing.T) {
 		}
 
 		r := &mockRunner{}
-		err := EnsureRenderGroup(r, reporter.NoopReporter{}, tmp, 992)
+		err := EnsureRenderGroup(context.Background(), r, reporter.NoopReporter{}, tmp, 992)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -469,7 +491,7 @@ func TestEnsureRenderGroup(t *testing.T) {
 		}
 
 		r := &mockRunner{}
-		err := EnsureRenderGroup(r, reporter.NoopReporter{}, tmp, 992)
+		err := EnsureRenderGroup(context.Background(), r, reporter.NoopReporter{}, tmp, 992)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -501,7 +523,7 @@ func TestCreateContainerUserIncludesRender(t *testing.T) {
 	}
 
 	r := &mockRunner{}
-	err := CreateContainerUser(r, reporter.NoopReporter{}, tmp, "alice", 1000, 1000)
+	err := CreateContainerUser(context.Background(), r, reporter.NoopReporter{}, tmp, "alice", 1000, 1000)
 	if err != nil {
 		t.Fatalf("CreateContainerUser error: %v", err)
 	}
@@ -526,7 +548,7 @@ func TestCreateContainerUserNoRenderGroupSkipsIt(t *testing.T) {
 	}
 
 	r := &mockRunner{}
-	err := CreateContainerUser(r, reporter.NoopReporter{}, tmp, "alice", 1000, 1000)
+	err := CreateContainerUser(context.Background(), r, reporter.NoopReporter{}, tmp, "alice", 1000, 1000)
 	if err != nil {
 		t.Fatalf("CreateContainerUser error: %v", err)
 	}
@@ -625,7 +647,7 @@ func TestEnsureUserGroups_SkipsWhenPresent(t *testing.T) {
 		},
 	}
 
-	added, err := EnsureUserGroups(r, "intuneme", "alice")
+	added, err := EnsureUserGroups(context.Background(), r, "intuneme", "alice")
 	if err != nil {
 		t.Fatalf("EnsureUserGroups returned error: %v", err)
 	}
@@ -647,7 +669,7 @@ func TestEnsureUserGroups_AddsWhenMissing(t *testing.T) {
 		},
 	}
 
-	added, err := EnsureUserGroups(r, "intuneme", "alice")
+	added, err := EnsureUserGroups(context.Background(), r, "intuneme", "alice")
 	if err != nil {
 		t.Fatalf("EnsureUserGroups returned error: %v", err)
 	}
@@ -675,7 +697,7 @@ func TestWritePolkitRule(t *testing.T) {
 	rulesDir := filepath.Join(tmp, "etc", "polkit-1", "rules.d")
 
 	r := &mockRunner{}
-	err := InstallPolkitRule(r, rulesDir)
+	err := InstallPolkitRule(context.Background(), r, rulesDir, "intuneme-clienta")
 	if err != nil {
 		t.Fatalf("InstallPolkitRule error: %v", err)
 	}
@@ -684,6 +706,15 @@ func TestWritePolkitRule(t *testing.T) {
 	if len(r.commands) == 0 {
 		t.Errorf("expected sudo commands for polkit installation")
 	}
+	if !strings.HasSuffix(r.commands[len(r.commands)-1], filepath.Join(rulesDir, "50-intuneme-clienta.rules")) {
+		t.Errorf("rule should be installed per machine, got: %s", r.commands[len(r.commands)-1])
+	}
+}
+
+func TestPolkitRuleFile_DefaultMachineUnchanged(t *testing.T) {
+	if got := PolkitRuleFile("intuneme"); got != "50-intuneme.rules" {
+		t.Errorf("PolkitRuleFile(intuneme) = %q, want 50-intuneme.rules", got)
+	}
 }
 
 func TestBaseGroupsContainsPlugdev(t *testing.T) {
@@ -1,10 +1,12 @@
 package puller
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/frostyard/intuneme/internal/runner"
 )
@@ -15,10 +17,14 @@ type Puller interface {
 	Name() string
 	// PullAndExtract pulls image from a registry and extracts it to rootfsPath.
 	// tmpDir overrides the directory used for intermediate files (e.g. exported
-	// tars). When empty, os.TempDir() is used.
-	PullAndExtract(r runner.Runner, image string, rootfsPath string, tmpDir string) error
+	// tars). When empty, os.TempDir() is used. Cancelling ctx aborts the
+	// transfer; temporary artifacts are still cleaned up.
+	PullAndExtract(ctx context.Context, r runner.Runner, image string, rootfsPath string, tmpDir string) error
 }
 
+// cleanupTimeout bounds removing temporary artifacts after a pull was cancelled.
+const cleanupTimeout = 30 * time.Second
+
 // resolveTmpDir returns tmpDir when non-empty, otherwise os.TempDir().
 func resolveTmpDir(tmpDir string) string {
 	if tmpDir != "" {
@@ -54,9 +60,17 @@ type containerToolPuller struct {
 
 func (c *containerToolPuller) Name() string { return c.tool }
 
-func (c *containerToolPuller) PullAndExtract(r runner.Runner, image string, rootfsPath string, tmpDir string) error {
+func (c *containerToolPuller) PullAndExtract(ctx context.Context, r runner.Runner, image string, rootfsPath string, tmpDir string) error {
+	// removeExtract deletes the temporary extract container. It deliberately
+	// ignores ctx cancellation so an interrupted pull still cleans up.
+	removeExtract := func() ([]byte, error) {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		defer cancel()
+		return r.RunContext(cleanupCtx, c.tool, "rm", "intuneme-extract")
+	}
+
 	// Clean up any leftover extract container from a previous failed run
-	_, _ = r.Run(c.tool, "rm", "intuneme-extract")
+	_, _ = removeExtract()
 
 	// Pull the image
 	pullArgs := []string{"pull"}
@@ -64,35 +78,36 @@ func (c *containerToolPuller) PullAndExtract(r runner.Runner, image string, root
 		pullArgs = append(pullArgs, c.pullFlags(image)...)
 	}
 	pullArgs = append(pullArgs, image)
-	out, err := r.Run(c.tool, pullArgs...)
+	out, err := r.RunContext(ctx, c.tool, pullArgs...)
 	if err != nil {
 		return fmt.Errorf("%s pull failed: %w\n%s", c.tool, err, out)
 	}
 
 	// Create a temporary container to export (command is required but never
 	// run — the container is only created so we can export its filesystem)
-	out, err = r.Run(c.tool, "create", "--name", "intuneme-extract", image, "/bin/true")
+	out, err = r.RunContext(ctx, c.tool, "create", "--name", "intuneme-extract", image, "/bin/true")
 	if err != nil {
+		_, _ = removeExtract()
 		return fmt.Errorf("%s create failed: %w\n%s", c.tool, err, out)
 	}
 
 	// Export to tar, then extract with sudo to preserve container-internal UIDs
 	tmpTar := filepath.Join(resolveTmpDir(tmpDir), "intuneme-rootfs.tar")
-	out, err = r.Run(c.tool, "export", "-o", tmpTar, "intuneme-extract")
+	out, err = r.RunContext(ctx, c.tool, "export", "-o", tmpTar, "intuneme-extract")
 	if err != nil {
-		_, _ = r.Run(c.tool, "rm", "intuneme-extract")
+		_, _ = removeExtract()
 		return fmt.Errorf("%s export failed: %w\n%s", c.tool, err, out)
 	}
 	defer func() { _ = os.Remove(tmpTar) }()
 
 	// RunAttached so sudo can prompt for password
-	if err := r.RunAttached("sudo", "tar", "-xf", tmpTar, "-C", rootfsPath); err != nil {
-		_, _ = r.Run(c.tool, "rm", "intuneme-extract")
+	if err := r.RunAttachedContext(ctx, "sudo", "tar", "-xf", tmpTar, "-C", rootfsPath); err != nil {
+		_, _ = removeExtract()
 		return fmt.Errorf("extract rootfs failed: %w", err)
 	}
 
 	// Remove temporary container
-	out, err = r.Run(c.tool, "rm", "intuneme-extract")
+	out, err = removeExtract()
 	if err != nil {
 		return fmt.Errorf("%s rm failed: %w\n%s", c.tool, err, out)
 	}
@@ -121,7 +136,7 @@ type SkopeoPuller struct{}
 
 func (p *SkopeoPuller) Name() string { return "skopeo+umoci" }
 
-func (p *SkopeoPuller) PullAndExtract(r runner.Runner, image string, rootfsPath string, tmpDir string) error {
+func (p *SkopeoPuller) PullAndExtract(ctx context.Context, r runner.Runner, image string, rootfsPath string, tmpDir string) error {
 	// Create a temp directory for the OCI layout
 	ociTmpDir, err := os.MkdirTemp(resolveTmpDir(tmpDir), "intuneme-oci-*")
 	if err != nil {
@@ -132,13 +147,13 @@ func (p *SkopeoPuller) PullAndExtract(r runner.Runner, image string, rootfsPath
 	ociDest := ociTmpDir + ":latest"
 
 	// Pull image to OCI layout
-	out, err := r.Run("skopeo", "copy", "docker://"+image, "oci:"+ociDest)
+	out, err := r.RunContext(ctx, "skopeo", "copy", "docker://"+image, "oci:"+ociDest)
 	if err != nil {
 		return fmt.Errorf("skopeo copy failed: %w\n%s", err, out)
 	}
 
 	// Unpack OCI layout to rootfs with sudo to preserve UIDs
-	if err := r.RunAttached("sudo", "umoci", "raw", "unpack", "--image", ociDest, rootfsPath); err != nil {
+	if err := r.RunAttachedContext(ctx, "sudo", "umoci", "raw", "unpack", "--image", ociDest, rootfsPath); err != nil {
 		return fmt.Errorf("umoci unpack failed: %w", err)
 	}
 
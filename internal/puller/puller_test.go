@@ -1,7 +1,10 @@
 package puller
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 )
@@ -21,6 +24,20 @@ func (m *mockRunner) RunAttached(name string, args ...string) error {
 	return nil
 }
 
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mockRunner) RunBackground(name string, args ...string) error {
 	m.commands = append(m.commands, name+" "+strings.Join(args, " "))
 	return nil
@@ -90,7 +107,7 @@ func TestPodmanPullAndExtract(t *testing.T) {
 	p := NewPodmanPuller()
 	rootfs := t.TempDir()
 
-	err := p.PullAndExtract(r, "ghcr.io/frostyard/ubuntu-intune:latest", rootfs, "")
+	err := p.PullAndExtract(context.Background(), r, "ghcr.io/frostyard/ubuntu-intune:latest", rootfs, "")
 	if err != nil {
 		t.Fatalf("PullAndExtract error: %v", err)
 	}
@@ -127,7 +144,7 @@ func TestSkopeoPullAndExtract(t *testing.T) {
 	p := &SkopeoPuller{}
 	rootfs := t.TempDir()
 
-	err := p.PullAndExtract(r, "ghcr.io/frostyard/ubuntu-intune:latest", rootfs, "")
+	err := p.PullAndExtract(context.Background(), r, "ghcr.io/frostyard/ubuntu-intune:latest", rootfs, "")
 	if err != nil {
 		t.Fatalf("PullAndExtract error: %v", err)
 	}
@@ -154,7 +171,7 @@ func TestDockerPullAndExtract(t *testing.T) {
 	p := NewDockerPuller()
 	rootfs := t.TempDir()
 
-	err := p.PullAndExtract(r, "ghcr.io/frostyard/ubuntu-intune:latest", rootfs, "")
+	err := p.PullAndExtract(context.Background(), r, "ghcr.io/frostyard/ubuntu-intune:latest", rootfs, "")
 	if err != nil {
 		t.Fatalf("PullAndExtract error: %v", err)
 	}
@@ -196,3 +213,39 @@ func TestDetectErrorsWhenNoneAvailable(t *testing.T) {
 		t.Errorf("unexpected error message: %v", err)
 	}
 }
+
+// cancelRunner fails the export with the context's error, like a real runner
+// whose command was killed by cancellation.
+type cancelRunner struct {
+	mockRunner
+	cleanupCtxErr error // ctx.Err() seen by the final "rm"
+}
+
+func (m *cancelRunner) RunContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, _ := m.Run(name, args...)
+	if len(args) > 0 && args[0] == "export" {
+		return nil, ctx.Err()
+	}
+	if len(args) > 0 && args[0] == "rm" {
+		m.cleanupCtxErr = ctx.Err()
+	}
+	return out, nil
+}
+
+func TestPullAndExtract_CancelledCleansUp(t *testing.T) {
+	r := &cancelRunner{mockRunner: mockRunner{available: map[string]bool{"podman": true}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := NewPodmanPuller().PullAndExtract(ctx, r, "ghcr.io/frostyard/ubuntu-intune:latest", t.TempDir(), "")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	last := r.commands[len(r.commands)-1]
+	if last != "podman rm intuneme-extract" {
+		t.Errorf("expected extract container cleanup, got: %s", last)
+	}
+	if r.cleanupCtxErr != nil {
+		t.Errorf("cleanup ran with a cancelled context: %v", r.cleanupCtxErr)
+	}
+}
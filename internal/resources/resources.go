@@ -0,0 +1,239 @@
+package resources
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// defaultTasksMax is the TasksMax systemd-nspawn and the installed service
+// unit give the container; clearing tasks_max live restores it.
+const defaultTasksMax = 16384
+
+// cgroupRoot is where the unified cgroup hierarchy is mounted. Tests point it
+// at a temporary directory.
+var cgroupRoot = "/sys/fs/cgroup"
+
+var (
+	validMemory = regexp.MustCompile(`^([0-9]+[KMGT]?|[0-9]+(\.[0-9]+)?%|infinity)$`)
+	validCPU    = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?%$`)
+)
+
+// Keys lists the settings of the [resources] table in config.toml.
+var Keys = []string{"memory_max", "memory_high", "cpu_quota", "io_weight", "tasks_max"}
+
+// Properties returns the systemd properties for the limits set in res, in the
+// order of Keys.
+func Properties(res config.Resources) []string {
+	var props []string
+	if res.MemoryMax != "" {
+		props = append(props, "MemoryMax="+res.MemoryMax)
+	}
+	if res.MemoryHigh != "" {
+		props = append(props, "MemoryHigh="+res.MemoryHigh)
+	}
+	if res.CPUQuota != "" {
+		props = append(props, "CPUQuota="+res.CPUQuota)
+	}
+	if res.IOWeight != 0 {
+		props = append(props, fmt.Sprintf("IOWeight=%d", res.IOWeight))
+	}
+	if res.TasksMax != 0 {
+		props = append(props, fmt.Sprintf("TasksMax=%d", res.TasksMax))
+	}
+	return props
+}
+
+// Validate checks the limits in res, which may have been edited into
+// config.toml by hand.
+func Validate(res config.Resources) error {
+	assignments := []string{
+		"memory_max=" + res.MemoryMax,
+		"memory_high=" + res.MemoryHigh,
+		"cpu_quota=" + res.CPUQuota,
+	}
+	if res.IOWeight != 0 {
+		assignments = append(assignments, fmt.Sprintf("io_weight=%d", res.IOWeight))
+	}
+	if res.TasksMax != 0 {
+		assignments = append(assignments, fmt.Sprintf("tasks_max=%d", res.TasksMax))
+	}
+	for _, a := range assignments {
+		if _, err := Set(&config.Resources{}, a); err != nil {
+			return fmt.Errorf("config.toml [resources]: %w", err)
+		}
+	}
+	return nil
+}
+
+// Set applies an assignment such as "memory_max=8G" to res. An empty value
+// clears the limit. It returns the systemd property that makes the same change
+// on a running container.
+func Set(res *config.Resources, assignment string) (string, error) {
+	key, value, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return "", fmt.Errorf("invalid setting %q — use key=value, e.g. memory_max=8G", assignment)
+	}
+	value = strings.TrimSpace(value)
+	switch key {
+	case "memory_max", "memory_high":
+		if value != "" && !validMemory.MatchString(value) {
+			return "", fmt.Errorf("invalid %s %q — use bytes with an optional K, M, G or T suffix, a percentage, or infinity", key, value)
+		}
+		prop := "MemoryMax"
+		target := &res.MemoryMax
+		if key == "memory_high" {
+			prop, target = "MemoryHigh", &res.MemoryHigh
+		}
+		*target = value
+		if value == "" {
+			value = "infinity"
+		}
+		return prop + "=" + value, nil
+	case "cpu_quota":
+		if value != "" && !validCPU.MatchString(value) {
+			return "", fmt.Errorf("invalid cpu_quota %q — use a percentage of one CPU, e.g. 200%%", value)
+		}
+		res.CPUQuota = value
+		return "CPUQuota=" + value, nil
+	case "io_weight":
+		n, err := parseLimit(key, value, 1, 10000)
+		if err != nil {
+			return "", err
+		}
+		res.IOWeight = n
+		if n == 0 {
+			return "IOWeight=", nil
+		}
+		return fmt.Sprintf("IOWeight=%d", n), nil
+	case "tasks_max":
+		n, err := parseLimit(key, value, 1, 1<<31-1)
+		if err != nil {
+			return "", err
+		}
+		res.TasksMax = n
+		if n == 0 {
+			n = defaultTasksMax
+		}
+		return fmt.Sprintf("TasksMax=%d", n), nil
+	}
+	return "", fmt.Errorf("unknown resource %q — use one of %s", key, strings.Join(Keys, ", "))
+}
+
+// parseLimit parses an integer setting within [lo, hi]; empty means 0 (unset).
+func parseLimit(key, value string, lo, hi int) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("invalid %s %q — use a number from %d to %d", key, value, lo, hi)
+	}
+	return n, nil
+}
+
+// Apply changes properties on the running machine's unit. The change is made
+// with --runtime so config.toml stays the only persistent source of limits.
+func Apply(ctx context.Context, r runner.Runner, machine string, props []string) error {
+	unit, err := nspawn.MachineUnit(ctx, r, machine)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"systemctl", "set-property", "--runtime", unit}, props...)
+	if out, err := r.RunContext(ctx, "sudo", args...); err != nil {
+		return fmt.Errorf("systemctl set-property failed: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// Usage is the container's current resource consumption.
+type Usage struct {
+	MemoryBytes  uint64 `json:"memory_bytes"`
+	CPUUsec      uint64 `json:"cpu_usec"`
+	Tasks        uint64 `json:"tasks"`
+	IOReadBytes  uint64 `json:"io_read_bytes"`
+	IOWriteBytes uint64 `json:"io_write_bytes"`
+}
+
+// ReadUsage reads the running machine's consumption from its cgroup.
+func ReadUsage(ctx context.Context, r runner.Runner, machine string) (*Usage, error) {
+	unit, err := nspawn.MachineUnit(ctx, r, machine)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, runner.QueryTimeout)
+	defer cancel()
+	out, err := r.RunContext(ctx, "systemctl", "show", unit, "-p", "ControlGroup", "--value")
+	if err != nil {
+		return nil, fmt.Errorf("systemctl show %s failed: %w", unit, err)
+	}
+	cgroup := strings.TrimSpace(string(out))
+	if cgroup == "" {
+		return nil, fmt.Errorf("%s has no control group", unit)
+	}
+	return readUsage(filepath.Join(cgroupRoot, cgroup))
+}
+
+// readUsage reads the cgroup v2 accounting files in dir. Controllers that are
+// not enabled leave their fields at zero.
+func readUsage(dir string) (*Usage, error) {
+	u := &Usage{}
+	var err error
+	if u.MemoryBytes, err = readUint(filepath.Join(dir, "memory.current")); err != nil {
+		return nil, fmt.Errorf("read cgroup memory usage: %w", err)
+	}
+	u.Tasks, _ = readUint(filepath.Join(dir, "pids.current"))
+	_ = scanKeyed(filepath.Join(dir, "cpu.stat"), func(fields []string) {
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			u.CPUUsec, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	})
+	// io.stat has one line per device: "8:0 rbytes=N wbytes=N rios=N ...".
+	_ = scanKeyed(filepath.Join(dir, "io.stat"), func(fields []string) {
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			n, _ := strconv.ParseUint(v, 10, 64)
+			switch k {
+			case "rbytes":
+				u.IOReadBytes += n
+			case "wbytes":
+				u.IOWriteBytes += n
+			}
+		}
+	})
+	return u, nil
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// scanKeyed calls fn with the whitespace-separated fields of each non-empty
+// line of path.
+func scanKeyed(path string, fn func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,125 @@
+package resources
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestProperties(t *testing.T) {
+	res := config.Resources{MemoryMax: "8G", CPUQuota: "200%", TasksMax: 4096}
+	got := strings.Join(Properties(res), " ")
+	if got != "MemoryMax=8G CPUQuota=200% TasksMax=4096" {
+		t.Errorf("Properties = %q", got)
+	}
+	if len(Properties(config.Resources{})) != 0 {
+		t.Error("empty resources should produce no properties")
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		assignment string
+		prop       string
+		wantErr    bool
+	}{
+		{"memory_max=8G", "MemoryMax=8G", false},
+		{"memory_high=40%", "MemoryHigh=40%", false},
+		{"memory_max=", "MemoryMax=infinity", false},
+		{"cpu_quota=150%", "CPUQuota=150%", false},
+		{"cpu_quota=", "CPUQuota=", false},
+		{"io_weight=50", "IOWeight=50", false},
+		{"io_weight=", "IOWeight=", false},
+		{"tasks_max=2048", "TasksMax=2048", false},
+		{"tasks_max=", "TasksMax=16384", false},
+		{"memory_max=8GB", "", true},
+		{"cpu_quota=2", "", true},
+		{"io_weight=0", "", true},
+		{"tasks_max=-1", "", true},
+		{"swap_max=1G", "", true},
+		{"memory_max", "", true},
+	}
+	for _, tt := range tests {
+		var res config.Resources
+		prop, err := Set(&res, tt.assignment)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error = %v, wantErr %v", tt.assignment, err, tt.wantErr)
+			continue
+		}
+		if prop != tt.prop {
+			t.Errorf("Set(%q) = %q, want %q", tt.assignment, prop, tt.prop)
+		}
+	}
+
+	res := config.Resources{MemoryMax: "4G", IOWeight: 200}
+	if _, err := Set(&res, "memory_max=6G"); err != nil || res.MemoryMax != "6G" {
+		t.Errorf("memory_max not updated: %+v, %v", res, err)
+	}
+	if _, err := Set(&res, "io_weight="); err != nil || res.IOWeight != 0 {
+		t.Errorf("io_weight not cleared: %+v, %v", res, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(config.Resources{MemoryMax: "8G", IOWeight: 100}); err != nil {
+		t.Errorf("valid limits rejected: %v", err)
+	}
+	if err := Validate(config.Resources{}); err != nil {
+		t.Errorf("empty limits rejected: %v", err)
+	}
+	if err := Validate(config.Resources{CPUQuota: "2 cores"}); err == nil {
+		t.Error("expected invalid cpu_quota to be rejected")
+	}
+	if err := Validate(config.Resources{TasksMax: -5}); err == nil {
+		t.Error("expected negative tasks_max to be rejected")
+	}
+}
+
+func TestApply(t *testing.T) {
+	r := &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Unit", runner.Reply{Output: "machine-intuneme.scope\n"})
+	if err := Apply(context.Background(), r, "intuneme", []string{"MemoryMax=8G"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "sudo systemctl set-property --runtime machine-intuneme.scope MemoryMax=8G"
+	if last := r.Steps[len(r.Steps)-1].String(); last != want {
+		t.Errorf("last command = %q, want %q", last, want)
+	}
+}
+
+func TestReadUsage(t *testing.T) {
+	cgroupRoot = t.TempDir()
+	defer func() { cgroupRoot = "/sys/fs/cgroup" }()
+	dir := filepath.Join(cgroupRoot, "machine.slice", "machine-intuneme.scope")
+	files := map[string]string{
+		"memory.current": "1073741824\n",
+		"pids.current":   "212\n",
+		"cpu.stat":       "usage_usec 5000000\nuser_usec 4000000\nsystem_usec 1000000\n",
+		"io.stat":        "8:0 rbytes=1000 wbytes=200 rios=10 wios=2\n259:0 rbytes=24 wbytes=800 rios=1 wios=3\n",
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Unit", runner.Reply{Output: "machine-intuneme.scope\n"})
+	r.Answer("systemctl show machine-intuneme.scope -p ControlGroup", runner.Reply{Output: "/machine.slice/machine-intuneme.scope\n"})
+	u, err := ReadUsage(context.Background(), r, "intuneme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Usage{MemoryBytes: 1 << 30, CPUUsec: 5000000, Tasks: 212, IOReadBytes: 1024, IOWriteBytes: 1000}
+	if *u != want {
+		t.Errorf("ReadUsage = %+v, want %+v", *u, want)
+	}
+}
@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Step is one action a Recorder captured, in the order it was requested.
+// Host-side work done in Go rather than through a command is recorded as a
+// Note with no Command.
+type Step struct {
+	Command    string   `json:"command,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	Attached   bool     `json:"attached,omitempty"`
+	Background bool     `json:"background,omitempty"`
+	Note       string   `json:"note,omitempty"`
+}
+
+// plainWord matches arguments that need no quoting in a shell command line.
+var plainWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// String renders the step as a shell command line, quoting only where needed.
+func (s Step) String() string {
+	if s.Command == "" {
+		return s.Note
+	}
+	words := make([]string, 0, len(s.Args)+1)
+	for _, w := range append([]string{s.Command}, s.Args...) {
+		if plainWord.MatchString(w) {
+			words = append(words, w)
+		} else {
+			words = append(words, "'"+strings.ReplaceAll(w, "'", `'\''`)+"'")
+		}
+	}
+	line := strings.Join(words, " ")
+	if s.Background {
+		line += " &"
+	}
+	return line
+}
+
+// Reply is a canned result for a command the Recorder is asked to run.
+type Reply struct {
+	Output string
+	Err    error
+}
+
+type answer struct {
+	prefix  string
+	replies []Reply
+}
+
+// Recorder is a Runner that executes nothing. It records every command it is
+// asked to run and answers with canned replies registered through Answer, so
+// read-only queries such as `machinectl show` can steer the caller down the
+// path it would really take. Commands without a registered answer succeed
+// with no output; LookPath consults the real PATH.
+type Recorder struct {
+	Steps   []Step
+	answers []*answer
+}
+
+// Answer registers replies for commands whose space-joined command line is
+// prefix or starts with prefix followed by a space, e.g.
+// "machinectl show intuneme". Successive matching commands consume the
+// replies in order and the last one repeats. When several prefixes match, the
+// longest wins.
+func (r *Recorder) Answer(prefix string, replies ...Reply) {
+	if len(replies) == 0 {
+		replies = []Reply{{}}
+	}
+	r.answers = append(r.answers, &answer{prefix: prefix, replies: replies})
+}
+
+// Note records host-side work the caller skips while recording.
+func (r *Recorder) Note(format string, args ...any) {
+	r.Steps = append(r.Steps, Step{Note: fmt.Sprintf(format, args...)})
+}
+
+func (r *Recorder) record(s Step) ([]byte, error) {
+	r.Steps = append(r.Steps, s)
+	line := strings.Join(append([]string{s.Command}, s.Args...), " ")
+	var best *answer
+	for _, a := range r.answers {
+		matches := line == a.prefix || strings.HasPrefix(line, a.prefix+" ")
+		if matches && (best == nil || len(a.prefix) > len(best.prefix)) {
+			best = a
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	reply := best.replies[0]
+	if len(best.replies) > 1 {
+		best.replies = best.replies[1:]
+	}
+	return []byte(reply.Output), reply.Err
+}
+
+func (r *Recorder) Run(name string, args ...string) ([]byte, error) {
+	return r.record(Step{Command: name, Args: args})
+}
+
+func (r *Recorder) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return r.Run(name, args...)
+}
+
+func (r *Recorder) RunAttached(name string, args ...string) error {
+	_, err := r.record(Step{Command: name, Args: args, Attached: true})
+	return err
+}
+
+func (r *Recorder) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return r.RunAttached(name, args...)
+}
+
+// RunStream records the command and writes its canned output to w.
+func (r *Recorder) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := r.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
+func (r *Recorder) RunBackground(name string, args ...string) error {
+	_, err := r.record(Step{Command: name, Args: args, Background: true})
+	return err
+}
+
+func (r *Recorder) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+// DryRun reports whether r only records commands. When it does, the host-side
+// work described by format is noted in the plan and the caller must skip it.
+func DryRun(r Runner, format string, args ...any) bool {
+	rec, ok := r.(*Recorder)
+	if ok {
+		rec.Note(format, args...)
+	}
+	return ok
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRecorder_RecordsInOrder(t *testing.T) {
+	rec := &Recorder{}
+	if _, err := rec.RunContext(context.Background(), "machinectl", "show", "intuneme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.RunAttached("sudo", "tar", "-xf", "/tmp/rootfs.tar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.RunBackground("sudo", "systemd-nspawn", "-b"); err != nil {
+		t.Fatal(err)
+	}
+	if !DryRun(rec, "remove %s", "/home/u/Intune") {
+		t.Fatal("DryRun should report true for a Recorder")
+	}
+
+	want := []string{
+		"machinectl show intuneme",
+		"sudo tar -xf /tmp/rootfs.tar",
+		"sudo systemd-nspawn -b &",
+		"remove /home/u/Intune",
+	}
+	if len(rec.Steps) != len(want) {
+		t.Fatalf("got %d steps, want %d: %v", len(rec.Steps), len(want), rec.Steps)
+	}
+	for i, s := range rec.Steps {
+		if s.String() != want[i] {
+			t.Errorf("step %d = %q, want %q", i, s.String(), want[i])
+		}
+	}
+	if !rec.Steps[1].Attached || !rec.Steps[2].Background {
+		t.Errorf("attached/background flags not recorded: %+v", rec.Steps)
+	}
+}
+
+func TestRecorder_Answer(t *testing.T) {
+	rec := &Recorder{}
+	rec.Answer("machinectl show intuneme", Reply{Err: errors.New("not running")}, Reply{})
+	rec.Answer("machinectl show intuneme -p Leader", Reply{Output: "4242\n"})
+
+	if _, err := rec.Run("machinectl", "show", "intuneme"); err == nil {
+		t.Error("first reply should fail")
+	}
+	out, err := rec.Run("machinectl", "show", "intuneme", "-p", "Leader", "--value")
+	if err != nil || string(out) != "4242\n" {
+		t.Errorf("longest prefix should win, got (%q, %v)", out, err)
+	}
+	for range 2 {
+		if _, err := rec.Run("machinectl", "show", "intuneme"); err != nil {
+			t.Errorf("last reply should repeat, got %v", err)
+		}
+	}
+	if _, err := rec.Run("machinectl", "show", "intuneme2"); err != nil {
+		t.Errorf("prefixes match whole words only, got %v", err)
+	}
+}
+
+func TestStep_StringQuotes(t *testing.T) {
+	s := Step{Command: "sudo", Args: []string{"helper", "1", "echo 'hi' $HOME"}}
+	want := `sudo helper 1 'echo '\''hi'\'' $HOME'`
+	if s.String() != want {
+		t.Errorf("String() = %s, want %s", s.String(), want)
+	}
+}
+
+func TestDryRun_SystemRunner(t *testing.T) {
+	if DryRun(&SystemRunner{}, "remove %s", "x") {
+		t.Error("DryRun should report false for a SystemRunner")
+	}
+}
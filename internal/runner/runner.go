@@ -1,16 +1,39 @@
 package runner
 
 import (
+	"context"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// QueryTimeout bounds short read-only queries (machinectl show, systemctl show,
+// stat) so a wedged machined or systemd cannot hang the CLI.
+const QueryTimeout = 15 * time.Second
+
+// killGrace is how long a cancelled command gets to exit after SIGTERM before
+// it is killed outright.
+const killGrace = 5 * time.Second
+
 // Runner executes system commands. Mockable for tests.
 type Runner interface {
 	// Run executes a command, returning combined output and error.
 	Run(name string, args ...string) ([]byte, error)
+	// RunContext is Run bound to ctx: when ctx is cancelled or its deadline
+	// passes, the command's process group is terminated.
+	RunContext(ctx context.Context, name string, args ...string) ([]byte, error)
 	// RunAttached executes a command with stdin/stdout/stderr attached to the terminal.
+	// SIGINT and SIGTERM received while it runs are forwarded to the command.
 	RunAttached(name string, args ...string) error
+	// RunAttachedContext is RunAttached bound to ctx.
+	RunAttachedContext(ctx context.Context, name string, args ...string) error
+	// RunStream is RunContext for long-running commands such as
+	// journalctl -f: stdout is written to w as it is produced and stderr
+	// goes to the terminal.
+	RunStream(ctx context.Context, w io.Writer, name string, args ...string) error
 	// RunBackground starts a command detached from the terminal and returns immediately.
 	// Stdin/stdout/stderr are connected to /dev/null.
 	RunBackground(name string, args ...string) error
@@ -22,15 +45,78 @@ type Runner interface {
 type SystemRunner struct{}
 
 func (r *SystemRunner) Run(name string, args ...string) ([]byte, error) {
-	return exec.Command(name, args...).CombinedOutput()
+	return r.RunContext(context.Background(), name, args...)
+}
+
+func (r *SystemRunner) RunContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return command(ctx, name, args...).CombinedOutput()
+}
+
+func (r *SystemRunner) RunStream(ctx context.Context, w io.Writer, name string, args ...string) error {
+	cmd := command(ctx, name, args...)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// command prepares name to run bound to ctx, for RunContext and RunStream.
+func command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Give the command its own process group so cancellation reaches everything
+	// it spawned (podman's conmon, skopeo's helpers). sudo is the exception: it
+	// must stay in the terminal's foreground group to prompt for a password,
+	// and it relays the termination signal to its command itself.
+	if name != "sudo" {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+		}
+	} else {
+		cmd.Cancel = func() error {
+			return cmd.Process.Signal(syscall.SIGTERM)
+		}
+	}
+	cmd.WaitDelay = killGrace
+	return cmd
 }
 
 func (r *SystemRunner) RunAttached(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
+	return r.RunAttachedContext(context.Background(), name, args...)
+}
+
+func (r *SystemRunner) RunAttachedContext(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	// Attached commands stay in the terminal's foreground group so they can
+	// read from it; cancellation terminates the command itself.
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = killGrace
+
+	// Register before Start so a signal arriving in between is not lost.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return cmd.Wait()
 }
 
 func (r *SystemRunner) RunBackground(name string, args ...string) error {
@@ -41,3 +127,43 @@ func (r *SystemRunner) RunBackground(name string, args ...string) error {
 func (r *SystemRunner) LookPath(name string) (string, error) {
 	return exec.LookPath(name)
 }
+
+// NonInteractive wraps a Runner for processes with no terminal to prompt on,
+// such as user services: sudo runs with -n, so a command that would need a
+// password fails at once instead of hanging. Passwordless rules (the nsenter
+// helper) keep working.
+type NonInteractive struct {
+	Runner
+}
+
+// sudoArgs inserts -n after sudo.
+func sudoArgs(name string, args []string) []string {
+	if name != "sudo" {
+		return args
+	}
+	return append([]string{"-n"}, args...)
+}
+
+func (n NonInteractive) Run(name string, args ...string) ([]byte, error) {
+	return n.Runner.Run(name, sudoArgs(name, args)...)
+}
+
+func (n NonInteractive) RunContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return n.Runner.RunContext(ctx, name, sudoArgs(name, args)...)
+}
+
+func (n NonInteractive) RunAttached(name string, args ...string) error {
+	return n.Runner.RunAttached(name, sudoArgs(name, args)...)
+}
+
+func (n NonInteractive) RunAttachedContext(ctx context.Context, name string, args ...string) error {
+	return n.Runner.RunAttachedContext(ctx, name, sudoArgs(name, args)...)
+}
+
+func (n NonInteractive) RunStream(ctx context.Context, w io.Writer, name string, args ...string) error {
+	return n.Runner.RunStream(ctx, w, name, sudoArgs(name, args)...)
+}
+
+func (n NonInteractive) RunBackground(name string, args ...string) error {
+	return n.Runner.RunBackground(name, sudoArgs(name, args)...)
+}
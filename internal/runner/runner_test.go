@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunContext_TimeoutKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The backgrounded sleep holds the output pipe open; unless the whole group
+	// is killed, the call would block until it exits.
+	start := time.Now()
+	r := &SystemRunner{}
+	if _, err := r.RunContext(ctx, "sh", "-c", "sleep 30 & wait"); err == nil {
+		t.Fatal("expected error from timed-out command")
+	}
+	if elapsed := time.Since(start); elapsed > killGrace {
+		t.Errorf("command outlived its context by %s", elapsed)
+	}
+}
+
+func TestRunContext_Output(t *testing.T) {
+	r := &SystemRunner{}
+	out, err := r.RunContext(context.Background(), "sh", "-c", "echo hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hi\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	rec := &Recorder{}
+	r := NonInteractive{rec}
+	_, _ = r.Run("sudo", "systemctl", "restart", "x")
+	_, _ = r.RunContext(context.Background(), "machinectl", "show", "intuneme")
+	_ = r.RunBackground("sudo", "true")
+	want := []string{"sudo -n systemctl restart x", "machinectl show intuneme", "sudo -n true &"}
+	for i, w := range want {
+		if got := rec.Steps[i].String(); got != w {
+			t.Errorf("step %d = %q, want %q", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// Snapshot methods.
+const (
+	// MethodBtrfs is a btrfs subvolume snapshot. The rootfs stays in place and
+	// restoring leaves the snapshot intact.
+	MethodBtrfs = "btrfs"
+	// MethodRename moves the rootfs itself into the snapshot directory.
+	// Restoring moves it back, consuming the snapshot.
+	MethodRename = "rename"
+)
+
+// DefaultKeep is how many snapshots recreate keeps after a successful run.
+const DefaultKeep = 2
+
+// btrfsSubvolumeInode is the inode number of every btrfs subvolume root.
+const btrfsSubvolumeInode = "256"
+
+// idLayout names snapshots by creation time so they sort chronologically.
+const idLayout = "20060102T150405Z"
+
+// Snapshot is a preserved container rootfs.
+type Snapshot struct {
+	ID      string    `toml:"-" json:"id"`
+	Path    string    `toml:"-" json:"path"`
+	Created time.Time `toml:"created" json:"created"`
+	Reason  string    `toml:"reason" json:"reason"`
+	Method  string    `toml:"method" json:"method"`
+}
+
+// Dir returns the directory snapshots of rootfs are kept in. It is a sibling
+// of the rootfs so that renames and btrfs snapshots stay on one filesystem.
+func Dir(rootfs string) string {
+	return filepath.Join(filepath.Dir(rootfs), "snapshots")
+}
+
+func metaPath(dir, id string) string {
+	return filepath.Join(dir, id+".toml")
+}
+
+// IsSubvolume reports whether path is the root of a btrfs subvolume.
+func IsSubvolume(r runner.Runner, path string) bool {
+	fsType, err := r.Run("stat", "-f", "-c", "%T", path)
+	if err != nil || strings.TrimSpace(string(fsType)) != "btrfs" {
+		return false
+	}
+	inode, err := r.Run("stat", "-c", "%i", path)
+	return err == nil && strings.TrimSpace(string(inode)) == btrfsSubvolumeInode
+}
+
+// haveBtrfs reports whether btrfs-progs is installed.
+func haveBtrfs(r runner.Runner) bool {
+	_, err := r.LookPath("btrfs")
+	return err == nil
+}
+
+// Take preserves rootfs as a new snapshot labelled with reason. A rootfs that
+// is a btrfs subvolume is snapshotted and left in place; any other rootfs is
+// renamed into the snapshot directory, so it no longer exists afterwards.
+// Callers replacing the rootfs should remove it with RemoveTree either way.
+func Take(r runner.Runner, rootfs, reason string, now time.Time) (*Snapshot, error) {
+	dir := Dir(rootfs)
+	if !exists(dir) && !runner.DryRun(r, "create directory %s", dir) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create snapshot dir: %w", err)
+		}
+	}
+
+	id := now.UTC().Format(idLayout)
+	for n := 2; exists(filepath.Join(dir, id)) || exists(metaPath(dir, id)); n++ {
+		id = fmt.Sprintf("%s-%d", now.UTC().Format(idLayout), n)
+	}
+	s := &Snapshot{
+		ID:      id,
+		Path:    filepath.Join(dir, id),
+		Created: now.UTC(),
+		Reason:  reason,
+		Method:  MethodRename,
+	}
+
+	if IsSubvolume(r, rootfs) && haveBtrfs(r) {
+		s.Method = MethodBtrfs
+		if out, err := r.Run("sudo", "btrfs", "subvolume", "snapshot", rootfs, s.Path); err != nil {
+			return nil, fmt.Errorf("btrfs snapshot failed: %w\n%s", err, out)
+		}
+	} else {
+		if out, err := r.Run("sudo", "mv", "-T", rootfs, s.Path); err != nil {
+			return nil, fmt.Errorf("move rootfs to %s failed: %w\n%s", s.Path, err, out)
+		}
+	}
+
+	if runner.DryRun(r, "write %s", metaPath(dir, s.ID)) {
+		return s, nil
+	}
+	if err := writeMeta(dir, s); err != nil {
+		// Without metadata the snapshot would be invisible to List, so put a
+		// renamed rootfs back rather than strand it.
+		if s.Method == MethodRename {
+			_, _ = r.Run("sudo", "mv", "-T", s.Path, rootfs)
+		} else {
+			_ = RemoveTree(r, s.Path)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func writeMeta(dir string, s *Snapshot) error {
+	f, err := os.Create(metaPath(dir, s.ID))
+	if err != nil {
+		return fmt.Errorf("write snapshot metadata: %w", err)
+	}
+	if err := toml.NewEncoder(f).Encode(s); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write snapshot metadata: %w", err)
+	}
+	return f.Close()
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// List returns the snapshots of rootfs, newest first. Metadata files whose
+// snapshot directory has gone missing are skipped.
+func List(rootfs string) ([]Snapshot, error) {
+	dir := Dir(rootfs)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []Snapshot
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".toml")
+		if !ok || e.IsDir() {
+			continue
+		}
+		var s Snapshot
+		if _, err := toml.DecodeFile(filepath.Join(dir, e.Name()), &s); err != nil {
+			return nil, fmt.Errorf("read snapshot %s: %w", id, err)
+		}
+		s.ID = id
+		s.Path = filepath.Join(dir, id)
+		if !exists(s.Path) {
+			continue
+		}
+		snaps = append(snaps, s)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID > snaps[j].ID })
+	return snaps, nil
+}
+
+// Find returns the snapshot with the given ID, or the newest snapshot when id
+// is empty.
+func Find(rootfs, id string) (*Snapshot, error) {
+	snaps, err := List(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	if len(snaps) == 0 {
+		return nil, fmt.Errorf("no snapshots of %s", rootfs)
+	}
+	if id == "" {
+		return &snaps[0], nil
+	}
+	for i := range snaps {
+		if snaps[i].ID == id {
+			return &snaps[i], nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %q not found — run 'intuneme snapshots list'", id)
+}
+
+// Restore puts snapshot s back at rootfs, which must not exist. A btrfs
+// snapshot is cloned into a new subvolume and kept; a renamed rootfs is
+// moved back and its snapshot entry removed.
+func Restore(r runner.Runner, s *Snapshot, rootfs string) error {
+	if exists(rootfs) {
+		return fmt.Errorf("cannot restore snapshot %s: %s still exists", s.ID, rootfs)
+	}
+	if s.Method == MethodBtrfs {
+		if out, err := r.Run("sudo", "btrfs", "subvolume", "snapshot", s.Path, rootfs); err != nil {
+			return fmt.Errorf("btrfs snapshot failed: %w\n%s", err, out)
+		}
+		return nil
+	}
+	if out, err := r.Run("sudo", "mv", "-T", s.Path, rootfs); err != nil {
+		return fmt.Errorf("move %s to rootfs failed: %w\n%s", s.Path, err, out)
+	}
+	if runner.DryRun(r, "remove %s", metaPath(filepath.Dir(s.Path), s.ID)) {
+		return nil
+	}
+	return os.Remove(metaPath(filepath.Dir(s.Path), s.ID))
+}
+
+// Delete removes snapshot s and its metadata.
+func Delete(r runner.Runner, s *Snapshot) error {
+	if err := RemoveTree(r, s.Path); err != nil {
+		return err
+	}
+	if runner.DryRun(r, "remove %s", metaPath(filepath.Dir(s.Path), s.ID)) {
+		return nil
+	}
+	if err := os.Remove(metaPath(filepath.Dir(s.Path), s.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Prune deletes all but the keep newest snapshots of rootfs and returns the
+// ones it removed.
+func Prune(r runner.Runner, rootfs string, keep int) ([]Snapshot, error) {
+	snaps, err := List(rootfs)
+	if err != nil || len(snaps) <= keep {
+		return nil, err
+	}
+	var removed []Snapshot
+	for i := range snaps[keep:] {
+		s := &snaps[keep+i]
+		if err := Delete(r, s); err != nil {
+			return removed, fmt.Errorf("delete snapshot %s: %w", s.ID, err)
+		}
+		removed = append(removed, *s)
+	}
+	return removed, nil
+}
+
+// RemoveTree deletes a rootfs or snapshot directory. rm removes btrfs
+// subvolumes too (Linux 4.18+), including nested ones systemd may have
+// created inside the container. A missing path is not an error.
+func RemoveTree(r runner.Runner, path string) error {
+	if !exists(path) {
+		return nil
+	}
+	if out, err := r.Run("sudo", "rm", "-rf", path); err != nil {
+		return fmt.Errorf("rm %s failed: %w\n%s", path, err, out)
+	}
+	return nil
+}
+
+// CreateRootfs creates an empty rootfs directory if it does not exist. On
+// btrfs it is created as a subvolume when btrfs-progs is available, so Take
+// can snapshot it later instead of renaming it.
+func CreateRootfs(r runner.Runner, path string) error {
+	if exists(path) {
+		return nil
+	}
+	if parent := filepath.Dir(path); !exists(parent) && !runner.DryRun(r, "create directory %s", parent) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("create rootfs dir: %w", err)
+		}
+	}
+	fsType, err := r.Run("stat", "-f", "-c", "%T", filepath.Dir(path))
+	if err == nil && strings.TrimSpace(string(fsType)) == "btrfs" && haveBtrfs(r) {
+		if out, err := r.Run("sudo", "btrfs", "subvolume", "create", path); err != nil {
+			return fmt.Errorf("btrfs subvolume create failed: %w\n%s", err, out)
+		}
+		return nil
+	}
+	if runner.DryRun(r, "create directory %s", path) {
+		return nil
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		return fmt.Errorf("create rootfs dir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// mockRunner records commands like runner.Recorder, without being one, so
+// the package takes its real rather than its dry-run path. It carries out mv,
+// rm and btrfs snapshot/create on the real filesystem so tests can check the
+// resulting layout.
+type mockRunner struct {
+	runner.Recorder
+	btrfs bool // stat reports btrfs and a subvolume inode
+}
+
+func (m *mockRunner) Run(name string, args ...string) ([]byte, error) {
+	_, _ = m.Recorder.Run(name, args...)
+	if name == "stat" {
+		if args[0] == "-f" {
+			if m.btrfs {
+				return []byte("btrfs\n"), nil
+			}
+			return []byte("ext2/ext3\n"), nil
+		}
+		return []byte("256\n"), nil
+	}
+	if name != "sudo" {
+		return nil, nil
+	}
+	switch args[0] {
+	case "mv":
+		return nil, os.Rename(args[2], args[3])
+	case "rm":
+		return nil, os.RemoveAll(args[2])
+	case "btrfs":
+		if args[2] == "create" {
+			return nil, os.Mkdir(args[3], 0755)
+		}
+		return nil, os.CopyFS(args[4], os.DirFS(args[3]))
+	}
+	return nil, nil
+}
+
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) LookPath(name string) (string, error) {
+	return "/usr/bin/" + name, nil
+}
+
+func (m *mockRunner) ran(prefix string) bool {
+	for _, step := range m.Steps {
+		if strings.HasPrefix(step.String(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func makeRootfs(t *testing.T, content string) string {
+	t.Helper()
+	rootfs := filepath.Join(t.TempDir(), "rootfs")
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "etc", "os-release"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return rootfs
+}
+
+func readRelease(t *testing.T, rootfs string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(rootfs, "etc", "os-release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+var t0 = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestTakeRename(t *testing.T) {
+	rootfs := makeRootfs(t, "old")
+	r := &mockRunner{}
+
+	s, err := Take(r, rootfs, "recreate", t0)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if s.Method != MethodRename || s.ID != "20260102T030405Z" {
+		t.Errorf("got method %q id %q", s.Method, s.ID)
+	}
+	if _, err := os.Stat(rootfs); !os.IsNotExist(err) {
+		t.Errorf("rootfs should have been moved, stat err = %v", err)
+	}
+	if got := readRelease(t, s.Path); got != "old" {
+		t.Errorf("snapshot content = %q", got)
+	}
+
+	snaps, err := List(rootfs)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(snaps) != 1 || snaps[0].ID != s.ID || snaps[0].Reason != "recreate" || !snaps[0].Created.Equal(t0) {
+		t.Errorf("List = %+v", snaps)
+	}
+}
+
+func TestTakeDryRun(t *testing.T) {
+	rootfs := makeRootfs(t, "old")
+	rec := &runner.Recorder{}
+
+	s, err := Take(rec, rootfs, "recreate", t0)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if got := readRelease(t, rootfs); got != "old" {
+		t.Errorf("rootfs content = %q, want it untouched", got)
+	}
+	if _, err := os.Stat(Dir(rootfs)); !os.IsNotExist(err) {
+		t.Errorf("snapshot dir should not be created, stat err = %v", err)
+	}
+	last := rec.Steps[len(rec.Steps)-1]
+	if last.Note != "write "+metaPath(Dir(rootfs), s.ID) {
+		t.Errorf("last step = %+v, want the metadata write noted", last)
+	}
+}
+
+func TestTakeBtrfs(t *testing.T) {
+	rootfs := makeRootfs(t, "old")
+	r := &mockRunner{btrfs: true}
+
+	s, err := Take(r, rootfs, "recreate", t0)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if s.Method != MethodBtrfs {
+		t.Errorf("method = %q, want btrfs", s.Method)
+	}
+	if !r.ran("sudo btrfs subvolume snapshot " + rootfs + " " + s.Path) {
+		t.Errorf("no btrfs snapshot command in %v", r.Steps)
+	}
+	if got := readRelease(t, rootfs); got != "old" {
+		t.Errorf("btrfs snapshot should leave rootfs in place, got %q", got)
+	}
+}
+
+func TestTakeSameSecond(t *testing.T) {
+	rootfs := makeRootfs(t, "a")
+	r := &mockRunner{btrfs: true}
+	a, err := Take(r, rootfs, "x", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Take(r, rootfs, "x", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == b.ID || b.ID != a.ID+"-2" {
+		t.Errorf("ids %q and %q", a.ID, b.ID)
+	}
+}
+
+func TestRestoreRename(t *testing.T) {
+	rootfs := makeRootfs(t, "old")
+	r := &mockRunner{}
+	s, err := Take(r, rootfs, "recreate", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(r, s, rootfs); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got := readRelease(t, rootfs); got != "old" {
+		t.Errorf("restored content = %q", got)
+	}
+	snaps, _ := List(rootfs)
+	if len(snaps) != 0 {
+		t.Errorf("rename snapshot should be consumed, List = %+v", snaps)
+	}
+}
+
+func TestRestoreBtrfsKeepsSnapshot(t *testing.T) {
+	rootfs := makeRootfs(t, "old")
+	r := &mockRunner{btrfs: true}
+	s, err := Take(r, rootfs, "recreate", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveTree(r, rootfs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(r, s, rootfs); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got := readRelease(t, rootfs); got != "old" {
+		t.Errorf("restored content = %q", got)
+	}
+	snaps, _ := List(rootfs)
+	if len(snaps) != 1 {
+		t.Errorf("btrfs snapshot should be kept, List = %+v", snaps)
+	}
+}
+
+func TestRestoreRefusesExistingRootfs(t *testing.T) {
+	rootfs := makeRootfs(t, "old")
+	r := &mockRunner{btrfs: true}
+	s, err := Take(r, rootfs, "recreate", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(r, s, rootfs); err == nil {
+		t.Fatal("expected error restoring over an existing rootfs")
+	}
+}
+
+func TestFindAndPrune(t *testing.T) {
+	rootfs := makeRootfs(t, "x")
+	r := &mockRunner{btrfs: true}
+	var ids []string
+	for i := range 4 {
+		s, err := Take(r, rootfs, "recreate", t0.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, s.ID)
+	}
+
+	latest, err := Find(rootfs, "")
+	if err != nil || latest.ID != ids[3] {
+		t.Fatalf("Find(\"\") = %+v, %v; want %s", latest, err, ids[3])
+	}
+	if s, err := Find(rootfs, ids[1]); err != nil || s.ID != ids[1] {
+		t.Errorf("Find(%s) = %+v, %v", ids[1], s, err)
+	}
+	if _, err := Find(rootfs, "nope"); err == nil {
+		t.Error("expected error for unknown id")
+	}
+
+	removed, err := Prune(r, rootfs, 2)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if len(removed) != 2 || removed[0].ID != ids[1] || removed[1].ID != ids[0] {
+		t.Errorf("removed = %+v", removed)
+	}
+	snaps, _ := List(rootfs)
+	if len(snaps) != 2 || snaps[0].ID != ids[3] || snaps[1].ID != ids[2] {
+		t.Errorf("remaining = %+v", snaps)
+	}
+	for _, id := range ids[:2] {
+		if _, err := os.Stat(filepath.Join(Dir(rootfs), id)); !os.IsNotExist(err) {
+			t.Errorf("snapshot %s directory still present", id)
+		}
+	}
+}
+
+func TestFindNoSnapshots(t *testing.T) {
+	if _, err := Find(filepath.Join(t.TempDir(), "rootfs"), ""); err == nil {
+		t.Fatal("expected error with no snapshots")
+	}
+}
+
+func TestCreateRootfs(t *testing.T) {
+	for _, btrfs := range []bool{false, true} {
+		t.Run(fmt.Sprintf("btrfs=%v", btrfs), func(t *testing.T) {
+			rootfs := filepath.Join(t.TempDir(), "rootfs")
+			r := &mockRunner{btrfs: btrfs}
+			if err := CreateRootfs(r, rootfs); err != nil {
+				t.Fatalf("CreateRootfs: %v", err)
+			}
+			if fi, err := os.Stat(rootfs); err != nil || !fi.IsDir() {
+				t.Fatalf("rootfs not created: %v", err)
+			}
+			if got := r.ran("sudo btrfs subvolume create"); got != btrfs {
+				t.Errorf("subvolume create ran = %v, want %v", got, btrfs)
+			}
+		})
+	}
+}
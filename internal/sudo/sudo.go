@@ -1,6 +1,7 @@
 package sudo
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -10,7 +11,7 @@ import (
 // WriteFile writes data to path via a temp file + sudo install.
 // This avoids needing root to create the temp file while still installing
 // the final file with correct ownership (root) and permissions.
-func WriteFile(r runner.Runner, path string, data []byte, perm os.FileMode) error {
+func WriteFile(ctx context.Context, r runner.Runner, path string, data []byte, perm os.FileMode) error {
 	tmp, err := os.CreateTemp("", "intuneme-*")
 	if err != nil {
 		return err
@@ -21,6 +22,6 @@ func WriteFile(r runner.Runner, path string, data []byte, perm os.FileMode) erro
 		return err
 	}
 	_ = tmp.Close()
-	_, err = r.Run("sudo", "install", "-m", fmt.Sprintf("%04o", perm), tmp.Name(), path)
+	_, err = r.RunContext(ctx, "sudo", "install", "-m", fmt.Sprintf("%04o", perm), tmp.Name(), path)
 	return err
 }
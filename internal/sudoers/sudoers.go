@@ -6,9 +6,14 @@ import (
 
 	"github.com/frostyard/intuneme/internal/nspawn"
 	"github.com/frostyard/intuneme/internal/runner"
+	"github.com/frostyard/intuneme/internal/udev"
 )
 
-const filePath = "/etc/sudoers.d/intuneme-exec"
+// rulePath returns the sudoers.d file holding the machine's intuneme-exec rule.
+// The default machine keeps the original /etc/sudoers.d/intuneme-exec path.
+func rulePath(machine string) string {
+	return "/etc/sudoers.d/" + machine + "-exec"
+}
 
 // Install writes a sudoers rule granting the user passwordless sudo for the
 // intuneme nsenter helper, so the GNOME extension can launch container apps
@@ -19,20 +24,29 @@ const filePath = "/etc/sudoers.d/intuneme-exec"
 // command arguments, so the old rule (which used "*" for the leader PID and
 // script) was rejected and broke every sudo call. The helper keeps the rule
 // wildcard-free; what the user can invoke is unchanged.
-func Install(r runner.Runner, user string) error {
+//
+// Each machine (profile) gets its own rule and helper so profiles can be
+// installed and removed independently.
+func Install(r runner.Runner, user, machine string) error {
 	// Install the helper first. It must be root-owned and not user-writable,
 	// since it runs as root before dropping to the user via su.
-	if _, err := r.Run("sudo", "install", "-d", "-m", "0755", "-o", "root", "-g", "root", nspawn.NsenterHelperDir); err != nil {
+	if _, err := r.Run("sudo", "install", "-d", "-m", "0755", "-o", "root", "-g", "root", nspawn.NsenterHelperDir(machine)); err != nil {
 		return fmt.Errorf("create helper dir: %w", err)
 	}
-	if err := installHelper(r, nspawn.NsenterHelperScript(user)); err != nil {
+	if err := installHelper(r, nspawn.NsenterHelperPath(machine), nspawn.NsenterHelperScript(user)); err != nil {
+		return err
+	}
+	if err := installHelper(r, nspawn.FreezerHelperPath(machine), nspawn.FreezerHelperScript(machine)); err != nil {
+		return err
+	}
+	if err := installHelper(r, udev.ForwardHelperPath(machine), udev.ForwardHelperScript(machine)); err != nil {
 		return err
 	}
 
 	rule := fmt.Sprintf(
-		"# Installed by intuneme: passwordless nsenter helper for container app launch.\n"+
-			"%s ALL=(root) NOPASSWD: %s\n",
-		user, nspawn.NsenterHelperPath,
+		"# Installed by intuneme: passwordless helpers for container app launch, pause/resume and device forwarding.\n"+
+			"%s ALL=(root) NOPASSWD: %s, %s, %s\n",
+		user, nspawn.NsenterHelperPath(machine), nspawn.FreezerHelperPath(machine), udev.ForwardHelperPath(machine),
 	)
 
 	tmp, err := os.CreateTemp("", "intuneme-sudoers-*")
@@ -52,15 +66,15 @@ func Install(r runner.Runner, user string) error {
 		return fmt.Errorf("sudoers syntax check failed: %w", err)
 	}
 
-	if _, err := r.Run("sudo", "install", "-m", "0440", tmp.Name(), filePath); err != nil {
+	if _, err := r.Run("sudo", "install", "-m", "0440", tmp.Name(), rulePath(machine)); err != nil {
 		return fmt.Errorf("install sudoers rule: %w", err)
 	}
 	return nil
 }
 
-// installHelper writes the helper script to NsenterHelperPath, root-owned and
-// executable (0755) so the user cannot modify the code that runs as root.
-func installHelper(r runner.Runner, script string) error {
+// installHelper writes a helper script to path, root-owned and executable
+// (0755) so the user cannot modify the code that runs as root.
+func installHelper(r runner.Runner, path, script string) error {
 	tmp, err := os.CreateTemp("", "intuneme-nsenter-helper-*")
 	if err != nil {
 		return fmt.Errorf("create temp file: %w", err)
@@ -73,27 +87,30 @@ func installHelper(r runner.Runner, script string) error {
 	}
 	_ = tmp.Close()
 
-	if _, err := r.Run("sudo", "install", "-m", "0755", "-o", "root", "-g", "root", tmp.Name(), nspawn.NsenterHelperPath); err != nil {
-		return fmt.Errorf("install nsenter helper: %w", err)
+	if _, err := r.Run("sudo", "install", "-m", "0755", "-o", "root", "-g", "root", tmp.Name(), path); err != nil {
+		return fmt.Errorf("install helper %s: %w", path, err)
 	}
 	return nil
 }
 
-// Remove deletes the sudoers rule file and the privileged helper. Intentionally
-// graceful: missing files and failed removals are not errors.
-func Remove(r runner.Runner) {
-	_, _ = r.Run("sudo", "rm", "-f", filePath, nspawn.NsenterHelperPath)
+// Remove deletes the machine's sudoers rule file and privileged helpers.
+// Intentionally graceful: missing files and failed removals are not errors.
+func Remove(r runner.Runner, machine string) {
+	_, _ = r.Run("sudo", "rm", "-f", rulePath(machine), nspawn.NsenterHelperPath(machine), nspawn.FreezerHelperPath(machine), udev.ForwardHelperPath(machine))
 }
 
-// IsInstalled reports whether both the sudoers rule and the nsenter helper
-// exist. Requiring both means an upgrade from the old wildcard-only rule counts
-// as not installed, so start self-heals by reinstalling the rule and helper.
-func IsInstalled() bool {
-	if _, err := os.Stat(filePath); err != nil {
-		return false
-	}
-	if _, err := os.Stat(nspawn.NsenterHelperPath); err != nil {
-		return false
+// IsInstalled reports whether the machine's sudoers rule and all helpers
+// exist, and whether the nsenter helper is the one user would get from Install.
+// Requiring all of them means an upgrade from an older rule (the wildcard-only
+// one, or one without the freezer or forward helper) or an older helper (one that cannot
+// enter a private_users container) counts as not installed, so start self-heals
+// by reinstalling the rule and helpers.
+func IsInstalled(user, machine string) bool {
+	for _, path := range []string{rulePath(machine), nspawn.FreezerHelperPath(machine), udev.ForwardHelperPath(machine)} {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
 	}
-	return true
+	helper, err := os.ReadFile(nspawn.NsenterHelperPath(machine))
+	return err == nil && string(helper) == nspawn.NsenterHelperScript(user)
 }
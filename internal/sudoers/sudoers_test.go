@@ -1,11 +1,14 @@
 package sudoers
 
 import (
+	"context"
+	"io"
 	"os"
 	"strings"
 	"testing"
 
 	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/udev"
 )
 
 // mockRunner records commands and captures the content installed to each
@@ -34,6 +37,21 @@ func (m *mockRunner) Run(name string, args ...string) ([]byte, error) {
 }
 
 func (m *mockRunner) RunAttached(name string, args ...string) error { return nil }
+
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mockRunner) RunBackground(name string, args ...string) error {
 	return nil
 }
@@ -50,29 +68,29 @@ func contains(s []string, v string) bool {
 
 func TestInstall_RuleHasNoWildcards(t *testing.T) {
 	r := newMockRunner()
-	if err := Install(r, "testuser"); err != nil {
+	if err := Install(r, "testuser", "intuneme"); err != nil {
 		t.Fatalf("Install failed: %v", err)
 	}
 
-	rule, ok := r.installed[filePath]
+	rule, ok := r.installed[rulePath("intuneme")]
 	if !ok {
 		t.Fatalf("sudoers rule was not installed; commands: %v", r.commands)
 	}
 	if strings.Contains(rule, "*") {
 		t.Errorf("sudoers rule must not contain wildcards (sudo-rs rejects them):\n%s", rule)
 	}
-	if !strings.Contains(rule, "testuser ALL=(root) NOPASSWD: "+nspawn.NsenterHelperPath) {
+	if !strings.Contains(rule, "testuser ALL=(root) NOPASSWD: "+nspawn.NsenterHelperPath("intuneme")) {
 		t.Errorf("sudoers rule does not reference the helper path:\n%s", rule)
 	}
 }
 
 func TestInstall_InstallsHelper(t *testing.T) {
 	r := newMockRunner()
-	if err := Install(r, "testuser"); err != nil {
+	if err := Install(r, "testuser", "intuneme"); err != nil {
 		t.Fatalf("Install failed: %v", err)
 	}
 
-	helper, ok := r.installed[nspawn.NsenterHelperPath]
+	helper, ok := r.installed[nspawn.NsenterHelperPath("intuneme")]
 	if !ok {
 		t.Fatalf("helper script was not installed; commands: %v", r.commands)
 	}
@@ -84,10 +102,10 @@ func TestInstall_InstallsHelper(t *testing.T) {
 	// directory created with the same ownership.
 	var sawHelperInstall, sawDirInstall bool
 	for _, c := range r.commands {
-		if strings.Contains(c, nspawn.NsenterHelperPath) && strings.Contains(c, "install -m 0755 -o root -g root") {
+		if strings.Contains(c, nspawn.NsenterHelperPath("intuneme")) && strings.Contains(c, "install -m 0755 -o root -g root") {
 			sawHelperInstall = true
 		}
-		if strings.Contains(c, "install -d -m 0755 -o root -g root "+nspawn.NsenterHelperDir) {
+		if strings.Contains(c, "install -d -m 0755 -o root -g root "+nspawn.NsenterHelperDir("intuneme")) {
 			sawDirInstall = true
 		}
 	}
@@ -99,9 +117,47 @@ func TestInstall_InstallsHelper(t *testing.T) {
 	}
 }
 
+func TestInstall_InstallsFreezerHelper(t *testing.T) {
+	r := newMockRunner()
+	if err := Install(r, "testuser", "intuneme"); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	helper, ok := r.installed[nspawn.FreezerHelperPath("intuneme")]
+	if !ok {
+		t.Fatalf("freezer helper was not installed; commands: %v", r.commands)
+	}
+	if helper != nspawn.FreezerHelperScript("intuneme") {
+		t.Errorf("installed freezer helper does not match FreezerHelperScript output:\n%s", helper)
+	}
+	rule := r.installed[rulePath("intuneme")]
+	if !strings.Contains(rule, ", "+nspawn.FreezerHelperPath("intuneme")+",") {
+		t.Errorf("sudoers rule does not reference the freezer helper:\n%s", rule)
+	}
+}
+
+func TestInstall_InstallsForwardHelper(t *testing.T) {
+	r := newMockRunner()
+	if err := Install(r, "testuser", "intuneme"); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	helper, ok := r.installed[udev.ForwardHelperPath("intuneme")]
+	if !ok {
+		t.Fatalf("forward helper was not installed; commands: %v", r.commands)
+	}
+	if helper != udev.ForwardHelperScript("intuneme") {
+		t.Errorf("installed forward helper does not match ForwardHelperScript output:\n%s", helper)
+	}
+	rule := r.installed[rulePath("intuneme")]
+	if !strings.Contains(rule, ", "+udev.ForwardHelperPath("intuneme")+"\n") {
+		t.Errorf("sudoers rule does not reference the forward helper:\n%s", rule)
+	}
+}
+
 func TestInstall_ValidatesBeforeInstallingRule(t *testing.T) {
 	r := newMockRunner()
-	if err := Install(r, "testuser"); err != nil {
+	if err := Install(r, "testuser", "intuneme"); err != nil {
 		t.Fatalf("Install failed: %v", err)
 	}
 
@@ -110,7 +166,7 @@ func TestInstall_ValidatesBeforeInstallingRule(t *testing.T) {
 		if strings.HasPrefix(c, "/usr/sbin/visudo -c -f") {
 			visudoIdx = i
 		}
-		if strings.Contains(c, "install -m 0440") && strings.Contains(c, filePath) {
+		if strings.Contains(c, "install -m 0440") && strings.Contains(c, rulePath("intuneme")) {
 			ruleInstallIdx = i
 		}
 	}
@@ -127,16 +183,46 @@ func TestInstall_ValidatesBeforeInstallingRule(t *testing.T) {
 
 func TestRemove_RemovesRuleAndHelper(t *testing.T) {
 	r := newMockRunner()
-	Remove(r)
+	Remove(r, "intuneme")
 
 	if len(r.commands) != 1 {
 		t.Fatalf("expected a single rm command, got: %v", r.commands)
 	}
 	cmd := r.commands[0]
-	if !strings.Contains(cmd, filePath) {
+	if !strings.Contains(cmd, rulePath("intuneme")) {
 		t.Errorf("Remove must delete the sudoers rule, got: %s", cmd)
 	}
-	if !strings.Contains(cmd, nspawn.NsenterHelperPath) {
+	if !strings.Contains(cmd, nspawn.NsenterHelperPath("intuneme")) {
 		t.Errorf("Remove must delete the nsenter helper, got: %s", cmd)
 	}
+	if !strings.Contains(cmd, nspawn.FreezerHelperPath("intuneme")) {
+		t.Errorf("Remove must delete the freezer helper, got: %s", cmd)
+	}
+	if !strings.Contains(cmd, udev.ForwardHelperPath("intuneme")) {
+		t.Errorf("Remove must delete the forward helper, got: %s", cmd)
+	}
+}
+
+func TestRulePath_DefaultMachineUnchanged(t *testing.T) {
+	if got := rulePath("intuneme"); got != "/etc/sudoers.d/intuneme-exec" {
+		t.Errorf("rulePath(intuneme) = %q, want /etc/sudoers.d/intuneme-exec", got)
+	}
+}
+
+func TestInstall_PerMachine(t *testing.T) {
+	r := newMockRunner()
+	if err := Install(r, "testuser", "intuneme-clienta"); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	rule, ok := r.installed["/etc/sudoers.d/intuneme-clienta-exec"]
+	if !ok {
+		t.Fatalf("per-machine sudoers rule was not installed; commands: %v", r.commands)
+	}
+	if !strings.Contains(rule, nspawn.NsenterHelperPath("intuneme-clienta")) {
+		t.Errorf("rule should reference the machine's helper:\n%s", rule)
+	}
+	if _, ok := r.installed[nspawn.NsenterHelperPath("intuneme-clienta")]; !ok {
+		t.Errorf("per-machine helper was not installed; commands: %v", r.commands)
+	}
 }
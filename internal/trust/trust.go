@@ -0,0 +1,200 @@
+package trust
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/nspawn"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// HostAnchorDirs hold the CAs a host administrator added to the system trust
+// store: Fedora's and Debian's. Variable so tests can point it elsewhere.
+var HostAnchorDirs = []string{"/etc/pki/ca-trust/source/anchors", "/usr/local/share/ca-certificates"}
+
+// containerDir is where imported certificates go in the container, one .crt
+// per certificate as update-ca-certificates expects. intuneme owns it.
+const containerDir = "/usr/local/share/ca-certificates/intuneme"
+
+// checksumPath records which certificates containerDir holds, so start only
+// rebuilds the trust stores when they change.
+const checksumPath = containerDir + "/checksum"
+
+// maxScript bounds the size of one script passed to the nsenter helper, well
+// under the kernel's limit for a single argument.
+const maxScript = 64 * 1024
+
+// Cert is a CA certificate to import.
+type Cert struct {
+	// Name identifies the certificate in the container: its file name
+	// without .crt, and its NSS nickname.
+	Name string
+	PEM  []byte
+}
+
+// Collect reads the certificates selected by the [trust] table. A file in
+// ca_files that cannot be read or holds no certificate is an error; files in
+// the host anchor directories that hold none, such as p11-kit's, are skipped.
+// Certificates are deduplicated and returned in a stable order.
+func Collect(t config.Trust) ([]Cert, error) {
+	var certs []Cert
+	add := func(der []byte) {
+		sum := sha256.Sum256(der)
+		name := "intuneme-" + hex.EncodeToString(sum[:8])
+		if !slices.ContainsFunc(certs, func(c Cert) bool { return c.Name == name }) {
+			certs = append(certs, Cert{Name: name, PEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})})
+		}
+	}
+
+	if t.HostAnchors {
+		for _, dir := range HostAnchorDirs {
+			_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || !d.Type().IsRegular() {
+					return nil
+				}
+				if data, err := os.ReadFile(path); err == nil {
+					for _, der := range parseCerts(data) {
+						add(der)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, path := range t.CAFiles {
+		if rest, ok := strings.CutPrefix(path, "~/"); ok && home != "" {
+			path = filepath.Join(home, rest)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("trust: %w", err)
+		}
+		ders := parseCerts(data)
+		if len(ders) == 0 {
+			return nil, fmt.Errorf("trust: %s holds no PEM or DER certificate", path)
+		}
+		for _, der := range ders {
+			add(der)
+		}
+	}
+
+	slices.SortFunc(certs, func(a, b Cert) int { return strings.Compare(a.Name, b.Name) })
+	return certs, nil
+}
+
+// parseCerts returns the DER bytes of each certificate in data, which is
+// either PEM (a single certificate or a bundle) or one DER certificate.
+func parseCerts(data []byte) [][]byte {
+	var ders [][]byte
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err == nil {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		if _, err := x509.ParseCertificate(data); err == nil {
+			ders = append(ders, data)
+		}
+	}
+	return ders
+}
+
+// checksum identifies a set of certificates.
+func checksum(certs []Cert) string {
+	if len(certs) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, c := range certs {
+		h.Write([]byte(c.Name + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sync makes certs the container's imported CAs: it replaces containerDir,
+// rebuilds the system trust store (which also updates Java's, if
+// ca-certificates-java is installed) and mirrors the set into the container
+// user's NSS database, which Edge reads. Certificates removed from the config
+// are removed from both. It does nothing when the set is unchanged.
+func Sync(ctx context.Context, r runner.Runner, machine string, uid int, certs []Cert) error {
+	sum := checksum(certs)
+	out, _ := nspawn.ExecOutput(ctx, r, machine, uid, "cat "+checksumPath+" 2>/dev/null || true")
+	if strings.TrimSpace(string(out)) == sum {
+		return nil
+	}
+
+	// System store. Written in chunks so a large bundle never exceeds the
+	// size of one helper argument.
+	scripts := []string{"sudo rm -rf " + containerDir + " && sudo mkdir -p " + containerDir + " || exit 1"}
+	for _, c := range certs {
+		line := fmt.Sprintf("printf '%%s' %s | sudo tee %s/%s.crt >/dev/null || exit 1", nspawn.ShellQuote(string(c.PEM)), containerDir, c.Name)
+		if last := len(scripts) - 1; len(scripts[last])+len(line) < maxScript {
+			scripts[last] += "\n" + line
+		} else {
+			scripts = append(scripts, line)
+		}
+	}
+	scripts = append(scripts, "sudo update-ca-certificates --fresh >/dev/null")
+	for _, script := range scripts {
+		if out, err := nspawn.ExecOutput(ctx, r, machine, uid, script); err != nil {
+			return fmt.Errorf("update container trust store: %w\n%s", err, out)
+		}
+	}
+
+	if out, err := nspawn.ExecOutput(ctx, r, machine, uid, nssScript(certs)); err != nil {
+		if strings.Contains(string(out), "certutil not found") {
+			return fmt.Errorf("certutil is not installed in the container, so Edge does not trust the imported CAs — install libnss3-tools inside it ('intuneme shell', then 'sudo apt install libnss3-tools') and restart")
+		}
+		return fmt.Errorf("update Edge's certificate database: %w\n%s", err, out)
+	}
+
+	// Recorded last, so a failed step is retried at the next start.
+	if sum != "" {
+		if out, err := nspawn.ExecOutput(ctx, r, machine, uid, fmt.Sprintf("printf '%%s\\n' %s | sudo tee %s >/dev/null", sum, checksumPath)); err != nil {
+			return fmt.Errorf("record imported certificates: %w\n%s", err, out)
+		}
+	}
+	return nil
+}
+
+// nssScript returns the script that makes the certificates in containerDir
+// trusted CAs in the user's NSS database, dropping ones intuneme added
+// before that are no longer configured. It runs as the container user.
+func nssScript(certs []Cert) string {
+	names := make([]string, len(certs))
+	for i, c := range certs {
+		names[i] = c.Name
+	}
+	list := strings.Join(names, " ")
+	return fmt.Sprintf(`command -v certutil >/dev/null || { echo "certutil not found"; exit 2; }
+db="sql:$HOME/.pki/nssdb"
+mkdir -p "$HOME/.pki/nssdb"
+[ -f "$HOME/.pki/nssdb/cert9.db" ] || certutil -N -d "$db" --empty-password || exit 1
+for n in $(certutil -L -d "$db" | awk '$1 ~ /^intuneme-/ { print $1 }'); do
+    case " %[1]s " in *" $n "*) ;; *) certutil -D -d "$db" -n "$n" ;; esac
+done
+for n in %[1]s; do
+    certutil -A -d "$db" -n "$n" -t C,, -i "%[2]s/$n.crt" || exit 1
+done`, list, containerDir)
+}
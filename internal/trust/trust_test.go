@@ -0,0 +1,134 @@
+package trust
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// newCert returns a self-signed CA certificate in DER form.
+func newCert(t *testing.T, cn string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func pemOf(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	anchors := filepath.Join(dir, "anchors")
+	if err := os.MkdirAll(anchors, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := HostAnchorDirs
+	HostAnchorDirs = []string{anchors, filepath.Join(dir, "missing")}
+	t.Cleanup(func() { HostAnchorDirs = old })
+
+	root, proxy, issuing := newCert(t, "Corp Root"), newCert(t, "Corp Proxy"), newCert(t, "Corp Issuing")
+	files := map[string][]byte{
+		filepath.Join(anchors, "root.pem"):  pemOf(root),
+		filepath.Join(anchors, "notes.txt"): []byte("not a certificate"),
+		filepath.Join(dir, "bundle.pem"):    append(pemOf(proxy), pemOf(root)...),
+		filepath.Join(dir, "issuing.der"):   issuing,
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	certs, err := Collect(config.Trust{HostAnchors: true, CAFiles: []string{filepath.Join(dir, "bundle.pem"), filepath.Join(dir, "issuing.der")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root appears twice but is imported once.
+	if len(certs) != 3 {
+		t.Fatalf("Collect returned %d certificates, want 3", len(certs))
+	}
+	for i, c := range certs {
+		if !strings.HasPrefix(c.Name, "intuneme-") || !strings.HasPrefix(string(c.PEM), "-----BEGIN CERTIFICATE-----") {
+			t.Errorf("unexpected certificate %q", c.Name)
+		}
+		if i > 0 && certs[i-1].Name >= c.Name {
+			t.Errorf("certificates not sorted: %q before %q", certs[i-1].Name, c.Name)
+		}
+	}
+
+	if _, err := Collect(config.Trust{CAFiles: []string{filepath.Join(anchors, "notes.txt")}}); err == nil {
+		t.Error("expected an error for a ca_files entry without certificates")
+	}
+	if _, err := Collect(config.Trust{CAFiles: []string{filepath.Join(dir, "nope.pem")}}); err == nil {
+		t.Error("expected an error for a missing ca_files entry")
+	}
+}
+
+func TestSync(t *testing.T) {
+	certs := []Cert{{Name: "intuneme-0011223344556677", PEM: pemOf(newCert(t, "Corp Root"))}}
+	r := &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+	if err := Sync(context.Background(), r, "intuneme", 1000, certs); err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, step := range r.Steps {
+		commands = append(commands, strings.Join(step.Args, " "))
+	}
+	all := strings.Join(commands, "\n")
+	for _, want := range []string{
+		"sudo tee " + containerDir + "/intuneme-0011223344556677.crt",
+		"sudo update-ca-certificates --fresh",
+		"certutil -A -d \"$db\" -n \"$n\" -t C,,",
+		"case \" intuneme-0011223344556677 \" in",
+		"sudo tee " + checksumPath,
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing %q in:\n%s", want, all)
+		}
+	}
+}
+
+func TestSync_Unchanged(t *testing.T) {
+	certs := []Cert{{Name: "intuneme-0011223344556677"}}
+	r := &runner.Recorder{}
+	r.Answer("machinectl show intuneme -p Leader", runner.Reply{Output: "4321\n"})
+	r.Answer("sudo /usr/local/libexec/intuneme/nsenter-exec", runner.Reply{Output: checksum(certs) + "\n"})
+	if err := Sync(context.Background(), r, "intuneme", 1000, certs); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range r.Steps {
+		if c := strings.Join(step.Args, " "); strings.Contains(c, "update-ca-certificates") {
+			t.Errorf("unchanged certificates should not rebuild the trust store: %s", c)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package udev
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"os"
@@ -14,12 +15,8 @@ import (
 )
 
 const (
-	RulesFile      = "70-intuneme-yubikey.rules"
-	VideoRulesFile = "70-intuneme-video.rules"
-	RulesDir       = "/etc/udev/rules.d"
-	ScriptDir      = "/usr/local/lib/intuneme"
-	ScriptName     = "usb-hotplug"
-	StateDir       = "/run/intuneme/devices"
+	RulesDir   = "/etc/udev/rules.d"
+	ScriptName = "usb-hotplug"
 
 	YubicoVendorID = "1050"
 )
@@ -33,8 +30,18 @@ var videoRulesTemplate string
 //go:embed usb-hotplug.sh.tmpl
 var scriptTemplate string
 
+// render fills the per-machine placeholders shared by the script and rule
+// templates.
+func render(tmpl, machine string) string {
+	return strings.NewReplacer(
+		"{{.Machine}}", machine,
+		"{{.Script}}", ScriptPath(machine),
+		"{{.StateDir}}", StateDir(machine),
+	).Replace(tmpl)
+}
+
 func scriptContent(machine string) string {
-	return strings.ReplaceAll(scriptTemplate, "{{.Machine}}", machine)
+	return render(scriptTemplate, machine)
 }
 
 // YubikeyDevice represents a detected Yubico USB security key.
@@ -56,83 +63,98 @@ func (y YubikeyDevice) Devices() []string {
 	return devs
 }
 
-// RulesPath returns the full path to the udev rules file.
-func RulesPath() string {
-	return filepath.Join(RulesDir, RulesFile)
+// All host-side hotplug artifacts are keyed by machine name so that several
+// profiles can run side by side without sharing rules, scripts or state. The
+// default "intuneme" machine maps to the original single-container paths.
+
+// RulesPath returns the full path to the machine's YubiKey udev rules file.
+func RulesPath(machine string) string {
+	return filepath.Join(RulesDir, "70-"+machine+"-yubikey.rules")
+}
+
+// VideoRulesPath returns the full path to the machine's video udev rules file.
+func VideoRulesPath(machine string) string {
+	return filepath.Join(RulesDir, "70-"+machine+"-video.rules")
+}
+
+// ScriptDir returns the directory holding the machine's helper script.
+func ScriptDir(machine string) string {
+	return filepath.Join("/usr/local/lib", machine)
 }
 
-// VideoRulesPath returns the full path to the video udev rules file.
-func VideoRulesPath() string {
-	return filepath.Join(RulesDir, VideoRulesFile)
+// ScriptPath returns the full path to the machine's helper script.
+func ScriptPath(machine string) string {
+	return filepath.Join(ScriptDir(machine), ScriptName)
 }
 
-// ScriptPath returns the full path to the helper script.
-func ScriptPath() string {
-	return filepath.Join(ScriptDir, ScriptName)
+// StateDir returns the directory recording devices forwarded to the machine.
+func StateDir(machine string) string {
+	return filepath.Join("/run", machine, "devices")
 }
 
 // Install writes the udev rule file and helper script, then reloads udev.
-func Install(r runner.Runner, machineName string) error {
+func Install(ctx context.Context, r runner.Runner, machineName string) error {
 	// Create script directory.
-	if _, err := r.Run("sudo", "mkdir", "-p", ScriptDir); err != nil {
+	if _, err := r.RunContext(ctx, "sudo", "mkdir", "-p", ScriptDir(machineName)); err != nil {
 		return fmt.Errorf("create script dir: %w", err)
 	}
 
 	// Write helper script.
-	if err := sudo.WriteFile(r, ScriptPath(), []byte(scriptContent(machineName)), 0755); err != nil {
+	if err := sudo.WriteFile(ctx, r, ScriptPath(machineName), []byte(scriptContent(machineName)), 0755); err != nil {
 		return fmt.Errorf("install helper script: %w", err)
 	}
 
 	// Write udev rules.
-	if err := sudo.WriteFile(r, RulesPath(), []byte(rulesTemplate), 0644); err != nil {
+	if err := sudo.WriteFile(ctx, r, RulesPath(machineName), []byte(render(rulesTemplate, machineName)), 0644); err != nil {
 		return fmt.Errorf("install yubikey udev rule: %w", err)
 	}
-	if err := sudo.WriteFile(r, VideoRulesPath(), []byte(videoRulesTemplate), 0644); err != nil {
+	if err := sudo.WriteFile(ctx, r, VideoRulesPath(machineName), []byte(render(videoRulesTemplate, machineName)), 0644); err != nil {
 		return fmt.Errorf("install video udev rule: %w", err)
 	}
 
 	// Reload udev rules.
-	if _, err := r.Run("sudo", "udevadm", "control", "--reload-rules"); err != nil {
+	if _, err := r.RunContext(ctx, "sudo", "udevadm", "control", "--reload-rules"); err != nil {
 		return fmt.Errorf("reload udev rules: %w", err)
 	}
 
 	return nil
 }
 
-// Remove deletes the udev rule file, helper script, and state directory.
-// It is intentionally graceful: missing files and failed reloads are not errors.
-func Remove(r runner.Runner) error {
-	yubikeyRulesExisted := fileExists(RulesPath())
-	videoRulesExisted := fileExists(VideoRulesPath())
-	scriptExisted := fileExists(ScriptPath())
+// Remove deletes the machine's udev rule files, helper script, and state
+// directory. It is intentionally graceful: missing files and failed reloads are
+// not errors. Other machines' hotplug artifacts are left untouched.
+func Remove(ctx context.Context, r runner.Runner, machine string) error {
+	yubikeyRulesExisted := fileExists(RulesPath(machine))
+	videoRulesExisted := fileExists(VideoRulesPath(machine))
+	scriptExisted := fileExists(ScriptPath(machine))
 
 	if yubikeyRulesExisted {
-		_, _ = r.Run("sudo", "rm", "-f", RulesPath())
+		_, _ = r.RunContext(ctx, "sudo", "rm", "-f", RulesPath(machine))
 	}
 	if videoRulesExisted {
-		_, _ = r.Run("sudo", "rm", "-f", VideoRulesPath())
+		_, _ = r.RunContext(ctx, "sudo", "rm", "-f", VideoRulesPath(machine))
 	}
 	if scriptExisted {
-		_, _ = r.Run("sudo", "rm", "-f", ScriptPath())
+		_, _ = r.RunContext(ctx, "sudo", "rm", "-f", ScriptPath(machine))
 	}
 
 	// Clean up empty script directory (ignore errors — may not be empty).
-	_, _ = r.Run("sudo", "rmdir", ScriptDir)
+	_, _ = r.RunContext(ctx, "sudo", "rmdir", ScriptDir(machine))
 
 	// Clean up state directory.
-	_, _ = r.Run("sudo", "rm", "-rf", StateDir)
+	_, _ = r.RunContext(ctx, "sudo", "rm", "-rf", StateDir(machine))
 
 	// Reload udev rules if we removed any rule file.
 	if yubikeyRulesExisted || videoRulesExisted {
-		_, _ = r.Run("sudo", "udevadm", "control", "--reload-rules")
+		_, _ = r.RunContext(ctx, "sudo", "udevadm", "control", "--reload-rules")
 	}
 
 	return nil
 }
 
-// IsInstalled reports whether any udev rules files are installed.
-func IsInstalled() bool {
-	return fileExists(RulesPath()) || fileExists(VideoRulesPath())
+// IsInstalled reports whether any of the machine's udev rules files are installed.
+func IsInstalled(machine string) bool {
+	return fileExists(RulesPath(machine)) || fileExists(VideoRulesPath(machine))
 }
 
 func fileExists(path string) bool {
@@ -229,20 +251,76 @@ func findHIDRawDevices(usbDevDir string) []string {
 	return devices
 }
 
+// ForwardHelperPath returns the fixed, root-owned helper that forwards one
+// device to the running machine. Like the freezer helper it is authorized by
+// the machine's sudoers rule, so the agent can re-forward devices after a
+// resume without a password prompt.
+func ForwardHelperPath(machine string) string {
+	return nspawn.NsenterHelperDir(machine) + "/forward-device"
+}
+
+// ForwardHelperScript renders the forward helper for a machine. The only
+// runtime input is the device node ($1), which must be one the udev rules
+// would forward themselves: a Yubico USB device or hidraw interface, or a
+// video or media device. The forwarding is left to the hotplug script.
+func ForwardHelperScript(machine string) string {
+	return fmt.Sprintf(`#!/bin/bash
+# Installed by intuneme. Forwards a YubiKey, camera or media device to the %s
+# container with the udev hotplug script. Invoked through passwordless sudo
+# (the intuneme-exec sudoers rule).
+set -euo pipefail
+dev="${1:-}"
+case "$dev" in
+/dev/video[0-9]* | /dev/media[0-9]*) yubikey=false ;;
+/dev/hidraw[0-9]* | /dev/bus/usb/[0-9][0-9][0-9]/[0-9][0-9][0-9]) yubikey=true ;;
+*)
+	echo "usage: $0 /dev/hidrawN|/dev/bus/usb/BBB/DDD|/dev/videoN|/dev/mediaN" >&2
+	exit 2
+	;;
+esac
+if [[ ! "${dev#/dev/}" =~ ^(video|media|hidraw)[0-9]+$|^bus/usb/[0-9]{3}/[0-9]{3}$ ]] || [ ! -c "$dev" ]; then
+	echo "$dev is not a character device intuneme forwards" >&2
+	exit 2
+fi
+if $yubikey; then
+	vendor=$(/usr/bin/udevadm info -a -n "$dev" | grep -m1 -oE 'ATTRS?\{idVendor\}=="[0-9a-f]+"' || true)
+	if [ "${vendor#*==}" != '"%s"' ]; then
+		echo "$dev is not a Yubico device" >&2
+		exit 2
+	fi
+fi
+if [ ! -x %s ]; then
+	echo "the udev hotplug rules are not installed; run 'intuneme udev install'" >&2
+	exit 1
+fi
+exec %s add "$dev"
+`, machine, YubicoVendorID, ScriptPath(machine), ScriptPath(machine))
+}
+
+// ForwardDeviceHelper forwards devnode to the running container through the
+// passwordless forward helper, for callers without a terminal to prompt on.
+// Unlike ForwardDevice it needs the hotplug script from Install.
+func ForwardDeviceHelper(ctx context.Context, r runner.Runner, machine, devnode string) error {
+	if out, err := r.RunContext(ctx, "sudo", ForwardHelperPath(machine), devnode); err != nil {
+		return fmt.Errorf("forward %s: %w\n%s", devnode, err, out)
+	}
+	return nil
+}
+
 // ForwardDevice creates a device node inside the running container using nsenter.
 // For hidraw devices, it also adjusts the cgroup device allow list.
-func ForwardDevice(r runner.Runner, machine, devnode string) error {
-	pid, err := nspawn.LeaderPID(r, machine)
+func ForwardDevice(ctx context.Context, r runner.Runner, machine, devnode string) error {
+	pid, err := nspawn.LeaderPID(ctx, r, machine)
 	if err != nil {
 		return err
 	}
-	unit, err := nspawn.MachineUnit(r, machine)
+	unit, err := nspawn.MachineUnit(ctx, r, machine)
 	if err != nil {
 		return err
 	}
 
 	// Get major:minor of the device.
-	out, err := r.Run("stat", "-c", "0x%t 0x%T", devnode)
+	out, err := r.RunContext(ctx, "stat", "-c", "0x%t 0x%T", devnode)
 	if err != nil {
 		return fmt.Errorf("stat %s: %w", devnode, err)
 	}
@@ -254,7 +332,7 @@ func ForwardDevice(r runner.Runner, machine, devnode string) error {
 
 	// Allow the device in the container's cgroup. DevicePolicy=auto preserves
 	// the existing nspawn device policy and adds our device on top.
-	if _, err := r.Run("sudo", "systemctl", "set-property",
+	if _, err := r.RunContext(ctx, "sudo", "systemctl", "set-property",
 		unit,
 		"DevicePolicy=auto",
 		fmt.Sprintf("DeviceAllow=%s rwm", devnode)); err != nil {
@@ -263,40 +341,68 @@ func ForwardDevice(r runner.Runner, machine, devnode string) error {
 
 	// Create the device node inside the container.
 	dir := filepath.Dir(devnode)
-	_, _ = r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+	_, _ = r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 		"mkdir", "-p", dir)
-	_, _ = r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+	_, _ = r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 		"rm", "-f", devnode)
-	if _, err := r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+	if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 		"mknod", devnode, "c", major, minor); err != nil {
 		return fmt.Errorf("mknod %s: %w", devnode, err)
 	}
 	// Use restrictive permissions for video/media devices (0660 root:video)
 	// matching the typical host access model. Other devices use 0666.
 	if isVideoDevice(devnode) {
-		if _, err := r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+		if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 			"chgrp", "video", devnode); err != nil {
 			return fmt.Errorf("chgrp %s: %w", devnode, err)
 		}
-		if _, err := r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+		if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 			"chmod", "0660", devnode); err != nil {
 			return fmt.Errorf("chmod %s: %w", devnode, err)
 		}
 	} else {
-		if _, err := r.Run("sudo", "nsenter", "-t", pid, "-m", "--",
+		if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
 			"chmod", "0666", devnode); err != nil {
 			return fmt.Errorf("chmod %s: %w", devnode, err)
 		}
 	}
+	if err := shiftOwner(ctx, r, machine, pid, devnode); err != nil {
+		return err
+	}
 
 	// Record in state directory.
-	_, _ = r.Run("sudo", "mkdir", "-p", StateDir)
-	stateFile := filepath.Join(StateDir, strings.ReplaceAll(devnode, "/", "_"))
-	_ = sudo.WriteFile(r, stateFile, []byte(devnode+"\n"), 0644)
+	_, _ = r.RunContext(ctx, "sudo", "mkdir", "-p", StateDir(machine))
+	stateFile := filepath.Join(StateDir(machine), strings.ReplaceAll(devnode, "/", "_"))
+	_ = sudo.WriteFile(ctx, r, stateFile, []byte(devnode+"\n"), 0644)
 
 	return nil
 }
 
+// shiftOwner moves devnode's owner and group into the container's ID range
+// when it runs with private_users. Created from the host, the node belongs to
+// host root, which the container's user namespace does not map, so neither
+// root nor the video group inside could use it.
+func shiftOwner(ctx context.Context, r runner.Runner, machine, pid, devnode string) error {
+	shift, err := nspawn.UIDShift(ctx, r, machine)
+	if err != nil || shift == 0 {
+		return err
+	}
+	out, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
+		"stat", "-c", "%u %g", devnode)
+	if err != nil {
+		return fmt.Errorf("stat %s in container: %w", devnode, err)
+	}
+	var uid, gid int
+	if _, err := fmt.Sscan(string(out), &uid, &gid); err != nil {
+		return fmt.Errorf("unexpected stat output for %s: %q", devnode, string(out))
+	}
+	if _, err := r.RunContext(ctx, "sudo", "nsenter", "-t", pid, "-m", "--",
+		"chown", fmt.Sprintf("%d:%d", shift+uid, shift+gid), devnode); err != nil {
+		return fmt.Errorf("chown %s: %w", devnode, err)
+	}
+	return nil
+}
+
 // isVideoDevice reports whether the device path is a video or media controller device.
 func isVideoDevice(devnode string) bool {
 	base := filepath.Base(devnode)
@@ -336,14 +442,14 @@ func readVideoSysfsName(devPath string) string {
 	return strings.TrimSpace(string(data))
 }
 
-// RulesContent returns the YubiKey udev rules content (for testing).
-func RulesContent() string {
-	return rulesTemplate
+// RulesContent returns the YubiKey udev rules content for the given machine (for testing).
+func RulesContent(machine string) string {
+	return render(rulesTemplate, machine)
 }
 
-// VideoRulesContent returns the video udev rules content (for testing).
-func VideoRulesContent() string {
-	return videoRulesTemplate
+// VideoRulesContent returns the video udev rules content for the given machine (for testing).
+func VideoRulesContent(machine string) string {
+	return render(videoRulesTemplate, machine)
 }
 
 // ScriptContent returns the helper script content for the given machine name (for testing).
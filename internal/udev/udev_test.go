@@ -1,7 +1,11 @@
 package udev
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os/exec"
 	"strings"
 	"testing"
 )
@@ -41,6 +45,20 @@ func (m *mockRunner) RunAttached(name string, args ...string) error {
 	return nil
 }
 
+func (m *mockRunner) RunContext(_ context.Context, name string, args ...string) ([]byte, error) {
+	return m.Run(name, args...)
+}
+
+func (m *mockRunner) RunAttachedContext(_ context.Context, name string, args ...string) error {
+	return m.RunAttached(name, args...)
+}
+
+func (m *mockRunner) RunStream(_ context.Context, w io.Writer, name string, args ...string) error {
+	out, err := m.Run(name, args...)
+	_, _ = w.Write(out)
+	return err
+}
+
 func (m *mockRunner) RunBackground(name string, args ...string) error {
 	m.commands = append(m.commands, name+" "+strings.Join(args, " "))
 	return nil
@@ -60,12 +78,12 @@ func (m *mockRunner) hasCommand(prefix string) bool {
 }
 
 func TestRulesContent(t *testing.T) {
-	content := RulesContent()
+	content := RulesContent("intuneme")
 
 	checks := []string{
 		`ATTR{idVendor}=="1050"`,
 		`ENV{ID_VENDOR_ID}=="1050"`,
-		ScriptDir + "/" + ScriptName,
+		"/usr/local/lib/intuneme/" + ScriptName,
 		`SUBSYSTEM=="usb"`,
 		`SUBSYSTEM=="hidraw"`,
 		`ACTION=="add"`,
@@ -93,8 +111,11 @@ func TestScriptContent(t *testing.T) {
 	if !strings.Contains(content, "mknod") {
 		t.Error("script content missing mknod")
 	}
-	if !strings.Contains(content, StateDir) {
-		t.Errorf("script content missing state dir %s", StateDir)
+	if !strings.Contains(content, `systemctl set-property "$UNIT"`) {
+		t.Error("script content should set properties on the machine's backing unit")
+	}
+	if !strings.Contains(content, StateDir("testmachine")) {
+		t.Errorf("script content missing state dir %s", StateDir("testmachine"))
 	}
 	// Video/media devices should get restrictive permissions.
 	if !strings.Contains(content, "chgrp video") {
@@ -103,6 +124,10 @@ func TestScriptContent(t *testing.T) {
 	if !strings.Contains(content, "chmod 0660") {
 		t.Error("script content missing chmod 0660 for video devices")
 	}
+	// Nodes in a private_users container are chowned into its ID range.
+	if !strings.Contains(content, `/proc/$LEADER/uid_map`) {
+		t.Error("script content should shift ownership for user-namespaced containers")
+	}
 }
 
 func TestScriptContentDifferentMachines(t *testing.T) {
@@ -122,13 +147,13 @@ func TestScriptContentDifferentMachines(t *testing.T) {
 
 func TestInstall(t *testing.T) {
 	r := newMockRunner()
-	err := Install(r, "intuneme")
+	err := Install(context.Background(), r, "intuneme")
 	if err != nil {
 		t.Fatalf("Install failed: %v", err)
 	}
 
 	// Verify script dir creation.
-	if !r.hasCommand("sudo mkdir -p " + ScriptDir) {
+	if !r.hasCommand("sudo mkdir -p " + ScriptDir("intuneme")) {
 		t.Error("missing mkdir for script dir")
 	}
 
@@ -153,7 +178,7 @@ func TestInstallError(t *testing.T) {
 	r := newMockRunner()
 	r.errors["sudo mkdir"] = fmt.Errorf("permission denied")
 
-	err := Install(r, "intuneme")
+	err := Install(context.Background(), r, "intuneme")
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -165,21 +190,21 @@ func TestInstallError(t *testing.T) {
 func TestRemoveGraceful(t *testing.T) {
 	// Remove should succeed even when called multiple times or on a clean system.
 	r := newMockRunner()
-	err := Remove(r)
+	err := Remove(context.Background(), r, "intuneme")
 	if err != nil {
 		t.Fatalf("Remove failed: %v", err)
 	}
 
 	// A second remove should also succeed (idempotent).
 	r2 := newMockRunner()
-	err = Remove(r2)
+	err = Remove(context.Background(), r2, "intuneme")
 	if err != nil {
 		t.Fatalf("second Remove failed: %v", err)
 	}
 }
 
 func TestRulesPath(t *testing.T) {
-	got := RulesPath()
+	got := RulesPath("intuneme")
 	want := "/etc/udev/rules.d/70-intuneme-yubikey.rules"
 	if got != want {
 		t.Errorf("RulesPath() = %q, want %q", got, want)
@@ -187,7 +212,7 @@ func TestRulesPath(t *testing.T) {
 }
 
 func TestVideoRulesPath(t *testing.T) {
-	got := VideoRulesPath()
+	got := VideoRulesPath("intuneme")
 	want := "/etc/udev/rules.d/70-intuneme-video.rules"
 	if got != want {
 		t.Errorf("VideoRulesPath() = %q, want %q", got, want)
@@ -195,10 +220,10 @@ func TestVideoRulesPath(t *testing.T) {
 }
 
 func TestVideoRulesContent(t *testing.T) {
-	content := VideoRulesContent()
+	content := VideoRulesContent("intuneme")
 
 	checks := []string{
-		ScriptDir + "/" + ScriptName,
+		"/usr/local/lib/intuneme/" + ScriptName,
 		`SUBSYSTEM=="video4linux"`,
 		`SUBSYSTEM=="media"`,
 		`KERNEL=="video*"`,
@@ -215,20 +240,52 @@ func TestVideoRulesContent(t *testing.T) {
 }
 
 func TestScriptPath(t *testing.T) {
-	got := ScriptPath()
+	got := ScriptPath("intuneme")
 	want := "/usr/local/lib/intuneme/usb-hotplug"
 	if got != want {
 		t.Errorf("ScriptPath() = %q, want %q", got, want)
 	}
 }
 
+func TestStateDir(t *testing.T) {
+	if got := StateDir("intuneme"); got != "/run/intuneme/devices" {
+		t.Errorf("StateDir(intuneme) = %q, want /run/intuneme/devices", got)
+	}
+}
+
+func TestPathsPerMachine(t *testing.T) {
+	if RulesPath("intuneme-clienta") != "/etc/udev/rules.d/70-intuneme-clienta-yubikey.rules" {
+		t.Errorf("unexpected RulesPath: %s", RulesPath("intuneme-clienta"))
+	}
+	if VideoRulesPath("intuneme-clienta") != "/etc/udev/rules.d/70-intuneme-clienta-video.rules" {
+		t.Errorf("unexpected VideoRulesPath: %s", VideoRulesPath("intuneme-clienta"))
+	}
+	if ScriptPath("intuneme-clienta") != "/usr/local/lib/intuneme-clienta/usb-hotplug" {
+		t.Errorf("unexpected ScriptPath: %s", ScriptPath("intuneme-clienta"))
+	}
+
+	// Rules must invoke the machine's own script so two profiles don't share
+	// one hotplug handler.
+	rules := RulesContent("intuneme-clienta")
+	if !strings.Contains(rules, ScriptPath("intuneme-clienta")+" add") {
+		t.Errorf("rules do not reference per-machine script:\n%s", rules)
+	}
+	if strings.Contains(rules, "{{") {
+		t.Errorf("rules contain unrendered placeholders:\n%s", rules)
+	}
+	script := ScriptContent("intuneme-clienta")
+	if !strings.Contains(script, `STATE_DIR="/run/intuneme-clienta/devices"`) {
+		t.Errorf("script does not use per-machine state dir")
+	}
+}
+
 func TestForwardDevice(t *testing.T) {
 	r := newMockRunner()
 	r.outputs["machinectl show intuneme -p Leader --value"] = "12345"
 	r.outputs["machinectl show intuneme -p Unit --value"] = "intuneme.scope"
 	r.outputs["stat -c"] = "0xbd 0x9"
 
-	err := ForwardDevice(r, "intuneme", "/dev/bus/usb/003/009")
+	err := ForwardDevice(context.Background(), r, "intuneme", "/dev/bus/usb/003/009")
 	if err != nil {
 		t.Fatalf("ForwardDevice failed: %v", err)
 	}
@@ -250,7 +307,7 @@ func TestForwardDeviceHidraw(t *testing.T) {
 	r.outputs["machinectl show intuneme -p Unit --value"] = "intuneme.scope"
 	r.outputs["stat -c"] = "0xa 0x3"
 
-	err := ForwardDevice(r, "intuneme", "/dev/hidraw3")
+	err := ForwardDevice(context.Background(), r, "intuneme", "/dev/hidraw3")
 	if err != nil {
 		t.Fatalf("ForwardDevice failed: %v", err)
 	}
@@ -265,7 +322,7 @@ func TestForwardDeviceContainerNotRunning(t *testing.T) {
 	r := newMockRunner()
 	r.errors["machinectl show"] = fmt.Errorf("machine not found")
 
-	err := ForwardDevice(r, "intuneme", "/dev/bus/usb/003/009")
+	err := ForwardDevice(context.Background(), r, "intuneme", "/dev/bus/usb/003/009")
 	if err == nil {
 		t.Fatal("expected error when container not running")
 	}
@@ -277,7 +334,7 @@ func TestForwardDeviceVideoPermissions(t *testing.T) {
 	r.outputs["machinectl show intuneme -p Unit --value"] = "intuneme.scope"
 	r.outputs["stat -c"] = "0x51 0x0"
 
-	err := ForwardDevice(r, "intuneme", "/dev/video0")
+	err := ForwardDevice(context.Background(), r, "intuneme", "/dev/video0")
 	if err != nil {
 		t.Fatalf("ForwardDevice failed: %v", err)
 	}
@@ -301,7 +358,7 @@ func TestForwardDeviceMediaPermissions(t *testing.T) {
 	r.outputs["machinectl show intuneme -p Unit --value"] = "intuneme.scope"
 	r.outputs["stat -c"] = "0x51 0x1"
 
-	err := ForwardDevice(r, "intuneme", "/dev/media0")
+	err := ForwardDevice(context.Background(), r, "intuneme", "/dev/media0")
 	if err != nil {
 		t.Fatalf("ForwardDevice failed: %v", err)
 	}
@@ -366,3 +423,48 @@ func TestYubikeyDeviceDevices(t *testing.T) {
 		t.Errorf("first device should be USB, got %s", got[0])
 	}
 }
+
+func TestForwardDeviceUserNamespace(t *testing.T) {
+	r := newMockRunner()
+	r.outputs["machinectl show intuneme -p Leader --value"] = "12345"
+	r.outputs["machinectl show intuneme -p Unit --value"] = "intuneme.scope"
+	r.outputs["cat /proc/12345/uid_map"] = "0 1878523904 65536\n"
+	r.outputs["stat -c"] = "0x51 0x0"
+	r.outputs["sudo nsenter -t 12345 -m -- stat -c"] = "0 44\n"
+
+	if err := ForwardDevice(context.Background(), r, "intuneme", "/dev/video0"); err != nil {
+		t.Fatalf("ForwardDevice failed: %v", err)
+	}
+	// root:video inside the container are the shifted host IDs.
+	if !r.hasCommand("sudo nsenter -t 12345 -m -- chown 1878523904:1878523948 /dev/video0") {
+		t.Errorf("missing shifted chown, got %v", r.commands)
+	}
+}
+
+func TestForwardHelperScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	script := ForwardHelperScript("intuneme-work")
+	if !strings.Contains(script, "exec "+ScriptPath("intuneme-work")+` add "$dev"`) {
+		t.Errorf("helper does not hand off to the machine's hotplug script:\n%s", script)
+	}
+	// Only the devices the udev rules forward are accepted.
+	for _, dev := range []string{"", "/dev/mem", "/dev/sda", "/dev/video0/../../mem", "/dev/hidraw0;id", "/dev/bus/usb/1/2"} {
+		out, err := exec.Command("bash", "-c", script, "forward-device", dev).CombinedOutput()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+			t.Errorf("helper accepted %q: %v\n%s", dev, err, out)
+		}
+	}
+}
+
+func TestForwardDeviceHelper(t *testing.T) {
+	r := newMockRunner()
+	if err := ForwardDeviceHelper(context.Background(), r, "intuneme", "/dev/hidraw3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.commands) != 1 || r.commands[0] != "sudo "+ForwardHelperPath("intuneme")+" /dev/hidraw3" {
+		t.Errorf("commands = %v", r.commands)
+	}
+}
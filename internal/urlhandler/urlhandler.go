@@ -0,0 +1,175 @@
+package urlhandler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frostyard/intuneme/internal/apps"
+	"github.com/frostyard/intuneme/internal/config"
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+// Schemes are the URL schemes the handler registers for.
+var Schemes = []string{"x-scheme-handler/http", "x-scheme-handler/https"}
+
+// DesktopID returns the desktop entry name of the profile's URL handler.
+func DesktopID(profile string) string {
+	if profile == "" || profile == config.DefaultProfile {
+		return "intuneme-url.desktop"
+	}
+	return "intuneme-" + profile + "-url.desktop"
+}
+
+// DesktopFilePath returns where the profile's URL handler is installed.
+func DesktopFilePath(profile string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "applications", DesktopID(profile)), nil
+}
+
+// Installed reports whether the profile's URL handler is installed.
+func Installed(profile string) bool {
+	path, err := DesktopFilePath(profile)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// DesktopFileContent renders the desktop entry that hands clicked links to
+// `intuneme open url --route`. NoDisplay keeps it out of application menus;
+// it only shows up in the desktop's default browser settings.
+func DesktopFileContent(execPath, profile string) string {
+	exec := apps.ExecArg(execPath)
+	if profile != "" && profile != config.DefaultProfile {
+		exec += " --profile " + profile
+	}
+	return fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=Microsoft Edge (intuneme)
+Comment=Open corporate links in the container's Edge and other links in the host browser
+Exec=%s open url --route %%u
+Icon=microsoft-edge
+Terminal=false
+NoDisplay=true
+MimeType=%s;
+`, exec, strings.Join(Schemes, ";"))
+}
+
+// Parse checks that raw is an absolute http or https URL, the only kind
+// handed to a browser.
+func Parse(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q — only http and https URLs can be opened", raw)
+	}
+	return u, nil
+}
+
+// Match reports whether the URL's host is on the allowlist. A pattern is a
+// host name, matched exactly, or "*." and a domain, matching any host below
+// that domain but not the domain itself. Matching ignores case and port.
+func Match(domains []string, u *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if suffix, ok := strings.CutPrefix(d, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == d {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultBrowser returns the desktop entry registered for https links, or ""
+// if there is none.
+func DefaultBrowser(ctx context.Context, r runner.Runner) string {
+	out, err := r.RunContext(ctx, "xdg-mime", "query", "default", "x-scheme-handler/https")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// SetDefault registers the desktop entry id for http and https links.
+func SetDefault(ctx context.Context, r runner.Runner, id string) error {
+	args := append([]string{"default", id}, Schemes...)
+	if out, err := r.RunContext(ctx, "xdg-mime", args...); err != nil {
+		return fmt.Errorf("xdg-mime default %s: %w\n%s", id, err, out)
+	}
+	return nil
+}
+
+// OpenOnHost opens u with the host desktop entry id, looked up in the XDG
+// data directories like the desktop does.
+func OpenOnHost(ctx context.Context, r runner.Runner, id string, u *url.URL) error {
+	path := findDesktopFile(id)
+	if path == "" {
+		return fmt.Errorf("host browser %s not found — set host_browser in the [url_handler] table of config.toml", id)
+	}
+	if out, err := r.RunContext(ctx, "gio", "launch", path, u.String()); err != nil {
+		return fmt.Errorf("open %s with %s: %w\n%s", u, id, err, out)
+	}
+	return nil
+}
+
+// findDesktopFile returns the path of desktop entry id, or "".
+func findDesktopFile(id string) string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range append([]string{dataHome}, filepath.SplitList(dataDirs)...) {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, "applications", id)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Remove deletes the profile's URL handler and, if it is still the default
+// browser, makes hostBrowser the default again. A missing handler is not an
+// error.
+func Remove(ctx context.Context, r runner.Runner, profile, hostBrowser string) error {
+	if !Installed(profile) {
+		return nil
+	}
+	path, err := DesktopFilePath(profile)
+	if err != nil {
+		return err
+	}
+	if hostBrowser != "" && DefaultBrowser(ctx, r) == DesktopID(profile) {
+		if err := SetDefault(ctx, r, hostBrowser); err != nil {
+			return err
+		}
+	}
+	if !runner.DryRun(r, "remove %s", path) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", DesktopID(profile), err)
+		}
+	}
+	return nil
+}
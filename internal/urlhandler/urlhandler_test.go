@@ -0,0 +1,97 @@
+package urlhandler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/intuneme/internal/runner"
+)
+
+func TestParse(t *testing.T) {
+	for _, raw := range []string{"https://contoso.sharepoint.com/sites/x", "http://dev.azure.com:8080/org"} {
+		if _, err := Parse(raw); err != nil {
+			t.Errorf("Parse(%q): %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"file:///etc/passwd", "javascript:alert(1)", "--user-data-dir=/tmp", "https://", "mailto:a@b.c"} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("Parse(%q) should fail", raw)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	domains := []string{"*.sharepoint.com", "dev.azure.com"}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://contoso.sharepoint.com/sites/x", true},
+		{"https://Contoso-My.SharePoint.com./x", true},
+		{"https://sharepoint.com/", false},
+		{"https://evilsharepoint.com/", false},
+		{"https://dev.azure.com:443/org", true},
+		{"https://x.dev.azure.com/", false},
+		{"https://github.com/", false},
+		{"https://dev.azure.com.evil.example/", false},
+	}
+	for _, tt := range tests {
+		u, err := Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Match(domains, u); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestDesktopFileContent(t *testing.T) {
+	content := DesktopFileContent("/usr/bin/intuneme", "work")
+	for _, want := range []string{
+		"Exec=/usr/bin/intuneme --profile work open url --route %u\n",
+		"MimeType=x-scheme-handler/http;x-scheme-handler/https;\n",
+		"NoDisplay=true",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("desktop file missing %q:\n%s", want, content)
+		}
+	}
+	if c := DesktopFileContent("/usr/bin/intuneme", "default"); !strings.Contains(c, "Exec=/usr/bin/intuneme open url") {
+		t.Errorf("default profile should have no --profile flag:\n%s", c)
+	}
+	if c := DesktopFileContent("/home/alice/my tools/intuneme", "default"); !strings.Contains(c, `Exec="/home/alice/my tools/intuneme" open url`) {
+		t.Errorf("an executable path with a space should be quoted:\n%s", c)
+	}
+	if DesktopID("default") != "intuneme-url.desktop" || DesktopID("work") != "intuneme-work-url.desktop" {
+		t.Errorf("unexpected desktop IDs %q, %q", DesktopID("default"), DesktopID("work"))
+	}
+}
+
+func TestOpenOnHost(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "applications"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "applications", "firefox.desktop")
+	if err := os.WriteFile(path, []byte("[Desktop Entry]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_DIRS", dir)
+
+	u, _ := Parse("https://github.com/")
+	r := &runner.Recorder{}
+	if err := OpenOnHost(context.Background(), r, "firefox.desktop", u); err != nil {
+		t.Fatal(err)
+	}
+	if want := "gio launch " + path + " https://github.com/"; len(r.Steps) != 1 || r.Steps[0].String() != want {
+		t.Errorf("commands = %v, want %q", r.Steps, want)
+	}
+	if err := OpenOnHost(context.Background(), r, "missing.desktop", u); err == nil {
+		t.Error("expected an error for a desktop entry that does not exist")
+	}
+}